@@ -2,6 +2,8 @@ package actions
 
 import (
 	"context"
+	"main/callback"
+	"main/telegram"
 	"sync"
 	"time"
 
@@ -13,11 +15,11 @@ import (
 // Client - экземпляр Telegram бота
 type About struct {
 	Name   string
-	Client tgbotapi.BotAPI
+	Client telegram.BotClient
 	mu     *sync.Mutex
 }
 
-func NewAboutHandler(client tgbotapi.BotAPI) *About {
+func NewAboutHandler(client telegram.BotClient) *About {
 	return &About{
 		Name:   "about",
 		Client: client,
@@ -28,8 +30,8 @@ func NewAboutHandler(client tgbotapi.BotAPI) *About {
 // Run запускает отображение информации о боте
 // update - обновление от Telegram API
 // Возвращает ошибку, если что-то пошло не так
-func (a About) Run(update tgbotapi.Update) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (a About) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
     defer cancel()
 
     var wg sync.WaitGroup
@@ -43,7 +45,7 @@ func (a About) Run(update tgbotapi.Update) error {
             return
         default:
 			a.mu.Lock()
-			ClearNextStepForUser(update, &a.Client, true)
+			ClearNextStepForUser(update, a.Client, true)
 			a.mu.Unlock()
 		
 			const text = `🔥Вас приветствует команда FlyLex в боте для совершения покупок нашей продукции!🎯FlyLex отличается от других тем, что наша продукция является отечественной, так как она производится на территории РФ.
@@ -64,7 +66,7 @@ func (a About) Run(update tgbotapi.Update) error {
 			message.ParseMode = "HTML"
 			message.DisableWebPagePreview = true
 		
-			toMainMenuCallbackData := "mainMenu"
+			toMainMenuCallbackData := callback.MustEncode(callback.MainMenu{})
 			message.ReplyMarkup = &tgbotapi.InlineKeyboardMarkup{
 				InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
 					{{Text: "На главную", CallbackData: &toMainMenuCallbackData}},
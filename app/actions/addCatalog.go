@@ -3,9 +3,10 @@ package actions
 import (
 	"context"
 	"fmt"
+	"main/callback"
 	"main/controllers"
-	"main/database"
 	"main/database/models"
+	"main/telegram"
 	"sync"
 	"time"
 
@@ -17,15 +18,15 @@ import (
 // Client - экземпляр Telegram бота.
 type AddCatalog struct {
 	Name   string
-	Client tgbotapi.BotAPI
+	Client telegram.BotClient
 	mu     *sync.Mutex
 }
 
 var (
-	cancelCallbackData = "cancel"
+	cancelCallbackData = callback.MustEncode(callback.Cancel{})
 )
 
-func NewAddCatalogHandler(client tgbotapi.BotAPI) *AddCatalog {
+func NewAddCatalogHandler(client telegram.BotClient) *AddCatalog {
 	return &AddCatalog{
 		Name:   "addCatalog",
 		Client: client,
@@ -34,8 +35,8 @@ func NewAddCatalogHandler(client tgbotapi.BotAPI) *AddCatalog {
 }
 
 // Run отправляет запрос ввода названия каталога и регистрирует следующий шаг создания каталога.
-func (a AddCatalog) Run(update tgbotapi.Update) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (a AddCatalog) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var wg sync.WaitGroup
@@ -67,15 +68,13 @@ func (a AddCatalog) Run(update tgbotapi.Update) error {
 			}
 
 			stepAction := controllers.NextStepAction{
-				Func:          CreateCatalog,
+				FuncName:      createCatalogStep,
 				Params:        make(map[string]interface{}),
 				CreatedAtTS:   time.Now().Unix(),
 				CancelMessage: "Создание каталога отменено",
 			}
 
-			a.mu.Lock()
-			controllers.GetNextStepManager().RegisterNextStepAction(stepKey, stepAction)
-			a.mu.Unlock()
+			err = controllers.GetNextStepManager().RegisterNextStepAction(ctx, stepKey, stepAction)
 		}
 	}()
 
@@ -99,8 +98,8 @@ func (a AddCatalog) GetName() string {
 }
 
 // CreateCatalog обрабатывает ввод названия каталога и сохраняет новый каталог в базе данных.
-func CreateCatalog(client tgbotapi.BotAPI, stepUpdate tgbotapi.Update, stepParams map[string]any) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func CreateCatalog(ctx context.Context, env controllers.StepEnv, stepUpdate tgbotapi.Update, stepParams map[string]any) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var mu sync.Mutex
@@ -123,7 +122,7 @@ func CreateCatalog(client tgbotapi.BotAPI, stepUpdate tgbotapi.Update, stepParam
 				}
 
 				mu.Lock()
-				_, err = client.Send(msg)
+				_, err = env.Client.Send(msg)
 				mu.Unlock()
 				if err != nil {
 					return
@@ -135,21 +134,18 @@ func CreateCatalog(client tgbotapi.BotAPI, stepUpdate tgbotapi.Update, stepParam
 				}
 		
 				stepAction := controllers.NextStepAction{
-					Func:          CreateCatalog,
+					FuncName:      createCatalogStep,
 					Params:        make(map[string]interface{}),
 					CreatedAtTS:   time.Now().Unix(),
 					CancelMessage: "Создание каталога отменено",
 				}
 		
-				mu.Lock()
-				controllers.GetNextStepManager().RegisterNextStepAction(stepKey, stepAction)
-				mu.Unlock()
+				err = controllers.GetNextStepManager().RegisterNextStepAction(ctx, stepKey, stepAction)
 
 				return
 			}
 		
-			db := database.Connect()
-			defer db.Close()
+			db := env.DB
 		
 			_, err = db.Model(&models.Catalog{
 				Name: stepUpdate.Message.Text,
@@ -159,18 +155,18 @@ func CreateCatalog(client tgbotapi.BotAPI, stepUpdate tgbotapi.Update, stepParam
 			}
 
 			mu.Lock()
-			ClearNextStepForUser(stepUpdate, &client, false)
+			ClearNextStepForUser(stepUpdate, env.Client, false)
 			mu.Unlock()
 		
 			msg := tgbotapi.NewMessage(stepUpdate.Message.Chat.ID, fmt.Sprintf("Каталог с названием \"%s\" успешно создан", stepUpdate.Message.Text))
-			toCatalogListCallbackData := "shop"
+			toCatalogListCallbackData := callback.MustEncode(callback.Shop{})
 			msg.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{
 				InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
 					{{Text: "К списку каталогов", CallbackData: &toCatalogListCallbackData}},
 				},
 			}
 			mu.Lock()
-			_, err = client.Send(msg)
+			_, err = env.Client.Send(msg)
 			mu.Unlock()
 			if err != nil {
 				return
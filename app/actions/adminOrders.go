@@ -0,0 +1,795 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"main/callback"
+	"main/config"
+	"main/controllers"
+	"main/database/models"
+	"main/telegram"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// adminOrdersPageSize - сколько заказов на одной странице панели администратора
+const adminOrdersPageSize = 5
+
+// adminOrdersTab - вкладка панели заказов: ключ в callback data, статусы заказов и название
+type adminOrdersTab struct {
+	Key      string
+	Statuses []models.OrderStatus
+	Title    string
+}
+
+// adminOrdersTabs - вкладки панели заказов; первая открывается по умолчанию
+var adminOrdersTabs = []adminOrdersTab{
+	{Key: "review", Statuses: []models.OrderStatus{models.OrderStatusPaymentReview}, Title: "На проверке"},
+	{Key: "paid", Statuses: []models.OrderStatus{models.OrderStatusPaid}, Title: "Ждут отправки"},
+	{Key: "shipped", Statuses: []models.OrderStatus{models.OrderStatusShipped, models.OrderStatusArrived}, Title: "Отправлены"},
+}
+
+// adminOrdersPeriods - периоды отбора заказов в днях, переключаются по кругу (0 - за все время)
+var adminOrdersPeriods = []int{0, 1, 7, 30}
+
+// findAdminOrdersTab возвращает вкладку по ключу; неизвестный ключ - вкладка по умолчанию
+func findAdminOrdersTab(key string) adminOrdersTab {
+	for _, tab := range adminOrdersTabs {
+		if tab.Key == key {
+			return tab
+		}
+	}
+
+	return adminOrdersTabs[0]
+}
+
+// adminOrdersTabKey возвращает ключ вкладки, на которой виден заказ в статусе status
+func adminOrdersTabKey(status models.OrderStatus) string {
+	for _, tab := range adminOrdersTabs {
+		if slices.Contains(tab.Statuses, status) {
+			return tab.Key
+		}
+	}
+
+	return adminOrdersTabs[0].Key
+}
+
+// adminOrdersPeriodTitle - название периода отбора
+func adminOrdersPeriodTitle(days int) string {
+	switch days {
+	case 0:
+		return "за все время"
+	case 1:
+		return "за сутки"
+	default:
+		return fmt.Sprintf("за %d дней", days)
+	}
+}
+
+// nextAdminOrdersPeriod возвращает период, следующий за days
+func nextAdminOrdersPeriod(days int) int {
+	for i, period := range adminOrdersPeriods {
+		if period == days {
+			return adminOrdersPeriods[(i+1)%len(adminOrdersPeriods)]
+		}
+	}
+
+	return adminOrdersPeriods[0]
+}
+
+// orderCustomerText описывает покупателя заказа для администратора (HTML)
+func orderCustomerText(order models.Order) string {
+	text := html.EscapeString(order.FIO)
+	if order.Username != "" {
+		return text + " @" + html.EscapeString(order.Username)
+	}
+
+	return text + fmt.Sprintf(" (<a href='tg://user?id=%d'>написать</a>)", order.UserID)
+}
+
+// adminOrdersView собирает страницу панели заказов по отбору route
+func adminOrdersView(db *pg.DB, route callback.AdminOrders) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	tab := findAdminOrdersTab(route.Tab)
+	route.Tab = tab.Key
+
+	filter := models.OrderFilter{Statuses: tab.Statuses, UserID: route.UserID}
+	if route.Days > 0 {
+		filter.SinceTS = time.Now().AddDate(0, 0, -route.Days).Unix()
+	}
+
+	page := max(route.Page, 0)
+	orders, count, err := models.ListOrdersByFilter(db, filter, page*adminOrdersPageSize, adminOrdersPageSize)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	// Заказов стало меньше, чем было при отрисовке кнопки: показываем последнюю страницу
+	if len(orders) == 0 && page > 0 && count > 0 {
+		page = (count - 1) / adminOrdersPageSize
+		orders, count, err = models.ListOrdersByFilter(db, filter, page*adminOrdersPageSize, adminOrdersPageSize)
+		if err != nil {
+			return "", tgbotapi.InlineKeyboardMarkup{}, err
+		}
+	}
+	route.Page = page
+
+	customer := "все"
+	if route.UserID != 0 {
+		user := models.TelegramUser{ID: route.UserID}
+		if err := user.Get(db); err != nil && err != pg.ErrNoRows {
+			return "", tgbotapi.InlineKeyboardMarkup{}, err
+		}
+		customer = adminDisplayName(user)
+	}
+
+	text := "<b>Заказы: " + strings.ToLower(tab.Title) + "</b>\n"
+	text += "Период: " + adminOrdersPeriodTitle(route.Days) + "\n"
+	text += "Покупатель: " + customer + "\n"
+	text += fmt.Sprintf("Найдено: %d", count)
+
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+
+	var tabsRow []tgbotapi.InlineKeyboardButton
+	for _, t := range adminOrdersTabs {
+		title := t.Title
+		if t.Key == tab.Key {
+			title = "• " + title + " •"
+		}
+
+		tabCallbackData := callback.MustEncode(callback.AdminOrders{Tab: t.Key, Days: route.Days, UserID: route.UserID})
+		tabsRow = append(tabsRow, tgbotapi.InlineKeyboardButton{Text: title, CallbackData: &tabCallbackData})
+	}
+	keyboard = append(keyboard, tabsRow)
+
+	periodCallbackData := callback.MustEncode(callback.AdminOrders{Tab: tab.Key, Days: nextAdminOrdersPeriod(route.Days), UserID: route.UserID})
+	filtersRow := []tgbotapi.InlineKeyboardButton{{Text: "📅 " + adminOrdersPeriodTitle(route.Days), CallbackData: &periodCallbackData}}
+	if route.UserID != 0 {
+		resetCustomerCallbackData := callback.MustEncode(callback.AdminOrders{Tab: tab.Key, Days: route.Days})
+		filtersRow = append(filtersRow, tgbotapi.InlineKeyboardButton{Text: "👤 Все покупатели", CallbackData: &resetCustomerCallbackData})
+	} else {
+		customerCallbackData := callback.MustEncode(callback.AdminCustomerFilter{Tab: tab.Key, Days: route.Days})
+		filtersRow = append(filtersRow, tgbotapi.InlineKeyboardButton{Text: "👤 Покупатель", CallbackData: &customerCallbackData})
+	}
+	keyboard = append(keyboard, filtersRow)
+
+	for _, order := range orders {
+		cardCallbackData := callback.MustEncode(callback.AdminOrderCard{OrderID: order.ID, Tab: tab.Key, Page: page, Days: route.Days, UserID: route.UserID})
+		keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{
+			Text:         fmt.Sprintf("№%d · %s · %d₽ · %s", order.Number, order.FIO, order.TotalPrice, formatOrderTime(order.CreatedAtTS)),
+			CallbackData: &cardCallbackData,
+		}})
+	}
+
+	if pages := (count + adminOrdersPageSize - 1) / adminOrdersPageSize; pages > 1 {
+		prev, next := route, route
+		prev.Page = (page + pages - 1) % pages
+		next.Page = (page + 1) % pages
+
+		prevPageCallbackData := callback.MustEncode(prev)
+		noneCallbackData := callback.MustEncode(callback.Noop{})
+		nextPageCallbackData := callback.MustEncode(next)
+		keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{
+			{Text: "⬅️", CallbackData: &prevPageCallbackData},
+			{Text: fmt.Sprintf("%s/%s", NumberToEmoji(page+1), NumberToEmoji(pages)), CallbackData: &noneCallbackData},
+			{Text: "➡️", CallbackData: &nextPageCallbackData},
+		})
+	}
+
+	refreshCallbackData := callback.MustEncode(route)
+	toMainMenuCallbackData := callback.MustEncode(callback.MainMenu{})
+	keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{
+		{Text: "Обновить", CallbackData: &refreshCallbackData},
+		{Text: "На главную", CallbackData: &toMainMenuCallbackData},
+	})
+
+	return text, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: keyboard}, nil
+}
+
+// adminOrderCardView собирает карточку заказа для администратора.
+// Несуществующий заказ - pg.ErrNoRows.
+func adminOrderCardView(db *pg.DB, route callback.AdminOrderCard) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	order, err := models.GetOrder(db, route.OrderID)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	notes, err := models.ListOrderNotes(db, order.ID)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	text := fmt.Sprintf("<b>Заказ №%d</b>\n", order.Number)
+	text += "Статус: " + order.Status.Title() + "\n"
+	text += "Оформлен: " + formatOrderTime(order.CreatedAtTS) + "\n"
+	text += "Покупатель: " + orderCustomerText(order) + "\n\n"
+	text += orderItemsText(order) + "\n"
+	text += orderDeliveryText(order) + "\n"
+	text += orderHistoryText(order)
+
+	if len(notes) > 0 {
+		text += "\n<b>Заметки:</b>"
+		for _, note := range notes {
+			text += fmt.Sprintf("\n%s (<code>%d</code>): %s", formatOrderTime(note.CreatedAtTS), note.AuthorID, html.EscapeString(note.Text))
+		}
+		text += "\n"
+	}
+
+	action := func(name string) *string {
+		data := callback.MustEncode(callback.AdminOrderAction{OrderID: order.ID, Action: name})
+		return &data
+	}
+
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	switch order.Status {
+	case models.OrderStatusPaymentReview:
+		keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{
+			{Text: "Принять оплату✅", CallbackData: action("accept")},
+			{Text: "Отклонить❌", CallbackData: action("reject")},
+		})
+	case models.OrderStatusPaid:
+		shipCallbackData := callback.MustEncode(callback.AdminOrderShip{OrderID: order.ID})
+		keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: "Отправить📦", CallbackData: &shipCallbackData}})
+	case models.OrderStatusShipped, models.OrderStatusArrived:
+		var statusRow []tgbotapi.InlineKeyboardButton
+		if order.Status == models.OrderStatusShipped {
+			statusRow = append(statusRow, tgbotapi.InlineKeyboardButton{Text: "В пункте выдачи📍", CallbackData: action("arrived")})
+		}
+		statusRow = append(statusRow, tgbotapi.InlineKeyboardButton{Text: "Получен✅", CallbackData: action("delivered")})
+		keyboard = append(keyboard, statusRow)
+
+		shipCallbackData := callback.MustEncode(callback.AdminOrderShip{OrderID: order.ID})
+		keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: "Изменить трек-номер", CallbackData: &shipCallbackData}})
+	}
+
+	var extraRow []tgbotapi.InlineKeyboardButton
+	if order.ReceiptFileID != "" {
+		extraRow = append(extraRow, tgbotapi.InlineKeyboardButton{Text: "Показать чек🧾", CallbackData: action("receipt")})
+	}
+	extraRow = append(extraRow, tgbotapi.InlineKeyboardButton{Text: "Добавить заметку📝", CallbackData: action("note")})
+	keyboard = append(keyboard, extraRow)
+
+	backCallbackData := callback.MustEncode(callback.AdminOrders{Tab: route.Tab, Page: route.Page, Days: route.Days, UserID: route.UserID})
+	keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: "К списку заказов", CallbackData: &backCallbackData}})
+
+	return text, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: keyboard}, nil
+}
+
+// showAdminView правит сообщение с нажатой кнопкой или, если это не callback, отправляет новое
+func showAdminView(client telegram.BotClient, update tgbotapi.Update, text string, markup tgbotapi.InlineKeyboardMarkup) error {
+	if update.CallbackQuery != nil {
+		message := tgbotapi.NewEditMessageText(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, text)
+		message.ParseMode = "HTML"
+		message.DisableWebPagePreview = true
+		message.ReplyMarkup = &markup
+
+		_, err := client.Send(message)
+		return err
+	}
+
+	message := tgbotapi.NewMessage(update.Message.Chat.ID, text)
+	message.ParseMode = "HTML"
+	message.DisableWebPagePreview = true
+	message.ReplyMarkup = markup
+
+	_, err := client.Send(message)
+	return err
+}
+
+// registerAdminOrdersStep просит администратора ввести prompt и ждет ответ шагом funcName
+func registerAdminOrdersStep(ctx context.Context, client telegram.BotClient, chatID, userID int64, prompt string, cancelRoute callback.Route, funcName string, params map[string]any, cancelMessage string) error {
+	message := tgbotapi.NewMessage(chatID, prompt)
+	cancelCallbackData := callback.MustEncode(cancelRoute)
+	message.ReplyMarkup = &tgbotapi.InlineKeyboardMarkup{
+		InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
+			{{Text: "Отмена", CallbackData: &cancelCallbackData}},
+		},
+	}
+
+	_, err := client.Send(message)
+	if err != nil {
+		return err
+	}
+
+	stepKey := controllers.NextStepKey{ChatID: chatID, UserID: userID}
+	stepAction := controllers.NextStepAction{
+		FuncName:      funcName,
+		Params:        params,
+		CreatedAtTS:   time.Now().Unix(),
+		CancelMessage: cancelMessage,
+	}
+
+	return controllers.GetNextStepManager().RegisterNextStepAction(ctx, stepKey, stepAction)
+}
+
+// AdminOrdersCustomer обрабатывает ввод покупателя (Telegram ID или @username) для отбора заказов
+// env - Telegram бот и пул соединений с базой
+// update - обновление от Telegram API
+// stepParams - вкладка (tab) и период (days) панели заказов
+// Возвращает ошибку, если что-то пошло не так
+func AdminOrdersCustomer(ctx context.Context, env controllers.StepEnv, update tgbotapi.Update, stepParams map[string]any) error {
+	if update.Message == nil {
+		return nil
+	}
+
+	tab, _ := stepParams["tab"].(string)
+	days, _ := controllers.ParamInt(stepParams, "days")
+	cancelRoute := callback.AdminOrders{Tab: tab, Days: days}
+
+	if strings.TrimSpace(update.Message.Text) == "" {
+		return registerAdminOrdersStep(ctx, env.Client, update.Message.Chat.ID, update.Message.From.ID, "Введите Telegram ID или @username покупателя", cancelRoute, adminOrdersCustomerStep, stepParams, "Отбор по покупателю отменен")
+	}
+
+	customer, err := resolveAdminTarget(env.DB, update.Message.Text)
+	if err == pg.ErrNoRows {
+		return registerAdminOrdersStep(ctx, env.Client, update.Message.Chat.ID, update.Message.From.ID, "Покупатель не найден. Введите Telegram ID или @username покупателя", cancelRoute, adminOrdersCustomerStep, stepParams, "Отбор по покупателю отменен")
+	}
+	if err != nil {
+		return err
+	}
+
+	text, markup, err := adminOrdersView(env.DB, callback.AdminOrders{Tab: tab, Days: days, UserID: customer.ID})
+	if err != nil {
+		return err
+	}
+
+	return showAdminView(env.Client, update, text, markup)
+}
+
+// AdminOrderNote сохраняет заметку администратора к заказу и показывает карточку заказа
+// env - Telegram бот и пул соединений с базой
+// update - обновление от Telegram API
+// stepParams - заказ (orderId)
+// Возвращает ошибку, если что-то пошло не так
+func AdminOrderNote(ctx context.Context, env controllers.StepEnv, update tgbotapi.Update, stepParams map[string]any) error {
+	if update.Message == nil {
+		return nil
+	}
+
+	orderID, err := controllers.ParamInt(stepParams, "orderId")
+	if err != nil {
+		return err
+	}
+
+	cardRoute := callback.AdminOrderCard{OrderID: orderID}
+
+	if strings.TrimSpace(update.Message.Text) == "" {
+		return registerAdminOrdersStep(ctx, env.Client, update.Message.Chat.ID, update.Message.From.ID, "Отправьте текст заметки", cardRoute, adminOrderNoteStep, stepParams, "Заметка не добавлена")
+	}
+
+	err = models.AddOrderNote(env.DB, orderID, update.Message.From.ID, strings.TrimSpace(update.Message.Text))
+	if err != nil {
+		return err
+	}
+
+	order, err := models.GetOrder(env.DB, orderID)
+	if err != nil {
+		return err
+	}
+	cardRoute.Tab = adminOrdersTabKey(order.Status)
+
+	text, markup, err := adminOrderCardView(env.DB, cardRoute)
+	if err != nil {
+		return err
+	}
+
+	return showAdminView(env.Client, update, text, markup)
+}
+
+// AdminOrders представляет собой структуру для панели заказов администратора (/orders)
+// Name - имя команды
+// Client - экземпляр Telegram бота
+type AdminOrders struct {
+	Name   string
+	Client telegram.BotClient
+	DB     *pg.DB
+	mu     *sync.Mutex
+}
+
+func NewAdminOrdersHandler(client telegram.BotClient, db *pg.DB) *AdminOrders {
+	return &AdminOrders{
+		Name:   "adminOrders",
+		Client: client,
+		DB:     db,
+		mu:     &sync.Mutex{},
+	}
+}
+
+// Run показывает страницу панели заказов: на /orders - новым сообщением, на кнопку - вместо текущего
+// update - обновление от Telegram API
+// Возвращает ошибку, если что-то пошло не так
+func (a AdminOrders) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var err error
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			a.mu.Lock()
+			ClearNextStepForUser(update, a.Client, true)
+			a.mu.Unlock()
+
+			var route callback.AdminOrders
+			if update.CallbackQuery != nil {
+				err = callback.Decode(update.CallbackQuery.Data, &route)
+				if err != nil {
+					return
+				}
+			}
+
+			var text string
+			var markup tgbotapi.InlineKeyboardMarkup
+			text, markup, err = adminOrdersView(a.DB, route)
+			if err != nil {
+				return
+			}
+
+			a.mu.Lock()
+			err = showAdminView(a.Client, update, text, markup)
+			a.mu.Unlock()
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// GetName возвращает имя команды
+func (a AdminOrders) GetName() string {
+	return a.Name
+}
+
+// AdminCustomerFilter представляет собой структуру для запроса покупателя, по которому отбираются заказы
+// Name - имя команды
+// Client - экземпляр Telegram бота
+type AdminCustomerFilter struct {
+	Name   string
+	Client telegram.BotClient
+	mu     *sync.Mutex
+}
+
+func NewAdminCustomerFilterHandler(client telegram.BotClient) *AdminCustomerFilter {
+	return &AdminCustomerFilter{
+		Name:   "adminCustomerFilter",
+		Client: client,
+		mu:     &sync.Mutex{},
+	}
+}
+
+// Run просит ввести покупателя и регистрирует шаг AdminOrdersCustomer
+// update - обновление от Telegram API
+// Возвращает ошибку, если что-то пошло не так
+func (a AdminCustomerFilter) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var err error
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			a.mu.Lock()
+			ClearNextStepForUser(update, a.Client, true)
+			a.mu.Unlock()
+
+			var route callback.AdminCustomerFilter
+			err = callback.Decode(update.CallbackQuery.Data, &route)
+			if err != nil {
+				return
+			}
+
+			a.mu.Lock()
+			err = registerAdminOrdersStep(ctx, a.Client, update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.From.ID,
+				"Введите Telegram ID или @username покупателя",
+				callback.AdminOrders{Tab: route.Tab, Days: route.Days},
+				adminOrdersCustomerStep,
+				map[string]any{"tab": route.Tab, "days": route.Days},
+				"Отбор по покупателю отменен",
+			)
+			a.mu.Unlock()
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// GetName возвращает имя команды
+func (a AdminCustomerFilter) GetName() string {
+	return a.Name
+}
+
+// AdminOrderCard представляет собой структуру для просмотра карточки заказа администратором
+// Name - имя команды
+// Client - экземпляр Telegram бота
+type AdminOrderCard struct {
+	Name   string
+	Client telegram.BotClient
+	DB     *pg.DB
+	mu     *sync.Mutex
+}
+
+func NewAdminOrderCardHandler(client telegram.BotClient, db *pg.DB) *AdminOrderCard {
+	return &AdminOrderCard{
+		Name:   "adminOrderCard",
+		Client: client,
+		DB:     db,
+		mu:     &sync.Mutex{},
+	}
+}
+
+// Run показывает карточку заказа с действиями, доступными в его статусе
+// update - обновление от Telegram API
+// Возвращает ошибку, если что-то пошло не так
+func (a AdminOrderCard) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var err error
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			a.mu.Lock()
+			ClearNextStepForUser(update, a.Client, true)
+			a.mu.Unlock()
+
+			var route callback.AdminOrderCard
+			err = callback.Decode(update.CallbackQuery.Data, &route)
+			if err != nil {
+				return
+			}
+
+			var text string
+			var markup tgbotapi.InlineKeyboardMarkup
+			text, markup, err = adminOrderCardView(a.DB, route)
+			if err == pg.ErrNoRows {
+				a.mu.Lock()
+				_, err = a.Client.Request(tgbotapi.CallbackConfig{
+					CallbackQueryID: update.CallbackQuery.ID,
+					Text:            "Заказ не найден",
+					ShowAlert:       true,
+				})
+				a.mu.Unlock()
+				return
+			}
+			if err != nil {
+				return
+			}
+
+			a.mu.Lock()
+			err = showAdminView(a.Client, update, text, markup)
+			a.mu.Unlock()
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// GetName возвращает имя команды
+func (a AdminOrderCard) GetName() string {
+	return a.Name
+}
+
+// AdminOrderAction представляет собой структуру для действий администратора в карточке заказа
+// Name - имя команды
+// Client - экземпляр Telegram бота
+type AdminOrderAction struct {
+	Name   string
+	Client telegram.BotClient
+	DB     *pg.DB
+	Config *config.Config
+	mu     *sync.Mutex
+}
+
+func NewAdminOrderActionHandler(client telegram.BotClient, db *pg.DB, cfg *config.Config) *AdminOrderAction {
+	return &AdminOrderAction{
+		Name:   "adminOrderAction",
+		Client: client,
+		DB:     db,
+		Config: cfg,
+		mu:     &sync.Mutex{},
+	}
+}
+
+// Run выполняет действие над заказом (принять или отклонить оплату, отметить прибытие в пункт выдачи
+// или получение, показать чек, добавить заметку) и обновляет карточку заказа
+// update - обновление от Telegram API
+// Возвращает ошибку, если что-то пошло не так
+func (a AdminOrderAction) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var err error
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			a.mu.Lock()
+			ClearNextStepForUser(update, a.Client, true)
+			a.mu.Unlock()
+
+			var route callback.AdminOrderAction
+			err = callback.Decode(update.CallbackQuery.Data, &route)
+			if err != nil {
+				return
+			}
+
+			chatID := update.CallbackQuery.Message.Chat.ID
+			adminID := update.CallbackQuery.From.ID
+
+			var order models.Order
+			order, err = models.GetOrder(a.DB, route.OrderID)
+			if err == pg.ErrNoRows {
+				err = a.answer(update, "Заказ не найден")
+				return
+			}
+			if err != nil {
+				return
+			}
+
+			switch route.Action {
+			case "accept", "reject":
+				verdict := callback.PaymentVerdict{OK: route.Action == "accept", TransactionID: order.TransactionID, UserID: order.UserID, OrderID: order.ID}
+				err = applyPaymentVerdict(a.Client, a.DB, a.mu, verdict, adminID)
+			case "arrived", "delivered":
+				status := models.OrderStatusArrived
+				if route.Action == "delivered" {
+					status = models.OrderStatusDelivered
+				}
+
+				order, err = models.TransitionOrder(a.DB, order.ID, status, adminID, "")
+				if err == nil {
+					a.mu.Lock()
+					notifyOrderStatus(ctx, a.Client, a.Config.Delivery, order)
+					a.mu.Unlock()
+				}
+			case "receipt":
+				caption := fmt.Sprintf("Чек к заказу №%d", order.Number)
+
+				var msg tgbotapi.Chattable
+				if order.ReceiptIsDocument {
+					docMsg := tgbotapi.NewDocument(chatID, tgbotapi.FileID(order.ReceiptFileID))
+					docMsg.Caption = caption
+					msg = docMsg
+				} else {
+					photoMsg := tgbotapi.NewPhoto(chatID, tgbotapi.FileID(order.ReceiptFileID))
+					photoMsg.Caption = caption
+					msg = photoMsg
+				}
+
+				a.mu.Lock()
+				_, err = a.Client.Send(msg)
+				a.mu.Unlock()
+				return
+			case "note":
+				a.mu.Lock()
+				err = registerAdminOrdersStep(ctx, a.Client, chatID, adminID,
+					fmt.Sprintf("Отправьте текст заметки к заказу №%d", order.Number),
+					callback.AdminOrderCard{OrderID: order.ID, Tab: adminOrdersTabKey(order.Status)},
+					adminOrderNoteStep,
+					map[string]any{"orderId": order.ID},
+					"Заметка не добавлена",
+				)
+				a.mu.Unlock()
+				return
+			default:
+				err = fmt.Errorf("unknown admin order action %q", route.Action)
+				return
+			}
+
+			if text, ok := orderActionErrorText(err); ok {
+				err = a.answer(update, text)
+			}
+			if err != nil {
+				return
+			}
+
+			order, err = models.GetOrder(a.DB, order.ID)
+			if err != nil {
+				return
+			}
+
+			var text string
+			var markup tgbotapi.InlineKeyboardMarkup
+			text, markup, err = adminOrderCardView(a.DB, callback.AdminOrderCard{OrderID: order.ID, Tab: adminOrdersTabKey(order.Status)})
+			if err != nil {
+				return
+			}
+
+			a.mu.Lock()
+			err = showAdminView(a.Client, update, text, markup)
+			a.mu.Unlock()
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// answer показывает администратору всплывающее сообщение
+func (a AdminOrderAction) answer(update tgbotapi.Update, text string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, err := a.Client.Request(tgbotapi.CallbackConfig{
+		CallbackQueryID: update.CallbackQuery.ID,
+		Text:            text,
+		ShowAlert:       true,
+	})
+
+	return err
+}
+
+// GetName возвращает имя команды
+func (a AdminOrderAction) GetName() string {
+	return a.Name
+}
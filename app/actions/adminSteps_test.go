@@ -0,0 +1,43 @@
+package actions
+
+import (
+	"context"
+	"main/controllers"
+	"main/telegram"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// TestAdminStepsWithoutMessage проверяет, что шаги панели заказов не падают на обновлении без сообщения
+func TestAdminStepsWithoutMessage(t *testing.T) {
+	steps := []struct {
+		name string
+		step controllers.NextStepFunc
+	}{
+		{"AdminOrdersCustomer", AdminOrdersCustomer},
+		{"AdminOrderNote", AdminOrderNote},
+		{"AdminOrderTracking", AdminOrderTracking},
+	}
+
+	updates := []tgbotapi.Update{
+		{},
+		{CallbackQuery: &tgbotapi.CallbackQuery{From: &tgbotapi.User{ID: 1}, Data: "adminOrders"}},
+	}
+
+	params := map[string]any{"orderId": 1, "tab": "review", "days": 7}
+
+	for _, s := range steps {
+		for _, update := range updates {
+			bot := telegram.NewFakeBot()
+			env := controllers.StepEnv{Client: bot}
+
+			if err := s.step(context.Background(), env, update, params); err != nil {
+				t.Errorf("%s: unexpected error %v", s.name, err)
+			}
+			if _, sent := bot.Last(); sent {
+				t.Errorf("%s: unexpected reply to an update without message", s.name)
+			}
+		}
+	}
+}
@@ -0,0 +1,489 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"main/callback"
+	"main/database/models"
+	"main/telegram"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// adminLogLimit - сколько последних записей журнала прав показывает /admin_log
+	adminLogLimit = 20
+
+	adminsUsageText = "\n\nВыдать права: /grant_admin &lt;id или @username&gt;\nСнять права: /revoke_admin &lt;id или @username&gt; или кнопкой ниже\nЖурнал изменений: /admin_log"
+)
+
+// adminDisplayName описывает пользователя для списков администраторов (HTML)
+func adminDisplayName(u models.TelegramUser) string {
+	name := strings.TrimSpace(u.FirstName + " " + u.LastName)
+	if u.FIO != "" {
+		name = u.FIO
+	}
+	if name == "" {
+		name = "без имени"
+	}
+
+	text := html.EscapeString(name)
+	if u.Username != "" {
+		text += " @" + html.EscapeString(u.Username)
+	}
+
+	return text + fmt.Sprintf(" (<code>%d</code>)", u.ID)
+}
+
+// resolveAdminTarget находит пользователя по аргументу команды: Telegram ID или @username
+func resolveAdminTarget(db *pg.DB, arg string) (models.TelegramUser, error) {
+	arg = strings.TrimSpace(arg)
+
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		user := models.TelegramUser{ID: id}
+		return user, user.Get(db)
+	}
+
+	return models.FindUserByUsername(db, strings.TrimPrefix(arg, "@"))
+}
+
+// setAdminResultText описывает результат models.SetAdmin для владельца
+func setAdminResultText(target string, admin, changed bool, err error) string {
+	switch {
+	case errors.Is(err, pg.ErrNoRows):
+		return "Пользователь не найден: он должен хотя бы раз написать боту /start"
+	case errors.Is(err, models.ErrOwnerRights):
+		return "Права владельца нельзя изменить через бота"
+	case !changed && admin:
+		return target + " уже администратор"
+	case !changed:
+		return target + " не администратор"
+	case admin:
+		return target + " теперь администратор"
+	default:
+		return "Права администратора сняты: " + target
+	}
+}
+
+// Admins представляет собой структуру для отображения списка администраторов владельцу
+// Name - имя команды
+// Client - экземпляр Telegram бота
+type Admins struct {
+	Name   string
+	Client telegram.BotClient
+	DB     *pg.DB
+	mu     *sync.Mutex
+}
+
+func NewAdminsHandler(client telegram.BotClient, db *pg.DB) *Admins {
+	return &Admins{
+		Name:   "admins",
+		Client: client,
+		DB:     db,
+		mu:     &sync.Mutex{},
+	}
+}
+
+// Run отправляет (на /admins) или обновляет (на кнопку) список администраторов
+// с кнопками снятия прав
+// update - обновление от Telegram API
+// Возвращает ошибку, если что-то пошло не так
+func (a Admins) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var err error
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			a.mu.Lock()
+			ClearNextStepForUser(update, a.Client, true)
+			a.mu.Unlock()
+
+			var admins []models.TelegramUser
+			admins, err = models.ListAdmins(a.DB)
+			if err != nil {
+				return
+			}
+
+			text := "<b>Администраторы</b>\n"
+			var keyboard [][]tgbotapi.InlineKeyboardButton
+			for _, admin := range admins {
+				if admin.IsOwner {
+					text += "\n👑 " + adminDisplayName(admin) + " - владелец"
+					continue
+				}
+
+				text += "\n• " + adminDisplayName(admin)
+
+				buttonName := strings.TrimSpace(admin.FirstName + " " + admin.LastName)
+				if buttonName == "" {
+					buttonName = strconv.FormatInt(admin.ID, 10)
+				}
+
+				revokeCallbackData := callback.MustEncode(callback.RevokeAdmin{UserID: admin.ID})
+				keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{
+					{Text: "Снять права: " + buttonName, CallbackData: &revokeCallbackData},
+				})
+			}
+			text += adminsUsageText
+
+			refreshCallbackData := callback.MustEncode(callback.Admins{})
+			keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: "Обновить", CallbackData: &refreshCallbackData}})
+			markup := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+
+			var msg tgbotapi.Chattable
+			if update.CallbackQuery != nil {
+				edit := tgbotapi.NewEditMessageText(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, text)
+				edit.ParseMode = "HTML"
+				edit.ReplyMarkup = &markup
+				msg = edit
+			} else {
+				message := tgbotapi.NewMessage(update.Message.Chat.ID, text)
+				message.ParseMode = "HTML"
+				message.ReplyMarkup = markup
+				msg = message
+			}
+
+			a.mu.Lock()
+			_, err = a.Client.Send(msg)
+			a.mu.Unlock()
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// GetName возвращает имя команды
+func (a Admins) GetName() string {
+	return a.Name
+}
+
+// GrantAdmin представляет собой структуру для выдачи прав администратора (/grant_admin)
+// Name - имя команды
+// Client - экземпляр Telegram бота
+type GrantAdmin struct {
+	Name   string
+	Client telegram.BotClient
+	DB     *pg.DB
+	mu     *sync.Mutex
+}
+
+func NewGrantAdminHandler(client telegram.BotClient, db *pg.DB) *GrantAdmin {
+	return &GrantAdmin{
+		Name:   "grantAdmin",
+		Client: client,
+		DB:     db,
+		mu:     &sync.Mutex{},
+	}
+}
+
+// Run выдает права администратора пользователю из аргумента команды и сообщает ему об этом
+// update - обновление от Telegram API
+// Возвращает ошибку, если что-то пошло не так
+func (g GrantAdmin) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var err error
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			arg := update.Message.CommandArguments()
+			if strings.TrimSpace(arg) == "" {
+				g.mu.Lock()
+				_, err = g.Client.Send(tgbotapi.NewMessage(update.Message.Chat.ID, "Использование: /grant_admin <id или @username>"))
+				g.mu.Unlock()
+				return
+			}
+
+			target, findErr := resolveAdminTarget(g.DB, arg)
+			changed := false
+			if findErr == nil {
+				changed, findErr = models.SetAdmin(g.DB, update.Message.From.ID, target.ID, true)
+			}
+			if findErr != nil && !errors.Is(findErr, pg.ErrNoRows) && !errors.Is(findErr, models.ErrOwnerRights) {
+				err = findErr
+				return
+			}
+
+			reply := tgbotapi.NewMessage(update.Message.Chat.ID, setAdminResultText(adminDisplayName(target), true, changed, findErr))
+			reply.ParseMode = "HTML"
+
+			g.mu.Lock()
+			_, err = g.Client.Send(reply)
+			g.mu.Unlock()
+			if err != nil || !changed {
+				return
+			}
+
+			// Пользователь мог заблокировать бота: права уже выданы, ошибку уведомления не возвращаем
+			g.mu.Lock()
+			g.Client.Send(tgbotapi.NewMessage(target.ID, "Вам выданы права администратора магазина"))
+			g.mu.Unlock()
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// GetName возвращает имя команды
+func (g GrantAdmin) GetName() string {
+	return g.Name
+}
+
+// RevokeAdmin представляет собой структуру для снятия прав администратора
+// (/revoke_admin или кнопка в списке администраторов)
+// Name - имя команды
+// Client - экземпляр Telegram бота
+type RevokeAdmin struct {
+	Name   string
+	Client telegram.BotClient
+	DB     *pg.DB
+	mu     *sync.Mutex
+}
+
+func NewRevokeAdminHandler(client telegram.BotClient, db *pg.DB) *RevokeAdmin {
+	return &RevokeAdmin{
+		Name:   "revokeAdmin",
+		Client: client,
+		DB:     db,
+		mu:     &sync.Mutex{},
+	}
+}
+
+// Run снимает права администратора с пользователя из аргумента команды или из кнопки
+// update - обновление от Telegram API
+// Возвращает ошибку, если что-то пошло не так
+func (r RevokeAdmin) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var err error
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			var target models.TelegramUser
+			var findErr error
+			var actorID int64
+
+			if update.CallbackQuery != nil {
+				var route callback.RevokeAdmin
+				err = callback.Decode(update.CallbackQuery.Data, &route)
+				if err != nil {
+					return
+				}
+
+				actorID = update.CallbackQuery.From.ID
+				target = models.TelegramUser{ID: route.UserID}
+				findErr = target.Get(r.DB)
+			} else {
+				arg := update.Message.CommandArguments()
+				if strings.TrimSpace(arg) == "" {
+					r.mu.Lock()
+					_, err = r.Client.Send(tgbotapi.NewMessage(update.Message.Chat.ID, "Использование: /revoke_admin <id или @username>"))
+					r.mu.Unlock()
+					return
+				}
+
+				actorID = update.Message.From.ID
+				target, findErr = resolveAdminTarget(r.DB, arg)
+			}
+
+			changed := false
+			if findErr == nil {
+				changed, findErr = models.SetAdmin(r.DB, actorID, target.ID, false)
+			}
+			if findErr != nil && !errors.Is(findErr, pg.ErrNoRows) && !errors.Is(findErr, models.ErrOwnerRights) {
+				err = findErr
+				return
+			}
+
+			result := setAdminResultText(adminDisplayName(target), false, changed, findErr)
+
+			if update.CallbackQuery != nil {
+				r.mu.Lock()
+				_, err = r.Client.Request(tgbotapi.CallbackConfig{
+					CallbackQueryID: update.CallbackQuery.ID,
+					Text:            html.UnescapeString(strings.NewReplacer("<code>", "", "</code>", "").Replace(result)),
+				})
+				r.mu.Unlock()
+				if err != nil {
+					return
+				}
+
+				handler := NewAdminsHandler(r.Client, r.DB)
+				handler.mu = r.mu
+				err = handler.Run(ctx, withCallbackData(update, callback.Admins{}))
+				return
+			}
+
+			reply := tgbotapi.NewMessage(update.Message.Chat.ID, result)
+			reply.ParseMode = "HTML"
+
+			r.mu.Lock()
+			_, err = r.Client.Send(reply)
+			r.mu.Unlock()
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// GetName возвращает имя команды
+func (r RevokeAdmin) GetName() string {
+	return r.Name
+}
+
+// AdminLog представляет собой структуру для просмотра журнала изменений прав (/admin_log)
+// Name - имя команды
+// Client - экземпляр Telegram бота
+type AdminLog struct {
+	Name   string
+	Client telegram.BotClient
+	DB     *pg.DB
+	mu     *sync.Mutex
+}
+
+func NewAdminLogHandler(client telegram.BotClient, db *pg.DB) *AdminLog {
+	return &AdminLog{
+		Name:   "adminLog",
+		Client: client,
+		DB:     db,
+		mu:     &sync.Mutex{},
+	}
+}
+
+// Run отправляет последние записи журнала изменений прав администраторов
+// update - обновление от Telegram API
+// Возвращает ошибку, если что-то пошло не так
+func (a AdminLog) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var err error
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			var entries []models.AdminAuditEntry
+			entries, err = models.RecentAdminAudit(a.DB, adminLogLimit)
+			if err != nil {
+				return
+			}
+
+			text := "<b>Журнал изменений прав</b>\n"
+			if len(entries) == 0 {
+				text += "\nЗаписей пока нет"
+			}
+
+			for _, e := range entries {
+				when := time.Unix(e.CreatedAtTS, 0).Format("02.01.2006 15:04")
+
+				var what string
+				switch e.Action {
+				case models.AdminActionGrant:
+					what = fmt.Sprintf("<code>%d</code> выдал права <code>%d</code>", e.ActorID, e.TargetID)
+				case models.AdminActionRevoke:
+					what = fmt.Sprintf("<code>%d</code> снял права с <code>%d</code>", e.ActorID, e.TargetID)
+				case models.AdminActionBootstrapOwner:
+					what = fmt.Sprintf("<code>%d</code> назначен владельцем из настроек", e.TargetID)
+				case models.AdminActionDemoteOwner:
+					what = fmt.Sprintf("<code>%d</code> больше не владелец: в настройках указан другой", e.TargetID)
+				default:
+					what = fmt.Sprintf("%s: <code>%d</code> → <code>%d</code>", html.EscapeString(e.Action), e.ActorID, e.TargetID)
+				}
+
+				text += "\n" + when + " - " + what
+			}
+
+			message := tgbotapi.NewMessage(update.Message.Chat.ID, text)
+			message.ParseMode = "HTML"
+
+			a.mu.Lock()
+			_, err = a.Client.Send(message)
+			a.mu.Unlock()
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// GetName возвращает имя команды
+func (a AdminLog) GetName() string {
+	return a.Name
+}
@@ -2,6 +2,7 @@ package actions
 
 import (
 	"context"
+	"main/telegram"
 	"sync"
 	"time"
 
@@ -13,11 +14,11 @@ import (
 // Client - экземпляр Telegram бота
 type Cancel struct {
 	Name   string
-	Client tgbotapi.BotAPI
+	Client telegram.BotClient
 	mu     *sync.Mutex
 }
 
-func NewCancelHandler(client tgbotapi.BotAPI) *Cancel {
+func NewCancelHandler(client telegram.BotClient) *Cancel {
 	return &Cancel{
 		Name:   "cancel",
 		Client: client,
@@ -28,8 +29,8 @@ func NewCancelHandler(client tgbotapi.BotAPI) *Cancel {
 // Run запускает процесс отмены действия
 // update - обновление от Telegram API
 // Возвращает ошибку, если что-то пошло не так
-func (c Cancel) Run(update tgbotapi.Update) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (c Cancel) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var wg sync.WaitGroup
@@ -43,7 +44,7 @@ func (c Cancel) Run(update tgbotapi.Update) error {
 			return
 		default:
 			c.mu.Lock()
-			ClearNextStepForUser(update, &c.Client, false)
+			ClearNextStepForUser(update, c.Client, false)
 			c.Client.Send(tgbotapi.NewDeleteMessage(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID))
 			c.mu.Unlock()
 
@@ -3,40 +3,43 @@ package actions
 import (
 	"context"
 	"fmt"
+	"main/callback"
 	"main/controllers"
-	"main/database"
 	"main/database/models"
-	"strconv"
+	"main/telegram"
 	"sync"
 	"time"
 
+	"github.com/go-pg/pg/v10"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 type ChangeCatalogName struct {
 	Name   string
-	Client tgbotapi.BotAPI
+	Client telegram.BotClient
+	DB     *pg.DB
 	mu     *sync.Mutex
 }
 
-func NewChangeCatalogNameHandler(client tgbotapi.BotAPI) *ChangeCatalogName {
+func NewChangeCatalogNameHandler(client telegram.BotClient, db *pg.DB) *ChangeCatalogName {
 	return &ChangeCatalogName{
 		Name:   "changeCatalogName",
 		Client: client,
+		DB:     db,
 		mu:     &sync.Mutex{},
 	}
 }
 
-func ChangeCatalogNameStep(client tgbotapi.BotAPI, stepUpdate tgbotapi.Update, stepParams map[string]any) error {
+func ChangeCatalogNameStep(ctx context.Context, env controllers.StepEnv, stepUpdate tgbotapi.Update, stepParams map[string]any) error {
 	if stepUpdate.Message == nil || stepUpdate.Message.Text == "" {
 		message := tgbotapi.NewMessage(stepUpdate.Message.Chat.ID, "Введите новое название каталога")
-		toListofCats := "shop"
+		toListofCats := callback.MustEncode(callback.Shop{})
 		message.ReplyMarkup = &tgbotapi.InlineKeyboardMarkup{
 			InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
 				{{Text: "Отмена", CallbackData: &toListofCats}},
 			},
 		}
-		client.Send(message)
+		env.Client.Send(message)
 
 		stepKey := controllers.NextStepKey{
 			UserID: stepUpdate.Message.From.ID,
@@ -44,26 +47,18 @@ func ChangeCatalogNameStep(client tgbotapi.BotAPI, stepUpdate tgbotapi.Update, s
 		}
 		
 		stepAction := controllers.NextStepAction{
-			Func:          ChangeCatalogNameStep,
+			FuncName:      changeCatalogNameStep,
 			Params:        stepParams,
 			CreatedAtTS:   time.Now().Unix(),
 			CancelMessage: "Изменение названия каталога отменено",
 		}
 		
-		controllers.GetNextStepManager().RegisterNextStepAction(stepKey, stepAction)
-
-		return nil
+		return controllers.GetNextStepManager().RegisterNextStepAction(ctx, stepKey, stepAction)
 	}
 
-	db := database.Connect()
-	defer db.Close()
-
-	catalogId, ok := stepParams["catalogId"]
-	if !ok {
-		return fmt.Errorf("catalogId is required")
-	}
+	db := env.DB
 
-	catalogIdInt, err := strconv.Atoi(catalogId.(string))
+	catalogIdInt, err := controllers.ParamInt(stepParams, "catalogId")
 	if err != nil {
 		return err
 	}
@@ -79,19 +74,19 @@ func ChangeCatalogNameStep(client tgbotapi.BotAPI, stepUpdate tgbotapi.Update, s
 
 	text := fmt.Sprintf("Название каталога изменено на %s", stepUpdate.Message.Text)
 	message := tgbotapi.NewMessage(stepUpdate.Message.Chat.ID, text)
-	toListofCats := "shop"
+	toListofCats := callback.MustEncode(callback.Shop{})
 	message.ReplyMarkup = &tgbotapi.InlineKeyboardMarkup{
 		InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
 			{{Text: "К списку каталогов", CallbackData: &toListofCats}},
 		},
 	}
-	client.Send(message)
+	env.Client.Send(message)
 
 	return nil	
 }
 
-func (c ChangeCatalogName) Run(update tgbotapi.Update) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (c ChangeCatalogName) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
     defer cancel()
 
     var wg sync.WaitGroup
@@ -105,16 +100,18 @@ func (c ChangeCatalogName) Run(update tgbotapi.Update) error {
             return
         default:
 			c.mu.Lock()
-			ClearNextStepForUser(update, &c.Client, true)
+			ClearNextStepForUser(update, c.Client, true)
 			c.mu.Unlock()
 
-			db := database.Connect()
-			defer db.Close()
+			db := c.DB
+
+			var route callback.ChangeCatalogName
+			err = callback.Decode(update.CallbackQuery.Data, &route)
+			if err != nil {
+				return
+			}
 
-			data := ParseCallData(update.CallbackQuery.Data)
-			catalogId, ok := data["catalogId"]
-			
-			if !ok {
+			if route.CatalogID == 0 {
 				message := tgbotapi.NewEditMessageText(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, "Выберите каталог:")
 
 				catalogs := []models.Catalog{}
@@ -126,14 +123,14 @@ func (c ChangeCatalogName) Run(update tgbotapi.Update) error {
 				keyboard := [][]tgbotapi.InlineKeyboardButton{}
 
 				for _, cat := range catalogs {
-					callbackData := fmt.Sprintf("changeCatalogName?catalogId=%d", cat.ID)
+					callbackData := callback.MustEncode(callback.ChangeCatalogName{CatalogID: cat.ID})
 
 					keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{
 						{Text: cat.Name, CallbackData: &callbackData},
 					})
 				}
 
-				toListofCats := "shop"
+				toListofCats := callback.MustEncode(callback.Shop{})
 				keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{
 					{Text: "Отмена", CallbackData: &toListofCats},
 				})
@@ -151,7 +148,7 @@ func (c ChangeCatalogName) Run(update tgbotapi.Update) error {
 
 			const text = "Введите новое название каталога"
 			message := tgbotapi.NewEditMessageText(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, text)
-			toListofCats := "shop"
+			toListofCats := callback.MustEncode(callback.Shop{})
 			message.ReplyMarkup = &tgbotapi.InlineKeyboardMarkup{
 				InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
 					{{Text: "Отмена", CallbackData: &toListofCats}},
@@ -161,6 +158,9 @@ func (c ChangeCatalogName) Run(update tgbotapi.Update) error {
 			c.mu.Lock()
 			_, err = c.Client.Send(message)
 			c.mu.Unlock()
+			if err != nil {
+				return
+			}
 
 			stepKey := controllers.NextStepKey{
 				UserID: update.CallbackQuery.From.ID,
@@ -168,15 +168,13 @@ func (c ChangeCatalogName) Run(update tgbotapi.Update) error {
 			}
 	
 			stepAction := controllers.NextStepAction{
-				Func:          ChangeCatalogNameStep,
-				Params:        map[string]interface{}{"catalogId": catalogId},
+				FuncName:      changeCatalogNameStep,
+				Params:        map[string]interface{}{"catalogId": route.CatalogID},
 				CreatedAtTS:   time.Now().Unix(),
 				CancelMessage: "Изменение названия каталога отменено",
 			}
 	
-			c.mu.Lock()
-			controllers.GetNextStepManager().RegisterNextStepAction(stepKey, stepAction)
-			c.mu.Unlock()
+			err = controllers.GetNextStepManager().RegisterNextStepAction(ctx, stepKey, stepAction)
 
 			return
         }
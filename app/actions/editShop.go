@@ -2,11 +2,12 @@ package actions
 
 import (
 	"context"
+	"main/callback"
+	"main/config"
 	"main/controllers"
-	"main/database"
 	"main/database/models"
-	"main/filters"
 	"main/logger"
+	"main/telegram"
 	"strconv"
 	"sync"
 	"time"
@@ -20,14 +21,18 @@ import (
 // Client - экземпляр Telegram бота.
 type EditShop struct {
 	Name   string
-	Client tgbotapi.BotAPI
+	Client telegram.BotClient
+	DB     *pg.DB
+	Config *config.Config
 	mu     *sync.Mutex
 }
 
-func NewEditShopHandler(client tgbotapi.BotAPI) *EditShop {
+func NewEditShopHandler(client telegram.BotClient, db *pg.DB, cfg *config.Config) *EditShop {
 	return &EditShop{
 		Name:   "editShop",
 		Client: client,
+		DB:     db,
+		Config: cfg,
 		mu:     &sync.Mutex{},
 	}
 }
@@ -35,15 +40,15 @@ func NewEditShopHandler(client tgbotapi.BotAPI) *EditShop {
 // Run обрабатывает действие редактирования магазина на основе параметра a.
 // update - обновление от Telegram API.
 // Возвращает ошибку, если что-то пошло не так.
-func (e EditShop) Run(update tgbotapi.Update) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (e EditShop) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var wg sync.WaitGroup
 	var err error
 
 	// TODO: Delete
-	log := logger.GetLogger()
+	log := logger.FromContext(ctx)
 
 
 	wg.Add(1)
@@ -54,16 +59,15 @@ func (e EditShop) Run(update tgbotapi.Update) error {
 			return
 		default:
 			e.mu.Lock()
-			ClearNextStepForUser(update, &e.Client, true)
+			ClearNextStepForUser(update, e.Client, true)
 			e.mu.Unlock()
 
-			db := database.Connect()
-			defer db.Close()
+			db := e.DB
 
 			log.Info("[EditShop.Run]: Next step cleared, database connected. Success: all")
 
 			userDb := models.TelegramUser{ID: update.CallbackQuery.From.ID}
-			err = userDb.Get(*db)
+			err = userDb.Get(db)
 			if err != nil {
 				return
 			}
@@ -84,14 +88,19 @@ func (e EditShop) Run(update tgbotapi.Update) error {
 
 			if userDb.ShopSession == nil || userDb.ShopSession.CatalogID == 0 {
 				log.Info("[EditShop.Run] No valid shop session available. redirectiong to NewViewCatalogHandler")
-				handler := NewViewCatalogHandler(e.Client)
+				handler := NewViewCatalogHandler(e.Client, e.DB)
 				handler.mu = e.mu
-				err = handler.Run(update)
+				err = handler.Run(ctx, withCallbackData(update, callback.ToCat{}))
 
 				return
 			}
 
-			data := filters.ParseCallbackData(update.CallbackQuery.Data)
+			var route callback.EditShop
+			err = callback.Decode(update.CallbackQuery.Data, &route)
+			if err != nil {
+				return
+			}
+
 			session := *userDb.ShopSession
 
 			log.Info("[EditShop.Run] ShopSession model loaded")
@@ -108,23 +117,23 @@ func (e EditShop) Run(update tgbotapi.Update) error {
 			log.Info("[EditShop.Run] Catalog selected!")
 
 			e.mu.Lock()
-			switch data["a"] {
+			switch route.Action {
 			case "removeCatalog":
-				err = removeCatalog(update, e.Client, session, *db)
+				err = removeCatalog(ctx, update, e.Client, session, db, e.Config.Telegram.AdminChatID)
 			case "removeProduct":
-				err = removeProduct(update, e.Client, session, *db)
+				err = removeProduct(ctx, update, e.Client, session, db, e.Config.Telegram.AdminChatID)
 			case "changePhoto":
-				err = changePhoto(update, e.Client, session)
+				err = changePhoto(ctx, update, e.Client, session)
 			case "changePrice":
-				err = changePrice(update, e.Client, session)
+				err = changePrice(ctx, update, e.Client, session)
 			case "changeName":
-				err = changeName(update, e.Client, session)
+				err = changeName(ctx, update, e.Client, session)
 			case "changeDescription":
-				changeDescription(update, e.Client, session)
+				changeDescription(ctx, update, e.Client, session)
 			case "createProduct":
-				err = createProduct(update, e.Client, session)
+				err = createProduct(ctx, update, e.Client, session)
 			case "changeAvailbleForPurchase":
-				err = changeAvailbleForPurchase(update, e.Client, session)
+				err = changeAvailbleForPurchase(ctx, update, e.Client, session)
 			}
 			e.mu.Unlock()
 
@@ -147,7 +156,7 @@ func (e EditShop) Run(update tgbotapi.Update) error {
 }
 
 // removeCatalog удаляет каталог и возвращает пользователя к списку каталогов.
-func removeCatalog(update tgbotapi.Update, client tgbotapi.BotAPI, session models.ShopViewSession, db pg.DB) error {
+func removeCatalog(ctx context.Context, update tgbotapi.Update, client telegram.BotClient, session models.ShopViewSession, db *pg.DB, adminChatID int64) error {
 	var products []models.Product
 	err := db.Model(&products).Where("catalog_id = ?", session.CatalogID).Select()
 	if err != nil {
@@ -155,7 +164,7 @@ func removeCatalog(update tgbotapi.Update, client tgbotapi.BotAPI, session model
 	}
 
 	for _, product := range products {
-		err = DeleteProductFromUsersCarts(&db, product.ID, &client)
+		err = DeleteProductFromUsersCarts(db, product.ID, client, adminChatID)
 		if err != nil {
 			return err
 		}
@@ -182,12 +191,12 @@ func removeCatalog(update tgbotapi.Update, client tgbotapi.BotAPI, session model
 		return err
 	}
 
-	return NewShopHandler(client).Run(update)
+	return NewShopHandler(client, db).Run(ctx, withCallbackData(update, callback.Shop{}))
 }
 
 // removeProduct удаляет текущий товар и возвращает пользователя к просмотру каталога.
-func removeProduct(update tgbotapi.Update, client tgbotapi.BotAPI, session models.ShopViewSession, db pg.DB) error {
-	err := DeleteProductFromUsersCarts(&db, session.ProductAt.ID, &client)
+func removeProduct(ctx context.Context, update tgbotapi.Update, client telegram.BotClient, session models.ShopViewSession, db *pg.DB, adminChatID int64) error {
+	err := DeleteProductFromUsersCarts(db, session.ProductAt.ID, client, adminChatID)
 	if err != nil {
 		return err
 	}
@@ -207,18 +216,18 @@ func removeProduct(update tgbotapi.Update, client tgbotapi.BotAPI, session model
 		return err
 	}
 
-	handler := NewViewCatalogHandler(client)
-	return handler.Run(update)
+	handler := NewViewCatalogHandler(client, db)
+	return handler.Run(ctx, withCallbackData(update, callback.ToCat{}))
 }
 
 // baseForm отображает форму ввода с кнопкой отмены и регистрирует следующий шаг.
-func baseForm(client tgbotapi.BotAPI, update tgbotapi.Update, params map[string]any, formText, CancelMessage string, formHandler controllers.NextStepFunc) error {
+func baseForm(ctx context.Context, client telegram.BotClient, update tgbotapi.Update, params map[string]any, formText, CancelMessage string, formHandler string) error {
 	client.Send(tgbotapi.NewDeleteMessage(GetMessage(update).Chat.ID, GetMessage(update).MessageID))
 
 	msg := tgbotapi.NewMessage(GetMessage(update).Chat.ID, formText)
 	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Отмена", "toCat"),
+			tgbotapi.NewInlineKeyboardButtonData("Отмена", callback.MustEncode(callback.ToCat{})),
 		),
 	)
 	_, err := client.Send(msg)
@@ -232,25 +241,23 @@ func baseForm(client tgbotapi.BotAPI, update tgbotapi.Update, params map[string]
 	}
 
 	stepAction := controllers.NextStepAction{
-		Func:          formHandler,
+		FuncName:      formHandler,
 		Params:        params,
 		CreatedAtTS:   time.Now().Unix(),
 		CancelMessage: CancelMessage,
 	}
 
-	controllers.GetNextStepManager().RegisterNextStepAction(stepKey, stepAction)
-
-	return nil
+	return controllers.GetNextStepManager().RegisterNextStepAction(ctx, stepKey, stepAction)
 }
 
 // baseFormSuccess очищает следующий шаг и показывает сообщение об успехе.
-func baseFormSuccess(client tgbotapi.BotAPI, update tgbotapi.Update, successMessage string) error {
-	ClearNextStepForUser(update, &client, false)
+func baseFormSuccess(client telegram.BotClient, update tgbotapi.Update, successMessage string) error {
+	ClearNextStepForUser(update, client, false)
 
 	msg := tgbotapi.NewMessage(GetMessage(update).Chat.ID, successMessage)
 	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("К списку товаров", "toCat"),
+			tgbotapi.NewInlineKeyboardButtonData("К списку товаров", callback.MustEncode(callback.ToCat{})),
 		),
 	)
 	_, err := client.Send(msg)
@@ -259,11 +266,11 @@ func baseFormSuccess(client tgbotapi.BotAPI, update tgbotapi.Update, successMess
 }
 
 // baseFormResend повторно отображает форму ввода при ошибке.
-func baseFormResend(client tgbotapi.BotAPI, update tgbotapi.Update, formText, CancelMessage string, stepParams map[string]any, formHandler controllers.NextStepFunc) error {
+func baseFormResend(ctx context.Context, client telegram.BotClient, update tgbotapi.Update, formText, CancelMessage string, stepParams map[string]any, formHandler string) error {
 	msg := tgbotapi.NewMessage(GetMessage(update).Chat.ID, formText)
 	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("Отмена", "toCat"),
+			tgbotapi.NewInlineKeyboardButtonData("Отмена", callback.MustEncode(callback.ToCat{})),
 		),
 	)
 	_, err := client.Send(msg)
@@ -277,291 +284,327 @@ func baseFormResend(client tgbotapi.BotAPI, update tgbotapi.Update, formText, Ca
 	}
 
 	stepAction := controllers.NextStepAction{
-		Func:          formHandler,
+		FuncName:      formHandler,
 		Params:        stepParams,
 		CreatedAtTS:   time.Now().Unix(),
 		CancelMessage: CancelMessage,
 	}
 
-	controllers.GetNextStepManager().RegisterNextStepAction(stepKey, stepAction)
+	return controllers.GetNextStepManager().RegisterNextStepAction(ctx, stepKey, stepAction)
+}
 
-	return nil
+// sessionStepParams сохраняет в параметрах шага идентификаторы текущего каталога и товара сессии.
+// Сама сессия в параметры не кладется: параметры шага хранятся в базе в виде JSON.
+func sessionStepParams(session models.ShopViewSession) map[string]any {
+	return map[string]any{
+		"catalogId": session.CatalogID,
+		"productId": session.ProductAtID,
+	}
 }
 
 // changePhoto инициирует изменение фото товара.
-func changePhoto(update tgbotapi.Update, client tgbotapi.BotAPI, session models.ShopViewSession) error {
-	return baseForm(client, update, map[string]any{
-		"session": session,
-	}, "Отправьте ниже новое фото товара", "Фото не обновлено", changePhotoHandler)
+func changePhoto(ctx context.Context, update tgbotapi.Update, client telegram.BotClient, session models.ShopViewSession) error {
+	return baseForm(ctx, client, update, sessionStepParams(session), "Отправьте ниже новое фото товара", "Фото не обновлено", changeProductPhotoStep)
 }
 
 // changePhotoHandler обрабатывает загрузку нового фото и сохраняет его.
-func changePhotoHandler(client tgbotapi.BotAPI, update tgbotapi.Update, stepParams map[string]any) error {
-	client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID-1))
-	client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID))
+func changePhotoHandler(ctx context.Context, env controllers.StepEnv, update tgbotapi.Update, stepParams map[string]any) error {
+	env.Client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID-1))
+	env.Client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID))
 
 	photo := update.Message.Photo
 	if len(photo) == 0 {
-		return baseFormResend(client, update, "Отправьте ниже новое фото товара", "Фото не обновлено", stepParams, changePhotoHandler)
+		return baseFormResend(ctx, env.Client, update, "Отправьте ниже новое фото товара", "Фото не обновлено", stepParams, changeProductPhotoStep)
 	}
 
 	photoID := photo[len(photo)-1].FileID
 
-	db := database.Connect()
-	defer db.Close()
+	db := env.DB
+
+	productID, err := controllers.ParamInt(stepParams, "productId")
+	if err != nil {
+		return err
+	}
 
-	_, err := db.Model(stepParams["session"].(models.ShopViewSession).ProductAt).WherePK().Set("image_file_id = ?", photoID).Update()
+	_, err = db.Model(&models.Product{ID: productID}).WherePK().Set("image_file_id = ?", photoID).Update()
 	if err != nil {
 		return err
 	}
 
-	return baseFormSuccess(client, update, "Фото обновлено!")
+	return baseFormSuccess(env.Client, update, "Фото обновлено!")
 }
 
 // changePrice инициирует изменение цены товара.
-func changePrice(update tgbotapi.Update, client tgbotapi.BotAPI, session models.ShopViewSession) error {
-	return baseForm(client, update, map[string]any{
-		"session": session,
-	}, "Отправьте ниже новую цену товара", "Цена не обновлена", changePriceHandler)
+func changePrice(ctx context.Context, update tgbotapi.Update, client telegram.BotClient, session models.ShopViewSession) error {
+	return baseForm(ctx, client, update, sessionStepParams(session), "Отправьте ниже новую цену товара", "Цена не обновлена", changeProductPriceStep)
 }
 
 // changePriceHandler обрабатывает ввод новой цены и сохраняет её.
-func changePriceHandler(client tgbotapi.BotAPI, update tgbotapi.Update, stepParams map[string]any) error {
-	client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID-1))
-	client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID))
+func changePriceHandler(ctx context.Context, env controllers.StepEnv, update tgbotapi.Update, stepParams map[string]any) error {
+	env.Client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID-1))
+	env.Client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID))
 
 	price := update.Message.Text
 
 	priceInt, err := strconv.Atoi(price)
 
 	if err != nil {
-		return baseFormResend(client, update, "Отправьте ниже новую цену товара (целое число!)", "Цена не обновлена", stepParams, changePriceHandler)
+		return baseFormResend(ctx, env.Client, update, "Отправьте ниже новую цену товара (целое число!)", "Цена не обновлена", stepParams, changeProductPriceStep)
 	}
 
-	db := database.Connect()
-	defer db.Close()
+	db := env.DB
 
-	_, err = db.Model(stepParams["session"].(models.ShopViewSession).ProductAt).WherePK().Set("price = ?", priceInt).Update()
+	productID, err := controllers.ParamInt(stepParams, "productId")
 	if err != nil {
 		return err
 	}
 
-	return baseFormSuccess(client, update, "Цена обновлена!")
+	_, err = db.Model(&models.Product{ID: productID}).WherePK().Set("price = ?", priceInt).Update()
+	if err != nil {
+		return err
+	}
+
+	return baseFormSuccess(env.Client, update, "Цена обновлена!")
 }
 
-func changeAvailbleForPurchase(update tgbotapi.Update, client tgbotapi.BotAPI, session models.ShopViewSession) error {
-	return baseForm(client, update, map[string]any{
-		"session": session,
-	}, "Отправьте ниже количество товаров в наличии", "Количество товаров не обновлено", changeAvailbleForPurchaseHandler)
+func changeAvailbleForPurchase(ctx context.Context, update tgbotapi.Update, client telegram.BotClient, session models.ShopViewSession) error {
+	return baseForm(ctx, client, update, sessionStepParams(session), "Отправьте ниже количество товаров в наличии", "Количество товаров не обновлено", changeProductAvailbleForPurchaseStep)
 }
 
-func changeAvailbleForPurchaseHandler(client tgbotapi.BotAPI, update tgbotapi.Update, stepParams map[string]any) error {
-	client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID-1))
-	client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID))
+func changeAvailbleForPurchaseHandler(ctx context.Context, env controllers.StepEnv, update tgbotapi.Update, stepParams map[string]any) error {
+	env.Client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID-1))
+	env.Client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID))
 
 	availbleForPurchase := update.Message.Text
 
 	availbleForPurchaseInt, err := strconv.Atoi(availbleForPurchase)
 
 	if err != nil {
-		return baseFormResend(client, update, "Отправьте ниже количество товаров в наличии (целое число!)", "Количество товаров не обновлено", stepParams, changeAvailbleForPurchaseHandler)
+		return baseFormResend(ctx, env.Client, update, "Отправьте ниже количество товаров в наличии (целое число!)", "Количество товаров не обновлено", stepParams, changeProductAvailbleForPurchaseStep)
 	}
 
 	if availbleForPurchaseInt < 0 {
-		return baseFormResend(client, update, "Количество товаров в наличии не может быть отрицательным", "Количество товаров не обновлено", stepParams, changeAvailbleForPurchaseHandler)
+		return baseFormResend(ctx, env.Client, update, "Количество товаров в наличии не может быть отрицательным", "Количество товаров не обновлено", stepParams, changeProductAvailbleForPurchaseStep)
 	}
 
-	db := database.Connect()
-	defer db.Close()
+	db := env.DB
 
-	_, err = db.Model(stepParams["session"].(models.ShopViewSession).ProductAt).WherePK().Set("availble_for_purchase = ?", availbleForPurchaseInt).Update()
+	productID, err := controllers.ParamInt(stepParams, "productId")
 	if err != nil {
 		return err
 	}
 
-	return baseFormSuccess(client, update, "Количество товаров в наличии обновлено!")
+	_, err = db.Model(&models.Product{ID: productID}).WherePK().Set("availble_for_purchase = ?", availbleForPurchaseInt).Update()
+	if err != nil {
+		return err
+	}
+
+	return baseFormSuccess(env.Client, update, "Количество товаров в наличии обновлено!")
 }
 
 // changeName инициирует изменение названия товара.
 // update - обновление от Telegram API.
-// client - экземпляр Telegram бота.
+// env.Client - экземпляр Telegram бота.
 // session - текущая сессия просмотра магазина.
-func changeName(update tgbotapi.Update, client tgbotapi.BotAPI, session models.ShopViewSession) error {
-	return baseForm(client, update, map[string]any{
-		"session": session,
-	}, "Отправьте ниже новое название товара", "Название не обновлено", changeNameHandler)
+func changeName(ctx context.Context, update tgbotapi.Update, client telegram.BotClient, session models.ShopViewSession) error {
+	return baseForm(ctx, client, update, sessionStepParams(session), "Отправьте ниже новое название товара", "Название не обновлено", changeProductNameStep)
 }
 
 // changeNameHandler обрабатывает ввод нового названия товара и сохраняет его.
-// client - экземпляр Telegram бота.
+// env - Telegram бот и пул соединений с базой.
 // update - обновление от Telegram API.
-// stepParams - параметры шага, содержащие session.
-func changeNameHandler(client tgbotapi.BotAPI, update tgbotapi.Update, stepParams map[string]any) error {
-	client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID-1))
-	client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID))
+// stepParams - параметры шага, содержащие catalogId и productId.
+func changeNameHandler(ctx context.Context, env controllers.StepEnv, update tgbotapi.Update, stepParams map[string]any) error {
+	env.Client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID-1))
+	env.Client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID))
 
 	name := update.Message.Text
 
 	if name == "" {
-		return baseFormResend(client, update, "Название не может быть пустым", "Название не обновлено", stepParams, changeNameHandler)
+		return baseFormResend(ctx, env.Client, update, "Название не может быть пустым", "Название не обновлено", stepParams, changeProductNameStep)
 	}
 
-	db := database.Connect()
-	defer db.Close()
+	db := env.DB
 
-	_, err := db.Model(stepParams["session"].(models.ShopViewSession).ProductAt).WherePK().Set("name = ?", name).Update()
+	productID, err := controllers.ParamInt(stepParams, "productId")
 	if err != nil {
 		return err
 	}
 
-	return baseFormSuccess(client, update, "Название обновлено!")
+	_, err = db.Model(&models.Product{ID: productID}).WherePK().Set("name = ?", name).Update()
+	if err != nil {
+		return err
+	}
+
+	return baseFormSuccess(env.Client, update, "Название обновлено!")
 }
 
 // changeDescription инициирует изменение описания товара.
 // update - обновление от Telegram API.
-// client - экземпляр Telegram бота.
+// env.Client - экземпляр Telegram бота.
 // session - текущая сессия просмотра магазина.
-func changeDescription(update tgbotapi.Update, client tgbotapi.BotAPI, session models.ShopViewSession) error {
-	return baseForm(client, update, map[string]any{
-		"session": session,
-	}, "Отправьте ниже новое описание товара", "Описание не обновлено", changeDescriptionHandler)
+func changeDescription(ctx context.Context, update tgbotapi.Update, client telegram.BotClient, session models.ShopViewSession) error {
+	return baseForm(ctx, client, update, sessionStepParams(session), "Отправьте ниже новое описание товара", "Описание не обновлено", changeProductDescriptionStep)
 }
 
 // changeDescriptionHandler обрабатывает ввод нового описания товара и сохраняет его.
-// client - экземпляр Telegram бота.
+// env - Telegram бот и пул соединений с базой.
 // update - обновление от Telegram API.
-// stepParams - параметры шага, содержащие session.
-func changeDescriptionHandler(client tgbotapi.BotAPI, update tgbotapi.Update, stepParams map[string]any) error {
-	client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID-1))
-	client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID))
+// stepParams - параметры шага, содержащие catalogId и productId.
+func changeDescriptionHandler(ctx context.Context, env controllers.StepEnv, update tgbotapi.Update, stepParams map[string]any) error {
+	env.Client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID-1))
+	env.Client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID))
 
 	description := update.Message.Text
 
 	if description == "" {
-		return baseFormResend(client, update, "Описание не может быть пустым", "Описание не обновлено", stepParams, changeDescriptionHandler)
+		return baseFormResend(ctx, env.Client, update, "Описание не может быть пустым", "Описание не обновлено", stepParams, changeProductDescriptionStep)
 	}
 
-	db := database.Connect()
-	defer db.Close()
+	db := env.DB
+
+	productID, err := controllers.ParamInt(stepParams, "productId")
+	if err != nil {
+		return err
+	}
 
-	_, err := db.Model(stepParams["session"].(models.ShopViewSession).ProductAt).WherePK().Set("description = ?", description).Update()
+	_, err = db.Model(&models.Product{ID: productID}).WherePK().Set("description = ?", description).Update()
 	if err != nil {
 		return err
 	}
 
-	return baseFormSuccess(client, update, "Описание обновлено!")
+	return baseFormSuccess(env.Client, update, "Описание обновлено!")
 }
 
 // createProduct инициирует создание нового товара.
 // update - обновление от Telegram API.
-// client - экземпляр Telegram бота.
+// env.Client - экземпляр Telegram бота.
 // session - текущая сессия просмотра магазина.
-func createProduct(update tgbotapi.Update, client tgbotapi.BotAPI, session models.ShopViewSession) error {
-	return baseForm(client, update, map[string]any{
-		"session": session,
-	}, "Отправьте ниже название товара", "Товар не создан", registerNewProductName)
+func createProduct(ctx context.Context, update tgbotapi.Update, client telegram.BotClient, session models.ShopViewSession) error {
+	return baseForm(ctx, client, update, sessionStepParams(session), "Отправьте ниже название товара", "Товар не создан", registerNewProductNameStep)
 }
 
 // registerNewProductName обрабатывает ввод названия нового товара при создании.
-// client - экземпляр Telegram бота.
+// env - Telegram бот и пул соединений с базой.
 // update - обновление от Telegram API.
-// stepParams - параметры шага, содержащие session.
-func registerNewProductName(client tgbotapi.BotAPI, update tgbotapi.Update, stepParams map[string]any) error {
-	client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID-1))
-	client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID))
+// stepParams - параметры шага, содержащие catalogId и productId.
+func registerNewProductName(ctx context.Context, env controllers.StepEnv, update tgbotapi.Update, stepParams map[string]any) error {
+	env.Client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID-1))
+	env.Client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID))
 
 	name := update.Message.Text
 
 	if name == "" {
-		return baseFormResend(client, update, "Название не может быть пустым", "Товар не создан", stepParams, registerNewProductName)
+		return baseFormResend(ctx, env.Client, update, "Название не может быть пустым", "Товар не создан", stepParams, registerNewProductNameStep)
 	}
 
 	stepParams["productName"] = name
-	return baseForm(client, update, stepParams, "Отправьте ниже цену товара", "Товар не создан", registerNewProductPrice)
+	return baseForm(ctx, env.Client, update, stepParams, "Отправьте ниже цену товара", "Товар не создан", registerNewProductPriceStep)
 }
 
 // registerNewProductPrice обрабатывает ввод цены нового товара при создании.
-// client - экземпляр Telegram бота.
+// env.Client - экземпляр Telegram бота.
 // update - обновление от Telegram API.
-// stepParams - параметры шага, содержащие session и productName.
-func registerNewProductPrice(client tgbotapi.BotAPI, update tgbotapi.Update, stepParams map[string]any) error {
-	client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID-1))
-	client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID))
+// stepParams - параметры шага, содержащие catalogId, productId и productName.
+func registerNewProductPrice(ctx context.Context, env controllers.StepEnv, update tgbotapi.Update, stepParams map[string]any) error {
+	env.Client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID-1))
+	env.Client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID))
 
 	price := update.Message.Text
 
 	priceInt, err := strconv.Atoi(price)
 	if err != nil {
-		return baseFormResend(client, update, "Цена должна быть числом", "Товар не создан", stepParams, registerNewProductPrice)
+		return baseFormResend(ctx, env.Client, update, "Цена должна быть числом", "Товар не создан", stepParams, registerNewProductPriceStep)
 	}
 
 	stepParams["productPrice"] = priceInt
-	return baseForm(client, update, stepParams, "Отправьте ниже описание товара", "Товар не создан", registerNewProductDescription)
+	return baseForm(ctx, env.Client, update, stepParams, "Отправьте ниже описание товара", "Товар не создан", registerNewProductDescriptionStep)
 }
 
 // registerNewProductDescription обрабатывает ввод описания нового товара при создании.
-// client - экземпляр Telegram бота.
+// env.Client - экземпляр Telegram бота.
 // update - обновление от Telegram API.
-// stepParams - параметры шага, содержащие session, productName и productPrice.
-func registerNewProductDescription(client tgbotapi.BotAPI, update tgbotapi.Update, stepParams map[string]any) error {
-	client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID-1))
-	client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID))
+// stepParams - параметры шага, содержащие catalogId, productId, productName и productPrice.
+func registerNewProductDescription(ctx context.Context, env controllers.StepEnv, update tgbotapi.Update, stepParams map[string]any) error {
+	env.Client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID-1))
+	env.Client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID))
 
 	description := update.Message.Text
 
 	if description == "" {
-		return baseFormResend(client, update, "Описание не может быть пустым", "Товар не создан", stepParams, registerNewProductDescription)
+		return baseFormResend(ctx, env.Client, update, "Описание не может быть пустым", "Товар не создан", stepParams, registerNewProductDescriptionStep)
 	}
 
 	stepParams["productDescription"] = description
-	return baseForm(client, update, stepParams, "Отправьте ниже количество доступных в наличии товаров", "Товар не создан", registerNewProductAvailbleForPurchase)
+	return baseForm(ctx, env.Client, update, stepParams, "Отправьте ниже количество доступных в наличии товаров", "Товар не создан", registerNewProductAvailbleForPurchaseStep)
 }
 
-func registerNewProductAvailbleForPurchase(client tgbotapi.BotAPI, update tgbotapi.Update, stepParams map[string]any) error {
-	client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID-1))
-	client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID))
+func registerNewProductAvailbleForPurchase(ctx context.Context, env controllers.StepEnv, update tgbotapi.Update, stepParams map[string]any) error {
+	env.Client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID-1))
+	env.Client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID))
 
 	availbleForPurchase := update.Message.Text
 
 	availbleForPurchaseInt, err := strconv.Atoi(availbleForPurchase)
 	if err != nil {
-		return baseFormResend(client, update, "Количество доступных в наличии товаров должно быть числом", "Товар не создан", stepParams, registerNewProductAvailbleForPurchase)
+		return baseFormResend(ctx, env.Client, update, "Количество доступных в наличии товаров должно быть числом", "Товар не создан", stepParams, registerNewProductAvailbleForPurchaseStep)
+	}
+
+	if availbleForPurchaseInt < 0 {
+		return baseFormResend(ctx, env.Client, update, "Количество товаров в наличии не может быть отрицательным", "Товар не создан", stepParams, registerNewProductAvailbleForPurchaseStep)
 	}
 
 	stepParams["productAvailbleForPurchase"] = availbleForPurchaseInt
-	return baseForm(client, update, stepParams, "Отправьте ниже фото товара", "Товар не создан", registerNewProductPhoto)
+	return baseForm(ctx, env.Client, update, stepParams, "Отправьте ниже фото товара", "Товар не создан", registerNewProductPhotoStep)
 }
 
 // registerNewProductPhoto обрабатывает загрузку фото нового товара и сохраняет его.
-// client - экземпляр Telegram бота.
+// env.Client - экземпляр Telegram бота.
 // update - обновление от Telegram API.
-// stepParams - параметры шага, содержащие session, productName, productPrice и productDescription.
-func registerNewProductPhoto(client tgbotapi.BotAPI, update tgbotapi.Update, stepParams map[string]any) error {
-	client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID-1))
-	client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID))
+// stepParams - параметры шага, содержащие catalogId, productName, productPrice, productDescription и productAvailbleForPurchase.
+func registerNewProductPhoto(ctx context.Context, env controllers.StepEnv, update tgbotapi.Update, stepParams map[string]any) error {
+	env.Client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID-1))
+	env.Client.Send(tgbotapi.NewDeleteMessage(update.Message.Chat.ID, update.Message.MessageID))
 	photo := update.Message.Photo
 	if len(photo) == 0 {
-		return baseFormResend(client, update, "Отправьте ниже фото товара", "Товар не создан", stepParams, registerNewProductPhoto)
+		return baseFormResend(ctx, env.Client, update, "Отправьте ниже фото товара", "Товар не создан", stepParams, registerNewProductPhotoStep)
 	}
 
 	photoID := photo[len(photo)-1].FileID
 
-	db := database.Connect()
-	defer db.Close()
+	price, err := controllers.ParamInt(stepParams, "productPrice")
+	if err != nil {
+		return err
+	}
+
+	availbleForPurchase, err := controllers.ParamInt(stepParams, "productAvailbleForPurchase")
+	if err != nil {
+		return err
+	}
+
+	catalogID, err := controllers.ParamInt(stepParams, "catalogId")
+	if err != nil {
+		return err
+	}
+
+	name, _ := stepParams["productName"].(string)
+	description, _ := stepParams["productDescription"].(string)
+
+	db := env.DB
 
-	_, err := db.Model(&models.Product{
+	_, err = db.Model(&models.Product{
 		ImageFileID:         photoID,
-		Name:                stepParams["productName"].(string),
-		Price:               stepParams["productPrice"].(int),
-		Description:         stepParams["productDescription"].(string),
-		AvailbleForPurchase: stepParams["productAvailbleForPurchase"].(int),
-		CatalogID:           stepParams["session"].(models.ShopViewSession).Catalog.ID,
+		Name:                name,
+		Price:               price,
+		Description:         description,
+		AvailbleForPurchase: availbleForPurchase,
+		CatalogID:           catalogID,
 	}).Insert()
 	if err != nil {
 		return err
 	}
 
-	return baseFormSuccess(client, update, "Товар успешно создан!")
+	return baseFormSuccess(env.Client, update, "Товар успешно создан!")
 }
 
 // GetName возвращает имя команды EditShop.
@@ -2,11 +2,13 @@ package actions
 
 import (
 	"context"
-	"main/database"
+	"main/callback"
 	"main/database/models"
+	"main/telegram"
 	"sync"
 	"time"
 
+	"github.com/go-pg/pg/v10"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
@@ -15,14 +17,16 @@ import (
 // Client - экземпляр Telegram бота
 type MainMenu struct {
 	Name   string
-	Client tgbotapi.BotAPI
+	Client telegram.BotClient
+	DB     *pg.DB
 	mu     *sync.Mutex
 }
 
-func NewMainMenuHandler(client tgbotapi.BotAPI) *MainMenu {
+func NewMainMenuHandler(client telegram.BotClient, db *pg.DB) *MainMenu {
 	return &MainMenu{
 		Name:   "mainMenu",
 		Client: client,
+		DB:     db,
 		mu:     &sync.Mutex{},
 	}
 }
@@ -30,8 +34,8 @@ func NewMainMenuHandler(client tgbotapi.BotAPI) *MainMenu {
 // Run запускает отображение главного меню
 // update - обновление от Telegram API
 // Возвращает ошибку, если что-то пошло не так
-func (m MainMenu) Run(update tgbotapi.Update) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (m MainMenu) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var wg sync.WaitGroup
@@ -45,39 +49,38 @@ func (m MainMenu) Run(update tgbotapi.Update) error {
 			return
 		default:
 			m.mu.Lock()
-			ClearNextStepForUser(update, &m.Client, true)
+			ClearNextStepForUser(update, m.Client, true)
 			m.mu.Unlock()
 
-			if update.CallbackQuery != nil {
-				data := ParseCallData(update.CallbackQuery.Data)
-				if _, ok := data["resetAvailablity"]; ok {
-					db := database.Connect()
-					defer db.Close()
-
-					var transaction models.Transaction
-					transaction, err, _ = (&models.TelegramUser{ID: update.CallbackQuery.From.ID}).GetOrCreateTransaction(*db)
-					if err != nil {
-						return
-					}
-
-					err = (&models.TelegramUser{ID: update.CallbackQuery.From.ID}).IncreaseProductAvailbleForPurchase(*db, transaction.ID)
-				}
-			}
-
 			const text = "<b>Главное меню</b>\nВыберите опцию:"
 
-			settingsCallbackData := "profileSettings"
-			shopCallbackData := "shop"
-			aboutCallbackData := "about"
+			settingsCallbackData := callback.MustEncode(callback.ProfileSettings{})
+			shopCallbackData := callback.MustEncode(callback.Shop{})
+			aboutCallbackData := callback.MustEncode(callback.About{})
+			myOrdersCallbackData := callback.MustEncode(callback.MyOrders{})
 
 			keyboard := tgbotapi.InlineKeyboardMarkup{
 				InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
 					{{Text: "⚙️Настройки", CallbackData: &settingsCallbackData}},
 					{{Text: "🛍️Магазин", CallbackData: &shopCallbackData}},
+					{{Text: "📦Мои заказы", CallbackData: &myOrdersCallbackData}},
 					{{Text: "ℹ️О нас", CallbackData: &aboutCallbackData}},
 				},
 			}
 
+			user := models.TelegramUser{ID: update.SentFrom().ID}
+			err = user.Get(m.DB)
+			if err != nil && err != pg.ErrNoRows {
+				return
+			}
+
+			if user.IsAdmin {
+				adminOrdersCallbackData := callback.MustEncode(callback.AdminOrders{})
+				keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, []tgbotapi.InlineKeyboardButton{
+					{Text: "📋Заказы покупателей", CallbackData: &adminOrdersCallbackData},
+				})
+			}
+
 			if update.CallbackQuery != nil {
 				message := tgbotapi.NewEditMessageText(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, text)
 				message.ParseMode = "HTML"
@@ -3,11 +3,14 @@ package actions
 import (
 	"context"
 	"fmt"
-	"main/database"
+	"html"
+	"main/callback"
 	"main/database/models"
+	"main/telegram"
 	"sync"
 	"time"
 
+	"github.com/go-pg/pg/v10"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
@@ -18,25 +21,37 @@ const (
 
 var (
 	// processOrderCallbackData - callback data для обработки заказа
-	processOrderCallbackData = "processOrder"
+	processOrderCallbackData = callback.MustEncode(callback.ProcessOrder{})
 	// changeDataCallbackData - callback data для изменения данных пользователя
-	changeDataCallbackData = "profileSettings?showBackButton=true"
-	toListofCats = "shop"
+	changeDataCallbackData = callback.MustEncode(callback.ProfileSettings{ShowBackButton: true})
+	toListofCats = callback.MustEncode(callback.Shop{})
 )
 
+// cartPriceChangesText предупреждает покупателя об изменившихся ценах товаров в корзине (HTML)
+func cartPriceChangesText(changes []models.CartPriceChange) string {
+	text := "<b>⚠️Пока товары лежали в корзине, цены изменились:</b>\n"
+	for _, change := range changes {
+		text += fmt.Sprintf("|_ %s: %d₽ → %d₽\n", html.EscapeString(change.Name), change.OldPrice, change.NewPrice)
+	}
+
+	return text + "\n"
+}
+
 // MakeOrder представляет собой структуру для оформления заказа
 // Name - имя команды
 // Client - экземпляр Telegram бота
 type MakeOrder struct {
 	Name   string
-	Client tgbotapi.BotAPI
+	Client telegram.BotClient
+	DB     *pg.DB
 	mu     *sync.Mutex
 }
 
-func NewMakeOrderHandler(client tgbotapi.BotAPI) *MakeOrder {
+func NewMakeOrderHandler(client telegram.BotClient, db *pg.DB) *MakeOrder {
 	return &MakeOrder{
 		Name:   "makeOrder",
 		Client: client,
+		DB:     db,
 		mu:     &sync.Mutex{},
 	}
 }
@@ -44,8 +59,8 @@ func NewMakeOrderHandler(client tgbotapi.BotAPI) *MakeOrder {
 // Run запускает процесс оформления заказа
 // update - обновление от Telegram API
 // Возвращает ошибку, если что-то пошло не так
-func (m MakeOrder) Run(update tgbotapi.Update) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (m MakeOrder) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var wg sync.WaitGroup
@@ -59,20 +74,19 @@ func (m MakeOrder) Run(update tgbotapi.Update) error {
 			return
 		default:
 			m.mu.Lock()
-			ClearNextStepForUser(update, &m.Client, true)
+			ClearNextStepForUser(update, m.Client, true)
 			m.mu.Unlock()
 
-			db := database.Connect()
-			defer db.Close()
+			db := m.DB
 
 			user := models.TelegramUser{ID: update.CallbackQuery.From.ID}
-			err = user.Get(*db)
+			err = user.Get(db)
 			if err != nil {
 				return
 			}
 
 			var cartChanged bool
-			cartChanged, err = user.TidyCart(*db)
+			cartChanged, err = user.TidyCart(db)
 			if err != nil {
 				return
 			}
@@ -88,8 +102,14 @@ func (m MakeOrder) Run(update tgbotapi.Update) error {
 				}
 			}
 
+			var priceChanges []models.CartPriceChange
+			priceChanges, err = user.RefreshCartPrices(db)
+			if err != nil {
+				return
+			}
+
 			var totalPrice int
-			totalPrice, err = user.GetTotalCartPrice(*db)
+			totalPrice, err = user.GetTotalCartPrice(db)
 			if err != nil {
 				return
 			}
@@ -112,12 +132,15 @@ func (m MakeOrder) Run(update tgbotapi.Update) error {
 			}
 
 			var cartDesc string
-			cartDesc, err = user.GetCartDescription(*db)
+			cartDesc, err = user.GetCartDescription(db)
 			if err != nil {
 				return
 			}
 
 			finalPageText := fmt.Sprintf(makeOrderPageText, totalPrice, cartDesc, user.Phone, user.FIO, user.DeliveryAddress, user.DeliveryService)
+			if len(priceChanges) > 0 {
+				finalPageText = cartPriceChangesText(priceChanges) + finalPageText
+			}
 
 			msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, finalPageText)
 			msg.ParseMode = "HTML"
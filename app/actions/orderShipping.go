@@ -0,0 +1,236 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"main/callback"
+	"main/config"
+	"main/controllers"
+	"main/database/models"
+	"main/logger"
+	"main/telegram"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxTrackingNumberLength - ограничение длины трек-номера, введенного администратором
+const maxTrackingNumberLength = 64
+
+// deliveryServiceName возвращает название сервиса доставки для покупателя
+func deliveryServiceName(service string) string {
+	switch service {
+	case "cdek":
+		return "CDEK"
+	case "yandex":
+		return "Яндекс доставка"
+	default:
+		return service
+	}
+}
+
+// orderTrackingText описывает трек-номер заказа и ссылку отслеживания, если она настроена (HTML)
+func orderTrackingText(delivery config.Delivery, order models.Order) string {
+	text := fmt.Sprintf("Служба доставки: %s\nТрек-номер: <code>%s</code>", deliveryServiceName(order.Carrier), html.EscapeString(order.TrackingNumber))
+	if link := delivery.TrackingURL(order.Carrier, order.TrackingNumber); link != "" {
+		text += fmt.Sprintf("\n<a href=\"%s\">Отследить посылку</a>", html.EscapeString(link))
+	}
+
+	return text
+}
+
+// notifyOrderStatus сообщает покупателю об отправке, прибытии в пункт выдачи или получении заказа.
+// Статус заказа к этому моменту уже сохранен, поэтому ошибка отправки только записывается в лог.
+func notifyOrderStatus(ctx context.Context, client telegram.BotClient, delivery config.Delivery, order models.Order) {
+	var text string
+	switch order.Status {
+	case models.OrderStatusShipped:
+		text = fmt.Sprintf("<b>Заказ №%d отправлен</b>📦\n\n%s", order.Number, orderTrackingText(delivery, order))
+	case models.OrderStatusArrived:
+		text = fmt.Sprintf("<b>Заказ №%d прибыл в пункт выдачи</b>📍\n\nАдрес: %s", order.Number, html.EscapeString(order.DeliveryAddress))
+	case models.OrderStatusDelivered:
+		text = fmt.Sprintf("<b>Заказ №%d получен</b>✅\n\nСпасибо за покупку!", order.Number)
+	default:
+		return
+	}
+
+	message := tgbotapi.NewMessage(order.UserID, text)
+	message.ParseMode = "HTML"
+	message.DisableWebPagePreview = true
+	detailsCallbackData := callback.MustEncode(callback.OrderDetails{OrderID: order.ID})
+	message.ReplyMarkup = &tgbotapi.InlineKeyboardMarkup{
+		InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
+			{{Text: "Подробнее о заказе", CallbackData: &detailsCallbackData}},
+		},
+	}
+
+	_, err := client.Send(message)
+	if err != nil {
+		logger.FromContext(ctx).Warningw("Failed to notify customer about order status",
+			"order_id", order.ID, "user_id", order.UserID, "status", order.Status, "error", err)
+	}
+}
+
+// AdminOrderTracking сохраняет трек-номер заказа, уведомляет покупателя и показывает карточку заказа
+// env - Telegram бот, пул соединений с базой и настройки
+// update - обновление от Telegram API
+// stepParams - заказ (orderId) и служба доставки (carrier)
+// Возвращает ошибку, если что-то пошло не так
+func AdminOrderTracking(ctx context.Context, env controllers.StepEnv, update tgbotapi.Update, stepParams map[string]any) error {
+	if update.Message == nil {
+		return nil
+	}
+
+	orderID, err := controllers.ParamInt(stepParams, "orderId")
+	if err != nil {
+		return err
+	}
+	carrier, _ := stepParams["carrier"].(string)
+
+	cardRoute := callback.AdminOrderCard{OrderID: orderID}
+
+	trackingNumber := strings.TrimSpace(update.Message.Text)
+	if trackingNumber == "" || len(trackingNumber) > maxTrackingNumberLength || strings.ContainsAny(trackingNumber, " \n\t") {
+		return registerAdminOrdersStep(ctx, env.Client, update.Message.Chat.ID, update.Message.From.ID, "Отправьте трек-номер одной строкой без пробелов", cardRoute, adminOrderTrackingStep, stepParams, "Трек-номер не сохранен")
+	}
+
+	order, err := models.SetOrderTracking(env.DB, orderID, update.Message.From.ID, carrier, trackingNumber)
+	if errors.Is(err, models.ErrInvalidTransition) {
+		_, err = env.Client.Send(tgbotapi.NewMessage(update.Message.Chat.ID, "Трек-номер можно указать только у оплаченного или отправленного заказа"))
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	notifyOrderStatus(ctx, env.Client, env.Config.Delivery, order)
+
+	cardRoute.Tab = adminOrdersTabKey(order.Status)
+	text, markup, err := adminOrderCardView(env.DB, cardRoute)
+	if err != nil {
+		return err
+	}
+
+	return showAdminView(env.Client, update, text, markup)
+}
+
+// AdminOrderShip представляет собой структуру для отправки заказа администратором:
+// выбор службы доставки и запрос трек-номера
+// Name - имя команды
+// Client - экземпляр Telegram бота
+type AdminOrderShip struct {
+	Name   string
+	Client telegram.BotClient
+	DB     *pg.DB
+	mu     *sync.Mutex
+}
+
+func NewAdminOrderShipHandler(client telegram.BotClient, db *pg.DB) *AdminOrderShip {
+	return &AdminOrderShip{
+		Name:   "adminOrderShip",
+		Client: client,
+		DB:     db,
+		mu:     &sync.Mutex{},
+	}
+}
+
+// Run без выбранной службы показывает список служб доставки, с выбранной - просит трек-номер
+// update - обновление от Telegram API
+// Возвращает ошибку, если что-то пошло не так
+func (a AdminOrderShip) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var err error
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			a.mu.Lock()
+			ClearNextStepForUser(update, a.Client, true)
+			a.mu.Unlock()
+
+			var route callback.AdminOrderShip
+			err = callback.Decode(update.CallbackQuery.Data, &route)
+			if err != nil {
+				return
+			}
+
+			var order models.Order
+			order, err = models.GetOrder(a.DB, route.OrderID)
+			if err != nil && err != pg.ErrNoRows {
+				return
+			}
+
+			canShip := order.Status == models.OrderStatusPaid || order.Status == models.OrderStatusShipped || order.Status == models.OrderStatusArrived
+			if err == pg.ErrNoRows || !canShip {
+				a.mu.Lock()
+				_, err = a.Client.Request(tgbotapi.CallbackConfig{
+					CallbackQueryID: update.CallbackQuery.ID,
+					Text:            "Трек-номер можно указать только у оплаченного или отправленного заказа",
+					ShowAlert:       true,
+				})
+				a.mu.Unlock()
+				return
+			}
+
+			cardRoute := callback.AdminOrderCard{OrderID: order.ID, Tab: adminOrdersTabKey(order.Status)}
+
+			if !slices.Contains(config.DeliveryServices, route.Carrier) {
+				text := fmt.Sprintf("<b>Заказ №%d</b>\nВыберите службу доставки. Покупатель выбрал: %s", order.Number, deliveryServiceName(order.DeliveryService))
+
+				var keyboard [][]tgbotapi.InlineKeyboardButton
+				for _, service := range config.DeliveryServices {
+					serviceCallbackData := callback.MustEncode(callback.AdminOrderShip{OrderID: order.ID, Carrier: service})
+					keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: deliveryServiceName(service), CallbackData: &serviceCallbackData}})
+				}
+				backCallbackData := callback.MustEncode(cardRoute)
+				keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: "Назад", CallbackData: &backCallbackData}})
+
+				a.mu.Lock()
+				err = showAdminView(a.Client, update, text, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: keyboard})
+				a.mu.Unlock()
+				return
+			}
+
+			a.mu.Lock()
+			err = registerAdminOrdersStep(ctx, a.Client, update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.From.ID,
+				fmt.Sprintf("Отправьте трек-номер %s для заказа №%d", deliveryServiceName(route.Carrier), order.Number),
+				cardRoute,
+				adminOrderTrackingStep,
+				map[string]any{"orderId": order.ID, "carrier": route.Carrier},
+				"Трек-номер не сохранен",
+			)
+			a.mu.Unlock()
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// GetName возвращает имя команды
+func (a AdminOrderShip) GetName() string {
+	return a.Name
+}
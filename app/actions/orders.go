@@ -0,0 +1,319 @@
+package actions
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"main/callback"
+	"main/config"
+	"main/database/models"
+	"main/telegram"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// myOrdersPageSize - сколько заказов на одной странице списка «Мои заказы»
+	myOrdersPageSize = 5
+	// orderTimeLayout - формат дат в карточке заказа
+	orderTimeLayout = "02.01.2006 15:04"
+)
+
+// formatOrderTime форматирует метку времени заказа
+func formatOrderTime(ts int64) string {
+	return time.Unix(ts, 0).Format(orderTimeLayout)
+}
+
+// orderStatusIcon - значок статуса в списках заказов
+func orderStatusIcon(status models.OrderStatus) string {
+	switch status {
+	case models.OrderStatusDelivered:
+		return "✅"
+	case models.OrderStatusCancelled, models.OrderStatusRefunded:
+		return "❌"
+	default:
+		return "🕓"
+	}
+}
+
+// orderButtonText - подпись кнопки заказа в списках
+func orderButtonText(order models.Order) string {
+	return fmt.Sprintf("%s №%d · %s · %d₽", orderStatusIcon(order.Status), order.Number, order.Status.Title(), order.TotalPrice)
+}
+
+// orderItemsText описывает позиции и сумму заказа (HTML)
+func orderItemsText(order models.Order) string {
+	text := "<b>Товары:</b>\n"
+	for _, line := range order.Lines {
+		text += fmt.Sprintf("|_ %s (%d шт.) - %d₽\n", html.EscapeString(line.Name), line.Quantity, line.Quantity*line.UnitPrice)
+	}
+
+	return text + fmt.Sprintf("Итого: %d₽\n", order.TotalPrice)
+}
+
+// orderDeliveryText описывает данные доставки, сохраненные в заказе (HTML)
+func orderDeliveryText(order models.Order) string {
+	text := "<b>Доставка:</b>"
+	text += "\n|_ ФИО: " + html.EscapeString(order.FIO)
+	text += "\n|_ Номер телефона: " + html.EscapeString(order.Phone)
+	text += "\n|_ Сервис доставки: " + html.EscapeString(deliveryServiceName(order.DeliveryService))
+	text += "\n|_ Адрес ПВЗ: " + html.EscapeString(order.DeliveryAddress)
+	if order.TrackingNumber != "" {
+		text += "\n|_ Трек-номер: <code>" + html.EscapeString(order.TrackingNumber) + "</code> (" + deliveryServiceName(order.Carrier) + ")"
+	}
+
+	return text + "\n"
+}
+
+// orderHistoryText описывает историю статусов заказа (HTML)
+func orderHistoryText(order models.Order) string {
+	text := "<b>История:</b>"
+	for _, change := range order.History {
+		text += "\n" + formatOrderTime(change.CreatedAtTS) + " - " + change.ToStatus.Title()
+		if change.Note != "" {
+			text += " (" + html.EscapeString(change.Note) + ")"
+		}
+	}
+
+	return text + "\n"
+}
+
+// MyOrders представляет собой структуру для просмотра списка заказов покупателя
+// Name - имя команды
+// Client - экземпляр Telegram бота
+type MyOrders struct {
+	Name   string
+	Client telegram.BotClient
+	DB     *pg.DB
+	mu     *sync.Mutex
+}
+
+func NewMyOrdersHandler(client telegram.BotClient, db *pg.DB) *MyOrders {
+	return &MyOrders{
+		Name:   "myOrders",
+		Client: client,
+		DB:     db,
+		mu:     &sync.Mutex{},
+	}
+}
+
+// Run показывает страницу списка заказов покупателя
+// update - обновление от Telegram API
+// Возвращает ошибку, если что-то пошло не так
+func (m MyOrders) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var err error
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			m.mu.Lock()
+			ClearNextStepForUser(update, m.Client, true)
+			m.mu.Unlock()
+
+			var route callback.MyOrders
+			err = callback.Decode(update.CallbackQuery.Data, &route)
+			if err != nil {
+				return
+			}
+
+			page := max(route.Page, 0)
+			user := models.TelegramUser{ID: update.CallbackQuery.From.ID}
+
+			var orders []models.Order
+			var count int
+			orders, count, err = user.ListOrders(m.DB, page*myOrdersPageSize, myOrdersPageSize)
+			if err != nil {
+				return
+			}
+
+			// Заказов стало меньше, чем было при отрисовке кнопки: показываем последнюю страницу
+			if len(orders) == 0 && page > 0 && count > 0 {
+				page = (count - 1) / myOrdersPageSize
+				orders, count, err = user.ListOrders(m.DB, page*myOrdersPageSize, myOrdersPageSize)
+				if err != nil {
+					return
+				}
+			}
+
+			text := "<b>Мои заказы</b>\n\n"
+			if count == 0 {
+				text += "Вы еще ничего не заказывали"
+			} else {
+				text += "Выберите заказ, чтобы посмотреть состав, доставку и историю статусов"
+			}
+
+			var keyboard [][]tgbotapi.InlineKeyboardButton
+			for _, order := range orders {
+				detailsCallbackData := callback.MustEncode(callback.OrderDetails{OrderID: order.ID, Page: page})
+				keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{
+					{Text: orderButtonText(order), CallbackData: &detailsCallbackData},
+				})
+			}
+
+			if pages := (count + myOrdersPageSize - 1) / myOrdersPageSize; pages > 1 {
+				prevPageCallbackData := callback.MustEncode(callback.MyOrders{Page: (page + pages - 1) % pages})
+				noneCallbackData := callback.MustEncode(callback.Noop{})
+				nextPageCallbackData := callback.MustEncode(callback.MyOrders{Page: (page + 1) % pages})
+				keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{
+					{Text: "⬅️", CallbackData: &prevPageCallbackData},
+					{Text: fmt.Sprintf("%s/%s", NumberToEmoji(page+1), NumberToEmoji(pages)), CallbackData: &noneCallbackData},
+					{Text: "➡️", CallbackData: &nextPageCallbackData},
+				})
+			}
+
+			toMainMenuCallbackData := callback.MustEncode(callback.MainMenu{})
+			keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: "На главную", CallbackData: &toMainMenuCallbackData}})
+
+			message := tgbotapi.NewEditMessageText(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, text)
+			message.ParseMode = "HTML"
+			message.ReplyMarkup = &tgbotapi.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+
+			m.mu.Lock()
+			_, err = m.Client.Send(message)
+			m.mu.Unlock()
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// GetName возвращает имя команды
+func (m MyOrders) GetName() string {
+	return m.Name
+}
+
+// OrderDetails представляет собой структуру для просмотра карточки заказа покупателем
+// Name - имя команды
+// Client - экземпляр Telegram бота
+type OrderDetails struct {
+	Name   string
+	Client telegram.BotClient
+	DB     *pg.DB
+	Config *config.Config
+	mu     *sync.Mutex
+}
+
+func NewOrderDetailsHandler(client telegram.BotClient, db *pg.DB, cfg *config.Config) *OrderDetails {
+	return &OrderDetails{
+		Name:   "orderDetails",
+		Client: client,
+		DB:     db,
+		Config: cfg,
+		mu:     &sync.Mutex{},
+	}
+}
+
+// Run показывает состав, сумму, данные доставки и историю статусов заказа
+// update - обновление от Telegram API
+// Возвращает ошибку, если что-то пошло не так
+func (o OrderDetails) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var err error
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			o.mu.Lock()
+			ClearNextStepForUser(update, o.Client, true)
+			o.mu.Unlock()
+
+			var route callback.OrderDetails
+			err = callback.Decode(update.CallbackQuery.Data, &route)
+			if err != nil {
+				return
+			}
+
+			var order models.Order
+			order, err = models.GetOrder(o.DB, route.OrderID)
+			if err != nil && err != pg.ErrNoRows {
+				return
+			}
+
+			// Чужие заказы не показываем, как и несуществующие
+			if err == pg.ErrNoRows || order.UserID != update.CallbackQuery.From.ID {
+				o.mu.Lock()
+				_, err = o.Client.Request(tgbotapi.CallbackConfig{
+					CallbackQueryID: update.CallbackQuery.ID,
+					Text:            "Заказ не найден",
+					ShowAlert:       true,
+				})
+				o.mu.Unlock()
+				return
+			}
+
+			text := fmt.Sprintf("<b>Заказ №%d</b>\n", order.Number)
+			text += "Статус: " + order.Status.Title() + "\n"
+			text += "Оформлен: " + formatOrderTime(order.CreatedAtTS) + "\n\n"
+			text += orderItemsText(order) + "\n"
+			text += orderDeliveryText(order)
+			if link := o.Config.Delivery.TrackingURL(order.Carrier, order.TrackingNumber); link != "" {
+				text += fmt.Sprintf("<a href=\"%s\">Отследить посылку</a>\n", html.EscapeString(link))
+			}
+			text += "\n" + orderHistoryText(order)
+
+			backCallbackData := callback.MustEncode(callback.MyOrders{Page: route.Page})
+			toMainMenuCallbackData := callback.MustEncode(callback.MainMenu{})
+
+			message := tgbotapi.NewEditMessageText(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, text)
+			message.ParseMode = "HTML"
+			message.DisableWebPagePreview = true
+			message.ReplyMarkup = &tgbotapi.InlineKeyboardMarkup{
+				InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
+					{{Text: "К списку заказов", CallbackData: &backCallbackData}},
+					{{Text: "На главную", CallbackData: &toMainMenuCallbackData}},
+				},
+			}
+
+			o.mu.Lock()
+			_, err = o.Client.Send(message)
+			o.mu.Unlock()
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// GetName возвращает имя команды
+func (o OrderDetails) GetName() string {
+	return o.Name
+}
@@ -2,13 +2,15 @@ package actions
 
 import (
 	"context"
-	"main/database"
+	"errors"
+	"main/callback"
 	"main/database/models"
-	"main/filters"
-	"strconv"
+	"main/metrics"
+	"main/telegram"
 	"sync"
 	"time"
 
+	"github.com/go-pg/pg/v10"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
@@ -24,14 +26,16 @@ const (
 // Client - экземпляр Telegram бота
 type PaymentVerdict struct {
 	Name   string
-	Client tgbotapi.BotAPI
+	Client telegram.BotClient
+	DB     *pg.DB
 	mu     *sync.Mutex
 }
 
-func NewPaymentVerdictHandler(client tgbotapi.BotAPI) *PaymentVerdict {
+func NewPaymentVerdictHandler(client telegram.BotClient, db *pg.DB) *PaymentVerdict {
 	return &PaymentVerdict{
 		Name:   "paymentVerdict",
 		Client: client,
+		DB:     db,
 		mu:     &sync.Mutex{},
 	}
 }
@@ -39,8 +43,8 @@ func NewPaymentVerdictHandler(client tgbotapi.BotAPI) *PaymentVerdict {
 // Run обрабатывает результат проверки оплаты администратором
 // update - обновление от Telegram API
 // Возвращает ошибку, если что-то пошло не так
-func (p PaymentVerdict) Run(update tgbotapi.Update) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (p PaymentVerdict) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var wg sync.WaitGroup
@@ -54,98 +58,38 @@ func (p PaymentVerdict) Run(update tgbotapi.Update) error {
 			return
 		default:
 			p.mu.Lock()
-			ClearNextStepForUser(update, &p.Client, true)
+			ClearNextStepForUser(update, p.Client, true)
 			p.mu.Unlock()
 
-			data := filters.ParseCallbackData(update.CallbackQuery.Data)
-
-			var userId int64
-			userId, err = strconv.ParseInt(data["userId"], 10, 64)
+			var route callback.PaymentVerdict
+			err = callback.Decode(update.CallbackQuery.Data, &route)
 			if err != nil {
 				return
 			}
 
-			paymentAccepted := data["ok"]
-
-			if paymentAccepted == "true" {
-				message := tgbotapi.NewMessage(userId, paymentAcceptedMessageText)
-				mainMenuCallbackData := "mainMenu"
-				message.ReplyMarkup = &tgbotapi.InlineKeyboardMarkup{
-					InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
-						{{Text: "На главную", CallbackData: &mainMenuCallbackData}},
-					},
-				}
-				p.mu.Lock()
-				_, err = p.Client.Send(message)
-				p.mu.Unlock()
-				if err != nil {
-					return
-				}
-
+			err = applyPaymentVerdict(p.Client, p.DB, p.mu, route, update.CallbackQuery.From.ID)
+			if text, ok := orderActionErrorText(err); ok {
 				p.mu.Lock()
-				_, err = p.Client.Send(tgbotapi.NewEditMessageCaption(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, update.CallbackQuery.Message.Caption+"\n\nОплата принята✅"))
+				_, err = p.Client.Request(tgbotapi.CallbackConfig{
+					CallbackQueryID: update.CallbackQuery.ID,
+					Text:            text,
+					ShowAlert:       true,
+				})
 				p.mu.Unlock()
-				if err != nil {
-					return
-				}
-
-				db := database.Connect()
-				defer db.Close()
-
-				_, err = db.Model(&models.AddedProducts{}).Where("user_id = ?", userId).Delete()
-				if err != nil {
-					return
-				}
-
-				var transactionID int
-				transactionID, err = strconv.Atoi(data["tid"])
-				if err != nil {
-					return
-				}
-				err = (&models.TelegramUser{ID: userId}).DropTransaction(*db, transactionID)
-
-				return 
-			}
-
-			db := database.Connect()
-			defer db.Close()
-
-			var transactionID int
-			transactionID, err = strconv.Atoi(data["tid"])
-			if err != nil {
 				return
 			}
-			err = (&models.TelegramUser{ID: userId}).IncreaseProductAvailbleForPurchase(*db, transactionID)
 			if err != nil {
 				return
 			}
 
-			err = (&models.TelegramUser{ID: userId}).DropTransaction(*db, transactionID)
-
-			if err != nil {
-				return
+			verdict := "\n\nОплата отклонена❌"
+			if route.OK {
+				verdict = "\n\nОплата принята✅"
 			}
 
-			message := tgbotapi.NewMessage(userId, paymentRejectedMessageText)
-			mainMenuCallbackData := "mainMenu"
-			message.ReplyMarkup = &tgbotapi.InlineKeyboardMarkup{
-				InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
-					{{Text: "На главную", CallbackData: &mainMenuCallbackData}},
-				},
-			}
 			p.mu.Lock()
-			_, err = p.Client.Send(message)
+			_, err = p.Client.Send(tgbotapi.NewEditMessageCaption(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, update.CallbackQuery.Message.Caption+verdict))
 			p.mu.Unlock()
-			if err != nil {
-				return
-			}
-
-			p.mu.Lock()
-			_, err = p.Client.Send(tgbotapi.NewEditMessageCaption(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, update.CallbackQuery.Message.Caption+"\n\nОплата отклонена❌"))
-			p.mu.Unlock()
-			if err != nil {
-				return
-			}
 		}
 	}()
 
@@ -167,3 +111,86 @@ func (p PaymentVerdict) Run(update tgbotapi.Update) error {
 func (p PaymentVerdict) GetName() string {
 	return p.Name
 }
+
+// orderActionErrorText возвращает объяснение для администратора, если действие с заказом
+// не выполнено по ожидаемой причине: заказ уже обработан или товара на складе не хватает
+func orderActionErrorText(err error) (string, bool) {
+	switch {
+	case errors.Is(err, models.ErrInvalidTransition):
+		return "Заказ уже обработан", true
+	case errors.Is(err, pg.ErrNoRows):
+		return "Чек уже обработан", true
+	case errors.Is(err, models.ErrInsufficientStock):
+		return "Недостаточно товара на складе. Пополните наличие или отклоните чек", true
+	default:
+		return "", false
+	}
+}
+
+// applyPaymentVerdict применяет решение администратора actorID по оплате: меняет статус заказа,
+// удаляет корзину и сообщает покупателю. Товар списывается со склада или возвращается из резерва
+// вместе со сменой статуса заказа (см. models.TransitionOrder); по чекам без заказа товар
+// при отказе возвращается на склад вместе с удалением корзины (TelegramUser.RejectLegacyTransaction).
+// Используется и кнопками под чеком, и карточкой заказа в панели администратора.
+// Возвращает models.ErrInvalidTransition, если заказ уже обработан, pg.ErrNoRows, если чек без заказа
+// уже обработан, и models.ErrInsufficientStock, если для оплаченного заказа не хватает товара
+// (заказ остается на проверке).
+func applyPaymentVerdict(client telegram.BotClient, db *pg.DB, mu *sync.Mutex, route callback.PaymentVerdict, actorID int64) error {
+	userId := route.UserID
+
+	// Сначала меняем статус заказа: повторное нажатие на уже обработанный чек ничего не делает.
+	// У кнопок, отправленных до появления заказов, OrderID пуст: за такие чеки товар уже списан
+	// со склада, поэтому при отказе его нужно вернуть одновременно с удалением корзины
+	legacyReject := route.OrderID == 0 && !route.OK
+	if legacyReject {
+		err := (&models.TelegramUser{ID: userId}).RejectLegacyTransaction(db, route.TransactionID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if route.OrderID != 0 {
+		status, note := models.OrderStatusCancelled, "Чек отклонен администратором"
+		if route.OK {
+			status, note = models.OrderStatusPaid, ""
+		}
+
+		_, err := models.TransitionOrder(db, route.OrderID, status, actorID, note)
+		if err != nil {
+			return err
+		}
+	}
+
+	text := paymentRejectedMessageText
+	if route.OK {
+		text = paymentAcceptedMessageText
+
+		_, err := db.Model(&models.AddedProducts{}).Where("user_id = ?", userId).Delete()
+		if err != nil {
+			return err
+		}
+	}
+
+	if !legacyReject {
+		err := (&models.TelegramUser{ID: userId}).DropTransaction(db, route.TransactionID)
+		if err != nil {
+			return err
+		}
+	}
+
+	metrics.GetMetrics().RecordPayment(route.OK)
+
+	message := tgbotapi.NewMessage(userId, text)
+	mainMenuCallbackData := callback.MustEncode(callback.MainMenu{})
+	message.ReplyMarkup = &tgbotapi.InlineKeyboardMarkup{
+		InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
+			{{Text: "На главную", CallbackData: &mainMenuCallbackData}},
+		},
+	}
+
+	mu.Lock()
+	_, err := client.Send(message)
+	mu.Unlock()
+
+	return err
+}
@@ -2,30 +2,53 @@ package actions
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"main/callback"
+	"main/config"
 	"main/controllers"
-	"main/database"
 	"main/database/models"
-	"os"
-	"strconv"
+	"main/metrics"
+	"main/telegram"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/go-pg/pg/v10"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 const (
+	// cartShrankText - предупреждение покупателю, если TidyCart убрал из корзины закончившиеся товары
+	cartShrankText = "Количество некоторых товаров уменьшилось."
+	// notEnoughStockText - предупреждение покупателю, если товара не хватило при оформлении заказа
+	notEnoughStockText = "Недостаточно товара в наличии: его уже купили или зарезервировали другие покупатели."
+	// pricesChangedText - предупреждение покупателю, если цены изменились после подтверждения заказа
+	pricesChangedText = "Цены некоторых товаров изменились, пока вы оформляли заказ."
+	// checkCartText завершает предупреждения покупателю
+	checkCartText = "Проверьте корзину перед покупкой"
+	// receiptNotReservedText - ответ на чек, если к моменту его отправки товар не удалось зарезервировать
+	receiptNotReservedText = "Товара уже нет в наличии: его купили или зарезервировали другие покупатели, пока заказ ждал оплаты. Чек не отправлен на проверку, заказ отменен. Проверьте корзину и оформите заказ заново."
 	// processOrderPageText - шаблон текста для страницы оплаты заказа
-	processOrderPageText = "<b>Итог:</b> %d\n\nОплата осуществляется переводом по номеру карты или телефона:\n|_<b>Номер карты:</b> %s\n|_<b>Номер телефона:</b> %s\n|_<b>Банк:</b> %s\n\n<b>!!!После оплаты пришлите боту чек на проверку сообщением ниже!!!</b>"
+	processOrderPageText = "<b>Заказ №%d</b>\n<b>Итог:</b> %d\n\nОплата осуществляется переводом по номеру карты или телефона:\n|_<b>Номер карты:</b> %s\n|_<b>Номер телефона:</b> %s\n|_<b>Банк:</b> %s\n\n<b>!!!После оплаты пришлите боту чек на проверку сообщением ниже!!!</b>"
 )
 
+// formatReservationTTL описывает срок резерва для покупателя: «1 ч.», «30 мин.»
+func formatReservationTTL(ttl time.Duration) string {
+	if ttl >= time.Hour && ttl%time.Hour == 0 {
+		return fmt.Sprintf("%d ч.", int(ttl/time.Hour))
+	}
+
+	return fmt.Sprintf("%d мин.", int(ttl.Round(time.Minute)/time.Minute))
+}
+
 // RegisterPaymentPhoto обрабатывает фотографию чека об оплате или PDF файл
-// client - экземпляр Telegram бота
+// env - Telegram бот и пул соединений с базой
 // update - обновление от Telegram API
 // stepParams - параметры шага обработки заказа
 // Возвращает ошибку, если что-то пошло не так
-func RegisterPaymentPhoto(client tgbotapi.BotAPI, update tgbotapi.Update, stepParams map[string]any) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func RegisterPaymentPhoto(ctx context.Context, env controllers.StepEnv, update tgbotapi.Update, stepParams map[string]any) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var wg sync.WaitGroup
@@ -45,7 +68,7 @@ func RegisterPaymentPhoto(client tgbotapi.BotAPI, update tgbotapi.Update, stepPa
 
 			if !hasValidAttachment {
 				message := tgbotapi.NewMessage(update.Message.Chat.ID, "Пожалуйста, пришлите фото чека или PDF файл на проверку.")
-				toMainMenuCallbackData := "mainMenu?resetAvailablity=true"
+				toMainMenuCallbackData := callback.MustEncode(callback.MainMenu{})
 				message.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{
 					InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
 						{
@@ -54,7 +77,7 @@ func RegisterPaymentPhoto(client tgbotapi.BotAPI, update tgbotapi.Update, stepPa
 					},
 				}
 				mu.Lock()
-				_, err = client.Send(message)
+				_, err = env.Client.Send(message)
 				mu.Unlock()
 				if err != nil {
 					return
@@ -65,43 +88,75 @@ func RegisterPaymentPhoto(client tgbotapi.BotAPI, update tgbotapi.Update, stepPa
 					UserID: update.Message.From.ID,
 				}
 				stepAction := controllers.NextStepAction{
-					Func:          RegisterPaymentPhoto,
+					FuncName:      registerPaymentPhotoStep,
 					Params:        make(map[string]any),
 					CreatedAtTS:   time.Now().Unix(),
+					Timeout:       env.Config.Stock.ReservationTTL,
 					CancelMessage: "Оформление заказа прервано! Вы можете совершить покупку позже в этом же разделе.",
 				}
 
-				mu.Lock()
-				controllers.GetNextStepManager().RegisterNextStepAction(stepKey, stepAction)
-				mu.Unlock()
+				err = controllers.GetNextStepManager().RegisterNextStepAction(ctx, stepKey, stepAction)
 
 				return
 			}
 
-			adminChatID := os.Getenv("ADMIN_CHAT_ID")
-
-			db := database.Connect()
-			defer db.Close()
+			db := env.DB
 
 			user := models.TelegramUser{ID: update.Message.From.ID}
-			err = user.Get(*db)
+			err = user.Get(db)
 			if err != nil {
 				return
 			}
 
-			var totalPrice int
-			totalPrice, err = user.GetTotalCartPrice(*db)
+			var transaction models.Transaction
+			transaction, err, _ = user.GetOrCreateTransaction(db)
+			if err != nil {
+				return
+			}
+
+			var order models.Order
+			order, err = user.LastOrderWithStatus(db, models.OrderStatusAwaitingPayment)
+			if err == pg.ErrNoRows {
+				// Шаг зарегистрирован до появления заказов или резерв уже истек: собираем заказ из корзины сейчас
+				// Заказ оформляется только сейчас, поэтому и цены фиксируются сейчас: подпись администратору
+				// покажет их, даже если они изменились
+				order, _, err = user.CreateOrderFromCart(db, transaction.ID)
+				if err == nil {
+					order, err = models.ReserveOrder(db, order.ID, user.ID, env.Config.Stock.ReservationTTL)
+				}
+				if errors.Is(err, models.ErrInsufficientStock) {
+					// Заказ без резерва нельзя принять: отменяем его, как и при переходе к оплате (ProcessOrder.Run),
+					// и не отправляем чек администратору
+					_, err = models.TransitionOrder(db, order.ID, models.OrderStatusCancelled, user.ID, "Товара не хватило")
+					if err != nil {
+						return
+					}
+
+					message := tgbotapi.NewMessage(update.Message.Chat.ID, receiptNotReservedText)
+					mainMenuCallbackData := callback.MustEncode(callback.MainMenu{})
+					message.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{
+						InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
+							{{Text: "На главную", CallbackData: &mainMenuCallbackData}},
+						},
+					}
+
+					mu.Lock()
+					_, err = env.Client.Send(message)
+					mu.Unlock()
+					return
+				}
+			}
 			if err != nil {
 				return
 			}
 
-			var cartDesc string
-			cartDesc, err = user.GetCartDescription(*db)
+			// Цены в подписи - из заказа: администратор видит ту сумму, которую оплачивал покупатель
+			order, err = models.GetOrder(db, order.ID)
 			if err != nil {
 				return
 			}
 
-			cartDesc += fmt.Sprintf("\nИтоговая сумма: %d₽", totalPrice)
+			cartDesc := fmt.Sprintf("<b>Заказ №%d</b>\n", order.Number) + orderItemsText(order)
 			cartDesc += "\n<b>Дополнительная информация:</b>"
 			cartDesc += "\n|_ Адрес доставки: " + user.DeliveryAddress
 			cartDesc += "\n|_ Сервис доставки: " + user.DeliveryService
@@ -114,35 +169,33 @@ func RegisterPaymentPhoto(client tgbotapi.BotAPI, update tgbotapi.Update, stepPa
 				cartDesc += fmt.Sprintf("\n|_ Telegram: <a href='tg://user?id=%d'>%s</a>", user.ID, user.FirstName + " " + user.LastName)
 			}
 
-			var chatID int64
-			chatID, err = strconv.ParseInt(adminChatID, 10, 64)
-			if err != nil {
-				return
-			}
+			chatID := env.Config.Telegram.AdminChatID
 
 			var msg tgbotapi.Chattable
+			var receiptFileID string
 			if update.Message.Photo != nil {
-				photoMsg := tgbotapi.NewPhoto(chatID, tgbotapi.FileID(update.Message.Photo[len(update.Message.Photo)-1].FileID))
+				receiptFileID = update.Message.Photo[len(update.Message.Photo)-1].FileID
+				photoMsg := tgbotapi.NewPhoto(chatID, tgbotapi.FileID(receiptFileID))
 				photoMsg.ParseMode = "HTML"
 				photoMsg.Caption = cartDesc
 				msg = photoMsg
 			} else {
-				docMsg := tgbotapi.NewDocument(chatID, tgbotapi.FileID(update.Message.Document.FileID))
+				receiptFileID = update.Message.Document.FileID
+				docMsg := tgbotapi.NewDocument(chatID, tgbotapi.FileID(receiptFileID))
 				docMsg.ParseMode = "HTML"
 				docMsg.Caption = cartDesc
 				msg = docMsg
 			}
 
-			var transaction models.Transaction
-			transaction, err, _ = user.GetOrCreateTransaction(*db)
+			order, err = models.SubmitOrderReceipt(db, order.ID, user.ID, receiptFileID, update.Message.Photo == nil)
 			if err != nil {
 				return
 			}
 
 			db.Model(&transaction).WherePK().Set("is_waiting_for_approval = ?", true).Update()
 
-			acceptData := fmt.Sprintf("paymentVerdict?ok=true&tid=%d&userId=%d", transaction.ID, update.Message.From.ID)
-			rejectData := fmt.Sprintf("paymentVerdict?ok=false&tid=%d&userId=%d", transaction.ID, update.Message.From.ID)
+			acceptData := callback.MustEncode(callback.PaymentVerdict{OK: true, TransactionID: transaction.ID, UserID: update.Message.From.ID, OrderID: order.ID})
+			rejectData := callback.MustEncode(callback.PaymentVerdict{OK: false, TransactionID: transaction.ID, UserID: update.Message.From.ID, OrderID: order.ID})
 
 			// Создаем клавиатуру для обоих типов сообщений
 			keyboard := tgbotapi.InlineKeyboardMarkup{
@@ -164,21 +217,23 @@ func RegisterPaymentPhoto(client tgbotapi.BotAPI, update tgbotapi.Update, stepPa
 			}
 
 			mu.Lock()
-			_, err = client.Send(msg)
+			_, err = env.Client.Send(msg)
 			mu.Unlock()
 			if err != nil {
 				return
 			}
 
+			metrics.GetMetrics().RecordOrderSubmitted()
+
 			successMsg := tgbotapi.NewMessage(update.Message.Chat.ID, "Спасибо, администратор скоро проверит оплату!")
-			mainMenuCallbackData := "mainMenu"
+			mainMenuCallbackData := callback.MustEncode(callback.MainMenu{})
 			successMsg.ReplyMarkup = &tgbotapi.InlineKeyboardMarkup{
 				InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
 					{{Text: "На главную", CallbackData: &mainMenuCallbackData}},
 				},
 			}
 			mu.Lock()
-			_, err = client.Send(successMsg)
+			_, err = env.Client.Send(successMsg)
 			mu.Unlock()
 		}
 	}()
@@ -202,14 +257,18 @@ func RegisterPaymentPhoto(client tgbotapi.BotAPI, update tgbotapi.Update, stepPa
 // Client - экземпляр Telegram бота
 type ProcessOrder struct {
 	Name   string
-	Client tgbotapi.BotAPI
+	Client telegram.BotClient
+	DB     *pg.DB
+	Config *config.Config
 	mu     *sync.Mutex
 }
 
-func NewProcessOrderHandler(client tgbotapi.BotAPI) *ProcessOrder {
+func NewProcessOrderHandler(client telegram.BotClient, db *pg.DB, cfg *config.Config) *ProcessOrder {
 	return &ProcessOrder{
 		Name:   "processOrder",
 		Client: client,
+		DB:     db,
+		Config: cfg,
 		mu:     &sync.Mutex{},
 	}
 }
@@ -217,8 +276,8 @@ func NewProcessOrderHandler(client tgbotapi.BotAPI) *ProcessOrder {
 // Run запускает процесс обработки заказа
 // update - обновление от Telegram API
 // Возвращает ошибку, если что-то пошло не так
-func (p ProcessOrder) Run(update tgbotapi.Update) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (p ProcessOrder) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var wg sync.WaitGroup
@@ -232,48 +291,37 @@ func (p ProcessOrder) Run(update tgbotapi.Update) error {
 			return
 		default:
 			p.mu.Lock()
-			ClearNextStepForUser(update, &p.Client, true)
+			ClearNextStepForUser(update, p.Client, true)
 			p.mu.Unlock()
 
-			db := database.Connect()
-			defer db.Close()
+			db := p.DB
 
 			user := models.TelegramUser{ID: update.CallbackQuery.From.ID}
-			err = user.Get(*db)
+			err = user.Get(db)
 			if err != nil {
 				return
 			}
 
 			var cartChanged bool
-			cartChanged, err = user.TidyCart(*db)
+			cartChanged, err = user.TidyCart(db)
 			if err != nil {
 				return
 			}
 
+			// На callback можно ответить только один раз, поэтому предупреждения собираются в одно
+			var alerts []string
 			if cartChanged {
-				_, err := p.Client.Request(tgbotapi.CallbackConfig{
-					CallbackQueryID: update.CallbackQuery.ID,
-					Text:            "Количество некторых товаров уменьшилось. Проверьте корзину перед покупкой",
-					ShowAlert:       true,
-				})
-				if err != nil {
-					return
-				}
+				alerts = append(alerts, cartShrankText)
 			}
 
 			var transaction models.Transaction
-			transaction, err, _ = user.GetOrCreateTransaction(*db)
-			if err != nil {
-				return
-			}
-
-			err = user.DecreaseProductAvailbleForPurchase(*db, transaction.ID)
+			transaction, err, _ = user.GetOrCreateTransaction(db)
 			if err != nil {
 				return
 			}
 
 			var totalPrice int
-			totalPrice, err = user.GetTotalCartPrice(*db)
+			totalPrice, err = user.GetTotalCartPrice(db)
 			if err != nil {
 				return
 			}
@@ -287,14 +335,52 @@ func (p ProcessOrder) Run(update tgbotapi.Update) error {
 				p.mu.Lock()
 				_, err = p.Client.Send(msg)
 				p.mu.Unlock()
+				if err != nil {
+					return
+				}
 
+				err = p.answer(update, alerts)
 				return
 			}
 
-			pageText := fmt.Sprintf(processOrderPageText, totalPrice, os.Getenv("PAYMENT_CARD_NUMBER"), os.Getenv("PAYMENT_PHONE_NUMBER"), os.Getenv("PAYMENT_BANK"))
+			var order models.Order
+			var priceChanges []models.CartPriceChange
+			order, priceChanges, err = user.CreateOrderFromCart(db, transaction.ID)
+			if err != nil {
+				return
+			}
+
+			if len(priceChanges) > 0 {
+				// Покупатель подтвердил заказ по старым ценам: заказ с новыми он должен увидеть до оплаты
+				_, err = models.TransitionOrder(db, order.ID, models.OrderStatusCancelled, user.ID, "Цены изменились")
+				if err != nil {
+					return
+				}
+
+				err = p.answer(update, append(alerts, pricesChangedText))
+				return
+			}
+
+			order, err = models.ReserveOrder(db, order.ID, user.ID, p.Config.Stock.ReservationTTL)
+			if errors.Is(err, models.ErrInsufficientStock) {
+				// Товар успели купить или зарезервировать другие покупатели после проверки корзины
+				_, err = models.TransitionOrder(db, order.ID, models.OrderStatusCancelled, user.ID, "Товара не хватило")
+				if err != nil {
+					return
+				}
+
+				err = p.answer(update, append(alerts, notEnoughStockText))
+				return
+			}
+			if err != nil {
+				return
+			}
+
+			pageText := fmt.Sprintf(processOrderPageText, order.Number, order.TotalPrice, p.Config.Payment.CardNumber, p.Config.Payment.PhoneNumber, p.Config.Payment.Bank)
+			pageText += fmt.Sprintf("\n\nТовары зарезервированы на %s.", formatReservationTTL(p.Config.Stock.ReservationTTL))
 
 			msg := tgbotapi.NewEditMessageText(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, pageText)
-			toMainMenuCallbackData := "mainMenu?resetAvailablity=true"
+			toMainMenuCallbackData := callback.MustEncode(callback.MainMenu{})
 			msg.ReplyMarkup = &tgbotapi.InlineKeyboardMarkup{
 				InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
 					{
@@ -311,20 +397,24 @@ func (p ProcessOrder) Run(update tgbotapi.Update) error {
 				return
 			}
 
+			err = p.answer(update, alerts)
+			if err != nil {
+				return
+			}
+
 			stepKey := controllers.NextStepKey{
 				ChatID: update.CallbackQuery.Message.Chat.ID,
 				UserID: update.CallbackQuery.From.ID,
 			}
 			stepAction := controllers.NextStepAction{
-				Func:          RegisterPaymentPhoto,
+				FuncName:      registerPaymentPhotoStep,
 				Params:        make(map[string]any),
 				CreatedAtTS:   time.Now().Unix(),
+				Timeout:       p.Config.Stock.ReservationTTL,
 				CancelMessage: "Оформление заказа прервано! Вы можете совершить покупку позже в этом же разделе.",
 			}
 
-			p.mu.Lock()
-			controllers.GetNextStepManager().RegisterNextStepAction(stepKey, stepAction)
-			p.mu.Unlock()
+			err = controllers.GetNextStepManager().RegisterNextStepAction(ctx, stepKey, stepAction)
 		}
 	}()
 
@@ -342,6 +432,24 @@ func (p ProcessOrder) Run(update tgbotapi.Update) error {
 	}
 }
 
+// answer показывает покупателю предупреждения alerts одним всплывающим сообщением; без предупреждений ничего не делает
+func (p ProcessOrder) answer(update tgbotapi.Update, alerts []string) error {
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err := p.Client.Request(tgbotapi.CallbackConfig{
+		CallbackQueryID: update.CallbackQuery.ID,
+		Text:            strings.Join(append(alerts, checkCartText), " "),
+		ShowAlert:       true,
+	})
+
+	return err
+}
+
 // GetName возвращает имя команды
 func (p ProcessOrder) GetName() string {
 	return p.Name
@@ -1,14 +1,16 @@
 package actions
 
 import (
+	"context"
 	"fmt"
+	"main/callback"
 	"main/controllers"
-	"main/database"
 	"main/database/models"
+	"main/telegram"
 	"regexp"
-	"strconv"
 	"time"
 
+	"github.com/go-pg/pg/v10"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
@@ -17,27 +19,32 @@ import (
 // Client - экземпляр Telegram бота.
 type ProfileSettings struct {
 	Name   string
-	Client tgbotapi.BotAPI
+	Client telegram.BotClient
 }
 
 // Run отображает меню настроек профиля.
 // update - обновление от Telegram API.
 // Возвращает ошибку, если отправка сообщения не удалась.
-func (p ProfileSettings) Run(update tgbotapi.Update) error {
+func (p ProfileSettings) Run(ctx context.Context, update tgbotapi.Update) error {
+	ClearNextStepForUser(update, p.Client, true)
+
 	const text = "<b>Настройки профиля</b>\nВыберите опцию:"
 
 	message := tgbotapi.NewEditMessageText(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, text)
 	message.ParseMode = "HTML"
 
-	data := ParseCallData(update.CallbackQuery.Data)
-	showBackButton := data["showBackButton"] == "true"
+	var route callback.ProfileSettings
+	if err := callback.Decode(update.CallbackQuery.Data, &route); err != nil {
+		return err
+	}
+	showBackButton := route.ShowBackButton
 
-	changeNameCallbackData := "changeName?showBackButton=" + strconv.FormatBool(showBackButton)
-	changePhoneCallbackData := "changePhone?showBackButton=" + strconv.FormatBool(showBackButton)
-	changeDeliveryAddressCallbackData := "changeDeliveryAddress?showBackButton=" + strconv.FormatBool(showBackButton)
-	changeDeliveryServiceCallbackData := "changeDeliveryService?showBackButton=" + strconv.FormatBool(showBackButton)
-	toMainMenuCallbackData := "mainMenu"
-	processOrderCallbackData := "makeOrder"
+	changeNameCallbackData := callback.MustEncode(callback.ChangeName{ShowBackButton: showBackButton})
+	changePhoneCallbackData := callback.MustEncode(callback.ChangePhone{ShowBackButton: showBackButton})
+	changeDeliveryAddressCallbackData := callback.MustEncode(callback.ChangeDeliveryAddress{ShowBackButton: showBackButton})
+	changeDeliveryServiceCallbackData := callback.MustEncode(callback.ChangeDeliveryService{ShowBackButton: showBackButton})
+	toMainMenuCallbackData := callback.MustEncode(callback.MainMenu{})
+	processOrderCallbackData := callback.MustEncode(callback.MakeOrder{})
 
 	keyboard := [][]tgbotapi.InlineKeyboardButton{
 		{{Text: "Изменить ФИО", CallbackData: &changeNameCallbackData}},
@@ -71,34 +78,37 @@ func (p ProfileSettings) GetName() string {
 // Client - экземпляр Telegram бота.
 type ChangeName struct {
 	Name   string
-	Client tgbotapi.BotAPI
+	Client telegram.BotClient
+	DB     *pg.DB
 }
 
 // Run инициирует процесс изменения ФИО.
 // update - обновление от Telegram API.
 // Возвращает ошибку, если отправка сообщения не удалась.
-func (c ChangeName) Run(update tgbotapi.Update) error {
+func (c ChangeName) Run(ctx context.Context, update tgbotapi.Update) error {
 	c.Client.Send(tgbotapi.NewDeleteMessage(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID))
 	const text = "Ваше ФИО сейчас:\n<b>%s</b>\n\n<i>Введите новое ФИО:</i>"
 
 	message := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, "")
 	message.ParseMode = "HTML"
 
-	db := database.Connect()
-	defer db.Close()
+	db := c.DB
 
 	user := models.TelegramUser{ID: update.CallbackQuery.Message.Chat.ID}
-	err := user.GetOrCreate(update.CallbackQuery.Message.From, *db)
+	err := user.GetOrCreate(update.CallbackQuery.Message.From, db)
 	if err != nil {
 		return err
 	}
 
 	message.Text = fmt.Sprintf(text, user.FIO)
 
-	data := ParseCallData(update.CallbackQuery.Data)
-	showBackButton := data["showBackButton"] == "true"
+	var route callback.ChangeName
+	if err := callback.Decode(update.CallbackQuery.Data, &route); err != nil {
+		return err
+	}
+	showBackButton := route.ShowBackButton
 
-	toSettingsCallbackData := "profileSettings?showBackButton=" + strconv.FormatBool(showBackButton)
+	toSettingsCallbackData := callback.MustEncode(callback.ProfileSettings{ShowBackButton: showBackButton})
 	message.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{
 		InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
 			{{Text: "Отмена", CallbackData: &toSettingsCallbackData}},
@@ -117,86 +127,94 @@ func (c ChangeName) Run(update tgbotapi.Update) error {
 		UserID: update.CallbackQuery.From.ID,
 	}
 	stepAction := controllers.NextStepAction{
-		Func: func(client tgbotapi.BotAPI, stepUpdate tgbotapi.Update, stepParams map[string]any) error {
-			db := database.Connect()
-			defer db.Close()
+		FuncName:    changeUserNameStep,
+		Params:      map[string]any{"showBackButton": showBackButton},
+		CreatedAtTS: time.Now().Unix(),
+	}
+	return stepManager.RegisterNextStepAction(ctx, stepKey, stepAction)
+}
 
-			user := models.TelegramUser{ID: stepUpdate.Message.From.ID}
-			err := user.GetOrCreate(stepUpdate.Message.From, *db)
-			if err != nil {
-				return err
-			}
+func (c ChangeName) GetName() string {
+	return c.Name
+}
 
-			user.FIO = stepUpdate.Message.Text
+// changeUserName сохраняет новое ФИО пользователя.
+// env - Telegram бот и пул соединений с базой.
+// stepUpdate - обновление от Telegram API.
+// stepParams - параметры шага, содержащие showBackButton.
+func changeUserName(ctx context.Context, env controllers.StepEnv, stepUpdate tgbotapi.Update, stepParams map[string]any) error {
+	showBackButton, _ := stepParams["showBackButton"].(bool)
 
-			_, err = db.Model(&user).WherePK().Column("fio").Update()
-			if err != nil {
-				return err
-			}
+	db := env.DB
 
-			message := tgbotapi.NewMessage(stepUpdate.Message.Chat.ID, "<b>ФИО успешно изменено</b>✅")
-			message.ParseMode = "HTML"
+	user := models.TelegramUser{ID: stepUpdate.Message.From.ID}
+	err := user.GetOrCreate(stepUpdate.Message.From, db)
+	if err != nil {
+		return err
+	}
 
-			toSettingsCallbackData := "profileSettings?showBackButton=" + strconv.FormatBool(showBackButton)
-			toMainMenuCallbackData := "mainMenu"
+	user.FIO = stepUpdate.Message.Text
 
-			keyboard := [][]tgbotapi.InlineKeyboardButton{
-				{{Text: "⚙️Настройки", CallbackData: &toSettingsCallbackData}},
-			}
+	_, err = db.Model(&user).WherePK().Column("fio").Update()
+	if err != nil {
+		return err
+	}
 
-			if !showBackButton {
-				keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: "На главную", CallbackData: &toMainMenuCallbackData}})
-			} else {
-				keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: "К оформлению заказа", CallbackData: &processOrderCallbackData}})
-			}
+	message := tgbotapi.NewMessage(stepUpdate.Message.Chat.ID, "<b>ФИО успешно изменено</b>✅")
+	message.ParseMode = "HTML"
 
-			message.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{
-				InlineKeyboard: keyboard,
-			}
+	toSettingsCallbackData := callback.MustEncode(callback.ProfileSettings{ShowBackButton: showBackButton})
+	toMainMenuCallbackData := callback.MustEncode(callback.MainMenu{})
 
-			_, err = client.Send(message)
+	keyboard := [][]tgbotapi.InlineKeyboardButton{
+		{{Text: "⚙️Настройки", CallbackData: &toSettingsCallbackData}},
+	}
 
-			return err
-		},
-		Params:      map[string]any{},
-		CreatedAtTS: time.Now().Unix(),
+	if !showBackButton {
+		keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: "На главную", CallbackData: &toMainMenuCallbackData}})
+	} else {
+		keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: "К оформлению заказа", CallbackData: &processOrderCallbackData}})
 	}
-	stepManager.RegisterNextStepAction(stepKey, stepAction)
 
-	return nil
-}
+	message.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{
+		InlineKeyboard: keyboard,
+	}
 
-func (c ChangeName) GetName() string {
-	return c.Name
+	_, err = env.Client.Send(message)
+
+	return err
 }
 
 type ChangePhone struct {
 	Name   string
-	Client tgbotapi.BotAPI
+	Client telegram.BotClient
+	DB     *pg.DB
 }
 
-func (c ChangePhone) Run(update tgbotapi.Update) error {
+func (c ChangePhone) Run(ctx context.Context, update tgbotapi.Update) error {
 	c.Client.Send(tgbotapi.NewDeleteMessage(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID))
 	const text = "Ваш номер телефона сейчас:\n<b>%v(%v)%v-%v</b>\n\n<i>Введите новый номер телефона:</i>"
 
 	message := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, "")
 	message.ParseMode = "HTML"
 
-	db := database.Connect()
-	defer db.Close()
+	db := c.DB
 
 	user := models.TelegramUser{ID: update.CallbackQuery.Message.Chat.ID}
-	err := user.GetOrCreate(update.CallbackQuery.From, *db)
+	err := user.GetOrCreate(update.CallbackQuery.From, db)
 	if err != nil {
 		return err
 	}
 
 	message.Text = fmt.Sprintf(text, user.Phone[0:1], user.Phone[1:4], user.Phone[4:7], user.Phone[7:])
 
-	data := ParseCallData(update.CallbackQuery.Data)
-	showBackButton := data["showBackButton"] == "true"
+	var route callback.ChangePhone
+	if err := callback.Decode(update.CallbackQuery.Data, &route); err != nil {
+		return err
+	}
+	showBackButton := route.ShowBackButton
 
-	toSettingsCallbackData := "profileSettings?showBackButton=" + strconv.FormatBool(showBackButton)
+	toSettingsCallbackData := callback.MustEncode(callback.ProfileSettings{ShowBackButton: showBackButton})
 	message.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{
 		InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
 			{{Text: "Отмена", CallbackData: &toSettingsCallbackData}},
@@ -215,93 +233,98 @@ func (c ChangePhone) Run(update tgbotapi.Update) error {
 		UserID: update.CallbackQuery.From.ID,
 	}
 	stepAction := controllers.NextStepAction{
-		Func: func(client tgbotapi.BotAPI, stepUpdate tgbotapi.Update, stepParams map[string]any) error {
-			db := database.Connect()
-			defer db.Close()
-
-			regex := regexp.MustCompile(`^[0-9]{11}$`)
-			if !regex.MatchString(stepUpdate.Message.Text) {
-				message := tgbotapi.NewMessage(stepUpdate.Message.Chat.ID, "Введите номер телефона в формате 89991234567")
-
-				tryAgainCallbackData := "changePhone?showBackButton=" + strconv.FormatBool(showBackButton)
-				message.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{
-					InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
-						{{Text: "Попробовать снова", CallbackData: &tryAgainCallbackData}},
-						{{Text: "Отмена", CallbackData: &toSettingsCallbackData}},
-					},
-				}
+		FuncName:    changeUserPhoneStep,
+		Params:      map[string]any{"showBackButton": showBackButton},
+		CreatedAtTS: time.Now().Unix(),
+	}
+	return stepManager.RegisterNextStepAction(ctx, stepKey, stepAction)
+}
 
-				_, err := client.Send(message)
+func (c ChangePhone) GetName() string {
+	return c.Name
+}
 
-				return err
-			}
+// changeUserPhone проверяет и сохраняет новый номер телефона пользователя.
+// env - Telegram бот и пул соединений с базой.
+// stepUpdate - обновление от Telegram API.
+// stepParams - параметры шага, содержащие showBackButton.
+func changeUserPhone(ctx context.Context, env controllers.StepEnv, stepUpdate tgbotapi.Update, stepParams map[string]any) error {
+	showBackButton, _ := stepParams["showBackButton"].(bool)
+	toSettingsCallbackData := callback.MustEncode(callback.ProfileSettings{ShowBackButton: showBackButton})
+
+	db := env.DB
+
+	regex := regexp.MustCompile(`^[0-9]{11}$`)
+	if !regex.MatchString(stepUpdate.Message.Text) {
+		message := tgbotapi.NewMessage(stepUpdate.Message.Chat.ID, "Введите номер телефона в формате 89991234567")
+
+		tryAgainCallbackData := callback.MustEncode(callback.ChangePhone{ShowBackButton: showBackButton})
+		message.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{
+			InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
+				{{Text: "Попробовать снова", CallbackData: &tryAgainCallbackData}},
+				{{Text: "Отмена", CallbackData: &toSettingsCallbackData}},
+			},
+		}
 
-			user := models.TelegramUser{ID: stepUpdate.Message.From.ID}
-			err := user.GetOrCreate(stepUpdate.Message.From, *db)
-			if err != nil {
-				return err
-			}
+		_, err := env.Client.Send(message)
 
-			user.Phone = stepUpdate.Message.Text
+		return err
+	}
 
-			_, err = db.Model(&user).WherePK().Column("phone").Update()
-			if err != nil {
-				return err
-			}
+	user := models.TelegramUser{ID: stepUpdate.Message.From.ID}
+	err := user.GetOrCreate(stepUpdate.Message.From, db)
+	if err != nil {
+		return err
+	}
 
-			message := tgbotapi.NewMessage(stepUpdate.Message.Chat.ID, "<b>Номер телефона успешно изменен</b>✅")
-			message.ParseMode = "HTML"
+	user.Phone = stepUpdate.Message.Text
 
-			toSettingsCallbackData := "profileSettings?showBackButton=" + strconv.FormatBool(showBackButton)
-			toMainMenuCallbackData := "mainMenu"
+	_, err = db.Model(&user).WherePK().Column("phone").Update()
+	if err != nil {
+		return err
+	}
 
-			keyboard := [][]tgbotapi.InlineKeyboardButton{
-				{{Text: "⚙️Настройки", CallbackData: &toSettingsCallbackData}},
-			}
+	message := tgbotapi.NewMessage(stepUpdate.Message.Chat.ID, "<b>Номер телефона успешно изменен</b>✅")
+	message.ParseMode = "HTML"
 
-			if !showBackButton {
-				keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: "На главную", CallbackData: &toMainMenuCallbackData}})
-			} else {
-				keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: "К оформлению заказа", CallbackData: &processOrderCallbackData}})
-			}
+	toMainMenuCallbackData := callback.MustEncode(callback.MainMenu{})
 
-			message.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{
-				InlineKeyboard: keyboard,
-			}
+	keyboard := [][]tgbotapi.InlineKeyboardButton{
+		{{Text: "⚙️Настройки", CallbackData: &toSettingsCallbackData}},
+	}
 
-			_, err = client.Send(message)
+	if !showBackButton {
+		keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: "На главную", CallbackData: &toMainMenuCallbackData}})
+	} else {
+		keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: "К оформлению заказа", CallbackData: &processOrderCallbackData}})
+	}
 
-			return err
-		},
-		Params:      map[string]any{},
-		CreatedAtTS: time.Now().Unix(),
+	message.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{
+		InlineKeyboard: keyboard,
 	}
-	stepManager.RegisterNextStepAction(stepKey, stepAction)
 
-	return nil
-}
+	_, err = env.Client.Send(message)
 
-func (c ChangePhone) GetName() string {
-	return c.Name
+	return err
 }
 
 type ChangeDeliveryAddress struct {
 	Name   string
-	Client tgbotapi.BotAPI
+	Client telegram.BotClient
+	DB     *pg.DB
 }
 
-func (c ChangeDeliveryAddress) Run(update tgbotapi.Update) error {
+func (c ChangeDeliveryAddress) Run(ctx context.Context, update tgbotapi.Update) error {
 	c.Client.Send(tgbotapi.NewDeleteMessage(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID))
 	const text = "Ваш адрес доставки сейчас:\n<b>%s</b>\n\n<i>Введите новый адрес пвз для сервиса %s (не забудьте указать город)</i>"
 
 	message := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, "")
 	message.ParseMode = "HTML"
 
-	db := database.Connect()
-	defer db.Close()
+	db := c.DB
 
 	user := models.TelegramUser{ID: update.CallbackQuery.Message.Chat.ID}
-	err := user.GetOrCreate(update.CallbackQuery.From, *db)
+	err := user.GetOrCreate(update.CallbackQuery.From, db)
 	if err != nil {
 		return err
 	}
@@ -316,10 +339,13 @@ func (c ChangeDeliveryAddress) Run(update tgbotapi.Update) error {
 
 	message.Text = fmt.Sprintf(text, user.DeliveryAddress, devServiceName)
 
-	data := ParseCallData(update.CallbackQuery.Data)
-	showBackButton := data["showBackButton"] == "true"
+	var route callback.ChangeDeliveryAddress
+	if err := callback.Decode(update.CallbackQuery.Data, &route); err != nil {
+		return err
+	}
+	showBackButton := route.ShowBackButton
 
-	toSettingsCallbackData := "profileSettings?showBackButton=" + strconv.FormatBool(showBackButton)
+	toSettingsCallbackData := callback.MustEncode(callback.ProfileSettings{ShowBackButton: showBackButton})
 	message.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{
 		InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
 			{{Text: "Отмена", CallbackData: &toSettingsCallbackData}},
@@ -338,61 +364,67 @@ func (c ChangeDeliveryAddress) Run(update tgbotapi.Update) error {
 		UserID: update.CallbackQuery.From.ID,
 	}
 	stepAction := controllers.NextStepAction{
-		Func: func(client tgbotapi.BotAPI, stepUpdate tgbotapi.Update, stepParams map[string]any) error {
-			db := database.Connect()
-			defer db.Close()
+		FuncName:    changeUserDeliveryAddressStep,
+		Params:      map[string]any{"showBackButton": showBackButton},
+		CreatedAtTS: time.Now().Unix(),
+	}
+	return stepManager.RegisterNextStepAction(ctx, stepKey, stepAction)
+}
+
+func (c ChangeDeliveryAddress) GetName() string {
+	return c.Name
+}
 
-			user := models.TelegramUser{ID: stepUpdate.Message.From.ID}
-			err := user.GetOrCreate(stepUpdate.Message.From, *db)
-			if err != nil {
-				return err
-			}
+// changeUserDeliveryAddress сохраняет новый адрес доставки пользователя.
+// env - Telegram бот и пул соединений с базой.
+// stepUpdate - обновление от Telegram API.
+// stepParams - параметры шага, содержащие showBackButton.
+func changeUserDeliveryAddress(ctx context.Context, env controllers.StepEnv, stepUpdate tgbotapi.Update, stepParams map[string]any) error {
+	showBackButton, _ := stepParams["showBackButton"].(bool)
 
-			user.DeliveryAddress = stepUpdate.Message.Text
+	db := env.DB
 
-			_, err = db.Model(&user).WherePK().Column("delivery_address").Update()
-			if err != nil {
-				return err
-			}
+	user := models.TelegramUser{ID: stepUpdate.Message.From.ID}
+	err := user.GetOrCreate(stepUpdate.Message.From, db)
+	if err != nil {
+		return err
+	}
 
-			message := tgbotapi.NewMessage(stepUpdate.Message.Chat.ID, "<b>Адрес доставки успешно изменен</b>✅")
-			message.ParseMode = "HTML"
+	user.DeliveryAddress = stepUpdate.Message.Text
 
-			toSettingsCallbackData := "profileSettings?showBackButton=" + strconv.FormatBool(showBackButton)
-			toMainMenuCallbackData := "mainMenu"
+	_, err = db.Model(&user).WherePK().Column("delivery_address").Update()
+	if err != nil {
+		return err
+	}
 
-			keyboard := [][]tgbotapi.InlineKeyboardButton{
-				{{Text: "⚙️Настройки", CallbackData: &toSettingsCallbackData}},
-			}
+	message := tgbotapi.NewMessage(stepUpdate.Message.Chat.ID, "<b>Адрес доставки успешно изменен</b>✅")
+	message.ParseMode = "HTML"
 
-			if !showBackButton {
-				keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: "На главную", CallbackData: &toMainMenuCallbackData}})
-			} else {
-				keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: "К оформлению заказа", CallbackData: &processOrderCallbackData}})
-			}
+	toSettingsCallbackData := callback.MustEncode(callback.ProfileSettings{ShowBackButton: showBackButton})
+	toMainMenuCallbackData := callback.MustEncode(callback.MainMenu{})
 
-			message.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{
-				InlineKeyboard: keyboard,
-			}
-			_, err = client.Send(message)
+	keyboard := [][]tgbotapi.InlineKeyboardButton{
+		{{Text: "⚙️Настройки", CallbackData: &toSettingsCallbackData}},
+	}
 
-			return err
-		},
-		Params:      map[string]any{},
-		CreatedAtTS: time.Now().Unix(),
+	if !showBackButton {
+		keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: "На главную", CallbackData: &toMainMenuCallbackData}})
+	} else {
+		keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: "К оформлению заказа", CallbackData: &processOrderCallbackData}})
 	}
-	stepManager.RegisterNextStepAction(stepKey, stepAction)
 
-	return nil
-}
+	message.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{
+		InlineKeyboard: keyboard,
+	}
+	_, err = env.Client.Send(message)
 
-func (c ChangeDeliveryAddress) GetName() string {
-	return c.Name
+	return err
 }
 
 type ChangeDeliveryService struct {
 	Name   string
-	Client tgbotapi.BotAPI
+	Client telegram.BotClient
+	DB     *pg.DB
 }
 
 func (c ChangeDeliveryService) GetKeyboard(userDb models.TelegramUser, showBackButton bool) [][]tgbotapi.InlineKeyboardButton {
@@ -406,7 +438,7 @@ func (c ChangeDeliveryService) GetKeyboard(userDb models.TelegramUser, showBackB
 			cfg.Text += " ✅"
 		}
 
-		callQuery := fmt.Sprintf("changeDeliveryService?service=%s&showBackButton=%t", cfg.Setting, showBackButton)
+		callQuery := callback.MustEncode(callback.ChangeDeliveryService{Service: cfg.Setting, ShowBackButton: showBackButton})
 
 		return tgbotapi.InlineKeyboardButton{
 			Text:         cfg.Text,
@@ -428,23 +460,37 @@ func (c ChangeDeliveryService) GetKeyboard(userDb models.TelegramUser, showBackB
 	return keyboard
 }
 
-func (c ChangeDeliveryService) Run(update tgbotapi.Update) error {
-	ClearNextStepForUser(update, &c.Client, true)
+func (c ChangeDeliveryService) Run(ctx context.Context, update tgbotapi.Update) error {
+	ClearNextStepForUser(update, c.Client, true)
 
 	const text = "Ваш сервис доставки сейчас:\n<b>%s</b>\n\n<i>Выберите новый сервис доставки:</i>"
 
 	message := tgbotapi.NewEditMessageText(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, "")
 	message.ParseMode = "HTML"
 
-	db := database.Connect()
-	defer db.Close()
+	db := c.DB
 
 	user := models.TelegramUser{ID: update.CallbackQuery.From.ID}
-	err := user.GetOrCreate(update.CallbackQuery.From, *db)
+	err := user.GetOrCreate(update.CallbackQuery.From, db)
+	if err != nil {
+		return err
+	}
+
+	var route callback.ChangeDeliveryService
+	err = callback.Decode(update.CallbackQuery.Data, &route)
 	if err != nil {
 		return err
 	}
 
+	if service := route.Service; (service == "cdek" || service == "yandex") && service != user.DeliveryService {
+		user.DeliveryService = service
+
+		_, err = db.Model(&user).WherePK().Column("delivery_service").Update()
+		if err != nil {
+			return err
+		}
+	}
+
 	devServiceName := ""
 	switch user.DeliveryService {
 	case "cdek":
@@ -455,10 +501,9 @@ func (c ChangeDeliveryService) Run(update tgbotapi.Update) error {
 
 	message.Text = fmt.Sprintf(text, devServiceName)
 
-	data := ParseCallData(update.CallbackQuery.Data)
-	showBackButton := data["showBackButton"] == "true"
+	showBackButton := route.ShowBackButton
 
-	toSettingsCallbackData := "profileSettings?showBackButton=" + strconv.FormatBool(showBackButton)
+	toSettingsCallbackData := callback.MustEncode(callback.ProfileSettings{ShowBackButton: showBackButton})
 	message.ReplyMarkup = &tgbotapi.InlineKeyboardMarkup{
 		InlineKeyboard: append(c.GetKeyboard(user, showBackButton), []tgbotapi.InlineKeyboardButton{{Text: "⚙️Настройки", CallbackData: &toSettingsCallbackData}}),
 	}
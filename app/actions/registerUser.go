@@ -3,13 +3,15 @@ package actions
 import (
 	"context"
 	"fmt"
+	"main/callback"
 	"main/controllers"
-	"main/database"
 	"main/database/models"
+	"main/telegram"
 	"regexp"
 	"sync"
 	"time"
 
+	"github.com/go-pg/pg/v10"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
@@ -18,11 +20,11 @@ import (
 // Client - экземпляр Telegram бота
 type RegisterUser struct {
 	Name   string
-	Client tgbotapi.BotAPI
+	Client telegram.BotClient
 	mu     *sync.Mutex
 }
 
-func NewRegisterUserHandler(client tgbotapi.BotAPI) *RegisterUser {
+func NewRegisterUserHandler(client telegram.BotClient) *RegisterUser {
 	return &RegisterUser{
 		Name:   "registerUser",
 		Client: client,
@@ -31,13 +33,13 @@ func NewRegisterUserHandler(client tgbotapi.BotAPI) *RegisterUser {
 }
 
 // RegistrationCompleted завершает процесс регистрации пользователя
-// client - экземпляр Telegram бота
+// env - Telegram бот и пул соединений с базой
 // update - обновление от Telegram API
 // stepParams - параметры шага регистрации
 // Возвращает ошибку, если что-то пошло не так
-func RegistrationCompleted(client tgbotapi.BotAPI, update tgbotapi.Update, stepParams map[string]any) error {
+func RegistrationCompleted(ctx context.Context, env controllers.StepEnv, update tgbotapi.Update, stepParams map[string]any) error {
 	fmt.Println(1)
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var wg sync.WaitGroup
@@ -51,11 +53,10 @@ func RegistrationCompleted(client tgbotapi.BotAPI, update tgbotapi.Update, stepP
 		case <-ctx.Done():
 			return
 		default:
-			db := database.Connect()
-			defer db.Close()
+			db := env.DB
 
 			user := models.TelegramUser{ID: update.Message.From.ID}
-			_ = user.GetOrCreate(update.Message.From, *db)
+			_ = user.GetOrCreate(update.Message.From, db)
 
 			_, err = db.Model(&user).
 				WherePK().
@@ -68,7 +69,7 @@ func RegistrationCompleted(client tgbotapi.BotAPI, update tgbotapi.Update, stepP
 
 			message := tgbotapi.NewMessage(update.Message.Chat.ID, "Вы успешно зарегистрированы! Нажмите «Главное меню» чтобы продолжить.")
 
-			callbackData := "mainMenu"
+			callbackData := callback.MustEncode(callback.MainMenu{})
 			message.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{
 				InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
 					{{Text: "Главное меню", CallbackData: &callbackData}},
@@ -76,7 +77,7 @@ func RegistrationCompleted(client tgbotapi.BotAPI, update tgbotapi.Update, stepP
 			}
 
 			mu.Lock()
-			_, err = client.Send(message)
+			_, err = env.Client.Send(message)
 			mu.Unlock()
 			if err != nil {
 				return
@@ -100,14 +101,16 @@ func RegistrationCompleted(client tgbotapi.BotAPI, update tgbotapi.Update, stepP
 
 type GetPVZ struct {
 	Name string
-	Client tgbotapi.BotAPI
+	Client telegram.BotClient
+	DB *pg.DB
 	mu *sync.Mutex
 }
 
-func NewGetPVZHandler(client tgbotapi.BotAPI) *GetPVZ {
+func NewGetPVZHandler(client telegram.BotClient, db *pg.DB) *GetPVZ {
 	return &GetPVZ{
 		Name: "getPVZ",
 		Client: client,
+		DB: db,
 		mu: &sync.Mutex{},
 	}
 }
@@ -117,8 +120,8 @@ func NewGetPVZHandler(client tgbotapi.BotAPI) *GetPVZ {
 // update - обновление от Telegram API
 // stepParams - параметры шага регистрации
 // Возвращает ошибку, если что-то пошло не так
-func (g GetPVZ) Run(update tgbotapi.Update) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (g GetPVZ) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
     defer cancel()
 
     var wg sync.WaitGroup
@@ -132,8 +135,12 @@ func (g GetPVZ) Run(update tgbotapi.Update) error {
         case <-ctx.Done():
             return
         default:
-			data := ParseCallData(update.CallbackQuery.Data)
-			service := data["service"]
+			var route callback.SelectDeliveryService
+			err = callback.Decode(update.CallbackQuery.Data, &route)
+			if err != nil {
+				return
+			}
+			service := route.Service
 
 			servisePVZName := ""
 			switch service {
@@ -143,8 +150,7 @@ func (g GetPVZ) Run(update tgbotapi.Update) error {
 				servisePVZName = "Яндекс доставки"
 			}
 
-			db := database.Connect()
-			defer db.Close()
+			db := g.DB
 		
 			message := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, fmt.Sprintf("Введите адрес пвз для сервиса %s (не забудьте указать город) ", servisePVZName))
 			mu.Lock()
@@ -155,7 +161,7 @@ func (g GetPVZ) Run(update tgbotapi.Update) error {
 			}
 		
 			user := models.TelegramUser{ID: update.CallbackQuery.From.ID}
-			err = user.GetOrCreate(update.CallbackQuery.From, *db)
+			err = user.GetOrCreate(update.CallbackQuery.From, db)
 			if err != nil {
 				return
 			}
@@ -173,14 +179,12 @@ func (g GetPVZ) Run(update tgbotapi.Update) error {
 				UserID: update.CallbackQuery.From.ID,
 			}
 			stepAction := controllers.NextStepAction{
-				Func:        RegistrationCompleted,
+				FuncName:    registrationCompletedStep,
 				Params:      make(map[string]any),
 				CreatedAtTS: time.Now().Unix(),
 			}
 		
-			mu.Lock()
-			controllers.GetNextStepManager().RegisterNextStepAction(stepKey, stepAction)
-			mu.Unlock()
+			err = controllers.GetNextStepManager().RegisterNextStepAction(ctx, stepKey, stepAction)
         }
     }()
 
@@ -202,8 +206,8 @@ func (g GetPVZ) GetName() string {
 	return g.Name
 }
 
-func GetDeliveryServiceFunc(client tgbotapi.BotAPI, update tgbotapi.Update, stepParams map[string]any) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func GetDeliveryServiceFunc(ctx context.Context, env controllers.StepEnv, update tgbotapi.Update, stepParams map[string]any) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
     defer cancel()
 
     var wg sync.WaitGroup
@@ -222,7 +226,7 @@ func GetDeliveryServiceFunc(client tgbotapi.BotAPI, update tgbotapi.Update, step
 				message := tgbotapi.NewMessage(update.Message.Chat.ID, "Неверный формат ввода!\n\nВведите номер телефона в формате 89991234567:")
 				
 				mu.Lock()
-				_, err = client.Send(message)
+				_, err = env.Client.Send(message)
 				mu.Unlock()
 				if err != nil {
 					return
@@ -233,24 +237,21 @@ func GetDeliveryServiceFunc(client tgbotapi.BotAPI, update tgbotapi.Update, step
 					UserID: update.Message.From.ID,
 				}
 				stepAction := controllers.NextStepAction{
-					Func:        GetDeliveryServiceFunc,
+					FuncName:    getDeliveryServiceStep,
 					Params:      make(map[string]any),
 					CreatedAtTS: time.Now().Unix(),
 				}
 		
-				mu.Lock()
-				controllers.GetNextStepManager().RegisterNextStepAction(stepKey, stepAction)
-				mu.Unlock()
+				err = controllers.GetNextStepManager().RegisterNextStepAction(ctx, stepKey, stepAction)
 		
 				return
 			}
 		
-			db := database.Connect()
-			defer db.Close()
+			db := env.DB
 		
 			message := tgbotapi.NewMessage(update.Message.Chat.ID, "выберите сервис доставки")
-			cdekCallbackData := "selectDeliveryService?service=cdek"
-			yandexCallbackData := "selectDeliveryService?service=yandex"
+			cdekCallbackData := callback.MustEncode(callback.SelectDeliveryService{Service: "cdek"})
+			yandexCallbackData := callback.MustEncode(callback.SelectDeliveryService{Service: "yandex"})
 			message.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{
 				InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
 					{{Text: "CDEK", CallbackData: &cdekCallbackData}},
@@ -258,14 +259,14 @@ func GetDeliveryServiceFunc(client tgbotapi.BotAPI, update tgbotapi.Update, step
 				},
 			}
 			mu.Lock()
-			_, err = client.Send(message)
+			_, err = env.Client.Send(message)
 			mu.Unlock()
 			if err != nil {
 				return
 			}
 		
 			user := models.TelegramUser{ID: update.Message.From.ID}
-			err = user.GetOrCreate(update.Message.From, *db)
+			err = user.GetOrCreate(update.Message.From, db)
 			if err != nil {
 				return
 			}
@@ -295,12 +296,12 @@ func GetDeliveryServiceFunc(client tgbotapi.BotAPI, update tgbotapi.Update, step
 }
 
 // RegisterPhoneNumberFunc обрабатывает ввод ФИО и запрашивает номер телефона
-// client - экземпляр Telegram бота
+// env.Client - экземпляр Telegram бота
 // update - обновление от Telegram API
 // stepParams - параметры шага регистрации
 // Возвращает ошибку, если что-то пошло не так
-func RegisterPhoneNumberFunc(client tgbotapi.BotAPI, update tgbotapi.Update, stepParams map[string]any) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func RegisterPhoneNumberFunc(ctx context.Context, env controllers.StepEnv, update tgbotapi.Update, stepParams map[string]any) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
     defer cancel()
 
     var wg sync.WaitGroup
@@ -314,20 +315,19 @@ func RegisterPhoneNumberFunc(client tgbotapi.BotAPI, update tgbotapi.Update, ste
         case <-ctx.Done():
             return
         default:
-			db := database.Connect()
-			defer db.Close()
+			db := env.DB
 
 			message := tgbotapi.NewMessage(update.Message.Chat.ID, "Введите номер телефона:\n<i>Пример ввода: 89991234567</i>")
 			message.ParseMode = "HTML"
 			mu.Lock()
-			_, err = client.Send(message)
+			_, err = env.Client.Send(message)
 			mu.Unlock()
 			if err != nil {
 				return
 			}
 
 			user := models.TelegramUser{ID: update.Message.From.ID}
-			err = user.GetOrCreate(update.Message.From, *db)
+			err = user.GetOrCreate(update.Message.From, db)
 			if err != nil {
 				return
 			}
@@ -345,14 +345,12 @@ func RegisterPhoneNumberFunc(client tgbotapi.BotAPI, update tgbotapi.Update, ste
 				UserID: update.Message.From.ID,
 			}
 			stepAction := controllers.NextStepAction{
-				Func:        GetDeliveryServiceFunc,
+				FuncName:    getDeliveryServiceStep,
 				Params:      make(map[string]any),
 				CreatedAtTS: time.Now().Unix(),
 			}
 
-			mu.Lock()
-			controllers.GetNextStepManager().RegisterNextStepAction(stepKey, stepAction)
-			mu.Unlock()
+			err = controllers.GetNextStepManager().RegisterNextStepAction(ctx, stepKey, stepAction)
         }
     }()
 
@@ -373,8 +371,8 @@ func RegisterPhoneNumberFunc(client tgbotapi.BotAPI, update tgbotapi.Update, ste
 // Run запускает процесс регистрации пользователя
 // update - обновление от Telegram API
 // Возвращает ошибку, если что-то пошло не так
-func (r RegisterUser) Run(update tgbotapi.Update) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (r RegisterUser) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
     defer cancel()
 
     var wg sync.WaitGroup
@@ -388,7 +386,7 @@ func (r RegisterUser) Run(update tgbotapi.Update) error {
             return
         default:
 			r.mu.Lock()
-			ClearNextStepForUser(update, &r.Client, true)
+			ClearNextStepForUser(update, r.Client, true)
 			r.mu.Unlock()
 		
 			message := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, "Введите ФИО")
@@ -404,14 +402,12 @@ func (r RegisterUser) Run(update tgbotapi.Update) error {
 				UserID: update.CallbackQuery.From.ID,
 			}
 			stepAction := controllers.NextStepAction{
-				Func:        RegisterPhoneNumberFunc,
+				FuncName:    registerPhoneNumberStep,
 				Params:      make(map[string]any),
 				CreatedAtTS: time.Now().Unix(),
 			}
 		
-			r.mu.Lock()
-			controllers.GetNextStepManager().RegisterNextStepAction(stepKey, stepAction)
-			r.mu.Unlock()
+			err = controllers.GetNextStepManager().RegisterNextStepAction(ctx, stepKey, stepAction)
         }
     }()
 
@@ -3,13 +3,15 @@ package actions
 import (
 	"context"
 	"fmt"
-	"main/database"
+	"main/callback"
 	"main/database/models"
-	"main/filters"
+	"main/metrics"
+	"main/telegram"
 	"strconv"
 	"sync"
 	"time"
 
+	"github.com/go-pg/pg/v10"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
@@ -18,14 +20,16 @@ import (
 // Client - экземпляр Telegram бота
 type Shop struct {
 	Name   string
-	Client tgbotapi.BotAPI
+	Client telegram.BotClient
+	DB     *pg.DB
 	mu     *sync.Mutex
 }
 
-func NewShopHandler(client tgbotapi.BotAPI) *Shop {
+func NewShopHandler(client telegram.BotClient, db *pg.DB) *Shop {
 	return &Shop{
 		Name:   "shop",
 		Client: client,
+		DB:     db,
 		mu:     &sync.Mutex{},
 	}
 }
@@ -33,8 +37,8 @@ func NewShopHandler(client tgbotapi.BotAPI) *Shop {
 // Run запускает отображение каталогов магазина
 // update - обновление от Telegram API
 // Возвращает ошибку, если что-то пошло не так
-func (s Shop) Run(update tgbotapi.Update) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (s Shop) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var wg sync.WaitGroup
@@ -48,24 +52,27 @@ func (s Shop) Run(update tgbotapi.Update) error {
 			return
 		default:
 			s.mu.Lock()
-			ClearNextStepForUser(update, &s.Client, true)
+			ClearNextStepForUser(update, s.Client, true)
 			s.mu.Unlock()
 
-			data := ParseCallData(update.CallbackQuery.Data)
-			if catIdStr, ok := data["catId"]; ok {
-				update.CallbackQuery.Data = "toCat?catId=" + catIdStr
-				handler := NewViewCatalogHandler(s.Client)
-				err = handler.Run(update)
+			var route callback.Shop
+			err = callback.Decode(update.CallbackQuery.Data, &route)
+			if err != nil {
+				return
+			}
+
+			if route.CatID != 0 {
+				handler := NewViewCatalogHandler(s.Client, s.DB)
+				err = handler.Run(ctx, withCallbackData(update, callback.ToCat{CatID: route.CatID}))
 				return
 			}
 
-			db := database.Connect()
-			defer db.Close()
+			db := s.DB
 
 			var session models.ShopViewSession
 
 			userDb := models.TelegramUser{ID: update.CallbackQuery.From.ID}
-			err = userDb.Get(*db)
+			err = userDb.Get(db)
 			if err != nil {
 				return
 			}
@@ -119,7 +126,7 @@ func (s Shop) Run(update tgbotapi.Update) error {
 			keyboard := [][]tgbotapi.InlineKeyboardButton{}
 
 			for _, cat := range catalogs {
-				callbackData := fmt.Sprintf("toCat?catId=%d", cat.ID)
+				callbackData := callback.MustEncode(callback.ToCat{CatID: cat.ID})
 				var productCount int
 				productCount, err = cat.GetProductCount(db)
 				if err != nil {
@@ -138,7 +145,7 @@ func (s Shop) Run(update tgbotapi.Update) error {
 				text = "Выберите каталог"
 
 				var transaction models.Transaction
-				transaction, err, _ = (&models.TelegramUser{ID: update.CallbackQuery.From.ID}).GetOrCreateTransaction(*db)
+				transaction, err, _ = (&models.TelegramUser{ID: update.CallbackQuery.From.ID}).GetOrCreateTransaction(db)
 				if err != nil {
 					return
 				}
@@ -153,7 +160,7 @@ func (s Shop) Run(update tgbotapi.Update) error {
 				}
 
 				if len(transaction.AddedProducts) > 0 {
-					toCartCallbackData := "viewCart?backIsMainMenu=true"
+					toCartCallbackData := callback.MustEncode(callback.ViewCart{BackIsMainMenu: true})
 
 					var total int
 					for _, item := range transaction.AddedProducts {
@@ -165,8 +172,8 @@ func (s Shop) Run(update tgbotapi.Update) error {
 			}
 
 			if userDb.IsAdmin {
-				addCatalogCallbackData := "addCatalog"
-				changeCatalogNameCallbackData := "changeCatalogName"
+				addCatalogCallbackData := callback.MustEncode(callback.AddCatalog{})
+				changeCatalogNameCallbackData := callback.MustEncode(callback.ChangeCatalogName{})
 				keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{
 					{Text: "Добавить каталог", CallbackData: &addCatalogCallbackData},
 				}, []tgbotapi.InlineKeyboardButton{
@@ -174,7 +181,7 @@ func (s Shop) Run(update tgbotapi.Update) error {
 				})
 			}
 
-			toMainMenuCallbackData := "mainMenu"
+			toMainMenuCallbackData := callback.MustEncode(callback.MainMenu{})
 			keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: "На главную", CallbackData: &toMainMenuCallbackData}})
 
 			if update.CallbackQuery.Message.Caption != "" {
@@ -219,14 +226,16 @@ func (s Shop) GetName() string {
 // Client - экземпляр Telegram бота
 type ViewCatalog struct {
 	Name   string
-	Client tgbotapi.BotAPI
+	Client telegram.BotClient
+	DB     *pg.DB
 	mu     *sync.Mutex
 }
 
-func NewViewCatalogHandler(client tgbotapi.BotAPI) *ViewCatalog {
+func NewViewCatalogHandler(client telegram.BotClient, db *pg.DB) *ViewCatalog {
 	return &ViewCatalog{
 		Name:   "viewCatalog",
 		Client: client,
+		DB:     db,
 		mu:     &sync.Mutex{},
 	}
 }
@@ -234,8 +243,8 @@ func NewViewCatalogHandler(client tgbotapi.BotAPI) *ViewCatalog {
 // Run запускает отображение содержимого каталога
 // update - обновление от Telegram API
 // Возвращает ошибку, если что-то пошло не так
-func (v ViewCatalog) Run(update tgbotapi.Update) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (v ViewCatalog) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var wg sync.WaitGroup
@@ -249,15 +258,18 @@ func (v ViewCatalog) Run(update tgbotapi.Update) error {
 			return
 		default:
 			v.mu.Lock()
-			ClearNextStepForUser(update, &v.Client, true)
+			ClearNextStepForUser(update, v.Client, true)
 			v.mu.Unlock()
-			db := database.Connect()
-			defer db.Close()
+			db := v.DB
 
-			var data map[string]string = filters.ParseCallbackData(update.CallbackQuery.Data)
+			var route callback.ToCat
+			err = callback.Decode(update.CallbackQuery.Data, &route)
+			if err != nil {
+				return
+			}
 
 			userDb := models.TelegramUser{ID: update.CallbackQuery.From.ID}
-			err = userDb.Get(*db)
+			err = userDb.Get(db)
 			if err != nil {
 				return
 			}
@@ -270,12 +282,7 @@ func (v ViewCatalog) Run(update tgbotapi.Update) error {
 				return
 			}
 
-			if catIdStr, ok := data["catId"]; ok {
-				var catId int
-				catId, err = strconv.Atoi(catIdStr)
-				if err != nil {
-					return
-				}
+			if catId := route.CatID; catId != 0 {
 				userDb.ShopSession.CatalogID = catId
 				userDb.ShopSession.Catalog = &models.Catalog{ID: catId}
 				err = db.Model(userDb.ShopSession.Catalog).Where("id = ?", catId).Select()
@@ -304,14 +311,14 @@ func (v ViewCatalog) Run(update tgbotapi.Update) error {
 
 			if productCount == 0 {
 				text := "В этом каталоге пока что нет товаров"
-				toListOfCats := "shop"
+				toListOfCats := callback.MustEncode(callback.Shop{})
 				keyboard := [][]tgbotapi.InlineKeyboardButton{
 					{{Text: "К списку каталогов", CallbackData: &toListOfCats}},
 				}
 
 				if userDb.IsAdmin {
-					removeCatalogCallbackData := "editShop?a=removeCatalog"
-					addProductCallbackData := "editShop?a=createProduct"
+					removeCatalogCallbackData := callback.MustEncode(callback.EditShop{Action: "removeCatalog"})
+					addProductCallbackData := callback.MustEncode(callback.EditShop{Action: "createProduct"})
 					keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{
 						{Text: "Удалить каталог", CallbackData: &removeCatalogCallbackData},
 						{Text: "Добавить товар", CallbackData: &addProductCallbackData},
@@ -342,15 +349,7 @@ func (v ViewCatalog) Run(update tgbotapi.Update) error {
 				return
 			}
 
-			if pageDeltaStr, ok := data["pageDelta"]; ok {
-				var pageDelta int
-				pageDelta, err = strconv.Atoi(pageDeltaStr)
-				if err != nil {
-					return
-				}
-
-				userDb.ShopSession.Offest += pageDelta
-			}
+			userDb.ShopSession.Offest += route.PageDelta
 
 			_, err = db.Model(userDb.ShopSession).WherePK().Column("offest").Update()
 			if err != nil {
@@ -382,26 +381,26 @@ func (v ViewCatalog) Run(update tgbotapi.Update) error {
 				return
 			}
 
+			err = models.LoadReservedStock(db, userDb.ID, &item)
+			if err != nil {
+				return
+			}
+
 			userDb.ShopSession.ProductAtID = item.ID
 			_, err = db.Model(userDb.ShopSession).WherePK().Column("product_at_id").Update()
 			if err != nil {
 				return
 			}
 
-			cartDelta, ok := data["cartDelta"]
-			if ok {
-				cartDeltaInt, err := strconv.Atoi(cartDelta)
-				if err != nil {
-					return
-				}
-
-				if cartDeltaInt == 1 {
-					err = userDb.AddProductToCart(*db, item.ID)
+			if cartDelta := route.CartDelta; cartDelta != 0 {
+				if cartDelta == 1 {
+					err = userDb.AddProductToCart(db, item.ID)
 					if err != nil {
 						return
 					}
-				} else if cartDeltaInt == -1 {
-					err = userDb.RemoveProductFromCart(*db, item.ID)
+					metrics.GetMetrics().RecordCartAdd()
+				} else if cartDelta == -1 {
+					err = userDb.RemoveProductFromCart(db, item.ID)
 					if err != nil {
 						return
 					}
@@ -411,7 +410,7 @@ func (v ViewCatalog) Run(update tgbotapi.Update) error {
 			keyboard := [][]tgbotapi.InlineKeyboardButton{}
 
 			var cartChanged bool
-			cartChanged, err = userDb.TidyCart(*db)
+			cartChanged, err = userDb.TidyCart(db)
 			if err != nil {
 				return
 			}
@@ -428,39 +427,39 @@ func (v ViewCatalog) Run(update tgbotapi.Update) error {
 			}
 
 			var productInCartCount int
-			productInCartCount, err = userDb.GetProductInCartCount(*db, item.ID)
+			productInCartCount, err = userDb.GetProductInCartCount(db, item.ID)
 			if err != nil {
 				return
 			}
 
-			if ok, err := item.InUserCart(update.CallbackQuery.From.ID, *db); ok && err == nil && item.AvailbleForPurchase > 0 && productInCartCount != 0 {
-				add1CallbackData := "toCat?cartDelta=1"
-				rem1CallbackData := "toCat?cartDelta=-1"
-				nullCallbackData := "<null>"
+			if ok, err := item.InUserCart(update.CallbackQuery.From.ID, db); ok && err == nil && item.Available() > 0 && productInCartCount != 0 {
+				add1CallbackData := callback.MustEncode(callback.ToCat{CartDelta: 1})
+				rem1CallbackData := callback.MustEncode(callback.ToCat{CartDelta: -1})
+				nullCallbackData := callback.MustEncode(callback.Noop{})
 
 				buttonRow := []tgbotapi.InlineKeyboardButton{
 					{Text: "-", CallbackData: &rem1CallbackData},
-					{Text: fmt.Sprintf("%d/%d", productInCartCount, item.AvailbleForPurchase), CallbackData: &nullCallbackData},
+					{Text: fmt.Sprintf("%d/%d", productInCartCount, item.Available()), CallbackData: &nullCallbackData},
 				}
 
-				if productInCartCount < item.AvailbleForPurchase {
+				if productInCartCount < item.Available() {
 					buttonRow = append(buttonRow, tgbotapi.InlineKeyboardButton{Text: "+", CallbackData: &add1CallbackData})
 				}
 
 				keyboard = append(keyboard, buttonRow)
 			} else if err != nil {
 				return
-			} else if item.AvailbleForPurchase > 0 {
-				callbackData := "toCat?cartDelta=1"
+			} else if item.Available() > 0 {
+				callbackData := callback.MustEncode(callback.ToCat{CartDelta: 1})
 				keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{
 					{Text: "Добавить в корзину✅", CallbackData: &callbackData},
 				})
 			}
 
 			if productCount > 1 {
-				nextItemCallbackData := "toCat?pageDelta=1"
-				noneCallbackData := "<null>"
-				prevItemCallbackData := "toCat?pageDelta=-1"
+				nextItemCallbackData := callback.MustEncode(callback.ToCat{PageDelta: 1})
+				noneCallbackData := callback.MustEncode(callback.Noop{})
+				prevItemCallbackData := callback.MustEncode(callback.ToCat{PageDelta: -1})
 				keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{
 					{Text: "⬅️", CallbackData: &prevItemCallbackData},
 					{Text: fmt.Sprintf("%s/%s", NumberToEmoji(userDb.ShopSession.Offest+1), NumberToEmoji(productCount)), CallbackData: &noneCallbackData},
@@ -469,21 +468,21 @@ func (v ViewCatalog) Run(update tgbotapi.Update) error {
 			}
 
 			var totalPrice int
-			totalPrice, err = userDb.GetTotalCartPrice(*db)
+			totalPrice, err = userDb.GetTotalCartPrice(db)
 			if err != nil {
 				return
 			}
 
 			if userDb.IsAdmin {
 				var (
-					removeCatalogCallbackData             = "editShop?a=removeCatalog"
-					removeProductCallbackData             = "editShop?a=removeProduct"
-					changePhotoCallbackData               = "editShop?a=changePhoto"
-					changePriceCallbackData               = "editShop?a=changePrice"
-					changeNameCallbackData                = "editShop?a=changeName"
-					changeDescriptionCallbackData         = "editShop?a=changeDescription"
-					addProductCallbackData                = "editShop?a=createProduct"
-					changeAvailbleForPurchaseCallbackData = "editShop?a=changeAvailbleForPurchase"
+					removeCatalogCallbackData             = callback.MustEncode(callback.EditShop{Action: "removeCatalog"})
+					removeProductCallbackData             = callback.MustEncode(callback.EditShop{Action: "removeProduct"})
+					changePhotoCallbackData               = callback.MustEncode(callback.EditShop{Action: "changePhoto"})
+					changePriceCallbackData               = callback.MustEncode(callback.EditShop{Action: "changePrice"})
+					changeNameCallbackData                = callback.MustEncode(callback.EditShop{Action: "changeName"})
+					changeDescriptionCallbackData         = callback.MustEncode(callback.EditShop{Action: "changeDescription"})
+					addProductCallbackData                = callback.MustEncode(callback.EditShop{Action: "createProduct"})
+					changeAvailbleForPurchaseCallbackData = callback.MustEncode(callback.EditShop{Action: "changeAvailbleForPurchase"})
 				)
 				keyboard = append(
 					keyboard,
@@ -506,16 +505,19 @@ func (v ViewCatalog) Run(update tgbotapi.Update) error {
 				)
 			}
 
-			toListOfCats := "shop"
-			toCart := "viewCart"
+			toListOfCats := callback.MustEncode(callback.Shop{})
+			toCart := callback.MustEncode(callback.ViewCart{})
 			keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: "К списку каталогов", CallbackData: &toListOfCats}, {Text: fmt.Sprintf("Корзина (%d₽)", totalPrice), CallbackData: &toCart}})
 
 			var availablityContent string
-			if item.AvailbleForPurchase > 0 {
-				availablityContent = fmt.Sprintf("В наличии: %d шт.", item.AvailbleForPurchase)
+			if item.Available() > 0 {
+				availablityContent = fmt.Sprintf("В наличии: %d шт.", item.Available())
 			} else {
 				availablityContent = "Нет в наличии❌"
 			}
+			if userDb.IsAdmin && item.Reserved > 0 {
+				availablityContent += fmt.Sprintf(" (еще %d шт. в резерве)", item.Reserved)
+			}
 
 			content := fmt.Sprintf("<b>%s</b>\nЦена: %d₽\n%s\n\n%s", item.Name, item.Price, availablityContent, item.Description)
 
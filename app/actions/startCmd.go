@@ -2,11 +2,13 @@ package actions
 
 import (
 	"context"
-	"main/database"
+	"main/callback"
 	"main/database/models"
+	"main/telegram"
 	"sync"
 	"time"
 
+	"github.com/go-pg/pg/v10"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
@@ -15,14 +17,16 @@ import (
 // Client - экземпляр Telegram бота
 type SayHi struct {
 	Name   string
-	Client tgbotapi.BotAPI
+	Client telegram.BotClient
+	DB     *pg.DB
 	mu     *sync.Mutex
 }
 
-func NewSayHiHandler(client tgbotapi.BotAPI) *SayHi {
+func NewSayHiHandler(client telegram.BotClient, db *pg.DB) *SayHi {
 	return &SayHi{
 		Name:   "sayHi",
 		Client: client,
+		DB:     db,
 		mu:     &sync.Mutex{},
 	}
 }
@@ -31,22 +35,21 @@ func NewSayHiHandler(client tgbotapi.BotAPI) *SayHi {
 // update - обновление от Telegram API
 // Возвращает сконфигурированное сообщение с приветствием и кнопкой регистрации
 func (e SayHi) fabricateAnswer(update tgbotapi.Update) tgbotapi.MessageConfig {
-	ClearNextStepForUser(update, &e.Client, true)
+	ClearNextStepForUser(update, e.Client, true)
 	const text = "Добрый день!👋\nВы попали в бота компании FlyLex🔥\n\nНажмите кнопку «Регистрация» чтобы продолжить!"
 	msg := tgbotapi.NewMessage(update.Message.Chat.ID, text)
 
-	callbackData := "registerUser"
+	callbackData := callback.MustEncode(callback.RegisterUser{})
 	msg.ReplyMarkup = tgbotapi.InlineKeyboardMarkup{
 		InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
 			{{Text: "Регистрация", CallbackData: &callbackData}},
 		},
 	}
 
-	db := database.Connect()
-	defer db.Close()
+	db := e.DB
 
 	user := models.TelegramUser{ID: update.Message.From.ID}
-	_ = user.GetOrCreate(update.Message.From, *db)
+	_ = user.GetOrCreate(update.Message.From, db)
 
 	return msg
 }
@@ -54,8 +57,8 @@ func (e SayHi) fabricateAnswer(update tgbotapi.Update) tgbotapi.MessageConfig {
 // Run выполняет обработку команды /start
 // update - обновление от Telegram API
 // Возвращает ошибку, если отправка сообщения не удалась
-func (e SayHi) Run(update tgbotapi.Update) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (e SayHi) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
     defer cancel()
 
     var wg sync.WaitGroup
@@ -0,0 +1,112 @@
+package actions
+
+import (
+	"context"
+	"main/controllers"
+	"main/database/models"
+	"main/logger"
+
+	"github.com/go-pg/pg/v10"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Имена функций следующего шага. Они сохраняются в базе вместе с ожидающими шагами,
+// поэтому переименовывать их можно только вместе с миграцией таблицы next_steps.
+const (
+	registerPhoneNumberStep   = "registerPhoneNumber"
+	getDeliveryServiceStep    = "getDeliveryService"
+	registrationCompletedStep = "registrationCompleted"
+
+	changeUserNameStep            = "changeUserName"
+	changeUserPhoneStep           = "changeUserPhone"
+	changeUserDeliveryAddressStep = "changeUserDeliveryAddress"
+
+	registerPaymentPhotoStep = "registerPaymentPhoto"
+
+	createCatalogStep     = "createCatalog"
+	changeCatalogNameStep = "changeCatalogName"
+
+	changeProductPhotoStep               = "changeProductPhoto"
+	changeProductPriceStep               = "changeProductPrice"
+	changeProductNameStep                = "changeProductName"
+	changeProductDescriptionStep         = "changeProductDescription"
+	changeProductAvailbleForPurchaseStep = "changeProductAvailbleForPurchase"
+
+	registerNewProductNameStep                = "registerNewProductName"
+	registerNewProductPriceStep               = "registerNewProductPrice"
+	registerNewProductDescriptionStep         = "registerNewProductDescription"
+	registerNewProductAvailbleForPurchaseStep = "registerNewProductAvailbleForPurchase"
+	registerNewProductPhotoStep               = "registerNewProductPhoto"
+
+	adminOrdersCustomerStep = "adminOrdersCustomer"
+	adminOrderNoteStep      = "adminOrderNote"
+	adminOrderTrackingStep  = "adminOrderTracking"
+)
+
+func init() {
+	steps := map[string]controllers.NextStepFunc{
+		registerPhoneNumberStep:   RegisterPhoneNumberFunc,
+		getDeliveryServiceStep:    GetDeliveryServiceFunc,
+		registrationCompletedStep: RegistrationCompleted,
+
+		changeUserNameStep:            changeUserName,
+		changeUserPhoneStep:           changeUserPhone,
+		changeUserDeliveryAddressStep: changeUserDeliveryAddress,
+
+		registerPaymentPhotoStep: RegisterPaymentPhoto,
+
+		createCatalogStep:     adminOnlyStep(CreateCatalog),
+		changeCatalogNameStep: adminOnlyStep(ChangeCatalogNameStep),
+
+		changeProductPhotoStep:               adminOnlyStep(changePhotoHandler),
+		changeProductPriceStep:               adminOnlyStep(changePriceHandler),
+		changeProductNameStep:                adminOnlyStep(changeNameHandler),
+		changeProductDescriptionStep:         adminOnlyStep(changeDescriptionHandler),
+		changeProductAvailbleForPurchaseStep: adminOnlyStep(changeAvailbleForPurchaseHandler),
+
+		registerNewProductNameStep:                adminOnlyStep(registerNewProductName),
+		registerNewProductPriceStep:               adminOnlyStep(registerNewProductPrice),
+		registerNewProductDescriptionStep:         adminOnlyStep(registerNewProductDescription),
+		registerNewProductAvailbleForPurchaseStep: adminOnlyStep(registerNewProductAvailbleForPurchase),
+		registerNewProductPhotoStep:               adminOnlyStep(registerNewProductPhoto),
+
+		adminOrdersCustomerStep: adminOnlyStep(AdminOrdersCustomer),
+		adminOrderNoteStep:      adminOnlyStep(AdminOrderNote),
+		adminOrderTrackingStep:  adminOnlyStep(AdminOrderTracking),
+	}
+
+	for name, f := range steps {
+		controllers.RegisterStepFunc(name, f)
+	}
+}
+
+// adminOnlyStep заново проверяет права администратора перед шагом редактирования магазина:
+// права могли снять, пока шаг ждал ответа
+func adminOnlyStep(step controllers.NextStepFunc) controllers.NextStepFunc {
+	return func(ctx context.Context, env controllers.StepEnv, stepUpdate tgbotapi.Update, stepParams map[string]any) error {
+		from := stepUpdate.SentFrom()
+		if from == nil {
+			return nil
+		}
+
+		user := models.TelegramUser{ID: from.ID}
+		err := user.Get(env.DB)
+		if err != nil && err != pg.ErrNoRows {
+			return err
+		}
+
+		if err == pg.ErrNoRows || !user.IsAdmin {
+			logger.FromContext(ctx).Warningw("Admin step denied")
+
+			chat := stepUpdate.FromChat()
+			if chat == nil {
+				return nil
+			}
+
+			_, err = env.Client.Send(tgbotapi.NewMessage(chat.ID, "Недостаточно прав"))
+			return err
+		}
+
+		return step(ctx, env, stepUpdate, stepParams)
+	}
+}
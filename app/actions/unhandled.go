@@ -0,0 +1,47 @@
+package actions
+
+import (
+	"context"
+	"main/logger"
+	"main/telegram"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Unhandled - запасной хендлер для обновлений, которые не подошли ни одному маршруту
+// Name - имя команды
+// Client - экземпляр Telegram бота
+type Unhandled struct {
+	Name   string
+	Client telegram.BotClient
+}
+
+func NewUnhandledHandler(client telegram.BotClient) *Unhandled {
+	return &Unhandled{
+		Name:   "unhandled",
+		Client: client,
+	}
+}
+
+// Run отвечает на неизвестный callback (например, кнопку из старого сообщения),
+// чтобы у пользователя не висела загрузка. Сообщения не трогает: их может ждать следующий шаг диалога.
+// update - обновление от Telegram API
+func (u Unhandled) Run(ctx context.Context, update tgbotapi.Update) error {
+	if update.CallbackQuery == nil {
+		return nil
+	}
+
+	logger.FromContext(ctx).Debugw("No route for callback data", "data", update.CallbackQuery.Data)
+
+	_, err := u.Client.Request(tgbotapi.CallbackConfig{
+		CallbackQueryID: update.CallbackQuery.ID,
+		Text:            "Эта кнопка больше не работает, откройте меню заново",
+	})
+
+	return err
+}
+
+// GetName возвращает имя команды
+func (u Unhandled) GetName() string {
+	return u.Name
+}
@@ -2,11 +2,11 @@ package actions
 
 import (
 	"fmt"
+	"main/callback"
 	"main/controllers"
 	"main/database/models"
-	"os"
+	"main/telegram"
 	"strconv"
-	"strings"
 
 	"github.com/go-pg/pg/v10"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -16,7 +16,7 @@ import (
 // update - обновление от Telegram API
 // client - экземпляр Telegram бота
 // sendCancelMessage - флаг, указывающий, нужно ли отправлять сообщение об отмене
-func ClearNextStepForUser(update tgbotapi.Update, client *tgbotapi.BotAPI, sendCancelMessage bool) {
+func ClearNextStepForUser(update tgbotapi.Update, client telegram.BotClient, sendCancelMessage bool) {
 	var user *tgbotapi.User
 	var chat *tgbotapi.Chat
 
@@ -39,7 +39,7 @@ func ClearNextStepForUser(update tgbotapi.Update, client *tgbotapi.BotAPI, sendC
 	controllers.GetNextStepManager().RemoveNextStepAction(controllers.NextStepKey{
 		ChatID: chat.ID,
 		UserID: user.ID,
-	}, *client, sendCancelMessage)
+	}, client, sendCancelMessage)
 }
 
 // GetMessageAndType возвращает сообщение и его тип из обновления
@@ -68,24 +68,20 @@ func GetMessage(update tgbotapi.Update) *tgbotapi.Message {
 	return message
 }
 
-func ParseCallData(s string) map[string]string {
-	res := make(map[string]string, 0)
-	if len(strings.Split(s, "?")) != 2 {
-		return res
+// withCallbackData возвращает копию update с callback data маршрута route.
+// Используется, когда один хендлер передает управление другому: хендлер разбирает только свой маршрут.
+// update - обновление от Telegram API
+// route - маршрут, от имени которого будет обработано обновление
+func withCallbackData(update tgbotapi.Update, route callback.Route) tgbotapi.Update {
+	if update.CallbackQuery == nil {
+		return update
 	}
-	params := strings.Trim(strings.Split(s, "?")[1], " ")
 
-	for _, p := range strings.Split(params, "&") {
-		if len(strings.Split(p, "=")) != 2 {
-			continue
-		}
-		key := strings.Split(p, "=")[0]
-		value := strings.Split(p, "=")[1]
-
-		res[strings.Trim(key, " ")] = strings.Trim(value, " ")
-	}
+	query := *update.CallbackQuery
+	query.Data = callback.MustEncode(route)
+	update.CallbackQuery = &query
 
-	return res
+	return update
 }
 
 func NumberToEmoji(n int) string {
@@ -117,7 +113,7 @@ func NumberToEmoji(n int) string {
 	return result
 }
 
-func DeleteProductFromUsersCarts(db *pg.DB, productID int, client *tgbotapi.BotAPI) error {
+func DeleteProductFromUsersCarts(db *pg.DB, productID int, client telegram.BotClient, adminChatID int64) error {
 	addedTo := []models.AddedProducts{}
 	err := db.Model(&addedTo).
 		Where("product_id = ?", productID).
@@ -135,13 +131,6 @@ func DeleteProductFromUsersCarts(db *pg.DB, productID int, client *tgbotapi.BotA
 			continue
 		}
 		if item.Transaction.IsWaitingForApproval {
-			adminChatIdStr := os.Getenv("ADMIN_CHAT_ID")
-
-			adminChatId, err := strconv.ParseInt(adminChatIdStr, 10, 64)
-			if err != nil {
-				return err
-			}
-
 			var userName string
 			if item.User.Username != "" {
 				userName = "@" + item.User.Username
@@ -149,9 +138,9 @@ func DeleteProductFromUsersCarts(db *pg.DB, productID int, client *tgbotapi.BotA
 				userName = "<a href='tg://user?id=" + strconv.FormatInt(item.User.ID, 10) + "'>" + item.User.FirstName + " " + item.User.LastName + "</a>"
 			}
 
-			message := tgbotapi.NewMessage(adminChatId, fmt.Sprintf("Товар удалён из корзины пользователя %s который уже оплатил заказ! Неоходимо осуществить возврат средств на сумму %d₽", userName, item.Product.Price*item.ProductCount))
+			message := tgbotapi.NewMessage(adminChatID, fmt.Sprintf("Товар удалён из корзины пользователя %s который уже оплатил заказ! Неоходимо осуществить возврат средств на сумму %d₽", userName, item.UnitPrice*item.ProductCount))
 
-			_, err = client.Send(message)
+			_, err := client.Send(message)
 			if err != nil {
 				return err
 			}
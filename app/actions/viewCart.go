@@ -3,13 +3,14 @@ package actions
 import (
 	"context"
 	"fmt"
-	"main/database"
+	"main/callback"
 	"main/database/models"
-	"main/filters"
-	"strconv"
+	"main/metrics"
+	"main/telegram"
 	"sync"
 	"time"
 
+	"github.com/go-pg/pg/v10"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
@@ -18,14 +19,16 @@ import (
 // Client - экземпляр Telegram бота
 type ViewCart struct {
 	Name   string
-	Client tgbotapi.BotAPI
+	Client telegram.BotClient
+	DB     *pg.DB
 	mu     *sync.Mutex
 }
 
-func NewViewCartHandler(client tgbotapi.BotAPI) *ViewCart {
+func NewViewCartHandler(client telegram.BotClient, db *pg.DB) *ViewCart {
 	return &ViewCart{
 		Name:   "view-cart",
 		Client: client,
+		DB:     db,
 		mu:     &sync.Mutex{},
 	}
 }
@@ -33,8 +36,8 @@ func NewViewCartHandler(client tgbotapi.BotAPI) *ViewCart {
 // Run запускает отображение содержимого корзины
 // update - обновление от Telegram API
 // Возвращает ошибку, если что-то пошло не так
-func (v ViewCart) Run(update tgbotapi.Update) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (v ViewCart) Run(ctx context.Context, update tgbotapi.Update) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	var wg sync.WaitGroup
@@ -48,28 +51,22 @@ func (v ViewCart) Run(update tgbotapi.Update) error {
 			return
 		default:
 			v.mu.Lock()
-			ClearNextStepForUser(update, &v.Client, true)
+			ClearNextStepForUser(update, v.Client, true)
 			v.mu.Unlock()
 
-			db := database.Connect()
-			defer db.Close()
+			db := v.DB
 
-			pars := filters.ParseCallbackData(update.CallbackQuery.Data)
-			backIsMainMenu := pars["backIsMainMenu"] == "true"
-
-			itemIdStr, ok := pars["itemId"]
-			if !ok {
-				itemIdStr = "0"
-			}
-
-			var itemId int
-			itemId, err = strconv.Atoi(itemIdStr)
+			var route callback.ViewCart
+			err = callback.Decode(update.CallbackQuery.Data, &route)
 			if err != nil {
 				return
 			}
 
+			backIsMainMenu := route.BackIsMainMenu
+			itemId := route.ItemID
+
 			var transaction models.Transaction
-			transaction, err, _ = (&models.TelegramUser{ID: update.CallbackQuery.From.ID}).GetOrCreateTransaction(*db)
+			transaction, err, _ = (&models.TelegramUser{ID: update.CallbackQuery.From.ID}).GetOrCreateTransaction(db)
 			if err != nil {
 				return
 			}
@@ -105,8 +102,13 @@ func (v ViewCart) Run(update tgbotapi.Update) error {
 				return
 			}
 
+			err = models.LoadReservedStock(db, update.CallbackQuery.From.ID, item)
+			if err != nil {
+				return
+			}
+
 			var cartChanged bool
-			cartChanged, err = (&models.TelegramUser{ID: update.CallbackQuery.From.ID}).TidyCart(*db)
+			cartChanged, err = (&models.TelegramUser{ID: update.CallbackQuery.From.ID}).TidyCart(db)
 			if err != nil {
 				return
 			}
@@ -124,67 +126,65 @@ func (v ViewCart) Run(update tgbotapi.Update) error {
 
 
 			// Обработка изменения количества товара
-			if deltaStr, ok := pars["cartDelta"]; ok {
-				var delta int
-				delta, err = strconv.Atoi(deltaStr)
-				if err == nil {
-					user := models.TelegramUser{ID: update.CallbackQuery.From.ID}
-					if delta == 1 {
-						err = user.AddProductToCart(*db, item.ID)
-					} else if delta == -1 {
-						err = user.RemoveProductFromCart(*db, item.ID)
-					}
-					if err != nil {
-						return
+			if delta := route.CartDelta; delta != 0 {
+				user := models.TelegramUser{ID: update.CallbackQuery.From.ID}
+				if delta == 1 {
+					err = user.AddProductToCart(db, item.ID)
+					if err == nil {
+						metrics.GetMetrics().RecordCartAdd()
 					}
+				} else if delta == -1 {
+					err = user.RemoveProductFromCart(db, item.ID)
+				}
+				if err != nil {
+					return
+				}
 
-					var transaction models.Transaction
-					transaction, err, _ = user.GetOrCreateTransaction(*db)
-					if err != nil {
-						return
-					}
-					err = db.Model(&transaction).
-						WherePK().
-						Relation("AddedProducts").
-						Select()
-					
-					if err != nil {
-						return
-					}
+				var transaction models.Transaction
+				transaction, err, _ = user.GetOrCreateTransaction(db)
+				if err != nil {
+					return
+				}
+				err = db.Model(&transaction).
+					WherePK().
+					Relation("AddedProducts").
+					Select()
+				
+				if err != nil {
+					return
+				}
 
-					if len(transaction.AddedProducts) == 0 {
-						v.mu.Lock()
-						_, err = v.Client.Request(tgbotapi.CallbackConfig{
-							CallbackQueryID: update.CallbackQuery.ID,
-							Text:            "Теперь ваша карзина пуста",
-							ShowAlert:       true,
-						})
-						v.mu.Unlock()
-						if err != nil {
-							return
-						}
-	
-						handler := NewShopHandler(v.Client)
-						handler.mu = v.mu
-						err = handler.Run(update)
+				if len(transaction.AddedProducts) == 0 {
+					v.mu.Lock()
+					_, err = v.Client.Request(tgbotapi.CallbackConfig{
+						CallbackQueryID: update.CallbackQuery.ID,
+						Text:            "Теперь ваша карзина пуста",
+						ShowAlert:       true,
+					})
+					v.mu.Unlock()
+					if err != nil {
 						return
 					}
 
-					update.CallbackQuery.Data = fmt.Sprintf("viewCart?itemId=%d&backIsMainMenu=%t", itemId, backIsMainMenu)
-					handler := NewViewCartHandler(v.Client)
+					handler := NewShopHandler(v.Client, v.DB)
 					handler.mu = v.mu
-					err = handler.Run(update)
+					err = handler.Run(ctx, withCallbackData(update, callback.Shop{}))
 					return
 				}
+
+				handler := NewViewCartHandler(v.Client, v.DB)
+				handler.mu = v.mu
+				err = handler.Run(ctx, withCallbackData(update, callback.ViewCart{ItemID: itemId, BackIsMainMenu: backIsMainMenu}))
+				return
 			}
 
 			// Клавиатура управления количеством
 			keyboard := [][]tgbotapi.InlineKeyboardButton{}
-			add1CallbackData := fmt.Sprintf("viewCart?itemId=%d&cartDelta=1&backIsMainMenu=%t", itemId, backIsMainMenu)
-			rem1CallbackData := fmt.Sprintf("viewCart?itemId=%d&cartDelta=-1&backIsMainMenu=%t", itemId, backIsMainMenu)
-			nullCallbackData := "<null>"
+			add1CallbackData := callback.MustEncode(callback.ViewCart{ItemID: itemId, CartDelta: 1, BackIsMainMenu: backIsMainMenu})
+			rem1CallbackData := callback.MustEncode(callback.ViewCart{ItemID: itemId, CartDelta: -1, BackIsMainMenu: backIsMainMenu})
+			nullCallbackData := callback.MustEncode(callback.Noop{})
 			countBtn := tgbotapi.InlineKeyboardButton{
-				Text:         fmt.Sprintf("%d/%d", cartItem.ProductCount, item.AvailbleForPurchase),
+				Text:         fmt.Sprintf("%d/%d", cartItem.ProductCount, item.Available()),
 				CallbackData: &nullCallbackData,
 			}
 			row := []tgbotapi.InlineKeyboardButton{
@@ -192,7 +192,7 @@ func (v ViewCart) Run(update tgbotapi.Update) error {
 				countBtn,
 			}
 
-			if cartItem.ProductCount < item.AvailbleForPurchase {
+			if cartItem.ProductCount < item.Available() {
 				row = append(row, tgbotapi.InlineKeyboardButton{Text: "+", CallbackData: &add1CallbackData})
 			}
 
@@ -200,9 +200,9 @@ func (v ViewCart) Run(update tgbotapi.Update) error {
 
 			// Навигация по товарам в корзине
 			if len(transaction.AddedProducts) > 1 {
-				nextItemCallbackData := fmt.Sprintf("viewCart?itemId=%d&backIsMainMenu=%t", itemId+1, backIsMainMenu)
-				noneCallbackData := "<null>"
-				prevItemCallbackData := fmt.Sprintf("viewCart?itemId=%d&backIsMainMenu=%t", itemId-1, backIsMainMenu)
+				nextItemCallbackData := callback.MustEncode(callback.ViewCart{ItemID: itemId + 1, BackIsMainMenu: backIsMainMenu})
+				noneCallbackData := callback.MustEncode(callback.Noop{})
+				prevItemCallbackData := callback.MustEncode(callback.ViewCart{ItemID: itemId - 1, BackIsMainMenu: backIsMainMenu})
 				keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{
 					{Text: "⬅️", CallbackData: &prevItemCallbackData},
 					{Text: fmt.Sprintf("%s/%s", NumberToEmoji(itemId+1), NumberToEmoji(len(transaction.AddedProducts))), CallbackData: &noneCallbackData},
@@ -219,14 +219,14 @@ func (v ViewCart) Run(update tgbotapi.Update) error {
 				Relation("ShopSession").
 				Select()
 			if err == nil && !backIsMainMenu {
-				toShop = "shop?catId=" + strconv.Itoa(userDb.ShopSession.CatalogID)
+				toShop = callback.MustEncode(callback.Shop{CatID: userDb.ShopSession.CatalogID})
 				buttonText = "К списку товаров"
 			} else {
-				toShop = "shop"
+				toShop = callback.MustEncode(callback.Shop{})
 				buttonText = "К списку каталогов"
 			}
 
-			makeOrder := "makeOrder"
+			makeOrder := callback.MustEncode(callback.MakeOrder{})
 			keyboard = append(keyboard, []tgbotapi.InlineKeyboardButton{{Text: buttonText, CallbackData: &toShop}, {Text: "Оформить заказ✅", CallbackData: &makeOrder}})
 
 			content := fmt.Sprintf("<b>%s</b>\nЦена: %d₽\n\n%s", item.Name, item.Price, item.Description)
@@ -0,0 +1,242 @@
+// Package callback кодирует и декодирует callback data inline-кнопок.
+//
+// Каждый маршрут описывается структурой, реализующей Route. Экспортируемые поля
+// с тегом `cb:"имя"` становятся параметрами: "route?имя=значение&...".
+// Поддерживаются string, bool и целые типы; нулевые значения не кодируются.
+package callback
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// MaxDataLen - ограничение Telegram на длину callback data в байтах
+const MaxDataLen = 64
+
+// tokenSeparator отделяет маршрут от токена данных, сохраненных в Store
+const tokenSeparator = "#"
+
+var (
+	// ErrTooLong - закодированные данные не помещаются в MaxDataLen, а Store не задан
+	ErrTooLong = errors.New("callback data exceeds 64 bytes")
+	// ErrMalformed - данные не разбираются или не подходят маршруту
+	ErrMalformed = errors.New("malformed callback data")
+	// ErrUnknownToken - токен не найден в Store
+	ErrUnknownToken = errors.New("unknown callback data token")
+)
+
+// Route - маршрут callback'а; Route() возвращает имя маршрута (часть до "?")
+type Route interface {
+	Route() string
+}
+
+// Encode кодирует r в callback data.
+// Если результат длиннее MaxDataLen, данные сохраняются в Store и кодируются как "route#token".
+func Encode(r Route) (string, error) {
+	values, err := marshal(r)
+	if err != nil {
+		return "", err
+	}
+
+	data := r.Route()
+	if query := values.Encode(); query != "" {
+		data += "?" + query
+	}
+
+	if len(data) <= MaxDataLen {
+		return data, nil
+	}
+
+	store := GetStore()
+	if store == nil {
+		return "", fmt.Errorf("%w: %q (%d bytes)", ErrTooLong, data, len(data))
+	}
+
+	token, err := store.Put(data)
+	if err != nil {
+		return "", err
+	}
+
+	short := r.Route() + tokenSeparator + token
+	if len(short) > MaxDataLen {
+		return "", fmt.Errorf("%w: %q (%d bytes)", ErrTooLong, short, len(short))
+	}
+
+	return short, nil
+}
+
+// MustEncode - Encode, паникующий при ошибке. Для маршрутов, длина которых заведомо
+// укладывается в MaxDataLen (без параметров или с числовыми параметрами).
+func MustEncode(r Route) string {
+	data, err := Encode(r)
+	if err != nil {
+		panic(err)
+	}
+
+	return data
+}
+
+// Decode разбирает data в r. Возвращает ErrMalformed, если data относится к другому маршруту,
+// содержит неизвестные параметры или значения неверного типа.
+func Decode(data string, r Route) error {
+	route, rest := splitRoute(data)
+	if route != r.Route() {
+		return fmt.Errorf("%w: route %q, expected %q", ErrMalformed, route, r.Route())
+	}
+
+	if strings.HasPrefix(rest, tokenSeparator) {
+		store := GetStore()
+		if store == nil {
+			return fmt.Errorf("%w: %q", ErrUnknownToken, rest)
+		}
+
+		full, err := store.Get(strings.TrimPrefix(rest, tokenSeparator))
+		if err != nil {
+			return err
+		}
+
+		route, rest = splitRoute(full)
+		if route != r.Route() {
+			return fmt.Errorf("%w: stored route %q, expected %q", ErrMalformed, route, r.Route())
+		}
+	}
+
+	if rest != "" && !strings.HasPrefix(rest, "?") {
+		return fmt.Errorf("%w: %q", ErrMalformed, data)
+	}
+
+	values, err := url.ParseQuery(strings.TrimPrefix(rest, "?"))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	return unmarshal(values, r)
+}
+
+// RouteOf возвращает имя маршрута из data
+func RouteOf(data string) string {
+	route, _ := splitRoute(data)
+	return route
+}
+
+func splitRoute(data string) (string, string) {
+	i := strings.IndexAny(data, "?"+tokenSeparator)
+	if i < 0 {
+		return data, ""
+	}
+
+	return data[:i], data[i:]
+}
+
+// field - параметр маршрута: имя из тега cb и индекс поля структуры
+type field struct {
+	name  string
+	index int
+}
+
+func fields(t reflect.Type) []field {
+	var res []field
+	for i := 0; i < t.NumField(); i++ {
+		if name, ok := t.Field(i).Tag.Lookup("cb"); ok && t.Field(i).IsExported() {
+			res = append(res, field{name: name, index: i})
+		}
+	}
+
+	return res
+}
+
+func structValue(r Route) (reflect.Value, error) {
+	v := reflect.ValueOf(r)
+	for v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("callback route %T is not a struct", r)
+	}
+
+	return v, nil
+}
+
+func marshal(r Route) (url.Values, error) {
+	v, err := structValue(r)
+	if err != nil {
+		return nil, err
+	}
+
+	values := url.Values{}
+	for _, f := range fields(v.Type()) {
+		fv := v.Field(f.index)
+		if fv.IsZero() {
+			continue
+		}
+
+		switch fv.Kind() {
+		case reflect.String:
+			values.Set(f.name, fv.String())
+		case reflect.Bool:
+			values.Set(f.name, strconv.FormatBool(fv.Bool()))
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			values.Set(f.name, strconv.FormatInt(fv.Int(), 10))
+		default:
+			return nil, fmt.Errorf("callback route %T: unsupported field type %s", r, fv.Type())
+		}
+	}
+
+	return values, nil
+}
+
+func unmarshal(values url.Values, r Route) error {
+	v := reflect.ValueOf(r)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("callback route %T must be a non-nil pointer", r)
+	}
+
+	v = v.Elem()
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("callback route %T is not a struct", r)
+	}
+	v.SetZero()
+
+	known := make(map[string]int)
+	for _, f := range fields(v.Type()) {
+		known[f.name] = f.index
+	}
+
+	for name, raw := range values {
+		index, ok := known[name]
+		if !ok {
+			return fmt.Errorf("%w: unknown parameter %q for route %q", ErrMalformed, name, r.Route())
+		}
+
+		if len(raw) != 1 {
+			return fmt.Errorf("%w: parameter %q repeated", ErrMalformed, name)
+		}
+
+		fv := v.Field(index)
+		switch fv.Kind() {
+		case reflect.String:
+			fv.SetString(raw[0])
+		case reflect.Bool:
+			b, err := strconv.ParseBool(raw[0])
+			if err != nil {
+				return fmt.Errorf("%w: parameter %q: %v", ErrMalformed, name, err)
+			}
+			fv.SetBool(b)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.ParseInt(raw[0], 10, fv.Type().Bits())
+			if err != nil {
+				return fmt.Errorf("%w: parameter %q: %v", ErrMalformed, name, err)
+			}
+			fv.SetInt(n)
+		default:
+			return fmt.Errorf("callback route %T: unsupported field type %s", r, fv.Type())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package callback
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeStore - Store в памяти
+type fakeStore map[string]string
+
+func (s fakeStore) Put(data string) (string, error) {
+	token := Token(data)
+	s[token] = data
+
+	return token, nil
+}
+
+func (s fakeStore) Get(token string) (string, error) {
+	data, ok := s[token]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownToken, token)
+	}
+
+	return data, nil
+}
+
+// useStore задает глобальное хранилище на время теста
+func useStore(t *testing.T, s Store) {
+	t.Helper()
+
+	SetStore(s)
+	t.Cleanup(func() { SetStore(nil) })
+}
+
+// longRoute - маршрут со строковым параметром произвольной длины
+type longRoute struct {
+	Text string `cb:"text"`
+}
+
+func (longRoute) Route() string { return "long" }
+
+// decodeAs декодирует data в новое значение того же типа, что и r
+func decodeAs(data string, r Route) (Route, error) {
+	ptr := reflect.New(reflect.TypeOf(r))
+	err := Decode(data, ptr.Interface().(Route))
+
+	return ptr.Elem().Interface().(Route), err
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	useStore(t, fakeStore{})
+
+	routes := []Route{
+		RegisterUser{},
+		MainMenu{ResetAvailability: true},
+		ChangeDeliveryService{Service: "yandex", ShowBackButton: true},
+		ToCat{CatID: 12, PageDelta: -1, CartDelta: 1},
+		ViewCart{ItemID: 3, CartDelta: -1, BackIsMainMenu: true},
+		PaymentVerdict{OK: true, TransactionID: 42, UserID: 9_007_199_254, OrderID: 17},
+		AdminOrderCard{OrderID: 5, Tab: "review", Page: 2, Days: 30, UserID: -100123456789},
+		AdminOrderShip{OrderID: 5, Carrier: "cdek"},
+		longRoute{Text: "строка & с ?символами=и#решеткой"},
+		longRoute{Text: strings.Repeat("длинный текст ", 10)},
+	}
+
+	for _, r := range routes {
+		data, err := Encode(r)
+		if err != nil {
+			t.Errorf("Encode(%#v): %v", r, err)
+			continue
+		}
+
+		if len(data) > MaxDataLen {
+			t.Errorf("Encode(%#v) = %q: %d bytes, limit %d", r, data, len(data), MaxDataLen)
+		}
+		if RouteOf(data) != r.Route() {
+			t.Errorf("RouteOf(%q) = %q, want %q", data, RouteOf(data), r.Route())
+		}
+
+		got, err := decodeAs(data, r)
+		if err != nil {
+			t.Errorf("Decode(%q): %v", data, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, r) {
+			t.Errorf("Decode(Encode(%#v)) = %#v", r, got)
+		}
+	}
+}
+
+func TestEncodeLongDataUsesStore(t *testing.T) {
+	long := longRoute{Text: strings.Repeat("x", MaxDataLen)}
+
+	if _, err := Encode(long); !errors.Is(err, ErrTooLong) {
+		t.Fatalf("Encode without store: expected ErrTooLong, got %v", err)
+	}
+
+	store := fakeStore{}
+	useStore(t, store)
+
+	data, err := Encode(long)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, ok := strings.CutPrefix(data, long.Route()+tokenSeparator)
+	if !ok || len(store) != 1 || store[token] == "" {
+		t.Fatalf("expected %q to be stored under a token, got %q with store %v", long.Text, data, store)
+	}
+
+	// Одинаковые данные получают один и тот же токен
+	again, err := Encode(long)
+	if err != nil || again != data || len(store) != 1 {
+		t.Errorf("expected repeated Encode to reuse token %q, got %q (%v), store size %d", data, again, err, len(store))
+	}
+
+	// Короткие данные в хранилище не попадают
+	if _, err := Encode(longRoute{Text: "short"}); err != nil || len(store) != 1 {
+		t.Errorf("expected short data to be encoded inline, store size %d (%v)", len(store), err)
+	}
+
+	var got longRoute
+	if err := Decode(data, &got); err != nil || got != long {
+		t.Errorf("Decode(%q) = %#v, %v", data, got, err)
+	}
+
+	if err := Decode(long.Route()+tokenSeparator+"missing", &got); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("Decode with unknown token: expected ErrUnknownToken, got %v", err)
+	}
+
+	// Токен чужого маршрута не подходит
+	foreign, _ := store.Put("other?text=" + long.Text)
+	if err := Decode(long.Route()+tokenSeparator+foreign, &got); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Decode with foreign token: expected ErrMalformed, got %v", err)
+	}
+}
+
+func TestDecodeRejectsMalformed(t *testing.T) {
+	route := OrderDetails{}.Route()
+
+	tests := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{"other route", AdminOrderCard{}.Route() + "?id=1", ErrMalformed},
+		{"route prefix", route + "s?id=1", ErrMalformed},
+		{"unknown param", route + "?id=1&x=2", ErrMalformed},
+		{"repeated param", route + "?id=1&id=2", ErrMalformed},
+		{"not a number", route + "?id=abc", ErrMalformed},
+		{"bad query", route + "?id=%zz", ErrMalformed},
+		{"token without store", route + tokenSeparator + "abc", ErrUnknownToken},
+	}
+
+	for _, tt := range tests {
+		var got OrderDetails
+		if err := Decode(tt.data, &got); !errors.Is(err, tt.err) {
+			t.Errorf("%s: Decode(%q): expected %v, got %v", tt.name, tt.data, tt.err, err)
+		}
+	}
+
+	var verdict PaymentVerdict
+	if err := Decode(PaymentVerdict{}.Route()+"?ok=maybe", &verdict); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Decode with bad bool: expected ErrMalformed, got %v", err)
+	}
+}
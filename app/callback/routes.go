@@ -0,0 +1,215 @@
+package callback
+
+// Маршруты без параметров
+
+type RegisterUser struct{}
+
+func (RegisterUser) Route() string { return "registerUser" }
+
+type About struct{}
+
+func (About) Route() string { return "about" }
+
+type MakeOrder struct{}
+
+func (MakeOrder) Route() string { return "makeOrder" }
+
+type ProcessOrder struct{}
+
+func (ProcessOrder) Route() string { return "processOrder" }
+
+type AddCatalog struct{}
+
+func (AddCatalog) Route() string { return "addCatalog" }
+
+type Cancel struct{}
+
+func (Cancel) Route() string { return "cancel" }
+
+// Noop - кнопка-надпись (счетчики, номера страниц), нажатие ничего не делает
+type Noop struct{}
+
+func (Noop) Route() string { return "<null>" }
+
+// Регистрация и профиль
+
+// SelectDeliveryService - выбор сервиса доставки при регистрации
+type SelectDeliveryService struct {
+	Service string `cb:"service"`
+}
+
+func (SelectDeliveryService) Route() string { return "selectDeliveryService" }
+
+// MainMenu - главное меню. ResetAvailability больше не используется: товар неоплаченного заказа
+// освобождается по истечении резерва. Поле оставлено, чтобы разбирались кнопки в старых сообщениях.
+type MainMenu struct {
+	ResetAvailability bool `cb:"resetAvailablity"`
+}
+
+func (MainMenu) Route() string { return "mainMenu" }
+
+// ProfileSettings - настройки профиля; ShowBackButton - вернуться к оформлению заказа, а не в главное меню
+type ProfileSettings struct {
+	ShowBackButton bool `cb:"showBackButton"`
+}
+
+func (ProfileSettings) Route() string { return "profileSettings" }
+
+type ChangeName struct {
+	ShowBackButton bool `cb:"showBackButton"`
+}
+
+func (ChangeName) Route() string { return "changeName" }
+
+type ChangePhone struct {
+	ShowBackButton bool `cb:"showBackButton"`
+}
+
+func (ChangePhone) Route() string { return "changePhone" }
+
+type ChangeDeliveryAddress struct {
+	ShowBackButton bool `cb:"showBackButton"`
+}
+
+func (ChangeDeliveryAddress) Route() string { return "changeDeliveryAddress" }
+
+// ChangeDeliveryService - смена сервиса доставки; пустой Service показывает список сервисов
+type ChangeDeliveryService struct {
+	Service        string `cb:"service"`
+	ShowBackButton bool   `cb:"showBackButton"`
+}
+
+func (ChangeDeliveryService) Route() string { return "changeDeliveryService" }
+
+// Магазин
+
+// Shop - список каталогов; CatID сразу открывает каталог
+type Shop struct {
+	CatID int `cb:"catId"`
+}
+
+func (Shop) Route() string { return "shop" }
+
+// ToCat - просмотр каталога: выбор каталога, листание товаров и изменение количества в корзине
+type ToCat struct {
+	CatID     int `cb:"catId"`
+	PageDelta int `cb:"pageDelta"`
+	CartDelta int `cb:"cartDelta"`
+}
+
+func (ToCat) Route() string { return "toCat" }
+
+// ViewCart - просмотр корзины с позиции ItemID
+type ViewCart struct {
+	ItemID         int  `cb:"itemId"`
+	CartDelta      int  `cb:"cartDelta"`
+	BackIsMainMenu bool `cb:"backIsMainMenu"`
+}
+
+func (ViewCart) Route() string { return "viewCart" }
+
+// Заказы покупателя
+
+// MyOrders - страница Page (с нуля) списка заказов покупателя
+type MyOrders struct {
+	Page int `cb:"p"`
+}
+
+func (MyOrders) Route() string { return "myOrders" }
+
+// OrderDetails - карточка заказа OrderID; Page - страница списка, на которую вернуться
+type OrderDetails struct {
+	OrderID int `cb:"id"`
+	Page    int `cb:"p"`
+}
+
+func (OrderDetails) Route() string { return "orderDetails" }
+
+// PaymentVerdict - решение администратора по оплате заказа OrderID (корзины TransactionID) пользователя UserID.
+// У кнопок, отправленных до появления заказов, OrderID пуст.
+type PaymentVerdict struct {
+	OK            bool  `cb:"ok"`
+	TransactionID int   `cb:"tid"`
+	UserID        int64 `cb:"userId"`
+	OrderID       int   `cb:"oid"`
+}
+
+func (PaymentVerdict) Route() string { return "paymentVerdict" }
+
+// Администрирование
+
+// EditShop - действие администратора над текущим каталогом или товаром
+type EditShop struct {
+	Action string `cb:"a"`
+}
+
+func (EditShop) Route() string { return "editShop" }
+
+// ChangeCatalogName - переименование каталога; пустой CatalogID показывает список каталогов
+type ChangeCatalogName struct {
+	CatalogID int `cb:"catalogId"`
+}
+
+func (ChangeCatalogName) Route() string { return "changeCatalogName" }
+
+// AdminOrders - панель заказов: вкладка Tab (пустая - заказы на проверке), страница Page,
+// заказы за последние Days дней (0 - за все время) покупателя UserID (0 - всех)
+type AdminOrders struct {
+	Tab    string `cb:"t"`
+	Page   int    `cb:"p"`
+	Days   int    `cb:"d"`
+	UserID int64  `cb:"u"`
+}
+
+func (AdminOrders) Route() string { return "adminOrders" }
+
+// AdminCustomerFilter - запросить покупателя для отбора заказов, сохранив вкладку Tab и период Days
+type AdminCustomerFilter struct {
+	Tab  string `cb:"t"`
+	Days int    `cb:"d"`
+}
+
+func (AdminCustomerFilter) Route() string { return "adminCustomerFilter" }
+
+// AdminOrderCard - карточка заказа OrderID; остальные поля - отбор списка, в который вернуться
+type AdminOrderCard struct {
+	OrderID int    `cb:"id"`
+	Tab     string `cb:"t"`
+	Page    int    `cb:"p"`
+	Days    int    `cb:"d"`
+	UserID  int64  `cb:"u"`
+}
+
+func (AdminOrderCard) Route() string { return "adminOrderCard" }
+
+// AdminOrderAction - действие администратора в карточке заказа OrderID:
+// accept, reject, arrived, delivered, note или receipt
+type AdminOrderAction struct {
+	OrderID int    `cb:"id"`
+	Action  string `cb:"a"`
+}
+
+func (AdminOrderAction) Route() string { return "adminOrderAction" }
+
+// AdminOrderShip - отправка заказа OrderID службой доставки Carrier (cdek, yandex);
+// без Carrier показывается выбор службы
+type AdminOrderShip struct {
+	OrderID int    `cb:"id"`
+	Carrier string `cb:"c"`
+}
+
+func (AdminOrderShip) Route() string { return "adminOrderShip" }
+
+// Управление администраторами (только владелец)
+
+// Admins - список администраторов
+type Admins struct{}
+
+func (Admins) Route() string { return "admins" }
+
+// RevokeAdmin - снять права администратора с пользователя UserID
+type RevokeAdmin struct {
+	UserID int64 `cb:"uid"`
+}
+
+func (RevokeAdmin) Route() string { return "revokeAdmin" }
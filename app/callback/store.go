@@ -0,0 +1,108 @@
+package callback
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"main/database/models"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// Store хранит на сервере callback data, не помещающиеся в MaxDataLen,
+// и выдает вместо них короткий токен
+type Store interface {
+	Put(data string) (token string, err error)
+	Get(token string) (data string, err error)
+}
+
+var globalStore atomic.Pointer[Store]
+
+// SetStore задает хранилище длинных callback data; nil отключает хранение
+func SetStore(s Store) {
+	if s == nil {
+		globalStore.Store(nil)
+		return
+	}
+
+	globalStore.Store(&s)
+}
+
+// GetStore возвращает хранилище длинных callback data или nil, если оно не задано
+func GetStore() Store {
+	s := globalStore.Load()
+	if s == nil {
+		return nil
+	}
+
+	return *s
+}
+
+// Token возвращает токен данных: одинаковые данные всегда получают один и тот же токен,
+// поэтому повторная отрисовка клавиатуры не плодит записи в хранилище
+func Token(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// PgStore хранит длинные callback data в таблице callback_payloads,
+// поэтому кнопки продолжают работать после перезапуска бота.
+// TTL - сколько данные живут после последней отрисовки кнопки (0 - бессрочно):
+// более старые токены считаются неизвестными (ErrUnknownToken) и удаляются Purge.
+type PgStore struct {
+	DB  *pg.DB
+	TTL time.Duration
+}
+
+func (s PgStore) Put(data string) (string, error) {
+	payload := &models.CallbackPayload{Token: Token(data), Data: data}
+
+	// Повторная отрисовка кнопки продлевает жизнь ее данных
+	_, err := s.DB.Model(payload).
+		OnConflict("(token) DO UPDATE").
+		Set("created_at_ts = EXCLUDED.created_at_ts").
+		Insert()
+	if err != nil {
+		return "", err
+	}
+
+	return payload.Token, nil
+}
+
+func (s PgStore) Get(token string) (string, error) {
+	payload := &models.CallbackPayload{Token: token}
+
+	q := s.DB.Model(payload).WherePK()
+	if s.TTL > 0 {
+		q = q.Where("created_at_ts >= extract(epoch from now()) - ?", int64(s.TTL.Seconds()))
+	}
+
+	err := q.Select()
+	if err == pg.ErrNoRows {
+		return "", fmt.Errorf("%w: %q", ErrUnknownToken, token)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return payload.Data, nil
+}
+
+// Purge удаляет данные кнопок, не отрисованных дольше TTL, и возвращает число удаленных записей.
+// Без TTL ничего не удаляет.
+func (s PgStore) Purge() (int, error) {
+	if s.TTL <= 0 {
+		return 0, nil
+	}
+
+	res, err := s.DB.Model((*models.CallbackPayload)(nil)).
+		Where("created_at_ts < extract(epoch from now()) - ?", int64(s.TTL.Seconds())).
+		Delete()
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected(), nil
+}
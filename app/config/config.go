@@ -0,0 +1,635 @@
+// Package config загружает и проверяет настройки бота.
+//
+// Настройки собираются в порядке возрастания приоритета: значения по умолчанию,
+// YAML-файл (путь в CONFIG_FILE, необязателен), переменные окружения (в том числе из .env).
+package config
+
+import (
+	"errors"
+	"fmt"
+	"main/logger"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Telegram - настройки Telegram API
+// APIKey - токен бота
+// AdminChatID - чат администратора, куда приходят чеки об оплате и уведомления о возвратах
+// OwnerID - Telegram ID владельца бота: при старте он получает права владельца и администратора (0 - не назначать)
+type Telegram struct {
+	APIKey      string `yaml:"api_key"`
+	AdminChatID int64  `yaml:"admin_chat_id"`
+	OwnerID     int64  `yaml:"owner_id"`
+}
+
+// Payment - реквизиты для оплаты, которые показываются покупателю
+type Payment struct {
+	CardNumber  string `yaml:"card_number"`
+	PhoneNumber string `yaml:"phone_number"`
+	Bank        string `yaml:"bank"`
+}
+
+// Database - параметры подключения и пула соединений с базой
+// PoolSize - максимальное число соединений в пуле
+// MinIdleConns - сколько простаивающих соединений держать открытыми
+// DialTimeout, ReadTimeout, WriteTimeout - таймауты установки соединения и операций
+// PoolTimeout - сколько ждать свободного соединения, если пул занят
+// IdleTimeout - через сколько закрывать простаивающее соединение
+// MaxConnAge - максимальное время жизни соединения
+// HealthCheckInterval - период проверки доступности базы (0 - не проверять)
+type Database struct {
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+
+	PoolSize     int `yaml:"pool_size"`
+	MinIdleConns int `yaml:"min_idle_conns"`
+
+	DialTimeout  time.Duration `yaml:"dial_timeout"`
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	PoolTimeout  time.Duration `yaml:"pool_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	MaxConnAge   time.Duration `yaml:"max_conn_age"`
+
+	HealthCheckInterval time.Duration `yaml:"health_check_interval"`
+}
+
+// Runtime - настройки обработки обновлений
+// MaxWorkers - сколько обновлений обрабатывается одновременно
+// UserQueueSize - сколько обновлений одного пользователя в чате может ждать обработки; лишние отбрасываются
+// UpdateTimeout - сколько времени дается на обработку одного обновления
+// ShutdownTimeout - сколько ждать завершения обработчиков при остановке
+// MetricsInterval - период вывода метрик в лог
+// StallTimeout - если цикл обработки обновлений не отзывается дольше, /healthz сообщает о зависании
+// HTTPAddr - адрес служебного HTTP-сервера с /metrics, /healthz и /readyz ("" - не запускать)
+// CallbackPayloadTTL - сколько хранятся длинные callback data кнопок (см. callback.PgStore);
+// кнопки старше отвечают, что устарели
+type Runtime struct {
+	MaxWorkers      int           `yaml:"max_workers"`
+	UserQueueSize   int           `yaml:"user_queue_size"`
+	UpdateTimeout   time.Duration `yaml:"update_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	MetricsInterval time.Duration `yaml:"metrics_interval"`
+	StallTimeout    time.Duration `yaml:"stall_timeout"`
+	HTTPAddr        string        `yaml:"http_addr"`
+
+	CallbackPayloadTTL time.Duration `yaml:"callback_payload_ttl"`
+}
+
+// Режимы получения обновлений (Updates.Mode)
+const (
+	ModePolling = "polling"
+	ModeWebhook = "webhook"
+)
+
+// Updates - способ получения обновлений от Telegram
+// Mode - ModePolling (long polling) или ModeWebhook
+// PollTimeout - таймаут одного запроса long polling
+// Webhook - настройки webhook-режима
+type Updates struct {
+	Mode        string        `yaml:"mode"`
+	PollTimeout time.Duration `yaml:"poll_timeout"`
+	Webhook     Webhook       `yaml:"webhook"`
+}
+
+// Webhook - настройки HTTP-сервера, принимающего обновления от Telegram
+// ListenAddr - адрес, который слушает сервер
+// Path - путь, на который Telegram отправляет обновления
+// PublicURL - внешний адрес бота (схема и хост, например https://bot.example.com); к нему добавляется Path
+// SecretToken - значение заголовка X-Telegram-Bot-Api-Secret-Token, без которого запросы отклоняются
+// CertFile, KeyFile - TLS-сертификат и ключ; если не заданы, сервер работает по HTTP за reverse proxy
+// UploadCert - отправить CertFile в Telegram (для самоподписанного сертификата)
+// Register - вызывать setWebhook при старте; при нескольких репликах достаточно одной
+// MaxConnections - сколько одновременных соединений разрешить Telegram (0 - по умолчанию Telegram)
+type Webhook struct {
+	ListenAddr     string `yaml:"listen_addr"`
+	Path           string `yaml:"path"`
+	PublicURL      string `yaml:"public_url"`
+	SecretToken    string `yaml:"secret_token"`
+	CertFile       string `yaml:"cert_file"`
+	KeyFile        string `yaml:"key_file"`
+	UploadCert     bool   `yaml:"upload_cert"`
+	Register       bool   `yaml:"register"`
+	MaxConnections int    `yaml:"max_connections"`
+}
+
+// Outbound - лимиты исходящих запросов к Telegram (см. telegram.Sender).
+// По умолчанию соответствуют ограничениям Telegram: 30 сообщений в секунду на бота,
+// около одного в секунду в личный чат и 20 в минуту в группу.
+// GlobalPerSecond - сообщений в секунду на всего бота
+// ChatPerMinute, GroupPerMinute - сообщений в минуту в один личный чат и в одну группу
+// ChatBurst - сколько сообщений подряд можно отправить в чат без ожидания
+// MaxRetries - сколько раз повторять запрос после 429, 5xx или сетевой ошибки
+// MaxWait - дольше этого запрос не ждет своей очереди и завершается ошибкой
+type Outbound struct {
+	GlobalPerSecond int           `yaml:"global_per_second"`
+	ChatPerMinute   int           `yaml:"chat_per_minute"`
+	GroupPerMinute  int           `yaml:"group_per_minute"`
+	ChatBurst       int           `yaml:"chat_burst"`
+	MaxRetries      int           `yaml:"max_retries"`
+	MaxWait         time.Duration `yaml:"max_wait"`
+}
+
+// Log - настройки журнала
+// Level - минимальный уровень записей: debug, info, warning, error (DEBUG=true понижает его до debug)
+// Format - формат строк: json или logfmt
+// File - путь к файлу журнала ("" - писать только в stdout/stderr)
+// MaxSizeMB - размер файла в мегабайтах, после которого он ротируется (0 - без ограничения)
+// RotateEvery - период ротации независимо от размера (0 - не ротировать по времени)
+// MaxBackups - сколько ротированных файлов хранить (0 - без ограничения)
+// MaxAge - сколько хранить ротированные файлы (0 - без ограничения)
+type Log struct {
+	Level       string        `yaml:"level"`
+	Format      string        `yaml:"format"`
+	File        string        `yaml:"file"`
+	MaxSizeMB   int           `yaml:"max_size_mb"`
+	RotateEvery time.Duration `yaml:"rotate_every"`
+	MaxBackups  int           `yaml:"max_backups"`
+	MaxAge      time.Duration `yaml:"max_age"`
+}
+
+// Stock - резервирование товаров под неоплаченные заказы
+// ReservationTTL - сколько товар держится за покупателем, перешедшим к оплате; столько же бот ждет чек
+// SweepInterval - как часто снимать истекшие резервы
+type Stock struct {
+	ReservationTTL time.Duration `yaml:"reservation_ttl"`
+	SweepInterval  time.Duration `yaml:"sweep_interval"`
+}
+
+// DeliveryServices - сервисы доставки, из которых выбирает покупатель
+var DeliveryServices = []string{"cdek", "yandex"}
+
+// trackingPlaceholder - место трек-номера в шаблоне ссылки отслеживания
+const trackingPlaceholder = "{track}"
+
+// Delivery - настройки служб доставки
+// TrackingURLs - шаблоны ссылок отслеживания по сервису доставки (cdek, yandex),
+// {track} заменяется трек-номером. Без шаблона покупатель получает только трек-номер.
+type Delivery struct {
+	TrackingURLs map[string]string `yaml:"tracking_urls"`
+}
+
+// TrackingURL возвращает ссылку отслеживания отправления track службой service или "", если шаблона нет
+func (d Delivery) TrackingURL(service, track string) string {
+	template := d.TrackingURLs[service]
+	if template == "" || track == "" {
+		return ""
+	}
+
+	return strings.ReplaceAll(template, trackingPlaceholder, url.QueryEscape(track))
+}
+
+// Config - все настройки бота
+type Config struct {
+	Debug    bool     `yaml:"debug"`
+	Telegram Telegram `yaml:"telegram"`
+	Payment  Payment  `yaml:"payment"`
+	Database Database `yaml:"database"`
+	Runtime  Runtime  `yaml:"runtime"`
+	Updates  Updates  `yaml:"updates"`
+	Log      Log      `yaml:"log"`
+	Outbound Outbound `yaml:"outbound"`
+	Delivery Delivery `yaml:"delivery"`
+	Stock    Stock    `yaml:"stock"`
+}
+
+// Default возвращает настройки по умолчанию. Секреты и параметры подключения в них не заданы.
+func Default() Config {
+	return Config{
+		Database: Database{
+			Port:                "5432",
+			PoolSize:            20,
+			MinIdleConns:        2,
+			DialTimeout:         5 * time.Second,
+			ReadTimeout:         10 * time.Second,
+			WriteTimeout:        10 * time.Second,
+			PoolTimeout:         15 * time.Second,
+			IdleTimeout:         5 * time.Minute,
+			MaxConnAge:          30 * time.Minute,
+			HealthCheckInterval: 30 * time.Second,
+		},
+		Runtime: Runtime{
+			MaxWorkers:      50,
+			UserQueueSize:   20,
+			UpdateTimeout:   30 * time.Second,
+			ShutdownTimeout: 5 * time.Second,
+			MetricsInterval: 12 * time.Hour,
+			StallTimeout:    2 * time.Minute,
+			HTTPAddr:        ":9090",
+
+			CallbackPayloadTTL: 30 * 24 * time.Hour,
+		},
+		Updates: Updates{
+			Mode:        ModePolling,
+			PollTimeout: 60 * time.Second,
+			Webhook: Webhook{
+				ListenAddr: ":8080",
+				Path:       "/telegram/webhook",
+				Register:   true,
+			},
+		},
+		Outbound: Outbound{
+			GlobalPerSecond: 30,
+			ChatPerMinute:   60,
+			GroupPerMinute:  20,
+			ChatBurst:       3,
+			MaxRetries:      3,
+			MaxWait:         20 * time.Second,
+		},
+		Log: Log{
+			Level:      "info",
+			Format:     string(logger.FormatJSON),
+			File:       "log.txt",
+			MaxSizeMB:  100,
+			MaxBackups: 5,
+			MaxAge:     7 * 24 * time.Hour,
+		},
+		Stock: Stock{
+			ReservationTTL: time.Hour,
+			SweepInterval:  time.Minute,
+		},
+	}
+}
+
+// Load собирает настройки из значений по умолчанию, YAML-файла из CONFIG_FILE
+// и переменных окружения (.env подхватывается для dev-режима, в проде его нет), затем проверяет их.
+func Load() (*Config, error) {
+	_ = godotenv.Load()
+
+	cfg := Default()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// loadEnv переопределяет настройки заданными переменными окружения
+func (c *Config) loadEnv() error {
+	strs := map[string]*string{
+		"API_KEY":              &c.Telegram.APIKey,
+		"PAYMENT_CARD_NUMBER":  &c.Payment.CardNumber,
+		"PAYMENT_PHONE_NUMBER": &c.Payment.PhoneNumber,
+		"PAYMENT_BANK":         &c.Payment.Bank,
+		"DB_HOST":              &c.Database.Host,
+		"DB_PORT":              &c.Database.Port,
+		"DB_USER":              &c.Database.User,
+		"DB_PASSWORD":          &c.Database.Password,
+		"DB_NAME":              &c.Database.Name,
+		"HTTP_ADDR":            &c.Runtime.HTTPAddr,
+		"UPDATES_MODE":         &c.Updates.Mode,
+		"WEBHOOK_LISTEN_ADDR":  &c.Updates.Webhook.ListenAddr,
+		"WEBHOOK_PATH":         &c.Updates.Webhook.Path,
+		"WEBHOOK_PUBLIC_URL":   &c.Updates.Webhook.PublicURL,
+		"WEBHOOK_SECRET_TOKEN": &c.Updates.Webhook.SecretToken,
+		"WEBHOOK_CERT_FILE":    &c.Updates.Webhook.CertFile,
+		"WEBHOOK_KEY_FILE":     &c.Updates.Webhook.KeyFile,
+		"LOG_LEVEL":            &c.Log.Level,
+		"LOG_FORMAT":           &c.Log.Format,
+		"LOG_FILE":             &c.Log.File,
+	}
+	ints := map[string]*int{
+		"DB_POOL_SIZE":      &c.Database.PoolSize,
+		"DB_MIN_IDLE_CONNS": &c.Database.MinIdleConns,
+		"MAX_WORKERS":       &c.Runtime.MaxWorkers,
+		"USER_QUEUE_SIZE":   &c.Runtime.UserQueueSize,
+
+		"WEBHOOK_MAX_CONNECTIONS": &c.Updates.Webhook.MaxConnections,
+
+		"OUTBOUND_GLOBAL_PER_SECOND": &c.Outbound.GlobalPerSecond,
+		"OUTBOUND_CHAT_PER_MINUTE":   &c.Outbound.ChatPerMinute,
+		"OUTBOUND_GROUP_PER_MINUTE":  &c.Outbound.GroupPerMinute,
+		"OUTBOUND_CHAT_BURST":        &c.Outbound.ChatBurst,
+		"OUTBOUND_MAX_RETRIES":       &c.Outbound.MaxRetries,
+
+		"LOG_MAX_SIZE_MB": &c.Log.MaxSizeMB,
+		"LOG_MAX_BACKUPS": &c.Log.MaxBackups,
+	}
+	durations := map[string]*time.Duration{
+		"DB_DIAL_TIMEOUT":          &c.Database.DialTimeout,
+		"DB_READ_TIMEOUT":          &c.Database.ReadTimeout,
+		"DB_WRITE_TIMEOUT":         &c.Database.WriteTimeout,
+		"DB_POOL_TIMEOUT":          &c.Database.PoolTimeout,
+		"DB_IDLE_TIMEOUT":          &c.Database.IdleTimeout,
+		"DB_MAX_CONN_AGE":          &c.Database.MaxConnAge,
+		"DB_HEALTH_CHECK_INTERVAL": &c.Database.HealthCheckInterval,
+		"UPDATE_TIMEOUT":           &c.Runtime.UpdateTimeout,
+		"SHUTDOWN_TIMEOUT":         &c.Runtime.ShutdownTimeout,
+		"METRICS_INTERVAL":         &c.Runtime.MetricsInterval,
+		"STALL_TIMEOUT":            &c.Runtime.StallTimeout,
+		"CALLBACK_PAYLOAD_TTL":     &c.Runtime.CallbackPayloadTTL,
+		"POLL_TIMEOUT":             &c.Updates.PollTimeout,
+		"OUTBOUND_MAX_WAIT":        &c.Outbound.MaxWait,
+		"LOG_ROTATE_EVERY":         &c.Log.RotateEvery,
+		"LOG_MAX_AGE":              &c.Log.MaxAge,
+		"STOCK_RESERVATION_TTL":    &c.Stock.ReservationTTL,
+		"STOCK_SWEEP_INTERVAL":     &c.Stock.SweepInterval,
+	}
+	bools := map[string]*bool{
+		"DEBUG":               &c.Debug,
+		"WEBHOOK_UPLOAD_CERT": &c.Updates.Webhook.UploadCert,
+		"WEBHOOK_REGISTER":    &c.Updates.Webhook.Register,
+	}
+
+	var errs []error
+
+	for key, dst := range strs {
+		if v, ok := os.LookupEnv(key); ok {
+			*dst = v
+		}
+	}
+
+	for key, dst := range ints {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not an integer", key, v))
+				continue
+			}
+			*dst = n
+		}
+	}
+
+	for key, dst := range durations {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a duration (e.g. 30s, 5m)", key, v))
+				continue
+			}
+			*dst = d
+		}
+	}
+
+	if v, ok := os.LookupEnv("ADMIN_CHAT_ID"); ok && v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ADMIN_CHAT_ID: %q is not a chat id", v))
+		} else {
+			c.Telegram.AdminChatID = id
+		}
+	}
+
+	if v, ok := os.LookupEnv("OWNER_ID"); ok && v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 0 {
+			errs = append(errs, fmt.Errorf("OWNER_ID: %q is not a user id", v))
+		} else {
+			c.Telegram.OwnerID = id
+		}
+	}
+
+	for _, service := range DeliveryServices {
+		if v, ok := os.LookupEnv("TRACKING_URL_" + strings.ToUpper(service)); ok {
+			if c.Delivery.TrackingURLs == nil {
+				c.Delivery.TrackingURLs = make(map[string]string)
+			}
+			c.Delivery.TrackingURLs[service] = v
+		}
+	}
+
+	for key, dst := range bools {
+		if v, ok := os.LookupEnv(key); ok && v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a boolean", key, v))
+				continue
+			}
+			*dst = b
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate проверяет, что заданы все обязательные настройки и значения имеют смысл.
+// Возвращает все найденные ошибки разом.
+func (c *Config) Validate() error {
+	var errs []error
+
+	required := []struct {
+		name  string
+		value string
+	}{
+		{"API_KEY (telegram.api_key)", c.Telegram.APIKey},
+		{"PAYMENT_CARD_NUMBER (payment.card_number)", c.Payment.CardNumber},
+		{"PAYMENT_PHONE_NUMBER (payment.phone_number)", c.Payment.PhoneNumber},
+		{"PAYMENT_BANK (payment.bank)", c.Payment.Bank},
+		{"DB_HOST (database.host)", c.Database.Host},
+		{"DB_PORT (database.port)", c.Database.Port},
+		{"DB_USER (database.user)", c.Database.User},
+		{"DB_NAME (database.name)", c.Database.Name},
+	}
+	for _, r := range required {
+		if r.value == "" {
+			errs = append(errs, fmt.Errorf("%s is required", r.name))
+		}
+	}
+
+	if c.Telegram.AdminChatID == 0 {
+		errs = append(errs, errors.New("ADMIN_CHAT_ID (telegram.admin_chat_id) is required"))
+	}
+
+	if c.Database.PoolSize < 1 {
+		errs = append(errs, errors.New("DB_POOL_SIZE (database.pool_size) must be positive"))
+	}
+	if c.Database.MinIdleConns < 0 || c.Database.MinIdleConns > c.Database.PoolSize {
+		errs = append(errs, errors.New("DB_MIN_IDLE_CONNS (database.min_idle_conns) must be between 0 and pool size"))
+	}
+	if c.Runtime.MaxWorkers < 1 {
+		errs = append(errs, errors.New("MAX_WORKERS (runtime.max_workers) must be positive"))
+	}
+	if c.Runtime.UserQueueSize < 1 {
+		errs = append(errs, errors.New("USER_QUEUE_SIZE (runtime.user_queue_size) must be positive"))
+	}
+
+	positive := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"DB_DIAL_TIMEOUT (database.dial_timeout)", c.Database.DialTimeout},
+		{"UPDATE_TIMEOUT (runtime.update_timeout)", c.Runtime.UpdateTimeout},
+		{"SHUTDOWN_TIMEOUT (runtime.shutdown_timeout)", c.Runtime.ShutdownTimeout},
+		{"METRICS_INTERVAL (runtime.metrics_interval)", c.Runtime.MetricsInterval},
+		{"STALL_TIMEOUT (runtime.stall_timeout)", c.Runtime.StallTimeout},
+		{"CALLBACK_PAYLOAD_TTL (runtime.callback_payload_ttl)", c.Runtime.CallbackPayloadTTL},
+		{"STOCK_RESERVATION_TTL (stock.reservation_ttl)", c.Stock.ReservationTTL},
+		{"STOCK_SWEEP_INTERVAL (stock.sweep_interval)", c.Stock.SweepInterval},
+	}
+	for _, p := range positive {
+		if p.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", p.name))
+		}
+	}
+
+	// Ответ getUpdates отмечает живость получения обновлений, поэтому он должен успевать прийти до STALL_TIMEOUT
+	if c.Updates.Mode == ModePolling && c.Runtime.StallTimeout > 0 && c.Runtime.StallTimeout <= c.Updates.PollTimeout {
+		errs = append(errs, errors.New("STALL_TIMEOUT (runtime.stall_timeout) must be longer than POLL_TIMEOUT (updates.poll_timeout)"))
+	}
+
+	errs = append(errs, c.Updates.validate()...)
+	errs = append(errs, c.Log.validate()...)
+	errs = append(errs, c.Outbound.validate()...)
+	errs = append(errs, c.Delivery.validate()...)
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+}
+
+// secretTokenRe - допустимые символы и длина secret_token по документации Telegram
+var secretTokenRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+func (u Updates) validate() []error {
+	var errs []error
+
+	switch u.Mode {
+	case ModePolling:
+		if u.PollTimeout <= 0 {
+			errs = append(errs, errors.New("POLL_TIMEOUT (updates.poll_timeout) must be positive"))
+		}
+		return errs
+	case ModeWebhook:
+	default:
+		return []error{fmt.Errorf("UPDATES_MODE (updates.mode) must be %q or %q, got %q", ModePolling, ModeWebhook, u.Mode)}
+	}
+
+	w := u.Webhook
+	if w.ListenAddr == "" {
+		errs = append(errs, errors.New("WEBHOOK_LISTEN_ADDR (updates.webhook.listen_addr) is required in webhook mode"))
+	}
+	if !strings.HasPrefix(w.Path, "/") {
+		errs = append(errs, errors.New("WEBHOOK_PATH (updates.webhook.path) must start with /"))
+	}
+	if !secretTokenRe.MatchString(w.SecretToken) {
+		errs = append(errs, errors.New("WEBHOOK_SECRET_TOKEN (updates.webhook.secret_token) is required in webhook mode: 1-256 characters A-Z, a-z, 0-9, _ and -"))
+	}
+	if (w.CertFile == "") != (w.KeyFile == "") {
+		errs = append(errs, errors.New("WEBHOOK_CERT_FILE and WEBHOOK_KEY_FILE (updates.webhook.cert_file, key_file) must be set together"))
+	}
+	if w.UploadCert && w.CertFile == "" {
+		errs = append(errs, errors.New("WEBHOOK_UPLOAD_CERT (updates.webhook.upload_cert) requires WEBHOOK_CERT_FILE"))
+	}
+	if w.MaxConnections < 0 || w.MaxConnections > 100 {
+		errs = append(errs, errors.New("WEBHOOK_MAX_CONNECTIONS (updates.webhook.max_connections) must be between 0 and 100"))
+	}
+	if w.Register {
+		if public, err := url.Parse(w.PublicURL); err != nil || public.Scheme != "https" || public.Host == "" {
+			errs = append(errs, errors.New("WEBHOOK_PUBLIC_URL (updates.webhook.public_url) must be an https URL when WEBHOOK_REGISTER is on"))
+		}
+	}
+
+	return errs
+}
+
+func (l Log) validate() []error {
+	var errs []error
+
+	if _, err := logger.ParseLevel(l.Level); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL (log.level) must be debug, info, warning or error, got %q", l.Level))
+	}
+	if _, err := logger.ParseFormat(l.Format); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT (log.format) must be %q or %q, got %q", logger.FormatJSON, logger.FormatLogfmt, l.Format))
+	}
+	if l.MaxSizeMB < 0 {
+		errs = append(errs, errors.New("LOG_MAX_SIZE_MB (log.max_size_mb) must not be negative"))
+	}
+	if l.MaxBackups < 0 {
+		errs = append(errs, errors.New("LOG_MAX_BACKUPS (log.max_backups) must not be negative"))
+	}
+	if l.RotateEvery < 0 || l.MaxAge < 0 {
+		errs = append(errs, errors.New("LOG_ROTATE_EVERY and LOG_MAX_AGE (log.rotate_every, log.max_age) must not be negative"))
+	}
+
+	return errs
+}
+
+func (o Outbound) validate() []error {
+	var errs []error
+
+	positive := []struct {
+		name  string
+		value int
+	}{
+		{"OUTBOUND_GLOBAL_PER_SECOND (outbound.global_per_second)", o.GlobalPerSecond},
+		{"OUTBOUND_CHAT_PER_MINUTE (outbound.chat_per_minute)", o.ChatPerMinute},
+		{"OUTBOUND_GROUP_PER_MINUTE (outbound.group_per_minute)", o.GroupPerMinute},
+		{"OUTBOUND_CHAT_BURST (outbound.chat_burst)", o.ChatBurst},
+	}
+	for _, p := range positive {
+		if p.value < 1 {
+			errs = append(errs, fmt.Errorf("%s must be positive", p.name))
+		}
+	}
+
+	if o.MaxRetries < 0 {
+		errs = append(errs, errors.New("OUTBOUND_MAX_RETRIES (outbound.max_retries) must not be negative"))
+	}
+	if o.MaxWait <= 0 {
+		errs = append(errs, errors.New("OUTBOUND_MAX_WAIT (outbound.max_wait) must be positive"))
+	}
+
+	return errs
+}
+
+func (d Delivery) validate() []error {
+	var errs []error
+
+	for service, template := range d.TrackingURLs {
+		name := fmt.Sprintf("TRACKING_URL_%s (delivery.tracking_urls.%s)", strings.ToUpper(service), service)
+
+		known := false
+		for _, s := range DeliveryServices {
+			known = known || s == service
+		}
+		if !known {
+			errs = append(errs, fmt.Errorf("%s: unknown delivery service, expected one of %v", name, DeliveryServices))
+			continue
+		}
+
+		if template == "" {
+			continue
+		}
+		if u, err := url.Parse(template); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || !strings.Contains(template, trackingPlaceholder) {
+			errs = append(errs, fmt.Errorf("%s must be an http(s) URL containing %s", name, trackingPlaceholder))
+		}
+	}
+
+	return errs
+}
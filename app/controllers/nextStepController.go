@@ -1,19 +1,33 @@
 package controllers
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"hash/fnv"
+	"main/config"
 	"main/logger"
+	"main/telegram"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/go-pg/pg/v10"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 const (
-	StepTimeout = 3600
+	// DefaultStepTimeout - время жизни шага, если в NextStepAction не указан Timeout
+	DefaultStepTimeout = time.Hour
+	// DefaultSweepInterval - период, с которым RunSweeper удаляет просроченные шаги
+	DefaultSweepInterval = time.Minute
+
+	keyLockStripes = 64
 )
 
 var (
 	ErrMessageIsCommand = errors.New("message is command")
+	ErrUnknownStepFunc  = errors.New("unknown next step function")
 )
 
 type NextStepKey struct {
@@ -21,22 +35,110 @@ type NextStepKey struct {
 	UserID int64
 }
 
-type NextStepFunc func(client tgbotapi.BotAPI, stepUpdate tgbotapi.Update, stepParams map[string]any) error
+// StepEnv - зависимости, с которыми вызывается функция следующего шага
+// Client - экземпляр Telegram бота
+// DB - общий пул соединений с базой
+// Config - настройки бота
+type StepEnv struct {
+	Client telegram.BotClient
+	DB     *pg.DB
+	Config *config.Config
+}
+
+// NextStepFunc - функция следующего шага. ctx - контекст обновления, продолжающего диалог;
+// в его полях журнала есть step и step_origin (correlation_id обновления, которое зарегистрировало шаг).
+type NextStepFunc func(ctx context.Context, env StepEnv, stepUpdate tgbotapi.Update, stepParams map[string]any) error
 
+// NextStepAction - следующий шаг диалога
+// FuncName - имя функции шага, зарегистрированной через RegisterStepFunc
+// Params - параметры шага; хранятся в JSON, поэтому числа после перезапуска приходят как float64 (см. ParamInt)
+// CreatedAtTS - время создания шага (если 0, подставляется текущее)
+// Timeout - время жизни шага (если 0, используется DefaultStepTimeout)
+// CancelMessage - сообщение, отправляемое пользователю при отмене шага
+// CorrelationID - correlation_id обновления, зарегистрировавшего шаг (заполняется RegisterNextStepAction)
 type NextStepAction struct {
-	Func        NextStepFunc
-	Params      map[string]any
-	CreatedAtTS int64
+	FuncName      string
+	Params        map[string]any
+	CreatedAtTS   int64
+	Timeout       time.Duration
 	CancelMessage string
+	CorrelationID string
+}
+
+// ExpiresAtTS возвращает время, после которого шаг считается просроченным
+func (a NextStepAction) ExpiresAtTS() int64 {
+	timeout := a.Timeout
+	if timeout <= 0 {
+		timeout = DefaultStepTimeout
+	}
+
+	return a.CreatedAtTS + int64(timeout/time.Second)
+}
+
+var (
+	stepFuncsMu sync.RWMutex
+	stepFuncs   = make(map[string]NextStepFunc)
+)
+
+// RegisterStepFunc регистрирует функцию следующего шага под именем name.
+// Имя сохраняется в базе вместе с шагом, поэтому его нельзя менять без миграции данных.
+func RegisterStepFunc(name string, f NextStepFunc) {
+	stepFuncsMu.Lock()
+	defer stepFuncsMu.Unlock()
+
+	if _, ok := stepFuncs[name]; ok {
+		panic(fmt.Sprintf("next step function %q is already registered", name))
+	}
+
+	stepFuncs[name] = f
 }
 
+func getStepFunc(name string) (NextStepFunc, bool) {
+	stepFuncsMu.RLock()
+	defer stepFuncsMu.RUnlock()
+
+	f, ok := stepFuncs[name]
+
+	return f, ok
+}
+
+// ParamInt достает целочисленный параметр шага независимо от того,
+// был ли он сохранен как int, пришел из JSON как float64 или передан строкой
+func ParamInt(params map[string]any, key string) (int, error) {
+	switch v := params[key].(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		return int(v), nil
+	case string:
+		return strconv.Atoi(v)
+	default:
+		return 0, fmt.Errorf("step param %q is missing or has unexpected type %T", key, v)
+	}
+}
+
+// NextStepManager управляет следующими шагами диалогов.
+// Безопасен для одновременного использования из нескольких воркеров:
+// операции над шагом одного пользователя в одном чате выполняются последовательно,
+// а забирает шаг из хранилища ровно один вызов (см. StepStore.Take).
 type NextStepManager struct {
-	nextStepActions map[NextStepKey]NextStepAction
+	store StepStore
+	locks [keyLockStripes]sync.Mutex
 }
 
-// Глобальный экземпляр NextStepManager
-var GlobalNextStepManager = &NextStepManager{
-	nextStepActions: make(map[NextStepKey]NextStepAction),
+// NewNextStepManager создает менеджер шагов поверх хранилища store
+func NewNextStepManager(store StepStore) *NextStepManager {
+	return &NextStepManager{store: store}
+}
+
+// Глобальный экземпляр NextStepManager; задается при старте через SetNextStepManager
+var GlobalNextStepManager *NextStepManager
+
+// SetNextStepManager задает глобальный экземпляр NextStepManager
+func SetNextStepManager(m *NextStepManager) {
+	GlobalNextStepManager = m
 }
 
 // GetNextStepManager возвращает глобальный экземпляр NextStepManager
@@ -44,64 +146,154 @@ func GetNextStepManager() *NextStepManager {
 	return GlobalNextStepManager
 }
 
-func (n *NextStepManager) RegisterNextStepAction(stepKey NextStepKey, action NextStepAction) {
-	n.nextStepActions[stepKey] = action
+// lock блокирует операции над шагом stepKey и возвращает функцию разблокировки
+func (n *NextStepManager) lock(stepKey NextStepKey) func() {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d:%d", stepKey.ChatID, stepKey.UserID)
+
+	mu := &n.locks[h.Sum64()%keyLockStripes]
+	mu.Lock()
+
+	return mu.Unlock
+}
+
+// RegisterNextStepAction сохраняет следующий шаг для stepKey, заменяя прежний.
+// ctx - контекст текущего обновления; его correlation_id сохраняется вместе с шагом.
+func (n *NextStepManager) RegisterNextStepAction(ctx context.Context, stepKey NextStepKey, action NextStepAction) error {
+	if _, ok := getStepFunc(action.FuncName); !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownStepFunc, action.FuncName)
+	}
+
+	if action.Params == nil {
+		action.Params = make(map[string]any)
+	}
+
+	if action.CreatedAtTS == 0 {
+		action.CreatedAtTS = time.Now().Unix()
+	}
+
+	if action.CorrelationID == "" {
+		action.CorrelationID = logger.CorrelationID(ctx)
+	}
+
+	defer n.lock(stepKey)()
+
+	return n.store.Save(stepKey, action)
 }
 
-func (n NextStepManager) RemoveNextStepAction(stepKey NextStepKey, bot tgbotapi.BotAPI, sendCancelMessage bool) {
-	if sendCancelMessage && n.nextStepActions[stepKey].CancelMessage != "" {
-		bot.Send(tgbotapi.NewMessage(stepKey.ChatID, n.nextStepActions[stepKey].CancelMessage))
+func (n *NextStepManager) RemoveNextStepAction(stepKey NextStepKey, bot telegram.BotClient, sendCancelMessage bool) {
+	unlock := n.lock(stepKey)
+	action, ok, err := n.store.Take(stepKey)
+	unlock()
+
+	if err != nil {
+		logger.GetLogger().Error("remove next step says: %v\n", err)
+		return
 	}
 
-	delete(n.nextStepActions, stepKey)
+	if sendCancelMessage && ok && action.CancelMessage != "" {
+		bot.Send(tgbotapi.NewMessage(stepKey.ChatID, action.CancelMessage))
+	}
 }
 
-func (n NextStepManager) RunUpdates(update tgbotapi.Update, client tgbotapi.BotAPI) error {
+func (n *NextStepManager) RunUpdates(ctx context.Context, update tgbotapi.Update, env StepEnv) error {
 	if update.Message == nil {
 		return nil
 	}
 
 	key := NextStepKey{ChatID: update.Message.Chat.ID, UserID: update.Message.From.ID}
 
-	action, ok := n.nextStepActions[key]
+	action, ok, err := n.takeForMessage(key, update.Message)
+	if err != nil || !ok {
+		return err
+	}
+
+	if action.ExpiresAtTS() <= time.Now().Unix() {
+		// Шаг просрочен, но сборщик до него еще не дошел
+		if action.CancelMessage != "" {
+			env.Client.Send(tgbotapi.NewMessage(key.ChatID, action.CancelMessage))
+		}
 
-	if !ok {
 		return nil
 	}
 
-	if update.Message.IsCommand() {
-		return ErrMessageIsCommand
+	f, ok := getStepFunc(action.FuncName)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownStepFunc, action.FuncName)
 	}
 
-	GlobalNextStepManager.RemoveNextStepAction(key, client, false)
+	ctx = logger.WithFields(ctx, "step", action.FuncName, "step_origin", action.CorrelationID)
 
-	return action.Func(client, update, action.Params)
+	return f(ctx, env, update, action.Params)
 }
 
-func (n *NextStepManager) ClearOldSteps(client tgbotapi.BotAPI) (int, error) {
-	now := time.Now().Unix()
-	deleted := 0
+// takeForMessage забирает шаг key для сообщения message.
+// Команды шаг не забирают: он остается ждать обычного сообщения.
+func (n *NextStepManager) takeForMessage(key NextStepKey, message *tgbotapi.Message) (NextStepAction, bool, error) {
+	defer n.lock(key)()
 
-	for key, action := range n.nextStepActions {
-		if now-action.CreatedAtTS > StepTimeout {
-			n.RemoveNextStepAction(key, client, true)
-			deleted++
+	if message.IsCommand() {
+		_, ok, err := n.store.Get(key)
+		if err == nil && ok {
+			err = ErrMessageIsCommand
 		}
+
+		return NextStepAction{}, false, err
 	}
 
-	return deleted, nil
+	return n.store.Take(key)
 }
 
-func RunStepUpdates(update tgbotapi.Update, stepManager *NextStepManager, client tgbotapi.BotAPI) {
-	err := stepManager.RunUpdates(update, client)
+// ClearOldSteps удаляет просроченные шаги и отправляет пользователям сообщения об отмене.
+// Возвращает количество удаленных шагов.
+func (n *NextStepManager) ClearOldSteps(client telegram.BotClient) (int, error) {
+	expired, err := n.store.TakeExpired(time.Now().Unix())
 	if err != nil {
-		logger.GetLogger().Error("run next steps says: %v\n", err)
+		return 0, err
+	}
+
+	for key, action := range expired {
+		if action.CancelMessage != "" {
+			client.Send(tgbotapi.NewMessage(key.ChatID, action.CancelMessage))
+		}
 	}
 
-	stepsCleaned, err := stepManager.ClearOldSteps(client)
+	return len(expired), nil
+}
+
+// RunSweeper раз в interval удаляет просроченные шаги, пока не отменен ctx.
+// Запускается отдельной горутиной.
+func (n *NextStepManager) RunSweeper(ctx context.Context, client telegram.BotClient, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			stepsCleaned, err := n.ClearOldSteps(client)
+			if err != nil {
+				logger.GetLogger().Error("clear old steps says: %v\n", err)
+			} else if stepsCleaned != 0 {
+				logger.GetLogger().Info("Cleaned %d old steps\n", stepsCleaned)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RunStepUpdates выполняет следующий шаг для обновления.
+// Возвращает ошибку функции следующего шага (она также пишется в лог).
+// Команда во время ожидающего шага - не ошибка: шаг просто ждет обычного сообщения.
+func RunStepUpdates(ctx context.Context, update tgbotapi.Update, stepManager *NextStepManager, env StepEnv) error {
+	err := stepManager.RunUpdates(ctx, update, env)
+	if errors.Is(err, ErrMessageIsCommand) {
+		logger.FromContext(ctx).Debugw("Next step is waiting, command is handled by routes")
+		return nil
+	}
 	if err != nil {
-		logger.GetLogger().Error("clear old steps says: %v\n", err)
-	} else if stepsCleaned != 0 {
-		logger.GetLogger().Info("Cleaned %d old steps\n", stepsCleaned)
+		logger.FromContext(ctx).Errorw("Next step failed", "error", err)
 	}
+
+	return err
 }
@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"context"
+	"main/telegram"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// memStepStore - StepStore в памяти с теми же гарантиями атомарности, что и PgStepStore
+type memStepStore struct {
+	mu    sync.Mutex
+	steps map[NextStepKey]NextStepAction
+}
+
+func newMemStepStore() *memStepStore {
+	return &memStepStore{steps: make(map[NextStepKey]NextStepAction)}
+}
+
+func (s *memStepStore) Save(key NextStepKey, action NextStepAction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.steps[key] = action
+
+	return nil
+}
+
+func (s *memStepStore) Get(key NextStepKey) (NextStepAction, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	action, ok := s.steps[key]
+
+	return action, ok, nil
+}
+
+func (s *memStepStore) Take(key NextStepKey) (NextStepAction, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	action, ok := s.steps[key]
+	delete(s.steps, key)
+
+	return action, ok, nil
+}
+
+func (s *memStepStore) TakeExpired(ts int64) (map[NextStepKey]NextStepAction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make(map[NextStepKey]NextStepAction)
+	for key, action := range s.steps {
+		if action.ExpiresAtTS() <= ts {
+			res[key] = action
+			delete(s.steps, key)
+		}
+	}
+
+	return res, nil
+}
+
+// stepRuns - сколько раз тестовый шаг выполнился для каждого пользователя
+var stepRuns sync.Map
+
+const countStep = "testCountStep"
+
+func init() {
+	RegisterStepFunc(countStep, func(_ context.Context, _ StepEnv, update tgbotapi.Update, _ map[string]any) error {
+		counter, _ := stepRuns.LoadOrStore(update.Message.From.ID, new(int64))
+		atomic.AddInt64(counter.(*int64), 1)
+		return nil
+	})
+}
+
+func textUpdate(userID int64, text string) tgbotapi.Update {
+	return tgbotapi.Update{Message: &tgbotapi.Message{
+		From: &tgbotapi.User{ID: userID},
+		Chat: &tgbotapi.Chat{ID: userID},
+		Text: text,
+	}}
+}
+
+// TestNextStepManagerConcurrent регистрирует, выполняет и просрочивает шаги из многих горутин.
+// Запускать с -race: go test -race ./controllers
+func TestNextStepManagerConcurrent(t *testing.T) {
+	const (
+		users   = 50
+		retries = 3
+	)
+
+	stepRuns.Clear()
+
+	manager := NewNextStepManager(newMemStepStore())
+	bot := telegram.NewFakeBot()
+	env := StepEnv{Client: bot}
+	ctx := context.Background()
+
+	stop := make(chan struct{})
+	var sweepers sync.WaitGroup
+	for range 4 {
+		sweepers.Add(1)
+		go func() {
+			defer sweepers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					if _, err := manager.ClearOldSteps(bot); err != nil {
+						t.Errorf("clear old steps: %v", err)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	for i := range users {
+		// Четные пользователи ждут обычного шага, нечетные - уже просроченного
+		userID := int64(i + 1)
+		expired := i%2 == 1
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			action := NextStepAction{FuncName: countStep, Timeout: time.Hour, CancelMessage: "cancelled"}
+			if expired {
+				action.CreatedAtTS = time.Now().Add(-2 * time.Hour).Unix()
+			}
+
+			if err := manager.RegisterNextStepAction(ctx, NextStepKey{ChatID: userID, UserID: userID}, action); err != nil {
+				t.Errorf("register step for %d: %v", userID, err)
+				return
+			}
+
+			// Одно и то же сообщение приходит несколько раз одновременно: шаг должен выполниться один раз
+			var runs sync.WaitGroup
+			for range retries {
+				runs.Add(1)
+				go func() {
+					defer runs.Done()
+					if err := manager.RunUpdates(ctx, textUpdate(userID, "answer"), env); err != nil {
+						t.Errorf("run step for %d: %v", userID, err)
+					}
+				}()
+			}
+			runs.Wait()
+		}()
+	}
+
+	wg.Wait()
+	close(stop)
+	sweepers.Wait()
+
+	cancelled := make(map[int64]int)
+	for _, r := range bot.Sent() {
+		cancelled[r.ChatID]++
+	}
+
+	for i := range users {
+		userID := int64(i + 1)
+
+		var runs int64
+		if counter, ok := stepRuns.Load(userID); ok {
+			runs = atomic.LoadInt64(counter.(*int64))
+		}
+
+		if i%2 == 1 {
+			if runs != 0 || cancelled[userID] != 1 {
+				t.Errorf("expired step of user %d: ran %d times, cancelled %d times, want 0 and 1", userID, runs, cancelled[userID])
+			}
+		} else if runs != 1 || cancelled[userID] != 0 {
+			t.Errorf("step of user %d: ran %d times, cancelled %d times, want 1 and 0", userID, runs, cancelled[userID])
+		}
+	}
+}
+
+func TestRunStepUpdatesKeepsStepOnCommand(t *testing.T) {
+	stepRuns.Clear()
+
+	const userID = 7
+	manager := NewNextStepManager(newMemStepStore())
+	env := StepEnv{Client: telegram.NewFakeBot()}
+	ctx := context.Background()
+
+	if err := manager.RegisterNextStepAction(ctx, NextStepKey{ChatID: userID, UserID: userID}, NextStepAction{FuncName: countStep}); err != nil {
+		t.Fatal(err)
+	}
+
+	command := textUpdate(userID, "/start")
+	command.Message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len("/start")}}
+
+	if err := RunStepUpdates(ctx, command, manager, env); err != nil {
+		t.Fatalf("expected a command during a pending step to be handled, got %v", err)
+	}
+	if _, ok := stepRuns.Load(int64(userID)); ok {
+		t.Fatal("step ran for a command")
+	}
+
+	if err := RunStepUpdates(ctx, textUpdate(userID, "answer"), manager, env); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stepRuns.Load(int64(userID)); !ok {
+		t.Error("step did not run for the message after the command")
+	}
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"main/database/models"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// StepStore - хранилище следующих шагов
+type StepStore interface {
+	Save(key NextStepKey, action NextStepAction) error
+	Get(key NextStepKey) (NextStepAction, bool, error)
+	// Take атомарно достает и удаляет шаг: если шаг забирают одновременно,
+	// получит его только один вызов
+	Take(key NextStepKey) (NextStepAction, bool, error)
+	// TakeExpired атомарно достает и удаляет шаги, истекшие к моменту ts
+	TakeExpired(ts int64) (map[NextStepKey]NextStepAction, error)
+}
+
+// PgStepStore хранит следующие шаги в таблице next_steps,
+// поэтому они переживают перезапуск бота
+type PgStepStore struct {
+	DB *pg.DB
+}
+
+func toModel(key NextStepKey, action NextStepAction) *models.NextStep {
+	return &models.NextStep{
+		ChatID:        key.ChatID,
+		UserID:        key.UserID,
+		FuncName:      action.FuncName,
+		Params:        action.Params,
+		CancelMessage: action.CancelMessage,
+		CorrelationID: action.CorrelationID,
+		CreatedAtTS:   action.CreatedAtTS,
+		ExpiresAtTS:   action.ExpiresAtTS(),
+	}
+}
+
+func fromModel(step models.NextStep) (NextStepKey, NextStepAction) {
+	params := step.Params
+	if params == nil {
+		params = make(map[string]any)
+	}
+
+	return NextStepKey{ChatID: step.ChatID, UserID: step.UserID}, NextStepAction{
+		FuncName:      step.FuncName,
+		Params:        params,
+		CreatedAtTS:   step.CreatedAtTS,
+		Timeout:       time.Duration(step.ExpiresAtTS-step.CreatedAtTS) * time.Second,
+		CancelMessage: step.CancelMessage,
+		CorrelationID: step.CorrelationID,
+	}
+}
+
+func (s PgStepStore) Save(key NextStepKey, action NextStepAction) error {
+	_, err := s.DB.Model(toModel(key, action)).
+		OnConflict("(chat_id, user_id) DO UPDATE").
+		Set("func_name = EXCLUDED.func_name").
+		Set("params = EXCLUDED.params").
+		Set("cancel_message = EXCLUDED.cancel_message").
+		Set("correlation_id = EXCLUDED.correlation_id").
+		Set("created_at_ts = EXCLUDED.created_at_ts").
+		Set("expires_at_ts = EXCLUDED.expires_at_ts").
+		Insert()
+
+	return err
+}
+
+func (s PgStepStore) Get(key NextStepKey) (NextStepAction, bool, error) {
+	step := models.NextStep{ChatID: key.ChatID, UserID: key.UserID}
+	err := s.DB.Model(&step).WherePK().Select()
+	if err == pg.ErrNoRows {
+		return NextStepAction{}, false, nil
+	}
+	if err != nil {
+		return NextStepAction{}, false, err
+	}
+
+	_, action := fromModel(step)
+
+	return action, true, nil
+}
+
+func (s PgStepStore) Take(key NextStepKey) (NextStepAction, bool, error) {
+	step := models.NextStep{ChatID: key.ChatID, UserID: key.UserID}
+	res, err := s.DB.Model(&step).WherePK().Returning("*").Delete()
+	if err == pg.ErrNoRows || (err == nil && res.RowsAffected() == 0) {
+		return NextStepAction{}, false, nil
+	}
+	if err != nil {
+		return NextStepAction{}, false, err
+	}
+
+	_, action := fromModel(step)
+
+	return action, true, nil
+}
+
+func (s PgStepStore) TakeExpired(ts int64) (map[NextStepKey]NextStepAction, error) {
+	var steps []models.NextStep
+	_, err := s.DB.Model(&steps).Where("expires_at_ts <= ?", ts).Returning("*").Delete()
+	if err != nil && err != pg.ErrNoRows {
+		return nil, err
+	}
+
+	res := make(map[NextStepKey]NextStepAction, len(steps))
+	for _, step := range steps {
+		key, action := fromModel(step)
+		res[key] = action
+	}
+
+	return res, nil
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"main/config"
+	"main/logger"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func pgOptions(o config.Database) *pg.Options {
+	return &pg.Options{
+		Addr:         o.Host + ":" + o.Port,
+		User:         o.User,
+		Password:     o.Password,
+		Database:     o.Name,
+		PoolSize:     o.PoolSize,
+		MinIdleConns: o.MinIdleConns,
+		DialTimeout:  o.DialTimeout,
+		ReadTimeout:  o.ReadTimeout,
+		WriteTimeout: o.WriteTimeout,
+		PoolTimeout:  o.PoolTimeout,
+		IdleTimeout:  o.IdleTimeout,
+		MaxConnAge:   o.MaxConnAge,
+	}
+}
+
+// Open создает общий пул соединений и проверяет, что база доступна.
+// Пул создается один раз при старте и передается в обработчики; закрывать его нужно при остановке бота.
+func Open(ctx context.Context, opts config.Database) (*pg.DB, error) {
+	db := pg.Connect(pgOptions(opts))
+
+	pingCtx, cancel := context.WithTimeout(ctx, opts.DialTimeout)
+	defer cancel()
+
+	if err := db.Ping(pingCtx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("database is unreachable: %w", err)
+	}
+
+	return db, nil
+}
+
+// RunHealthChecks раз в interval проверяет доступность базы и пишет в лог, когда она пропадает
+// и когда снова становится доступна. Блокируется до отмены ctx.
+func RunHealthChecks(ctx context.Context, db *pg.DB, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	healthy := true
+	for {
+		select {
+		case <-ticker.C:
+			pingCtx, cancel := context.WithTimeout(ctx, interval)
+			err := db.Ping(pingCtx)
+			cancel()
+
+			switch {
+			case err != nil && healthy:
+				logger.GetLogger().Error("Database health check failed: %v", err)
+			case err == nil && !healthy:
+				logger.GetLogger().Info("Database is reachable again")
+			}
+			healthy = err == nil
+
+			stats := db.PoolStats()
+			logger.GetLogger().Debug("Database pool: total=%d idle=%d stale=%d timeouts=%d", stats.TotalConns, stats.IdleConns, stats.StaleConns, stats.Timeouts)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
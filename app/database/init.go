@@ -1,80 +1,44 @@
 package database
 
 import (
-	"main/database/models"
-	"os"
+	"context"
+	"fmt"
+	"main/database/migrations"
+	"main/logger"
 
 	"github.com/go-pg/pg/v10"
-	"github.com/go-pg/pg/v10/orm"
 )
 
-func Connect() *pg.DB {
-	db := pg.Connect(&pg.Options{
-		Addr:     os.Getenv("DB_HOST") + ":" + os.Getenv("DB_PORT"),
-		User:     os.Getenv("DB_USER"),
-		Password: os.Getenv("DB_PASSWORD"),
-		Database: os.Getenv("DB_NAME"),
-	})
-
-	return db
-}
-
-func InitDb() error {
-	db := Connect()
-	defer db.Close()
-
-	models := []interface{}{
-		(*models.TelegramUser)(nil),
-		(*models.Catalog)(nil),
-		(*models.Product)(nil),
-		(*models.AddedProducts)(nil),
-		(*models.Transaction)(nil),
-		(*models.ShopViewSession)(nil),
+// Migrate применяет к базе все непримененные миграции схемы (см. пакет migrations).
+// Безопасно вызывать одновременно с нескольких инстансов.
+func Migrate(ctx context.Context, db *pg.DB) error {
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
 	}
 
-	for _, model := range models {
-		err := db.Model(model).CreateTable(&orm.CreateTableOptions{
-			Temp:        false,
-			IfNotExists: true,
-		})
-		if err != nil {
-			return err
-		}
+	applied, err := migrator.Up(ctx)
+	for _, m := range applied {
+		logger.GetLogger().Info("Applied migration %04d_%s", m.Version, m.Name)
 	}
 
-	createForeignKeys(db)
-
-	return nil
+	return err
 }
 
-func createForeignKeys(db *pg.DB) error {
-	fks := []string{
-		`ALTER TABLE added_products
-		ADD CONSTRAINT fk_added_products_transaction
-		FOREIGN KEY (transaction_id)
-		REFERENCES transactions(id)
-		ON DELETE CASCADE;`,
-
-		`ALTER TABLE added_products
-		ADD CONSTRAINT fk_added_products_product
-		FOREIGN KEY (product_id)
-		REFERENCES products(id)
-		ON DELETE CASCADE;`,
-
-		`ALTER TABLE added_products
-		ADD CONSTRAINT fk_added_products_user
-		FOREIGN KEY (user_id)
-		REFERENCES telegram_users(id)
-		ON DELETE CASCADE;`,
+// CheckMigrated возвращает ошибку, если в базе есть непримененные миграции
+func CheckMigrated(ctx context.Context, db *pg.DB) error {
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
 
-		`ALTER TABLE products
-		ADD CONSTRAINT fk_products_catalog
-		FOREIGN KEY (catalog_id) REFERENCES catalogs(id)
-		ON DELETE CASCADE;`,
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		return err
 	}
 
-	for _, fk := range fks {
-		db.Exec(fk)
+	if len(pending) > 0 {
+		return fmt.Errorf("%d pending migrations, first is %04d_%s", len(pending), pending[0].Version, pending[0].Name)
 	}
 
 	return nil
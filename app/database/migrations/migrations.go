@@ -0,0 +1,271 @@
+// Package migrations применяет версионированные SQL-миграции схемы базы.
+//
+// Миграции лежат в каталоге sql/ парами файлов NNNN_name.up.sql и NNNN_name.down.sql
+// и встраиваются в бинарник. Примененные версии записываются в таблицу schema_migrations,
+// а одновременный запуск миграций с нескольких инстансов исключается advisory lock'ом.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// lockID - ключ pg_advisory_lock, под которым выполняются миграции
+const lockID = 727_001
+
+//go:embed sql/*.sql
+var sqlFiles embed.FS
+
+var fileNameRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration - одна версия схемы
+// Version - номер версии (из префикса имени файла)
+// Name - название миграции
+// Up, Down - SQL применения и отката
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status - состояние миграции в базе
+type Status struct {
+	Migration
+	Applied bool
+}
+
+// Load читает встроенные миграции и возвращает их по возрастанию версии
+func Load() ([]Migration, error) {
+	return load(sqlFiles, "sql")
+}
+
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		m := fileNameRe.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("unexpected migration file name %q", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(m[1])
+		body, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		} else if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %04d has different names: %q and %q", version, migration.Name, m[2])
+		}
+
+		if m[3] == "up" {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+	}
+
+	res := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s must have both up and down files", migration.Version, migration.Name)
+		}
+		res = append(res, *migration)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+
+	return res, nil
+}
+
+// Migrator применяет и откатывает миграции
+type Migrator struct {
+	db         *pg.DB
+	migrations []Migration
+}
+
+// New создает Migrator со встроенными миграциями
+func New(db *pg.DB) (*Migrator, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// withLock выполняет f на отдельном соединении, удерживая advisory lock.
+// Второй инстанс, запустивший миграции одновременно, дождется окончания первого.
+func (m *Migrator) withLock(ctx context.Context, f func(conn *pg.Conn) error) error {
+	conn := m.db.Conn()
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(?)", lockID); err != nil {
+		return fmt.Errorf("acquire migrations lock: %w", err)
+	}
+	defer conn.Exec("SELECT pg_advisory_unlock(?)", lockID)
+
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return err
+	}
+
+	return f(conn)
+}
+
+// querier - общее у *pg.DB и *pg.Conn
+type querier interface {
+	QueryContext(c context.Context, model, query interface{}, params ...interface{}) (pg.Result, error)
+}
+
+func appliedVersions(ctx context.Context, conn querier) (map[int]bool, error) {
+	var versions []int
+	_, err := conn.QueryContext(ctx, pg.Scan(&versions), "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[int]bool, len(versions))
+	for _, v := range versions {
+		res[v] = true
+	}
+
+	return res, nil
+}
+
+// Pending возвращает непримененные миграции. Не захватывает блокировку миграций,
+// поэтому подходит для частых проверок (например, readiness).
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := appliedVersions(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Migration
+	for _, migration := range m.migrations {
+		if !applied[migration.Version] {
+			res = append(res, migration)
+		}
+	}
+
+	return res, nil
+}
+
+// Up применяет все непримененные миграции по возрастанию версии.
+// Каждая миграция выполняется в своей транзакции вместе с записью в schema_migrations.
+// Возвращает примененные миграции.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+
+	err := m.withLock(ctx, func(conn *pg.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if applied[migration.Version] {
+				continue
+			}
+
+			err := conn.RunInTransaction(ctx, func(tx *pg.Tx) error {
+				if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+					return err
+				}
+
+				_, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", migration.Version, migration.Name)
+
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s up: %w", migration.Version, migration.Name, err)
+			}
+
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Down откатывает steps последних примененных миграций.
+// Возвращает откаченные миграции.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+
+	err := m.withLock(ctx, func(conn *pg.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.migrations[i]
+			if !applied[migration.Version] {
+				continue
+			}
+
+			err := conn.RunInTransaction(ctx, func(tx *pg.Tx) error {
+				if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+					return err
+				}
+
+				_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s down: %w", migration.Version, migration.Name, err)
+			}
+
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Status возвращает все известные миграции с отметкой, применены ли они
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var res []Status
+
+	err := m.withLock(ctx, func(conn *pg.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			res = append(res, Status{Migration: migration, Applied: applied[migration.Version]})
+		}
+
+		return nil
+	})
+
+	return res, err
+}
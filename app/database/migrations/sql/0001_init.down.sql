@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS next_steps;
+DROP TABLE IF EXISTS shop_view_sessions;
+DROP TABLE IF EXISTS added_products;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS products;
+DROP TABLE IF EXISTS catalogs;
+DROP TABLE IF EXISTS telegram_users;
@@ -0,0 +1,107 @@
+-- Схема на момент перехода на миграции. IF NOT EXISTS позволяет применить миграцию
+-- к базе, которую раньше создавал InitDb через CreateTable.
+
+CREATE TABLE IF NOT EXISTS telegram_users (
+    id bigserial,
+    created_at_ts bigint DEFAULT extract(epoch from now()),
+    updated_at_ts bigint DEFAULT extract(epoch from now()),
+    fio text DEFAULT null,
+    phone text DEFAULT null,
+    delivery_address text DEFAULT null,
+    delivery_service text DEFAULT 'cdek',
+    is_authorized boolean DEFAULT false,
+    username text,
+    first_name text,
+    last_name text,
+    is_admin boolean DEFAULT false,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS catalogs (
+    id bigserial,
+    created_at bigint DEFAULT extract(epoch from now()),
+    name text,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS products (
+    id bigserial,
+    created_at bigint DEFAULT extract(epoch from now()),
+    image_file_id text,
+    name text,
+    description text,
+    price bigint,
+    catalog_id bigint,
+    availble_for_purchase bigint,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS added_products (
+    id bigserial,
+    user_id bigint,
+    product_id bigint,
+    product_count bigint DEFAULT 1,
+    transaction_id bigint,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id bigserial,
+    created_at_ts bigint DEFAULT extract(epoch from now()),
+    updated_at_ts bigint DEFAULT extract(epoch from now()),
+    user_id bigint,
+    is_waiting_for_approval boolean DEFAULT false,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS shop_view_sessions (
+    id bigserial,
+    user_id bigint,
+    chat_id bigint,
+    created_at bigint DEFAULT extract(epoch from now()),
+    updated_at bigint DEFAULT extract(epoch from now()),
+    catalog_id bigint,
+    product_at_id bigint,
+    offest bigint DEFAULT 0,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS next_steps (
+    chat_id bigint,
+    user_id bigint,
+    func_name text NOT NULL,
+    params jsonb,
+    cancel_message text,
+    created_at_ts bigint DEFAULT extract(epoch from now()),
+    expires_at_ts bigint NOT NULL,
+    PRIMARY KEY (chat_id, user_id)
+);
+
+-- Внешние ключи могли быть уже созданы старым createForeignKeys
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_added_products_transaction') THEN
+        ALTER TABLE added_products
+            ADD CONSTRAINT fk_added_products_transaction
+            FOREIGN KEY (transaction_id) REFERENCES transactions (id) ON DELETE CASCADE;
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_added_products_product') THEN
+        ALTER TABLE added_products
+            ADD CONSTRAINT fk_added_products_product
+            FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE CASCADE;
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_added_products_user') THEN
+        ALTER TABLE added_products
+            ADD CONSTRAINT fk_added_products_user
+            FOREIGN KEY (user_id) REFERENCES telegram_users (id) ON DELETE CASCADE;
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_products_catalog') THEN
+        ALTER TABLE products
+            ADD CONSTRAINT fk_products_catalog
+            FOREIGN KEY (catalog_id) REFERENCES catalogs (id) ON DELETE CASCADE;
+    END IF;
+END
+$$;
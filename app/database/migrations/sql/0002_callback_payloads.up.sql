@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS callback_payloads (
+    token text PRIMARY KEY,
+    data text NOT NULL,
+    created_at_ts bigint DEFAULT extract(epoch from now())
+);
@@ -0,0 +1 @@
+ALTER TABLE next_steps DROP COLUMN IF EXISTS correlation_id;
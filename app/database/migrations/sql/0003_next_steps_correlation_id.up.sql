@@ -0,0 +1 @@
+ALTER TABLE next_steps ADD COLUMN IF NOT EXISTS correlation_id text;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS admin_audit_entries;
+
+ALTER TABLE telegram_users DROP COLUMN IF EXISTS is_owner;
@@ -0,0 +1,12 @@
+ALTER TABLE telegram_users ADD COLUMN IF NOT EXISTS is_owner boolean DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS admin_audit_entries (
+    id bigserial,
+    actor_id bigint NOT NULL,
+    target_id bigint NOT NULL,
+    action text NOT NULL,
+    created_at_ts bigint DEFAULT extract(epoch from now()),
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS admin_audit_entries_target_id_idx ON admin_audit_entries (target_id);
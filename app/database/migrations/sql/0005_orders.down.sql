@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS order_status_changes;
+DROP TABLE IF EXISTS order_lines;
+DROP TABLE IF EXISTS orders;
+DROP SEQUENCE IF EXISTS order_numbers;
@@ -0,0 +1,50 @@
+CREATE SEQUENCE IF NOT EXISTS order_numbers START 1001;
+
+CREATE TABLE IF NOT EXISTS orders (
+    id bigserial,
+    number bigint NOT NULL DEFAULT nextval('order_numbers'),
+    created_at_ts bigint DEFAULT extract(epoch from now()),
+    updated_at_ts bigint DEFAULT extract(epoch from now()),
+    user_id bigint NOT NULL REFERENCES telegram_users (id) ON DELETE CASCADE,
+    transaction_id bigint,
+    status text NOT NULL,
+    total_price bigint NOT NULL DEFAULT 0,
+    fio text,
+    phone text,
+    delivery_address text,
+    delivery_service text,
+    username text,
+    receipt_file_id text,
+    receipt_is_document boolean DEFAULT false,
+    PRIMARY KEY (id),
+    UNIQUE (number)
+);
+
+CREATE INDEX IF NOT EXISTS orders_user_id_idx ON orders (user_id, id);
+CREATE INDEX IF NOT EXISTS orders_status_idx ON orders (status, id);
+
+-- Название и цена товара копируются в строку заказа: товар могут изменить или удалить
+CREATE TABLE IF NOT EXISTS order_lines (
+    id bigserial,
+    order_id bigint NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    product_id bigint REFERENCES products (id) ON DELETE SET NULL,
+    name text NOT NULL,
+    unit_price bigint NOT NULL,
+    quantity bigint NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS order_lines_order_id_idx ON order_lines (order_id);
+
+CREATE TABLE IF NOT EXISTS order_status_changes (
+    id bigserial,
+    order_id bigint NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    from_status text,
+    to_status text NOT NULL,
+    actor_id bigint NOT NULL DEFAULT 0,
+    note text,
+    created_at_ts bigint DEFAULT extract(epoch from now()),
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS order_status_changes_order_id_idx ON order_status_changes (order_id, id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS orders_created_at_ts_idx;
+DROP TABLE IF EXISTS order_notes;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS order_notes (
+    id bigserial,
+    order_id bigint NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    author_id bigint NOT NULL,
+    text text NOT NULL,
+    created_at_ts bigint DEFAULT extract(epoch from now()),
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS order_notes_order_id_idx ON order_notes (order_id, id);
+CREATE INDEX IF NOT EXISTS orders_created_at_ts_idx ON orders (created_at_ts);
@@ -0,0 +1,2 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS carrier text;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tracking_number text;
@@ -0,0 +1,13 @@
+-- Без резервов товар неоплаченных заказов снова считается списанным со склада
+UPDATE products p
+SET availble_for_purchase = p.availble_for_purchase - r.quantity
+FROM (
+    SELECT s.product_id, sum(s.quantity) AS quantity
+    FROM stock_reservations s
+    JOIN orders o ON o.id = s.order_id
+    WHERE o.status IN ('awaiting_payment', 'payment_review')
+    GROUP BY s.product_id
+) r
+WHERE p.id = r.product_id;
+
+DROP TABLE IF EXISTS stock_reservations;
@@ -0,0 +1,30 @@
+-- Товар неоплаченного заказа резервируется на время, а не списывается со склада сразу.
+-- expires_at_ts IS NULL - резерв держится, пока администратор проверяет чек
+CREATE TABLE IF NOT EXISTS stock_reservations (
+    id bigserial,
+    order_id bigint NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    product_id bigint NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    quantity bigint NOT NULL CHECK (quantity > 0),
+    expires_at_ts bigint,
+    created_at_ts bigint DEFAULT extract(epoch from now()),
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS stock_reservations_product_id_idx ON stock_reservations (product_id);
+CREATE INDEX IF NOT EXISTS stock_reservations_order_id_idx ON stock_reservations (order_id);
+CREATE INDEX IF NOT EXISTS stock_reservations_expires_at_ts_idx ON stock_reservations (expires_at_ts);
+
+-- Раньше товар списывался при показе страницы оплаты: возвращаем его на склад
+-- и резервируем под еще не оплаченные заказы
+INSERT INTO stock_reservations (order_id, product_id, quantity, expires_at_ts)
+SELECT l.order_id, l.product_id, sum(l.quantity),
+       CASE WHEN o.status = 'payment_review' THEN NULL ELSE extract(epoch from now())::bigint + 3600 END
+FROM order_lines l
+JOIN orders o ON o.id = l.order_id
+WHERE o.status IN ('awaiting_payment', 'payment_review') AND l.product_id IS NOT NULL
+GROUP BY l.order_id, l.product_id, o.status;
+
+UPDATE products p
+SET availble_for_purchase = p.availble_for_purchase + r.quantity
+FROM (SELECT product_id, sum(quantity) AS quantity FROM stock_reservations GROUP BY product_id) r
+WHERE p.id = r.product_id;
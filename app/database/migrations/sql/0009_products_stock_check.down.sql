@@ -0,0 +1,3 @@
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_availble_for_purchase_check;
+ALTER TABLE products ALTER COLUMN availble_for_purchase DROP NOT NULL;
+ALTER TABLE products ALTER COLUMN availble_for_purchase DROP DEFAULT;
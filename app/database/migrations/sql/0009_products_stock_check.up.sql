@@ -0,0 +1,6 @@
+-- Остаток товара не может уйти в минус: списание, которому не хватает товара, завершается ошибкой
+UPDATE products SET availble_for_purchase = 0 WHERE availble_for_purchase IS NULL OR availble_for_purchase < 0;
+
+ALTER TABLE products ALTER COLUMN availble_for_purchase SET DEFAULT 0;
+ALTER TABLE products ALTER COLUMN availble_for_purchase SET NOT NULL;
+ALTER TABLE products ADD CONSTRAINT products_availble_for_purchase_check CHECK (availble_for_purchase >= 0);
@@ -0,0 +1,2 @@
+ALTER TABLE added_products DROP COLUMN IF EXISTS unit_price;
+ALTER TABLE added_products DROP COLUMN IF EXISTS name;
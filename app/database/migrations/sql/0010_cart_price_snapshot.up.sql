@@ -0,0 +1,8 @@
+-- Корзина запоминает название и цену товара, которые видел покупатель
+ALTER TABLE added_products ADD COLUMN IF NOT EXISTS name text;
+ALTER TABLE added_products ADD COLUMN IF NOT EXISTS unit_price bigint;
+
+UPDATE added_products a
+SET name = p.name, unit_price = p.price
+FROM products p
+WHERE p.id = a.product_id AND a.unit_price IS NULL;
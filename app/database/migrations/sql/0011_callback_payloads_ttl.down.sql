@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS callback_payloads_created_at_ts_idx;
+ALTER TABLE callback_payloads ALTER COLUMN created_at_ts DROP NOT NULL;
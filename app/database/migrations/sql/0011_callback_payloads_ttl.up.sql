@@ -0,0 +1,6 @@
+-- Длинные callback data хранятся ограниченное время: created_at_ts обновляется при каждой
+-- отрисовке кнопки, устаревшие записи удаляются периодически (см. callback.PgStore.Purge)
+UPDATE callback_payloads SET created_at_ts = extract(epoch from now()) WHERE created_at_ts IS NULL;
+ALTER TABLE callback_payloads ALTER COLUMN created_at_ts SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS callback_payloads_created_at_ts_idx ON callback_payloads (created_at_ts);
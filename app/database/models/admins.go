@@ -0,0 +1,174 @@
+package models
+
+import (
+	"errors"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// Действия в журнале изменений прав (AdminAuditEntry.Action)
+const (
+	AdminActionGrant          = "grant"
+	AdminActionRevoke         = "revoke"
+	AdminActionBootstrapOwner = "bootstrap_owner"
+	AdminActionDemoteOwner    = "demote_owner"
+)
+
+// ErrOwnerRights - права владельца нельзя изменить через бота
+var ErrOwnerRights = errors.New("owner rights cannot be changed")
+
+// AdminAuditEntry - запись журнала изменений прав администраторов
+// ActorID - кто изменил права (0 - сам бот при старте, см. BootstrapOwner)
+// TargetID - чьи права изменены
+type AdminAuditEntry struct {
+	ID       int64
+	ActorID  int64  `pg:",use_zero,notnull"`
+	TargetID int64  `pg:",notnull"`
+	Action   string `pg:",notnull"`
+
+	CreatedAtTS int64 `pg:",default:extract(epoch from now())"`
+}
+
+// SetAdmin выдает (admin = true) или снимает права администратора пользователя targetID
+// от имени actorID и записывает изменение в журнал. Возвращает false, если права уже такие.
+// Права владельца не меняются (ErrOwnerRights), отсутствующий пользователь - pg.ErrNoRows.
+func SetAdmin(db *pg.DB, actorID, targetID int64, admin bool) (bool, error) {
+	changed := false
+
+	err := db.RunInTransaction(db.Context(), func(tx *pg.Tx) error {
+		target := TelegramUser{ID: targetID}
+		if err := tx.Model(&target).WherePK().For("UPDATE").Select(); err != nil {
+			return err
+		}
+
+		if target.IsOwner {
+			return ErrOwnerRights
+		}
+		if target.IsAdmin == admin {
+			return nil
+		}
+
+		_, err := tx.Model(&target).WherePK().
+			Set("is_admin = ?", admin).
+			Set("updated_at_ts = extract(epoch from now())").
+			Update()
+		if err != nil {
+			return err
+		}
+
+		action := AdminActionRevoke
+		if admin {
+			action = AdminActionGrant
+		}
+
+		_, err = tx.Model(&AdminAuditEntry{ActorID: actorID, TargetID: targetID, Action: action}).Insert()
+		if err != nil {
+			return err
+		}
+
+		changed = true
+
+		return nil
+	})
+
+	return changed, err
+}
+
+// BootstrapOwner делает пользователя ownerID владельцем и администратором.
+// Если пользователь еще не писал боту, создается его запись: регистрация пройдет как обычно.
+// Прежние владельцы (если OWNER_ID сменился) в той же транзакции теряют права владельца,
+// но остаются администраторами: снять их может новый владелец.
+// Возвращает false, если пользователь уже единственный владелец.
+func BootstrapOwner(db *pg.DB, ownerID int64) (bool, error) {
+	changed := false
+
+	err := db.RunInTransaction(db.Context(), func(tx *pg.Tx) error {
+		var previous []TelegramUser
+		err := tx.Model(&previous).
+			Where("is_owner").
+			Where("id <> ?", ownerID).
+			For("UPDATE").
+			Select()
+		if err != nil {
+			return err
+		}
+
+		for _, p := range previous {
+			_, err = tx.Model(&p).WherePK().
+				Set("is_owner = false").
+				Set("updated_at_ts = extract(epoch from now())").
+				Update()
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Model(&AdminAuditEntry{TargetID: p.ID, Action: AdminActionDemoteOwner}).Insert()
+			if err != nil {
+				return err
+			}
+
+			changed = true
+		}
+
+		res, err := tx.Model(&TelegramUser{ID: ownerID, IsAdmin: true, IsOwner: true}).
+			OnConflict("(id) DO UPDATE").
+			Set("is_admin = true").
+			Set("is_owner = true").
+			Where("NOT telegram_user.is_owner").
+			Insert()
+		if err == pg.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if res.RowsAffected() == 0 {
+			return nil
+		}
+
+		_, err = tx.Model(&AdminAuditEntry{TargetID: ownerID, Action: AdminActionBootstrapOwner}).Insert()
+		if err != nil {
+			return err
+		}
+
+		changed = true
+
+		return nil
+	})
+
+	return changed, err
+}
+
+// ListAdmins возвращает администраторов: сначала владельцев, затем по id
+func ListAdmins(db *pg.DB) ([]TelegramUser, error) {
+	var admins []TelegramUser
+	err := db.Model(&admins).
+		Where("is_admin OR is_owner").
+		Order("is_owner DESC", "id ASC").
+		Select()
+
+	return admins, err
+}
+
+// RecentAdminAudit возвращает последние limit записей журнала изменений прав, новые первыми
+func RecentAdminAudit(db *pg.DB, limit int) ([]AdminAuditEntry, error) {
+	var entries []AdminAuditEntry
+	err := db.Model(&entries).
+		Order("id DESC").
+		Limit(limit).
+		Select()
+
+	return entries, err
+}
+
+// FindUserByUsername ищет пользователя по username без учета регистра (без @)
+func FindUserByUsername(db *pg.DB, username string) (TelegramUser, error) {
+	var user TelegramUser
+	err := db.Model(&user).
+		Where("lower(username) = lower(?)", username).
+		Limit(1).
+		Select()
+
+	return user, err
+}
@@ -0,0 +1,11 @@
+package models
+
+// CallbackPayload - callback data, не поместившиеся в 64 байта (см. callback.PgStore).
+// Кнопка хранит только Token, сами данные лежат в базе.
+// CreatedAtTS - когда кнопка с этими данными отрисована последний раз; по нему удаляются устаревшие записи
+type CallbackPayload struct {
+	Token string `pg:",pk"`
+	Data  string `pg:",notnull"`
+
+	CreatedAtTS int64 `pg:",default:extract(epoch from now()),notnull"`
+}
@@ -38,12 +38,19 @@ type Product struct {
 	CatalogID   int    `json:"catalog_id"`
 
 	AvailbleForPurchase int
+	// Reserved - сколько товара отложено под чужие неоплаченные заказы (см. LoadReservedStock)
+	Reserved int `pg:"-"`
 
 	Catalog      *Catalog           `pg:"rel:has-one,fk:catalog_id"`
 	ShopSessions []*ShopViewSession `pg:"rel:has-many,join_fk:product_at_id"`
 }
 
-func (p *Product) InUserCart(userId int64, db pg.DB) (bool, error) {
+// Available возвращает, сколько товара можно купить: наличие на складе за вычетом резервов
+func (p *Product) Available() int {
+	return max(p.AvailbleForPurchase-p.Reserved, 0)
+}
+
+func (p *Product) InUserCart(userId int64, db *pg.DB) (bool, error) {
 	cart := []AddedProducts{}
 	err := db.Model(&cart).Where("user_id = ?", userId).Where("product_id = ?", p.ID).Select()
 	if err != nil {
@@ -0,0 +1,17 @@
+package models
+
+// NextStep - сохраненный в базе следующий шаг диалога с пользователем.
+// Функция шага хранится по имени (см. controllers.RegisterStepFunc), параметры - в виде JSON.
+type NextStep struct {
+	ChatID int64 `pg:",pk,type:bigint"`
+	UserID int64 `pg:",pk,type:bigint"`
+
+	FuncName      string         `pg:",notnull"`
+	Params        map[string]any `pg:",type:jsonb"`
+	CancelMessage string
+	// CorrelationID - correlation_id обновления, зарегистрировавшего шаг
+	CorrelationID string
+
+	CreatedAtTS int64 `pg:",default:extract(epoch from now())"`
+	ExpiresAtTS int64 `pg:",notnull"`
+}
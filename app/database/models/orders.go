@@ -0,0 +1,494 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// OrderStatus - статус заказа. Переходы между статусами проверяет CanTransitionTo.
+type OrderStatus string
+
+const (
+	// OrderStatusDraft - заказ собран из корзины, покупатель еще не перешел к оплате
+	OrderStatusDraft OrderStatus = "draft"
+	// OrderStatusAwaitingPayment - покупателю показаны реквизиты, ждем чек
+	OrderStatusAwaitingPayment OrderStatus = "awaiting_payment"
+	// OrderStatusPaymentReview - чек отправлен администратору на проверку
+	OrderStatusPaymentReview OrderStatus = "payment_review"
+	// OrderStatusPaid - администратор принял оплату
+	OrderStatusPaid OrderStatus = "paid"
+	// OrderStatusShipped - заказ передан в службу доставки
+	OrderStatusShipped OrderStatus = "shipped"
+	// OrderStatusArrived - заказ ждет покупателя в пункте выдачи
+	OrderStatusArrived OrderStatus = "arrived"
+	// OrderStatusDelivered - покупатель получил заказ
+	OrderStatusDelivered OrderStatus = "delivered"
+	// OrderStatusCancelled - заказ отменен до оплаты (покупатель ушел или чек отклонен)
+	OrderStatusCancelled OrderStatus = "cancelled"
+	// OrderStatusRefunded - деньги за оплаченный заказ возвращены
+	OrderStatusRefunded OrderStatus = "refunded"
+)
+
+// orderTransitions - разрешенные переходы: из статуса-ключа можно перейти только в перечисленные.
+// cancelled и refunded - конечные статусы.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusDraft:           {OrderStatusAwaitingPayment, OrderStatusCancelled},
+	OrderStatusAwaitingPayment: {OrderStatusPaymentReview, OrderStatusCancelled},
+	OrderStatusPaymentReview:   {OrderStatusPaid, OrderStatusAwaitingPayment, OrderStatusCancelled},
+	OrderStatusPaid:            {OrderStatusShipped, OrderStatusRefunded},
+	OrderStatusShipped:         {OrderStatusArrived, OrderStatusDelivered, OrderStatusRefunded},
+	OrderStatusArrived:         {OrderStatusDelivered, OrderStatusRefunded},
+	OrderStatusDelivered:       {OrderStatusRefunded},
+}
+
+// orderStatusTitles - названия статусов для покупателей и администраторов
+var orderStatusTitles = map[OrderStatus]string{
+	OrderStatusDraft:           "Черновик",
+	OrderStatusAwaitingPayment: "Ожидает оплаты",
+	OrderStatusPaymentReview:   "Оплата на проверке",
+	OrderStatusPaid:            "Оплачен",
+	OrderStatusShipped:         "Отправлен",
+	OrderStatusArrived:         "Ждет в пункте выдачи",
+	OrderStatusDelivered:       "Доставлен",
+	OrderStatusCancelled:       "Отменен",
+	OrderStatusRefunded:        "Деньги возвращены",
+}
+
+// CanTransitionTo сообщает, разрешен ли переход из статуса s в статус to
+func (s OrderStatus) CanTransitionTo(to OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Active сообщает, что заказ еще в работе: не доставлен, не отменен и деньги не возвращены
+func (s OrderStatus) Active() bool {
+	switch s {
+	case OrderStatusDelivered, OrderStatusCancelled, OrderStatusRefunded:
+		return false
+	default:
+		return true
+	}
+}
+
+// Title возвращает название статуса на русском
+func (s OrderStatus) Title() string {
+	if title, ok := orderStatusTitles[s]; ok {
+		return title
+	}
+
+	return string(s)
+}
+
+// ErrInvalidTransition - переход между статусами заказа запрещен (например, заказ уже обработан)
+var ErrInvalidTransition = errors.New("invalid order status transition")
+
+// ErrEmptyOrder - в корзине нет товаров, заказ не из чего собрать
+var ErrEmptyOrder = errors.New("order has no items")
+
+// Order - заказ покупателя. Создается из корзины (Transaction) и переживает ее:
+// товары, суммы и данные доставки копируются в заказ в момент оформления.
+// Number - номер заказа, который видят покупатель и администраторы
+// TransactionID - корзина, из которой собран заказ (после оплаты корзина удаляется)
+// ReceiptFileID - file_id чека об оплате, ReceiptIsDocument - чек прислан PDF файлом, а не фото
+// Carrier, TrackingNumber - служба доставки (cdek, yandex) и трек-номер отправления
+type Order struct {
+	ID     int   `json:"id"`
+	Number int64 `pg:",default:nextval('order_numbers')" json:"number"`
+
+	CreatedAtTS int64 `pg:",default:extract(epoch from now())" json:"created_at_ts"`
+	UpdatedAtTS int64 `pg:",default:extract(epoch from now())" json:"updated_at_ts"`
+
+	UserID        int64         `pg:",notnull" json:"user_id"`
+	User          *TelegramUser `pg:"rel:has-one,fk:user_id"`
+	TransactionID int           `json:"transaction_id"`
+
+	Status     OrderStatus `pg:",notnull" json:"status"`
+	TotalPrice int         `pg:",use_zero,notnull" json:"total_price"`
+
+	FIO             string `json:"name"`
+	Phone           string `json:"phone"`
+	DeliveryAddress string `json:"delivery_address"`
+	DeliveryService string `json:"delivery_service"`
+	Username        string `json:"username"`
+
+	ReceiptFileID     string `json:"receipt_file_id"`
+	ReceiptIsDocument bool   `pg:",default:false" json:"receipt_is_document"`
+
+	Carrier        string `json:"carrier"`
+	TrackingNumber string `json:"tracking_number"`
+
+	Lines   []*OrderLine         `pg:"rel:has-many,join_fk:order_id"`
+	History []*OrderStatusChange `pg:"rel:has-many,join_fk:order_id"`
+}
+
+// OrderLine - позиция заказа. Name и UnitPrice - название и цена товара на момент оформления.
+// ProductID обнуляется, если товар удален из магазина.
+type OrderLine struct {
+	ID int `json:"id"`
+
+	OrderID   int      `pg:",notnull" json:"order_id"`
+	ProductID int      `json:"product_id"`
+	Product   *Product `pg:"rel:has-one,fk:product_id"`
+
+	Name      string `pg:",notnull" json:"name"`
+	UnitPrice int    `pg:",use_zero,notnull" json:"unit_price"`
+	Quantity  int    `pg:",notnull" json:"quantity"`
+}
+
+// OrderStatusChange - запись истории статусов заказа
+// FromStatus пуст у записи о создании заказа
+// ActorID - кто изменил статус: покупатель или администратор (0 - сам бот)
+type OrderStatusChange struct {
+	ID int `json:"id"`
+
+	OrderID    int         `pg:",notnull" json:"order_id"`
+	FromStatus OrderStatus `json:"from_status"`
+	ToStatus   OrderStatus `pg:",notnull" json:"to_status"`
+	ActorID    int64       `pg:",use_zero,notnull" json:"actor_id"`
+	Note       string      `json:"note"`
+
+	CreatedAtTS int64 `pg:",default:extract(epoch from now())" json:"created_at_ts"`
+}
+
+// OrderNote - заметка администратора к заказу; покупатель ее не видит
+type OrderNote struct {
+	ID int `json:"id"`
+
+	OrderID  int    `pg:",notnull" json:"order_id"`
+	AuthorID int64  `pg:",notnull" json:"author_id"`
+	Text     string `pg:",notnull" json:"text"`
+
+	CreatedAtTS int64 `pg:",default:extract(epoch from now())" json:"created_at_ts"`
+}
+
+// OrderFilter - отбор заказов для панели администратора
+// Statuses - статусы заказов (обязательны)
+// SinceTS - только заказы, оформленные не раньше этого момента (0 - за все время)
+// UserID - только заказы этого покупателя (0 - всех)
+type OrderFilter struct {
+	Statuses []OrderStatus
+	SinceTS  int64
+	UserID   int64
+}
+
+// CreateOrderFromCart собирает заказ в статусе draft из корзины transactionID пользователя u:
+// копирует товары и данные доставки. Здесь фиксируются цены заказа: позиции получают текущие
+// название и цену товара, и на них же в той же транзакции обновляется корзина. Дальнейшая смена
+// цены сумму заказа не меняет. Возвращает товары, цена которых отличается от той, что покупатель
+// видел в корзине. Незавершенные заказы той же корзины (draft и awaiting_payment) отменяются -
+// покупатель оформляет заказ заново. Пустая корзина - ErrEmptyOrder.
+func (u *TelegramUser) CreateOrderFromCart(db *pg.DB, transactionID int) (Order, []CartPriceChange, error) {
+	var order Order
+	var changes []CartPriceChange
+
+	err := db.RunInTransaction(db.Context(), func(tx *pg.Tx) error {
+		err := cancelOpenOrders(tx, transactionID, u.ID, "Заказ оформлен заново")
+		if err != nil {
+			return err
+		}
+
+		var cart []AddedProducts
+		err = tx.Model(&cart).
+			Where("transaction_id = ?", transactionID).
+			Relation("Product").
+			Order("added_products.id ASC").
+			Select()
+		if err != nil {
+			return err
+		}
+
+		order = Order{
+			UserID:          u.ID,
+			TransactionID:   transactionID,
+			Status:          OrderStatusDraft,
+			FIO:             u.FIO,
+			Phone:           u.Phone,
+			DeliveryAddress: u.DeliveryAddress,
+			DeliveryService: u.DeliveryService,
+			Username:        u.Username,
+		}
+
+		for _, item := range cart {
+			if item.Product == nil || item.ProductCount <= 0 {
+				continue
+			}
+
+			if item.UnitPrice != item.Product.Price || item.Name != item.Product.Name {
+				_, err := tx.Model(&item).
+					WherePK().
+					Set("name = ?", item.Product.Name).
+					Set("unit_price = ?", item.Product.Price).
+					Update()
+				if err != nil {
+					return err
+				}
+
+				if item.UnitPrice != item.Product.Price {
+					changes = append(changes, CartPriceChange{Name: item.Product.Name, OldPrice: item.UnitPrice, NewPrice: item.Product.Price})
+				}
+			}
+
+			order.Lines = append(order.Lines, &OrderLine{
+				ProductID: item.ProductID,
+				Name:      item.Product.Name,
+				UnitPrice: item.Product.Price,
+				Quantity:  item.ProductCount,
+			})
+			order.TotalPrice += item.Product.Price * item.ProductCount
+		}
+
+		if len(order.Lines) == 0 {
+			return ErrEmptyOrder
+		}
+
+		if _, err := tx.Model(&order).Insert(); err != nil {
+			return err
+		}
+
+		for _, line := range order.Lines {
+			line.OrderID = order.ID
+		}
+		if _, err := tx.Model(&order.Lines).Insert(); err != nil {
+			return err
+		}
+
+		created := &OrderStatusChange{OrderID: order.ID, ToStatus: OrderStatusDraft, ActorID: u.ID}
+		if _, err := tx.Model(created).Insert(); err != nil {
+			return err
+		}
+		order.History = []*OrderStatusChange{created}
+
+		return nil
+	})
+	if err != nil {
+		changes = nil
+	}
+
+	return order, changes, err
+}
+
+// GetOrder загружает заказ id вместе с позициями и историей статусов
+func GetOrder(db *pg.DB, id int) (Order, error) {
+	order := Order{ID: id}
+	err := db.Model(&order).
+		WherePK().
+		Relation("Lines", func(q *pg.Query) (*pg.Query, error) {
+			return q.Order("order_line.id ASC"), nil
+		}).
+		Relation("History", func(q *pg.Query) (*pg.Query, error) {
+			return q.Order("order_status_change.id ASC"), nil
+		}).
+		Select()
+
+	return order, err
+}
+
+// LastOrderWithStatus возвращает последний заказ пользователя в статусе status
+func (u *TelegramUser) LastOrderWithStatus(db *pg.DB, status OrderStatus) (Order, error) {
+	var order Order
+	err := db.Model(&order).
+		Where("user_id = ?", u.ID).
+		Where("status = ?", status).
+		Order("id DESC").
+		Limit(1).
+		Select()
+
+	return order, err
+}
+
+// ListOrders возвращает страницу заказов пользователя (новые первыми) и общее число заказов.
+// Черновики не показываются: покупатель их еще не оформил.
+func (u *TelegramUser) ListOrders(db *pg.DB, offset, limit int) ([]Order, int, error) {
+	var orders []Order
+	count, err := db.Model(&orders).
+		Where("user_id = ?", u.ID).
+		Where("status != ?", OrderStatusDraft).
+		Order("id DESC").
+		Offset(offset).
+		Limit(limit).
+		SelectAndCount()
+
+	return orders, count, err
+}
+
+// ListOrdersByFilter возвращает страницу заказов, подходящих под filter (старые первыми - в порядке очереди),
+// и общее число таких заказов
+func ListOrdersByFilter(db *pg.DB, filter OrderFilter, offset, limit int) ([]Order, int, error) {
+	var orders []Order
+	q := db.Model(&orders).
+		WhereIn("status IN (?)", filter.Statuses).
+		Order("id ASC").
+		Offset(offset).
+		Limit(limit)
+
+	if filter.SinceTS > 0 {
+		q = q.Where("created_at_ts >= ?", filter.SinceTS)
+	}
+	if filter.UserID != 0 {
+		q = q.Where("user_id = ?", filter.UserID)
+	}
+
+	count, err := q.SelectAndCount()
+
+	return orders, count, err
+}
+
+// AddOrderNote добавляет заметку администратора authorID к заказу orderID
+func AddOrderNote(db *pg.DB, orderID int, authorID int64, text string) error {
+	_, err := db.Model(&OrderNote{OrderID: orderID, AuthorID: authorID, Text: text}).Insert()
+
+	return err
+}
+
+// ListOrderNotes возвращает заметки к заказу orderID в порядке добавления
+func ListOrderNotes(db *pg.DB, orderID int) ([]OrderNote, error) {
+	var notes []OrderNote
+	err := db.Model(&notes).
+		Where("order_id = ?", orderID).
+		Order("id ASC").
+		Select()
+
+	return notes, err
+}
+
+// TransitionOrder переводит заказ id в статус to и записывает переход в историю.
+// actorID - кто меняет статус, note - комментарий к переходу (может быть пустым).
+// Запрещенный переход - ErrInvalidTransition, статус заказа при этом не меняется.
+// Вместе со статусом меняются резервы и склад (см. applyOrderStock); резерв при переходе
+// в awaiting_payment создает ReserveOrder.
+func TransitionOrder(db *pg.DB, id int, to OrderStatus, actorID int64, note string) (Order, error) {
+	var order Order
+
+	err := db.RunInTransaction(db.Context(), func(tx *pg.Tx) error {
+		order = Order{ID: id}
+		if err := tx.Model(&order).WherePK().For("UPDATE").Select(); err != nil {
+			return err
+		}
+
+		return transitionOrder(tx, &order, to, actorID, note)
+	})
+
+	return order, err
+}
+
+// SubmitOrderReceipt сохраняет чек об оплате заказа id и переводит его на проверку (payment_review)
+func SubmitOrderReceipt(db *pg.DB, id int, actorID int64, fileID string, isDocument bool) (Order, error) {
+	var order Order
+
+	err := db.RunInTransaction(db.Context(), func(tx *pg.Tx) error {
+		order = Order{ID: id}
+		if err := tx.Model(&order).WherePK().For("UPDATE").Select(); err != nil {
+			return err
+		}
+
+		if err := transitionOrder(tx, &order, OrderStatusPaymentReview, actorID, ""); err != nil {
+			return err
+		}
+
+		order.ReceiptFileID = fileID
+		order.ReceiptIsDocument = isDocument
+		_, err := tx.Model(&order).WherePK().Column("receipt_file_id", "receipt_is_document").Update()
+
+		return err
+	})
+
+	return order, err
+}
+
+// SetOrderTracking сохраняет службу доставки и трек-номер заказа id. Оплаченный заказ при этом
+// переводится в shipped; у отправленного заказа трек-номер просто заменяется.
+// Заказ в другом статусе - ErrInvalidTransition.
+func SetOrderTracking(db *pg.DB, id int, actorID int64, carrier, trackingNumber string) (Order, error) {
+	var order Order
+
+	err := db.RunInTransaction(db.Context(), func(tx *pg.Tx) error {
+		order = Order{ID: id}
+		if err := tx.Model(&order).WherePK().For("UPDATE").Select(); err != nil {
+			return err
+		}
+
+		switch order.Status {
+		case OrderStatusPaid:
+			if err := transitionOrder(tx, &order, OrderStatusShipped, actorID, "Трек-номер: "+trackingNumber); err != nil {
+				return err
+			}
+		case OrderStatusShipped, OrderStatusArrived:
+		default:
+			return fmt.Errorf("%w: order %d is %s, tracking number can't be set", ErrInvalidTransition, order.ID, order.Status)
+		}
+
+		order.Carrier = carrier
+		order.TrackingNumber = trackingNumber
+		_, err := tx.Model(&order).WherePK().Column("carrier", "tracking_number").Update()
+
+		return err
+	})
+
+	return order, err
+}
+
+// cancelOpenOrders отменяет незавершенные заказы (draft и awaiting_payment) корзины transactionID
+func cancelOpenOrders(tx *pg.Tx, transactionID int, actorID int64, note string) error {
+	var open []Order
+	err := tx.Model(&open).
+		Where("transaction_id = ?", transactionID).
+		WhereIn("status IN (?)", []OrderStatus{OrderStatusDraft, OrderStatusAwaitingPayment}).
+		For("UPDATE").
+		Select()
+	if err != nil {
+		return err
+	}
+
+	for i := range open {
+		if err := transitionOrder(tx, &open[i], OrderStatusCancelled, actorID, note); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkTransition возвращает ErrInvalidTransition, если заказ orderID нельзя перевести из from в to
+func checkTransition(orderID int, from, to OrderStatus) error {
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: order %d %s -> %s", ErrInvalidTransition, orderID, from, to)
+	}
+
+	return nil
+}
+
+// transitionOrder меняет статус заблокированного (SELECT ... FOR UPDATE) заказа order,
+// а также его резервы и остатки товаров
+func transitionOrder(tx *pg.Tx, order *Order, to OrderStatus, actorID int64, note string) error {
+	from := order.Status
+	if err := checkTransition(order.ID, from, to); err != nil {
+		return err
+	}
+
+	if err := applyOrderStock(tx, order, to); err != nil {
+		return err
+	}
+
+	_, err := tx.Model(order).
+		WherePK().
+		Set("status = ?", to).
+		Set("updated_at_ts = extract(epoch from now())").
+		Returning("updated_at_ts").
+		Update()
+	if err != nil {
+		return err
+	}
+	order.Status = to
+
+	change := &OrderStatusChange{OrderID: order.ID, FromStatus: from, ToStatus: to, ActorID: actorID, Note: note}
+	_, err = tx.Model(change).Insert()
+
+	return err
+}
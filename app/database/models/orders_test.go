@@ -0,0 +1,73 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+var allOrderStatuses = []OrderStatus{
+	OrderStatusDraft,
+	OrderStatusAwaitingPayment,
+	OrderStatusPaymentReview,
+	OrderStatusPaid,
+	OrderStatusShipped,
+	OrderStatusArrived,
+	OrderStatusDelivered,
+	OrderStatusCancelled,
+	OrderStatusRefunded,
+}
+
+// TestOrderTransitions проверяет все пары статусов: разрешены только переходы из таблицы,
+// остальные (в том числе в тот же статус и из конечных) дают ErrInvalidTransition
+func TestOrderTransitions(t *testing.T) {
+	allowed := map[OrderStatus][]OrderStatus{
+		OrderStatusDraft:           {OrderStatusAwaitingPayment, OrderStatusCancelled},
+		OrderStatusAwaitingPayment: {OrderStatusPaymentReview, OrderStatusCancelled},
+		OrderStatusPaymentReview:   {OrderStatusPaid, OrderStatusAwaitingPayment, OrderStatusCancelled},
+		OrderStatusPaid:            {OrderStatusShipped, OrderStatusRefunded},
+		OrderStatusShipped:         {OrderStatusArrived, OrderStatusDelivered, OrderStatusRefunded},
+		OrderStatusArrived:         {OrderStatusDelivered, OrderStatusRefunded},
+		OrderStatusDelivered:       {OrderStatusRefunded},
+		OrderStatusCancelled:       nil,
+		OrderStatusRefunded:        nil,
+	}
+
+	for _, from := range allOrderStatuses {
+		for _, to := range allOrderStatuses {
+			want := false
+			for _, s := range allowed[from] {
+				if s == to {
+					want = true
+				}
+			}
+
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%s -> %s: CanTransitionTo = %v, want %v", from, to, got, want)
+			}
+
+			err := checkTransition(1, from, to)
+			if want && err != nil {
+				t.Errorf("%s -> %s: unexpected error %v", from, to, err)
+			}
+			if !want && !errors.Is(err, ErrInvalidTransition) {
+				t.Errorf("%s -> %s: expected ErrInvalidTransition, got %v", from, to, err)
+			}
+		}
+	}
+
+	if OrderStatus("unknown").CanTransitionTo(OrderStatusPaid) {
+		t.Error("unknown status must not transition anywhere")
+	}
+}
+
+func TestOrderStatusActive(t *testing.T) {
+	for _, s := range allOrderStatuses {
+		want := s != OrderStatusDelivered && s != OrderStatusCancelled && s != OrderStatusRefunded
+		if s.Active() != want {
+			t.Errorf("%s: Active = %v, want %v", s, s.Active(), want)
+		}
+		if s.Title() == string(s) {
+			t.Errorf("%s: no title", s)
+		}
+	}
+}
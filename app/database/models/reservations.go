@@ -0,0 +1,282 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+const (
+	// activeReservation - условие на действующий резерв: без срока или срок еще не истек
+	activeReservation = "(expires_at_ts IS NULL OR expires_at_ts > extract(epoch from now()))"
+	// stockCheckConstraint - ограничение products, не дающее остатку уйти в минус
+	stockCheckConstraint = "products_availble_for_purchase_check"
+	// pgCheckViolation - код ошибки PostgreSQL при нарушении CHECK
+	pgCheckViolation = "23514"
+)
+
+// ErrInsufficientStock - товара в наличии меньше, чем в заказе
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// StockReservation - товар, отложенный под заказ до решения по оплате.
+// Пока резерв действует, товар не доступен другим покупателям, но со склада
+// (Product.AvailbleForPurchase) он списывается только при оплате заказа.
+// ExpiresAtTS - когда резерв истекает; 0 (NULL) - держится, пока администратор проверяет чек
+type StockReservation struct {
+	ID          int64
+	OrderID     int `pg:",notnull"`
+	ProductID   int `pg:",notnull"`
+	Quantity    int `pg:",notnull"`
+	ExpiresAtTS int64
+
+	CreatedAtTS int64 `pg:",default:extract(epoch from now())"`
+}
+
+// ReserveOrder резервирует товары заказа id на ttl и переводит его из draft в awaiting_payment.
+// Если какого-то товара не хватает с учетом чужих резервов - ErrInsufficientStock, заказ не меняется.
+func ReserveOrder(db *pg.DB, id int, actorID int64, ttl time.Duration) (Order, error) {
+	var order Order
+
+	err := db.RunInTransaction(db.Context(), func(tx *pg.Tx) error {
+		order = Order{ID: id}
+		if err := tx.Model(&order).WherePK().For("UPDATE").Select(); err != nil {
+			return err
+		}
+
+		if !order.Status.CanTransitionTo(OrderStatusAwaitingPayment) {
+			return fmt.Errorf("%w: order %d %s -> %s", ErrInvalidTransition, order.ID, order.Status, OrderStatusAwaitingPayment)
+		}
+
+		if err := reserveOrderStock(tx, &order, time.Now().Add(ttl).Unix()); err != nil {
+			return err
+		}
+
+		return transitionOrder(tx, &order, OrderStatusAwaitingPayment, actorID, "")
+	})
+
+	return order, err
+}
+
+// LoadReservedStock заполняет Product.Reserved действующими резервами чужих заказов:
+// собственные заказы покупателя viewerID не уменьшают доступное ему количество
+func LoadReservedStock(db orm.DB, viewerID int64, products ...*Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	ids := make([]int, 0, len(products))
+	for _, p := range products {
+		ids = append(ids, p.ID)
+	}
+
+	reserved, err := reservedStock(db, ids, viewerID)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range products {
+		p.Reserved = reserved[p.ID]
+	}
+
+	return nil
+}
+
+// ReleaseExpiredReservations отменяет неоплаченные заказы, резерв которых истек, и удаляет
+// истекшие резервы. Возвращает количество отмененных заказов.
+func ReleaseExpiredReservations(db *pg.DB) (int, error) {
+	cancelled := 0
+
+	err := db.RunInTransaction(db.Context(), func(tx *pg.Tx) error {
+		var expired []Order
+		err := tx.Model(&expired).
+			Where("status = ?", OrderStatusAwaitingPayment).
+			Where("id IN (SELECT order_id FROM stock_reservations WHERE expires_at_ts <= extract(epoch from now()))").
+			Order("id ASC").
+			For("UPDATE").
+			Select()
+		if err != nil {
+			return err
+		}
+
+		for i := range expired {
+			if err := transitionOrder(tx, &expired[i], OrderStatusCancelled, 0, "Резерв товаров истек"); err != nil {
+				return err
+			}
+		}
+		cancelled = len(expired)
+
+		_, err = tx.Model((*StockReservation)(nil)).
+			Where("expires_at_ts <= extract(epoch from now())").
+			Delete()
+
+		return err
+	})
+
+	return cancelled, err
+}
+
+// reservedStock возвращает количество товаров ids в действующих резервах, кроме заказов покупателя excludeUserID
+func reservedStock(db orm.DB, ids []int, excludeUserID int64) (map[int]int, error) {
+	var rows []struct {
+		ProductID int
+		Quantity  int
+	}
+
+	q := db.Model((*StockReservation)(nil)).
+		ColumnExpr("product_id, sum(quantity) AS quantity").
+		WhereIn("product_id IN (?)", ids).
+		Where(activeReservation).
+		Group("product_id")
+	if excludeUserID != 0 {
+		q = q.Where("order_id NOT IN (SELECT id FROM orders WHERE user_id = ?)", excludeUserID)
+	}
+
+	if err := q.Select(&rows); err != nil {
+		return nil, err
+	}
+
+	reserved := make(map[int]int, len(rows))
+	for _, row := range rows {
+		reserved[row.ProductID] = row.Quantity
+	}
+
+	return reserved, nil
+}
+
+// reserveOrderStock заменяет резервы заказа order резервами его позиций до expiresAtTS.
+// Строки товаров блокируются в порядке id, поэтому одновременные оформления не резервируют один товар дважды.
+func reserveOrderStock(tx *pg.Tx, order *Order, expiresAtTS int64) error {
+	if _, err := tx.Model((*StockReservation)(nil)).Where("order_id = ?", order.ID).Delete(); err != nil {
+		return err
+	}
+
+	ids, need, err := orderStockNeeds(tx, order.ID)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	var products []Product
+	err = tx.Model(&products).
+		WhereIn("id IN (?)", ids).
+		Order("id ASC").
+		For("UPDATE").
+		Select()
+	if err != nil {
+		return err
+	}
+
+	reserved, err := reservedStock(tx, ids, 0)
+	if err != nil {
+		return err
+	}
+
+	stock := make(map[int]Product, len(products))
+	for _, p := range products {
+		stock[p.ID] = p
+	}
+
+	reservations := make([]StockReservation, 0, len(ids))
+	for _, id := range ids {
+		p, ok := stock[id]
+		if !ok || p.AvailbleForPurchase-reserved[id] < need[id] {
+			return fmt.Errorf("%w: product %d for order %d", ErrInsufficientStock, id, order.ID)
+		}
+
+		reservations = append(reservations, StockReservation{OrderID: order.ID, ProductID: id, Quantity: need[id], ExpiresAtTS: expiresAtTS})
+	}
+
+	_, err = tx.Model(&reservations).Insert()
+
+	return err
+}
+
+// applyOrderStock меняет резервы и склад вместе со статусом заказа order:
+// на проверке чека резерв держится без срока, при оплате товар списывается со склада,
+// при отмене резерв снимается
+func applyOrderStock(tx *pg.Tx, order *Order, to OrderStatus) error {
+	switch to {
+	case OrderStatusPaymentReview:
+		_, err := tx.Model((*StockReservation)(nil)).
+			Where("order_id = ?", order.ID).
+			Set("expires_at_ts = NULL").
+			Update()
+		return err
+	case OrderStatusPaid:
+		if err := sellOrderStock(tx, order); err != nil {
+			return err
+		}
+
+		fallthrough
+	case OrderStatusCancelled:
+		_, err := tx.Model((*StockReservation)(nil)).Where("order_id = ?", order.ID).Delete()
+		return err
+	}
+
+	return nil
+}
+
+// sellOrderStock списывает товары заказа order со склада. Остаток уменьшается в самом UPDATE
+// только при достаточном наличии, строки товаров блокируются в порядке id. Если товара не хватает,
+// возвращается ErrInsufficientStock и транзакция со сменой статуса откатывается.
+func sellOrderStock(tx *pg.Tx, order *Order) error {
+	ids, need, err := orderStockNeeds(tx, order.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		res, err := tx.Model((*Product)(nil)).
+			Where("id = ?", id).
+			Where("availble_for_purchase >= ?", need[id]).
+			Set("availble_for_purchase = availble_for_purchase - ?", need[id]).
+			Update()
+		if err != nil {
+			return asStockError(err)
+		}
+
+		if res.RowsAffected() == 0 {
+			return fmt.Errorf("%w: product %d for order %d", ErrInsufficientStock, id, order.ID)
+		}
+	}
+
+	return nil
+}
+
+// orderStockNeeds возвращает товары заказа orderID по возрастанию id и нужное количество каждого
+func orderStockNeeds(tx *pg.Tx, orderID int) ([]int, map[int]int, error) {
+	var lines []OrderLine
+	err := tx.Model(&lines).
+		Where("order_id = ?", orderID).
+		Where("product_id IS NOT NULL").
+		Select()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	need := make(map[int]int)
+	for _, line := range lines {
+		need[line.ProductID] += line.Quantity
+	}
+
+	ids := make([]int, 0, len(need))
+	for id := range need {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	return ids, need, nil
+}
+
+// asStockError превращает нарушение ограничения на остаток товара в ErrInsufficientStock
+func asStockError(err error) error {
+	var pgErr pg.Error
+	if errors.As(err, &pgErr) && pgErr.Field('C') == pgCheckViolation && pgErr.Field('n') == stockCheckConstraint {
+		return fmt.Errorf("%w: %s", ErrInsufficientStock, pgErr.Field('M'))
+	}
+
+	return err
+}
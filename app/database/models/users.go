@@ -24,6 +24,8 @@ type TelegramUser struct {
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
 	IsAdmin   bool   `pg:",default:false" json:"is_admin"`
+	// IsOwner - владелец бота: назначает и снимает администраторов (см. SetAdmin, BootstrapOwner)
+	IsOwner bool `pg:",default:false" json:"is_owner"`
 
 	ShopSession *ShopViewSession `pg:"rel:has-one,fk:id,join_fk:user_id"`
 }
@@ -41,13 +43,13 @@ func (u *TelegramUser) UpdateProfileData(apiUser *tgbotapi.User, db *pg.DB) erro
 	return err
 }
 
-func (u *TelegramUser) Get(db pg.DB) error {
+func (u *TelegramUser) Get(db *pg.DB) error {
 	err := db.Model(u).Where("id = ?", u.ID).Select()
 
 	return err
 }
 
-func (u *TelegramUser) GetOrCreate(apiUser *tgbotapi.User, db pg.DB) error {
+func (u *TelegramUser) GetOrCreate(apiUser *tgbotapi.User, db *pg.DB) error {
 	return db.RunInTransaction(db.Context(), func(tx *pg.Tx) error {
 		// Сначала пытаемся получить пользователя в транзакции
 		err := tx.Model(u).Where("id = ?", u.ID).For("UPDATE").Select()
@@ -79,7 +81,7 @@ func (u *TelegramUser) GetOrCreate(apiUser *tgbotapi.User, db pg.DB) error {
 	})
 }
 
-func (u *TelegramUser) GetOrCreateTransaction(db pg.DB) (Transaction, error, bool) {
+func (u *TelegramUser) GetOrCreateTransaction(db *pg.DB) (Transaction, error, bool) {
 	var result Transaction
 	var isCreated bool
 
@@ -117,7 +119,7 @@ func (u *TelegramUser) GetOrCreateTransaction(db pg.DB) (Transaction, error, boo
 	return result, err, isCreated
 }
 
-func (u *TelegramUser) GetProductInCartCount(db pg.DB, productID int) (int, error) {
+func (u *TelegramUser) GetProductInCartCount(db *pg.DB, productID int) (int, error) {
 	transaction, err, created := u.GetOrCreateTransaction(db)
 	if err != nil {
 		return 0, err
@@ -143,7 +145,7 @@ func (u *TelegramUser) GetProductInCartCount(db pg.DB, productID int) (int, erro
 	return product.ProductCount, nil
 }
 
-func (u *TelegramUser) AddProductToCart(db pg.DB, productID int) error {
+func (u *TelegramUser) AddProductToCart(db *pg.DB, productID int) error {
 	transaction, err, _ := u.GetOrCreateTransaction(db)
 	if err != nil {
 		return err
@@ -162,10 +164,17 @@ func (u *TelegramUser) AddProductToCart(db pg.DB, productID int) error {
 			return err
 		}
 	} else {
+		product := Product{ID: productID}
+		if err := db.Model(&product).WherePK().Select(); err != nil {
+			return err
+		}
+
 		_, err := db.Model(&AddedProducts{
 			UserID:        u.ID,
 			ProductID:     productID,
 			TransactionID: transaction.ID,
+			Name:          product.Name,
+			UnitPrice:     product.Price,
 		}).Insert()
 		if err != nil {
 			return err
@@ -175,7 +184,7 @@ func (u *TelegramUser) AddProductToCart(db pg.DB, productID int) error {
 	return nil
 }
 
-func (u *TelegramUser) RemoveProductFromCart(db pg.DB, productID int) error {
+func (u *TelegramUser) RemoveProductFromCart(db *pg.DB, productID int) error {
 	transaction, err, _ := u.GetOrCreateTransaction(db)
 	if err != nil {
 		return err
@@ -207,7 +216,7 @@ func (u *TelegramUser) RemoveProductFromCart(db pg.DB, productID int) error {
 	return nil
 }
 
-func (u *TelegramUser) TidyCart(db pg.DB) (bool, error) {
+func (u *TelegramUser) TidyCart(db *pg.DB) (bool, error) {
 	transaction, err, _ := u.GetOrCreateTransaction(db)
 	if err != nil {
 		return false, err
@@ -222,10 +231,20 @@ func (u *TelegramUser) TidyCart(db pg.DB) (bool, error) {
 		return false, err
 	}
 
+	var products []*Product
+	for _, item := range transaction.AddedProducts {
+		if item.Product != nil {
+			products = append(products, item.Product)
+		}
+	}
+	if err := LoadReservedStock(db, u.ID, products...); err != nil {
+		return false, err
+	}
+
 	var cartChanged bool
 	for _, item := range transaction.AddedProducts {
-		if item.ProductCount > item.Product.AvailbleForPurchase {
-			if item.Product.AvailbleForPurchase == 0 {
+		if item.ProductCount > item.Product.Available() {
+			if item.Product.Available() == 0 {
 				_, err := db.Model(item).
 					WherePK().
 					Delete()
@@ -240,7 +259,7 @@ func (u *TelegramUser) TidyCart(db pg.DB) (bool, error) {
 
 			_, err := db.Model(item).
 				WherePK().
-				Set("product_count = ?", item.Product.AvailbleForPurchase).
+				Set("product_count = ?", item.Product.Available()).
 				Update()
 			if err != nil {
 				return cartChanged, err
@@ -253,35 +272,58 @@ func (u *TelegramUser) TidyCart(db pg.DB) (bool, error) {
 	return cartChanged, nil
 }
 
-func (u *TelegramUser) DropTransaction(db pg.DB, transactionID int) error {
-	var transaction Transaction
-	err := db.Model(&transaction).Where("id = ?", transactionID).Select()
-	if err != nil {
-		return err
-	}
+// RejectLegacyTransaction отклоняет чек по корзине transactionID, отправленный до появления резервов
+// (у его кнопок нет OrderID): тогда товар списывался со склада еще на странице оплаты, поэтому
+// он возвращается на склад, а корзина удаляется. Все это делается в одной транзакции под блокировкой
+// строки transactions, поэтому повторное отклонение того же чека возвращает pg.ErrNoRows.
+func (u *TelegramUser) RejectLegacyTransaction(db *pg.DB, transactionID int) error {
+	return db.RunInTransaction(db.Context(), func(tx *pg.Tx) error {
+		transaction := Transaction{ID: transactionID}
+		err := tx.Model(&transaction).
+			WherePK().
+			Where("user_id = ?", u.ID).
+			For("UPDATE").
+			Select()
+		if err != nil {
+			return err
+		}
 
-	err = db.Model(&transaction).
-		WherePK().
-		Relation("AddedProducts").
-		Relation("AddedProducts.Product").
-		Select()
-	if err != nil {
-		return err
-	}
+		var cart []AddedProducts
+		err = tx.Model(&cart).
+			Where("transaction_id = ?", transaction.ID).
+			Where("product_id IS NOT NULL").
+			Order("product_id ASC").
+			Select()
+		if err != nil {
+			return err
+		}
 
-	for _, item := range transaction.AddedProducts {
-		db.Model(&item).WherePK().Delete()
-	}
+		for _, item := range cart {
+			_, err := tx.Model((*Product)(nil)).
+				Where("id = ?", item.ProductID).
+				Set("availble_for_purchase = availble_for_purchase + ?", item.ProductCount).
+				Update()
+			if err != nil {
+				return err
+			}
+		}
 
-	_, err = db.Model(&transaction).WherePK().Delete()
+		_, err = tx.Model((*AddedProducts)(nil)).
+			Where("transaction_id = ?", transaction.ID).
+			Delete()
+		if err != nil {
+			return err
+		}
 
-	return err
+		_, err = tx.Model(&transaction).WherePK().Delete()
+
+		return err
+	})
 }
 
-func (u *TelegramUser) DecreaseProductAvailbleForPurchase(db pg.DB, transactionID int) error {
+func (u *TelegramUser) DropTransaction(db *pg.DB, transactionID int) error {
 	var transaction Transaction
 	err := db.Model(&transaction).Where("id = ?", transactionID).Select()
-
 	if err != nil {
 		return err
 	}
@@ -296,49 +338,58 @@ func (u *TelegramUser) DecreaseProductAvailbleForPurchase(db pg.DB, transactionI
 	}
 
 	for _, item := range transaction.AddedProducts {
-		_, _err := db.Model(item.Product).
-			WherePK().
-			Set("availble_for_purchase = ?", item.Product.AvailbleForPurchase-item.ProductCount).
-			Update()
-		if _err != nil {
-			return _err
-		}
+		db.Model(&item).WherePK().Delete()
 	}
 
-	return nil
-}
+	_, err = db.Model(&transaction).WherePK().Delete()
 
-func (u *TelegramUser) IncreaseProductAvailbleForPurchase(db pg.DB, transactionID int) error {
-	var transaction Transaction
-	err := db.Model(&transaction).Where("id = ?", transactionID).Select()
+	return err
+}
 
+// RefreshCartPrices обновляет цены и названия товаров в корзине пользователя до текущих
+// и возвращает товары, цена которых изменилась, пока они лежали в корзине. Только для показа корзины:
+// цены заказа фиксирует CreateOrderFromCart
+func (u *TelegramUser) RefreshCartPrices(db *pg.DB) ([]CartPriceChange, error) {
+	transaction, err, _ := u.GetOrCreateTransaction(db)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = db.Model(&transaction).
-		WherePK().
-		Relation("AddedProducts").
-		Relation("AddedProducts.Product").
+	var cart []AddedProducts
+	err = db.Model(&cart).
+		Where("transaction_id = ?", transaction.ID).
+		Relation("Product").
+		Order("added_products.id ASC").
 		Select()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, item := range transaction.AddedProducts {
-		_, _err := db.Model(item.Product).
+	var changes []CartPriceChange
+	for _, item := range cart {
+		if item.Product == nil || (item.UnitPrice == item.Product.Price && item.Name == item.Product.Name) {
+			continue
+		}
+
+		_, err := db.Model(&item).
 			WherePK().
-			Set("availble_for_purchase = ?", item.Product.AvailbleForPurchase+item.ProductCount).
+			Set("name = ?", item.Product.Name).
+			Set("unit_price = ?", item.Product.Price).
 			Update()
-		if _err != nil {
-			return _err
+		if err != nil {
+			return changes, err
+		}
+
+		if item.UnitPrice != item.Product.Price {
+			changes = append(changes, CartPriceChange{Name: item.Product.Name, OldPrice: item.UnitPrice, NewPrice: item.Product.Price})
 		}
 	}
 
-	return nil
+	return changes, nil
 }
 
-func (u *TelegramUser) GetTotalCartPrice(db pg.DB) (int, error) {
+// GetTotalCartPrice возвращает стоимость корзины по ценам, запомненным в корзине (см. CreateOrderFromCart)
+func (u *TelegramUser) GetTotalCartPrice(db *pg.DB) (int, error) {
 	transaction, err, _ := u.GetOrCreateTransaction(db)
 	if err != nil {
 		return 0, err
@@ -348,7 +399,6 @@ func (u *TelegramUser) GetTotalCartPrice(db pg.DB) (int, error) {
 	err = db.Model(&cart).
 		Where("user_id = ?", u.ID).
 		Where("transaction_id = ?", transaction.ID).
-		Relation("Product").
 		Select()
 	if err != nil {
 		return 0, err
@@ -356,12 +406,13 @@ func (u *TelegramUser) GetTotalCartPrice(db pg.DB) (int, error) {
 
 	totalPrice := 0
 	for _, item := range cart {
-		totalPrice += item.Product.Price * item.ProductCount
+		totalPrice += item.UnitPrice * item.ProductCount
 	}
 	return totalPrice, nil
 }
 
-func (u *TelegramUser) GetCartDescription(db pg.DB) (string, error) {
+// GetCartDescription описывает товары корзины по запомненным в ней названиям и ценам
+func (u *TelegramUser) GetCartDescription(db *pg.DB) (string, error) {
 	var transaction Transaction
 	transaction, err, _ := u.GetOrCreateTransaction(db)
 	if err != nil {
@@ -371,7 +422,6 @@ func (u *TelegramUser) GetCartDescription(db pg.DB) (string, error) {
 	err = db.Model(&transaction).
 		WherePK().
 		Relation("AddedProducts").
-		Relation("AddedProducts.Product").
 		Select()
 	if err != nil {
 		return "", err
@@ -379,7 +429,7 @@ func (u *TelegramUser) GetCartDescription(db pg.DB) (string, error) {
 
 	cartDesc := "Список товаров:\n"
 	for _, item := range transaction.AddedProducts {
-		cartDesc += fmt.Sprintf("|_ %s (%d шт.) - %d₽\n", item.Product.Name, item.ProductCount, item.ProductCount*item.Product.Price)
+		cartDesc += fmt.Sprintf("|_ %s (%d шт.) - %d₽\n", item.Name, item.ProductCount, item.ProductCount*item.UnitPrice)
 	}
 
 	return cartDesc, nil
@@ -411,4 +461,17 @@ type AddedProducts struct {
 
 	TransactionID int          `json:"transaction_id"`
 	Transaction   *Transaction `pg:"rel:has-one,fk:transaction_id"`
+
+	// Name и UnitPrice - название и цена товара, которые видел покупатель: запоминаются при добавлении
+	// в корзину, обновляются на странице оформления (RefreshCartPrices) и фиксируются вместе с позициями
+	// заказа при переходе к оплате (CreateOrderFromCart)
+	Name      string `json:"name"`
+	UnitPrice int    `pg:",use_zero" json:"unit_price"`
+}
+
+// CartPriceChange - товар корзины, цена которого изменилась с момента добавления
+type CartPriceChange struct {
+	Name     string
+	OldPrice int
+	NewPrice int
 }
@@ -0,0 +1,150 @@
+// Package dispatch распределяет обновления по воркерам так, что обновления одного
+// пользователя в одном чате обрабатываются строго по очереди, а разные пользователи - параллельно.
+package dispatch
+
+import (
+	"errors"
+	"main/metrics"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ErrQueueFull - очередь пользователя заполнена, обновление отброшено
+var ErrQueueFull = errors.New("update queue is full")
+
+// Key - очередь, в которую попадает обновление: пользователь в чате.
+// Обновления без пользователя и чата (например, опросы) попадают в нулевой ключ.
+type Key struct {
+	ChatID int64
+	UserID int64
+}
+
+// KeyOf возвращает ключ очереди обновления
+func KeyOf(update tgbotapi.Update) Key {
+	var key Key
+	if user := update.SentFrom(); user != nil {
+		key.UserID = user.ID
+	}
+	if chat := update.FromChat(); chat != nil {
+		key.ChatID = chat.ID
+	}
+
+	return key
+}
+
+// Handler обрабатывает одно обновление
+type Handler func(update tgbotapi.Update)
+
+// Dispatcher держит для каждого ключа ограниченную очередь и горутину, которая разбирает ее по порядку.
+// Одновременно выполняется не больше workers обработчиков. Горутина ключа завершается, когда очередь пуста.
+type Dispatcher struct {
+	handle    Handler
+	queueSize int
+	metrics   *metrics.Metrics
+
+	sem chan struct{}
+	wg  sync.WaitGroup
+
+	mu     sync.Mutex
+	queues map[Key]*queue
+	queued int
+}
+
+// queue - ожидающие обновления одного ключа; обрабатываемое в данный момент в ней уже не лежит
+type queue struct {
+	updates []tgbotapi.Update
+}
+
+// New создает Dispatcher. workers - сколько обновлений обрабатывается одновременно,
+// queueSize - сколько обновлений одного ключа может ждать обработки. m может быть nil.
+func New(handle Handler, workers, queueSize int, m *metrics.Metrics) *Dispatcher {
+	return &Dispatcher{
+		handle:    handle,
+		queueSize: queueSize,
+		metrics:   m,
+		sem:       make(chan struct{}, workers),
+		queues:    make(map[Key]*queue),
+	}
+}
+
+// Submit ставит обновление в очередь его ключа и сразу возвращается.
+// Если очередь ключа заполнена, обновление отбрасывается с ErrQueueFull.
+func (d *Dispatcher) Submit(update tgbotapi.Update) error {
+	key := KeyOf(update)
+
+	d.mu.Lock()
+	q, running := d.queues[key]
+	if running && len(q.updates) >= d.queueSize {
+		d.mu.Unlock()
+
+		if d.metrics != nil {
+			d.metrics.RecordDroppedUpdate()
+		}
+
+		return ErrQueueFull
+	}
+
+	if !running {
+		q = &queue{}
+		d.queues[key] = q
+		d.wg.Add(1)
+	}
+	q.updates = append(q.updates, update)
+	d.queued++
+	d.recordLocked(len(q.updates))
+	d.mu.Unlock()
+
+	if !running {
+		go d.drain(key, q)
+	}
+
+	return nil
+}
+
+// Busy сообщает, есть ли ожидающие или обрабатываемые обновления
+func (d *Dispatcher) Busy() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.queues) > 0
+}
+
+// Wait ждет, пока будут обработаны все поставленные в очереди обновления
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// drain обрабатывает обновления ключа по одному, пока очередь не опустеет
+func (d *Dispatcher) drain(key Key, q *queue) {
+	defer d.wg.Done()
+
+	for {
+		d.mu.Lock()
+		if len(q.updates) == 0 {
+			delete(d.queues, key)
+			d.recordLocked(0)
+			d.mu.Unlock()
+			return
+		}
+
+		update := q.updates[0]
+		q.updates[0] = tgbotapi.Update{}
+		q.updates = q.updates[1:]
+		d.queued--
+		d.recordLocked(len(q.updates))
+		d.mu.Unlock()
+
+		d.sem <- struct{}{}
+		d.handle(update)
+		<-d.sem
+	}
+}
+
+// recordLocked передает в метрики глубину очередей; depth - глубина только что измененной очереди.
+// Вызывается под d.mu.
+func (d *Dispatcher) recordLocked(depth int) {
+	if d.metrics != nil {
+		d.metrics.RecordQueue(d.queued, len(d.queues), depth)
+	}
+}
@@ -0,0 +1,171 @@
+package dispatch
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func userUpdate(updateID int, userID int64) tgbotapi.Update {
+	return tgbotapi.Update{UpdateID: updateID, Message: &tgbotapi.Message{
+		From: &tgbotapi.User{ID: userID},
+		Chat: &tgbotapi.Chat{ID: userID},
+	}}
+}
+
+// waitFor ждет закрытия ch не дольше секунды
+func waitFor(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+// TestDispatcherKeepsOrderPerKey перемежает обновления двух пользователей.
+// Запускать с -race: go test -race ./dispatch
+func TestDispatcherKeepsOrderPerKey(t *testing.T) {
+	const perKey = 200
+
+	var mu sync.Mutex
+	handled := make(map[int64][]int)
+	var inFlight [3]int32
+
+	d := New(func(update tgbotapi.Update) {
+		userID := update.Message.From.ID
+		if atomic.AddInt32(&inFlight[userID], 1) != 1 {
+			t.Errorf("two updates of user %d are handled at once", userID)
+		}
+		defer atomic.AddInt32(&inFlight[userID], -1)
+
+		mu.Lock()
+		handled[userID] = append(handled[userID], update.UpdateID)
+		mu.Unlock()
+	}, 4, perKey, nil)
+
+	for i := range perKey {
+		for _, userID := range []int64{1, 2} {
+			if err := d.Submit(userUpdate(i, userID)); err != nil {
+				t.Fatalf("submit %d for user %d: %v", i, userID, err)
+			}
+		}
+	}
+
+	d.Wait()
+
+	if d.Busy() {
+		t.Error("dispatcher is busy after Wait")
+	}
+	for _, userID := range []int64{1, 2} {
+		got := handled[userID]
+		if len(got) != perKey {
+			t.Fatalf("user %d: expected %d updates handled after Wait, got %d", userID, perKey, len(got))
+		}
+		for i, id := range got {
+			if id != i {
+				t.Fatalf("user %d: update %d handled at position %d", userID, id, i)
+			}
+		}
+	}
+}
+
+func TestDispatcherRunsKeysInParallel(t *testing.T) {
+	firstStarted := make(chan struct{})
+	secondStarted := make(chan struct{})
+
+	d := New(func(update tgbotapi.Update) {
+		switch update.Message.From.ID {
+		case 1:
+			close(firstStarted)
+			// Первый пользователь ждет второго: без параллельной обработки второй не начнется
+			select {
+			case <-secondStarted:
+			case <-time.After(time.Second):
+				t.Error("the second user was not handled while the first one was running")
+			}
+		case 2:
+			close(secondStarted)
+		}
+	}, 2, 1, nil)
+
+	d.Submit(userUpdate(1, 1))
+	waitFor(t, firstStarted, "the first user")
+	d.Submit(userUpdate(2, 2))
+
+	d.Wait()
+}
+
+func TestDispatcherLimitsWorkers(t *testing.T) {
+	const workers = 2
+
+	var running, maxRunning int32
+	d := New(func(tgbotapi.Update) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+	}, workers, 1, nil)
+
+	for userID := range int64(10) {
+		d.Submit(userUpdate(1, userID+1))
+	}
+	d.Wait()
+
+	if maxRunning > workers {
+		t.Errorf("expected at most %d handlers at once, got %d", workers, maxRunning)
+	}
+}
+
+func TestDispatcherQueueFull(t *testing.T) {
+	const queueSize = 2
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var handled int32
+
+	d := New(func(update tgbotapi.Update) {
+		if update.UpdateID == 0 {
+			started <- struct{}{}
+			<-release
+		}
+		atomic.AddInt32(&handled, 1)
+	}, 1, queueSize, nil)
+
+	// Первое обновление уже обрабатывается и в очереди не лежит
+	if err := d.Submit(userUpdate(0, 1)); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	for i := 1; i <= queueSize; i++ {
+		if err := d.Submit(userUpdate(i, 1)); err != nil {
+			t.Fatalf("submit %d: %v", i, err)
+		}
+	}
+	if err := d.Submit(userUpdate(queueSize+1, 1)); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull for a full queue, got %v", err)
+	}
+
+	// Очередь другого пользователя не зависит от заполненной
+	if err := d.Submit(userUpdate(1, 2)); err != nil {
+		t.Errorf("expected another user to be accepted, got %v", err)
+	}
+
+	close(release)
+	d.Wait()
+
+	if handled != queueSize+2 {
+		t.Errorf("expected %d updates handled, got %d", queueSize+2, handled)
+	}
+}
@@ -1,28 +1,38 @@
 package filters
 
 import (
-	"main/database"
 	"main/database/models"
+	"main/telegram"
 
+	"github.com/go-pg/pg/v10"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-var StartFilter = func(update tgbotapi.Update, _ tgbotapi.BotAPI) bool {
-	db := database.Connect()
-	defer db.Close()
+// StartFilter пропускает /start от пользователей, еще не прошедших регистрацию
+// (в том числе тех, кого еще нет в базе)
+func StartFilter(db *pg.DB) func(update tgbotapi.Update, _ telegram.BotClient) bool {
+	return func(update tgbotapi.Update, _ telegram.BotClient) bool {
+		if update.Message.Command() != "start" {
+			return false
+		}
 
-	user := models.TelegramUser{ID: update.Message.From.ID}
-	_ = user.GetOrCreate(update.Message.From, *db)
+		user := models.TelegramUser{ID: update.Message.From.ID}
+		err := user.Get(db)
 
-	return update.Message.Command() == "start" && !user.IsAuthorized
+		return err == pg.ErrNoRows || (err == nil && !user.IsAuthorized)
+	}
 }
 
-var ToMainMenuFilter = func(update tgbotapi.Update, _ tgbotapi.BotAPI) bool {
-	db := database.Connect()
-	defer db.Close()
+// ToMainMenuFilter пропускает /start от зарегистрированных пользователей
+func ToMainMenuFilter(db *pg.DB) func(update tgbotapi.Update, _ telegram.BotClient) bool {
+	return func(update tgbotapi.Update, _ telegram.BotClient) bool {
+		if update.Message.Command() != "start" {
+			return false
+		}
 
-	user := models.TelegramUser{ID: update.Message.From.ID}
-	err := user.Get(*db)
+		user := models.TelegramUser{ID: update.Message.From.ID}
+		err := user.Get(db)
 
-	return update.Message.Command() == "start" && user.IsAuthorized && err == nil
+		return user.IsAuthorized && err == nil
+	}
 }
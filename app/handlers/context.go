@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"context"
+	"main/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/google/uuid"
+)
+
+// UpdateContext возвращает контекст обработки обновления: новый correlation_id и поля журнала
+// update_id, user_id и chat_id. Имя хендлера (handler) добавляет Router перед вызовом Callback.
+func UpdateContext(ctx context.Context, update tgbotapi.Update) context.Context {
+	ctx = logger.WithCorrelationID(ctx, uuid.NewString())
+
+	fields := []any{"update_id", update.UpdateID}
+	if from, chatID := sender(update); from != nil {
+		fields = append(fields, "user_id", from.ID, "chat_id", chatID)
+	}
+
+	return logger.WithFields(ctx, fields...)
+}
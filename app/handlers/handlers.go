@@ -1,25 +1,47 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
+	"main/callback"
+	"main/logger"
+	"main/telegram"
+	"strings"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/google/uuid"
 )
 
-type Filter func(update tgbotapi.Update, client tgbotapi.BotAPI) bool
+type Filter func(update tgbotapi.Update, client telegram.BotClient) bool
 
+// Callback - обработчик маршрута.
+// ctx несет таймаут обработки обновления и поля журнала (см. UpdateContext).
 type Callback interface {
-	Run(update tgbotapi.Update) error
+	Run(ctx context.Context, update tgbotapi.Update) error
 	GetName() string
 }
 
 type Handler interface {
 	checkType(update tgbotapi.Update) bool
-	checkFilters(update tgbotapi.Update, client tgbotapi.BotAPI) bool
-	run(update tgbotapi.Update, client tgbotapi.BotAPI) (bool, error)
+	checkFilters(update tgbotapi.Update, client telegram.BotClient) bool
+	run(ctx context.Context, update tgbotapi.Update, client telegram.BotClient) (bool, error)
 	getId() uuid.UUID
 	GetName() string
+	String() string
+	route() route
+	withMiddleware(mw []Middleware) Handler
+}
+
+// route - параметры маршрутизации хендлера (см. Router)
+// match - дешевая проверка данных обновления (префикс callback data или имя команды), "" - без проверки
+// exact - match сравнивается целиком, а не как префикс
+// priority - маршруты с большим приоритетом проверяются раньше
+// fallThrough - после срабатывания маршрута проверять следующие
+type route struct {
+	match       string
+	exact       bool
+	priority    int
+	fallThrough bool
 }
 
 type BaseHandler struct {
@@ -27,6 +49,61 @@ type BaseHandler struct {
 	queryType string
 	callback  Callback
 	filters   []Filter
+	routing   route
+}
+
+// OnPrefix ограничивает хендлер callback'ами маршрута prefix (данные prefix, prefix?параметры
+// или prefix#токен, см. callback.RouteOf), для команд - командой с именем prefix, для сообщений -
+// текстом, начинающимся с prefix. Проверка выполняется до фильтров.
+func (h BaseHandler) OnPrefix(prefix string) BaseHandler {
+	h.routing.match = prefix
+	h.routing.exact = false
+	return h
+}
+
+// OnData ограничивает хендлер callback'ами с данными, в точности равными data
+func (h BaseHandler) OnData(data string) BaseHandler {
+	h.routing.match = data
+	h.routing.exact = true
+	return h
+}
+
+// WithPriority задает приоритет маршрута: маршруты с большим приоритетом проверяются раньше
+func (h BaseHandler) WithPriority(priority int) BaseHandler {
+	h.routing.priority = priority
+	return h
+}
+
+// FallThrough разрешает Router проверять следующие маршруты после срабатывания этого
+func (h BaseHandler) FallThrough() BaseHandler {
+	h.routing.fallThrough = true
+	return h
+}
+
+// Use оборачивает обработчик маршрута в middleware; первая в списке выполняется первой
+func (h BaseHandler) Use(mw ...Middleware) BaseHandler {
+	h.callback = chain(h.callback, mw)
+	return h
+}
+
+func (h BaseHandler) withMiddleware(mw []Middleware) Handler {
+	return h.Use(mw...)
+}
+
+func (h BaseHandler) route() route {
+	return h.routing
+}
+
+// String описывает маршрут для логов и HandleResult
+func (h BaseHandler) String() string {
+	switch {
+	case h.routing.match == "":
+		return h.queryType
+	case h.routing.exact:
+		return h.queryType + ":" + h.routing.match
+	default:
+		return h.queryType + ":" + h.routing.match + "*"
+	}
 }
 
 func (h BaseHandler) GetName() string {
@@ -51,7 +128,34 @@ func (h BaseHandler) checkType(update tgbotapi.Update) bool {
 	}
 }
 
-func (h BaseHandler) checkFilters(update tgbotapi.Update, client tgbotapi.BotAPI) bool {
+// checkMatch выполняет дешевую проверку маршрута; вызывается после checkType
+func (h BaseHandler) checkMatch(update tgbotapi.Update) bool {
+	if h.routing.match == "" {
+		return true
+	}
+
+	var value string
+	switch {
+	case h.queryType == commandType:
+		value = update.Message.Command()
+	case update.CallbackQuery != nil:
+		value = update.CallbackQuery.Data
+	case update.Message != nil:
+		value = update.Message.Text
+	}
+
+	switch {
+	case h.routing.exact || h.queryType == commandType:
+		return value == h.routing.match
+	case update.CallbackQuery != nil:
+		// Имя маршрута сравнивается целиком, чтобы "adminOrder" не перехватывал "adminOrders?..."
+		return callback.RouteOf(value) == h.routing.match
+	default:
+		return strings.HasPrefix(value, h.routing.match)
+	}
+}
+
+func (h BaseHandler) checkFilters(update tgbotapi.Update, client telegram.BotClient) bool {
 	for _, f := range h.filters {
 		if !f(update, client) {
 			return false
@@ -61,40 +165,24 @@ func (h BaseHandler) checkFilters(update tgbotapi.Update, client tgbotapi.BotAPI
 	return true
 }
 
-func (h BaseHandler) run(update tgbotapi.Update, client tgbotapi.BotAPI) (bool, error) {
-	if h.checkType(update) && h.checkFilters(update, client) {
-		return true, h.callback.Run(update)
+func (h BaseHandler) run(ctx context.Context, update tgbotapi.Update, client telegram.BotClient) (bool, error) {
+	if h.checkType(update) && h.checkMatch(update) && h.checkFilters(update, client) {
+		return true, h.callback.Run(logger.WithFields(ctx, "handler", h.GetName()), update)
 	}
 
 	return false, nil
 }
 
-type ActiveHandlers struct {
-	Handlers []Handler
-}
-
+// HandleResult - результат обработки обновления хендлером
+// Route - маршрут, обработавший обновление (см. BaseHandler.String)
+// Fallback - обновление не подошло ни одному маршруту и обработано запасным хендлером Router
 type HandleResult struct {
-	UUID uuid.UUID
-	Name string
-	IsActed bool
-	Error error
-}
-
-func (hl ActiveHandlers) HandleAll(update tgbotapi.Update, client tgbotapi.BotAPI) map[uuid.UUID]HandleResult {
-	result := make(map[uuid.UUID]HandleResult)
-
-	for _, h := range hl.Handlers {
-		runResult, err := h.run(update, client)
-
-		result[h.getId()] = HandleResult{
-			UUID: h.getId(),
-			Name: h.GetName(),
-			IsActed: runResult,
-			Error: err,
-		}
-	}
-
-	return result
+	UUID     uuid.UUID
+	Name     string
+	Route    string
+	IsActed  bool
+	Fallback bool
+	Error    error
 }
 
 type handlerProducer struct {
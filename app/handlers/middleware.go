@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"main/callback"
+	"main/database/models"
+	"main/logger"
+	"main/metrics"
+	"main/telegram"
+	"runtime/debug"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ErrPanic - ошибка, в которую Recover превращает панику обработчика
+var ErrPanic = errors.New("handler panicked")
+
+// Middleware оборачивает Callback дополнительной логикой.
+// Middleware может не вызывать next, чтобы остановить обработку (например, при нехватке прав).
+type Middleware func(next Callback) Callback
+
+// callbackFunc - Callback из функции; имя берется у оборачиваемого Callback
+type callbackFunc struct {
+	name string
+	run  func(ctx context.Context, update tgbotapi.Update) error
+}
+
+func (c callbackFunc) Run(ctx context.Context, update tgbotapi.Update) error {
+	return c.run(ctx, update)
+}
+
+func (c callbackFunc) GetName() string {
+	return c.name
+}
+
+// wrap создает Callback с именем next, выполняющий run
+func wrap(next Callback, run func(ctx context.Context, update tgbotapi.Update) error) Callback {
+	return callbackFunc{name: next.GetName(), run: run}
+}
+
+// chain оборачивает callback в middleware так, что первая в списке выполняется первой
+func chain(callback Callback, mw []Middleware) Callback {
+	for i := len(mw) - 1; i >= 0; i-- {
+		callback = mw[i](callback)
+	}
+
+	return callback
+}
+
+// sender возвращает автора и чат обновления
+func sender(update tgbotapi.Update) (*tgbotapi.User, int64) {
+	switch {
+	case update.CallbackQuery != nil:
+		var chatID int64
+		if update.CallbackQuery.Message != nil {
+			chatID = update.CallbackQuery.Message.Chat.ID
+		}
+		return update.CallbackQuery.From, chatID
+	case update.Message != nil:
+		return update.Message.From, update.Message.Chat.ID
+	default:
+		return nil, 0
+	}
+}
+
+// deny сообщает пользователю, что действие недоступно:
+// для callback'ов - всплывающим уведомлением, для сообщений - ответным сообщением
+func deny(client telegram.BotClient, update tgbotapi.Update, text string) error {
+	if update.CallbackQuery != nil {
+		_, err := client.Request(tgbotapi.CallbackConfig{
+			CallbackQueryID: update.CallbackQuery.ID,
+			Text:            text,
+			ShowAlert:       true,
+		})
+		return err
+	}
+
+	_, chatID := sender(update)
+	if chatID == 0 {
+		return nil
+	}
+
+	_, err := client.Send(tgbotapi.NewMessage(chatID, text))
+
+	return err
+}
+
+// Recover превращает панику обработчика в ошибку ErrPanic, чтобы она не роняла воркер
+func Recover() Middleware {
+	return func(next Callback) Callback {
+		return wrap(next, func(ctx context.Context, update tgbotapi.Update) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					logger.FromContext(ctx).Errorw("Panic in handler", "panic", r, "stack", string(debug.Stack()))
+					err = fmt.Errorf("%w: %s: %v", ErrPanic, next.GetName(), r)
+				}
+			}()
+
+			return next.Run(ctx, update)
+		})
+	}
+}
+
+// Log пишет в лог (уровень Debug) каждый вызов обработчика и его длительность
+func Log() Middleware {
+	return func(next Callback) Callback {
+		return wrap(next, func(ctx context.Context, update tgbotapi.Update) error {
+			start := time.Now()
+			err := next.Run(ctx, update)
+
+			logger.FromContext(ctx).Debugw("Handler finished", "duration", time.Since(start), "error", err)
+
+			return err
+		})
+	}
+}
+
+// Metrics учитывает вызовы, длительность, ошибки и паники обработчиков в m
+func Metrics(m *metrics.Metrics) Middleware {
+	return func(next Callback) Callback {
+		return wrap(next, func(ctx context.Context, update tgbotapi.Update) error {
+			start := time.Now()
+			err := next.Run(ctx, update)
+			m.RecordHandler(next.GetName(), time.Since(start), err == nil)
+
+			switch {
+			case errors.Is(err, ErrPanic):
+				m.RecordError("panic")
+			case err != nil:
+				m.RecordError("handler_error")
+			}
+
+			return err
+		})
+	}
+}
+
+// staleButtonText - ответ на нажатие кнопки, данные которой уже удалены из callback.Store
+const staleButtonText = "Кнопка устарела. Откройте меню заново: /start"
+
+// StaleButtons отвечает на нажатие устаревшей кнопки (callback.ErrUnknownToken) всплывающим уведомлением
+// вместо ошибки обработчика
+func StaleButtons(client telegram.BotClient) Middleware {
+	return func(next Callback) Callback {
+		return wrap(next, func(ctx context.Context, update tgbotapi.Update) error {
+			err := next.Run(ctx, update)
+			if update.CallbackQuery == nil || !errors.Is(err, callback.ErrUnknownToken) {
+				return err
+			}
+
+			logger.FromContext(ctx).Warningw("Stale callback button", "error", err)
+
+			return deny(client, update, staleButtonText)
+		})
+	}
+}
+
+// userLookup загружает пользователя по Telegram ID; pg.ErrNoRows - пользователь не найден
+type userLookup func(id int64) (models.TelegramUser, error)
+
+func dbUsers(db *pg.DB) userLookup {
+	return func(id int64) (models.TelegramUser, error) {
+		user := models.TelegramUser{ID: id}
+		err := user.Get(db)
+
+		return user, err
+	}
+}
+
+// requireUser пропускает только пользователей, для которых allowed возвращает true.
+// Остальным отвечает denyText; если задан denyLog, отказ пишется в журнал.
+func requireUser(users userLookup, client telegram.BotClient, allowed func(user models.TelegramUser) bool, denyText, denyLog string) Middleware {
+	return func(next Callback) Callback {
+		return wrap(next, func(ctx context.Context, update tgbotapi.Update) error {
+			from, _ := sender(update)
+			if from == nil {
+				return nil
+			}
+
+			user, err := users(from.ID)
+			if err != nil && err != pg.ErrNoRows {
+				return err
+			}
+
+			if err == pg.ErrNoRows || !allowed(user) {
+				if denyLog != "" {
+					logger.FromContext(ctx).Warningw(denyLog)
+				}
+				return deny(client, update, denyText)
+			}
+
+			return next.Run(ctx, update)
+		})
+	}
+}
+
+// RequireRegistered пропускает только пользователей, завершивших регистрацию
+func RequireRegistered(db *pg.DB, client telegram.BotClient) Middleware {
+	return requireRegistered(dbUsers(db), client)
+}
+
+func requireRegistered(users userLookup, client telegram.BotClient) Middleware {
+	return requireUser(users, client, func(user models.TelegramUser) bool { return user.IsAuthorized },
+		"Сначала пройдите регистрацию: отправьте /start", "")
+}
+
+// RequireAdmin пропускает только администраторов (TelegramUser.IsAdmin)
+func RequireAdmin(db *pg.DB, client telegram.BotClient) Middleware {
+	return requireAdmin(dbUsers(db), client)
+}
+
+func requireAdmin(users userLookup, client telegram.BotClient) Middleware {
+	return requireUser(users, client, func(user models.TelegramUser) bool { return user.IsAdmin },
+		"Недостаточно прав", "Admin handler denied")
+}
+
+// RequireOwner пропускает только владельцев бота (TelegramUser.IsOwner)
+func RequireOwner(db *pg.DB, client telegram.BotClient) Middleware {
+	return requireOwner(dbUsers(db), client)
+}
+
+func requireOwner(users userLookup, client telegram.BotClient) Middleware {
+	return requireUser(users, client, func(user models.TelegramUser) bool { return user.IsOwner },
+		"Недостаточно прав", "Owner handler denied")
+}
+
+// RequireChat пропускает только обновления из чата chatID (например, чата администратора)
+func RequireChat(chatID int64, client telegram.BotClient) Middleware {
+	return func(next Callback) Callback {
+		return wrap(next, func(ctx context.Context, update tgbotapi.Update) error {
+			from, updateChatID := sender(update)
+			if updateChatID != chatID {
+				if from != nil {
+					logger.FromContext(ctx).Warningw("Handler used outside of its chat", "allowed_chat_id", chatID)
+				}
+				return deny(client, update, "Недостаточно прав")
+			}
+
+			return next.Run(ctx, update)
+		})
+	}
+}
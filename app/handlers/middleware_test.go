@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"main/callback"
+	"main/database/models"
+	"main/telegram"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeUsers - userLookup по пользователям в памяти
+func fakeUsers(users ...models.TelegramUser) userLookup {
+	byID := make(map[int64]models.TelegramUser)
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+
+	return func(id int64) (models.TelegramUser, error) {
+		user, ok := byID[id]
+		if !ok {
+			return models.TelegramUser{}, pg.ErrNoRows
+		}
+
+		return user, nil
+	}
+}
+
+func fromUser(update tgbotapi.Update, userID int64) tgbotapi.Update {
+	if update.CallbackQuery != nil {
+		update.CallbackQuery.From = &tgbotapi.User{ID: userID}
+	} else {
+		update.Message.From = &tgbotapi.User{ID: userID}
+		update.Message.Chat = &tgbotapi.Chat{ID: userID}
+	}
+
+	return update
+}
+
+// TestRequireRoles проверяет, что администраторские маршруты недоступны покупателям,
+// а маршруты владельца (admins, grant_admin, revoke_admin, admin_log) - администраторам без прав владельца
+func TestRequireRoles(t *testing.T) {
+	const (
+		unknownID  = 1
+		customerID = 2
+		adminID    = 3
+		ownerID    = 4
+	)
+
+	users := fakeUsers(
+		models.TelegramUser{ID: customerID, IsAuthorized: true},
+		models.TelegramUser{ID: adminID, IsAuthorized: true, IsAdmin: true},
+		models.TelegramUser{ID: ownerID, IsAuthorized: true, IsAdmin: true, IsOwner: true},
+	)
+
+	log := &callLog{}
+	bot := telegram.NewFakeBot()
+	registered, admin, owner := requireRegistered(users, bot), requireAdmin(users, bot), requireOwner(users, bot)
+	h := func(name string) Callback { return recorder{name: name, log: log} }
+
+	router := NewRouter(nil,
+		CallbackQueryHandler.Product(h("shop"), nil).OnPrefix("shop").Use(registered),
+		CommandHandler.Product(h("orders"), nil).OnPrefix("orders").Use(admin),
+		CallbackQueryHandler.Product(h("adminOrders"), nil).OnPrefix("adminOrders").Use(admin),
+		CommandHandler.Product(h("admins"), nil).OnPrefix("admins").Use(owner),
+		CallbackQueryHandler.Product(h("admins callback"), nil).OnData("admins").Use(owner),
+		CommandHandler.Product(h("grant_admin"), nil).OnPrefix("grant_admin").Use(owner),
+		CommandHandler.Product(h("revoke_admin"), nil).OnPrefix("revoke_admin").Use(owner),
+		CallbackQueryHandler.Product(h("revokeAdmin"), nil).OnPrefix("revokeAdmin").Use(owner),
+		CommandHandler.Product(h("admin_log"), nil).OnPrefix("admin_log").Use(owner),
+	)
+
+	type role int
+	const (
+		anyone role = iota
+		registeredOnly
+		adminOnly
+		ownerOnly
+	)
+
+	routes := []struct {
+		update tgbotapi.Update
+		name   string
+		need   role
+	}{
+		{callbackUpdate("shop"), "shop", registeredOnly},
+		{commandUpdate("/orders"), "orders", adminOnly},
+		{callbackUpdate("adminOrders?tab=review"), "adminOrders", adminOnly},
+		{commandUpdate("/admins"), "admins", ownerOnly},
+		{callbackUpdate("admins"), "admins callback", ownerOnly},
+		{commandUpdate("/grant_admin 2"), "grant_admin", ownerOnly},
+		{commandUpdate("/revoke_admin 3"), "revoke_admin", ownerOnly},
+		{callbackUpdate("revokeAdmin?id=3"), "revokeAdmin", ownerOnly},
+		{commandUpdate("/admin_log"), "admin_log", ownerOnly},
+	}
+
+	callers := []struct {
+		name   string
+		userID int64
+		has    role
+	}{
+		{"unknown user", unknownID, anyone},
+		{"customer", customerID, registeredOnly},
+		{"admin", adminID, adminOnly},
+		{"owner", ownerID, ownerOnly},
+	}
+
+	for _, c := range callers {
+		for _, r := range routes {
+			log.calls = nil
+			bot.Reset()
+
+			results := router.Handle(context.Background(), fromUser(r.update, c.userID), bot)
+			if len(results) != 1 || results[0].Error != nil {
+				t.Fatalf("%s -> %s: unexpected results %+v", c.name, r.name, results)
+			}
+
+			allowed := c.has >= r.need
+			ran := len(log.calls) == 1 && log.calls[0] == r.name
+			if ran != allowed {
+				t.Errorf("%s -> %s: handler ran = %v, want %v", c.name, r.name, ran, allowed)
+			}
+
+			last, replied := bot.Last()
+			if allowed && replied {
+				t.Errorf("%s -> %s: unexpected reply %+v", c.name, r.name, last)
+			}
+			if !allowed && (!replied || last.Text == "") {
+				t.Errorf("%s -> %s: expected the user to be told access is denied", c.name, r.name)
+			}
+			if !allowed && r.need > registeredOnly && last.Text != "Недостаточно прав" {
+				t.Errorf("%s -> %s: expected «Недостаточно прав», got %q", c.name, r.name, last.Text)
+			}
+		}
+	}
+}
+
+func TestStaleButtons(t *testing.T) {
+	failing := errors.New("failed")
+	decode := callbackFunc{name: "myOrders", run: func(_ context.Context, update tgbotapi.Update) error {
+		var route callback.MyOrders
+		if update.CallbackQuery != nil {
+			return callback.Decode(update.CallbackQuery.Data, &route)
+		}
+		return callback.ErrUnknownToken
+	}}
+
+	tests := []struct {
+		name    string
+		handler Callback
+		update  tgbotapi.Update
+		err     error
+		answer  string
+	}{
+		{"unknown token", decode, callbackUpdate("myOrders#missing"), nil, staleButtonText},
+		{"valid data", decode, callbackUpdate("myOrders?p=1"), nil, ""},
+		{"other error", recorder{name: "failing", log: &callLog{}, err: failing}, callbackUpdate("myOrders"), failing, ""},
+		{"not a callback", decode, textUpdate("hello"), callback.ErrUnknownToken, ""},
+	}
+
+	for _, tt := range tests {
+		bot := telegram.NewFakeBot()
+		router := NewRouter(nil, CallbackQueryHandler.Product(tt.handler, nil), MessageHandler.Product(tt.handler, nil))
+		router.Use(StaleButtons(bot))
+
+		results := router.Handle(context.Background(), tt.update, bot)
+		if len(results) != 1 || !errors.Is(results[0].Error, tt.err) || (tt.err == nil && results[0].Error != nil) {
+			t.Errorf("%s: expected error %v, got %+v", tt.name, tt.err, results)
+		}
+
+		last, replied := bot.Last()
+		if tt.answer == "" && replied {
+			t.Errorf("%s: unexpected reply %+v", tt.name, last)
+		}
+		if tt.answer != "" && (!replied || last.Kind != telegram.KindCallbackAnswer || last.Text != tt.answer) {
+			t.Errorf("%s: expected callback answer %q, got %+v", tt.name, tt.answer, last)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"main/logger"
+	"main/telegram"
+	"sort"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/google/uuid"
+)
+
+// Router выбирает хендлер для обновления.
+// Маршруты проверяются по убыванию приоритета, при равном приоритете маршруты с дешевой
+// проверкой (OnPrefix/OnData) идут раньше остальных, дальше - в порядке регистрации.
+// Обработка останавливается на первом сработавшем маршруте, если он не помечен FallThrough.
+// Если не сработал ни один маршрут, обновление передается в Fallback (если он задан).
+type Router struct {
+	routes   []Handler
+	Fallback Callback
+}
+
+// NewRouter создает Router из маршрутов routes. fallback может быть nil.
+func NewRouter(fallback Callback, routes ...Handler) *Router {
+	sorted := make([]Handler, len(routes))
+	copy(sorted, routes)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, rj := sorted[i].route(), sorted[j].route()
+		if ri.priority != rj.priority {
+			return ri.priority > rj.priority
+		}
+
+		return ri.match != "" && rj.match == ""
+	})
+
+	return &Router{routes: sorted, Fallback: fallback}
+}
+
+// Use оборачивает в middleware все маршруты и запасной хендлер.
+// Middleware, добавленные через Use, выполняются раньше middleware отдельных маршрутов.
+func (r *Router) Use(mw ...Middleware) {
+	for i, h := range r.routes {
+		r.routes[i] = h.withMiddleware(mw)
+	}
+
+	if r.Fallback != nil {
+		r.Fallback = chain(r.Fallback, mw)
+	}
+}
+
+// Routes возвращает маршруты в порядке проверки
+func (r *Router) Routes() []Handler {
+	return r.routes
+}
+
+// Handle обрабатывает обновление и возвращает результаты сработавших маршрутов
+// (или запасного хендлера) в порядке срабатывания. Пустой результат - обновление никто не обработал.
+func (r *Router) Handle(ctx context.Context, update tgbotapi.Update, client telegram.BotClient) []HandleResult {
+	var results []HandleResult
+
+	for _, h := range r.routes {
+		acted, err := h.run(ctx, update, client)
+		if !acted {
+			continue
+		}
+
+		results = append(results, HandleResult{
+			UUID:    h.getId(),
+			Name:    h.GetName(),
+			Route:   h.String(),
+			IsActed: true,
+			Error:   err,
+		})
+
+		if !h.route().fallThrough {
+			return results
+		}
+	}
+
+	if len(results) == 0 && r.Fallback != nil {
+		results = append(results, HandleResult{
+			UUID:     uuid.Nil,
+			Name:     r.Fallback.GetName(),
+			Route:    "fallback",
+			IsActed:  true,
+			Fallback: true,
+			Error:    r.Fallback.Run(logger.WithFields(ctx, "handler", r.Fallback.GetName()), update),
+		})
+	}
+
+	return results
+}
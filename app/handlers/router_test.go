@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"main/telegram"
+	"reflect"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// callLog - порядок вызовов обработчиков и middleware в тесте
+type callLog struct {
+	calls []string
+}
+
+// recorder - Callback, который записывает свой вызов в log
+type recorder struct {
+	name string
+	log  *callLog
+	err  error
+}
+
+func (r recorder) Run(context.Context, tgbotapi.Update) error {
+	r.log.calls = append(r.log.calls, r.name)
+	return r.err
+}
+
+func (r recorder) GetName() string {
+	return r.name
+}
+
+// mark - middleware, которая записывает name перед вызовом следующего обработчика
+func mark(name string, log *callLog) Middleware {
+	return func(next Callback) Callback {
+		return wrap(next, func(ctx context.Context, update tgbotapi.Update) error {
+			log.calls = append(log.calls, name)
+			return next.Run(ctx, update)
+		})
+	}
+}
+
+func callbackUpdate(data string) tgbotapi.Update {
+	return tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      "query",
+		From:    &tgbotapi.User{ID: 1},
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}},
+		Data:    data,
+	}}
+}
+
+func commandUpdate(text string) tgbotapi.Update {
+	command := strings.Fields(text)[0]
+
+	return tgbotapi.Update{Message: &tgbotapi.Message{
+		From:     &tgbotapi.User{ID: 1},
+		Chat:     &tgbotapi.Chat{ID: 1},
+		Text:     text,
+		Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}},
+	}}
+}
+
+func textUpdate(text string) tgbotapi.Update {
+	return tgbotapi.Update{Message: &tgbotapi.Message{
+		From: &tgbotapi.User{ID: 1},
+		Chat: &tgbotapi.Chat{ID: 1},
+		Text: text,
+	}}
+}
+
+// handled возвращает имена обработчиков из результатов Router.Handle
+func handled(results []HandleResult) []string {
+	var names []string
+	for _, r := range results {
+		names = append(names, r.Name)
+	}
+
+	return names
+}
+
+func TestRouterOrder(t *testing.T) {
+	log := &callLog{}
+	h := func(name string) Callback { return recorder{name: name, log: log} }
+
+	router := NewRouter(nil,
+		CallbackQueryHandler.Product(h("any"), nil),
+		CallbackQueryHandler.Product(h("prefix"), nil).OnPrefix("shop"),
+		CallbackQueryHandler.Product(h("urgent"), nil).WithPriority(10),
+		CallbackQueryHandler.Product(h("second prefix"), nil).OnPrefix("shop"),
+		CallbackQueryHandler.Product(h("low"), nil).WithPriority(-1).OnPrefix("shop"),
+	)
+
+	var order []string
+	for _, r := range router.Routes() {
+		order = append(order, r.GetName())
+	}
+
+	// Сначала приоритет, затем маршруты с дешевой проверкой, затем порядок регистрации
+	want := []string{"urgent", "prefix", "second prefix", "any", "low"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("expected routes in order %v, got %v", want, order)
+	}
+
+	if got := handled(router.Handle(context.Background(), callbackUpdate("shop"), telegram.NewFakeBot())); !reflect.DeepEqual(got, []string{"urgent"}) {
+		t.Errorf("expected only the highest priority route to handle the update, got %v", got)
+	}
+}
+
+func TestRouterMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler BaseHandler
+		update  tgbotapi.Update
+		want    bool
+	}{
+		{"callback route", CallbackQueryHandler.Product(nil, nil).OnPrefix("adminOrder"), callbackUpdate("adminOrder"), true},
+		{"callback with params", CallbackQueryHandler.Product(nil, nil).OnPrefix("adminOrder"), callbackUpdate("adminOrder?id=1"), true},
+		{"callback with token", CallbackQueryHandler.Product(nil, nil).OnPrefix("adminOrder"), callbackUpdate("adminOrder#abc"), true},
+		{"longer route name", CallbackQueryHandler.Product(nil, nil).OnPrefix("adminOrder"), callbackUpdate("adminOrders?tab=review"), false},
+		{"other route", CallbackQueryHandler.Product(nil, nil).OnPrefix("adminOrder"), callbackUpdate("shop"), false},
+		{"exact data", CallbackQueryHandler.Product(nil, nil).OnData("makeOrder"), callbackUpdate("makeOrder"), true},
+		{"exact data with params", CallbackQueryHandler.Product(nil, nil).OnData("makeOrder"), callbackUpdate("makeOrder?x=1"), false},
+		{"command", CommandHandler.Product(nil, nil).OnPrefix("start"), commandUpdate("/start"), true},
+		{"command with args", CommandHandler.Product(nil, nil).OnPrefix("start"), commandUpdate("/start ref"), true},
+		{"longer command", CommandHandler.Product(nil, nil).OnPrefix("start"), commandUpdate("/started"), false},
+		{"message prefix", MessageHandler.Product(nil, nil).OnPrefix("Привет"), textUpdate("Привет, бот"), true},
+		{"message without prefix", MessageHandler.Product(nil, nil).OnPrefix("Привет"), textUpdate("Пока"), false},
+		{"no match configured", CallbackQueryHandler.Product(nil, nil), callbackUpdate("anything"), true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.handler.checkType(tt.update) && tt.handler.checkMatch(tt.update); got != tt.want {
+			t.Errorf("%s: route %s matched = %v, want %v", tt.name, tt.handler, got, tt.want)
+		}
+	}
+}
+
+func TestRouterFallThroughAndFallback(t *testing.T) {
+	log := &callLog{}
+	failing := errors.New("failed")
+
+	router := NewRouter(recorder{name: "fallback", log: log},
+		CallbackQueryHandler.Product(recorder{name: "audit", log: log}, nil).WithPriority(1).FallThrough(),
+		CallbackQueryHandler.Product(recorder{name: "shop", log: log, err: failing}, nil).OnPrefix("shop"),
+		CallbackQueryHandler.Product(recorder{name: "shop again", log: log}, nil).OnPrefix("shop"),
+		CommandHandler.Product(recorder{name: "start", log: log}, nil).OnPrefix("start"),
+	)
+	bot := telegram.NewFakeBot()
+
+	// Маршрут с FallThrough не останавливает поиск, обычный - останавливает, даже если вернул ошибку
+	results := router.Handle(context.Background(), callbackUpdate("shop"), bot)
+	if got := handled(results); !reflect.DeepEqual(got, []string{"audit", "shop"}) {
+		t.Fatalf("expected audit and shop to handle the update, got %v", got)
+	}
+	if !errors.Is(results[1].Error, failing) || results[1].Route != "callbackQuery:shop*" || results[0].Fallback {
+		t.Errorf("unexpected results: %+v", results)
+	}
+
+	// Сработал только маршрут с FallThrough: запасной хендлер не вызывается
+	if got := handled(router.Handle(context.Background(), callbackUpdate("other"), bot)); !reflect.DeepEqual(got, []string{"audit"}) {
+		t.Errorf("expected only audit for an unknown callback, got %v", got)
+	}
+
+	// Не сработал ни один маршрут
+	results = router.Handle(context.Background(), textUpdate("hello"), bot)
+	if len(results) != 1 || !results[0].Fallback || results[0].Name != "fallback" {
+		t.Errorf("expected the fallback to handle an unmatched message, got %+v", results)
+	}
+
+	if len(NewRouter(nil).Handle(context.Background(), textUpdate("hello"), bot)) != 0 {
+		t.Error("expected no results without routes and fallback")
+	}
+}
+
+func TestRouterMiddlewareOrder(t *testing.T) {
+	log := &callLog{}
+
+	router := NewRouter(recorder{name: "fallback", log: log},
+		CallbackQueryHandler.Product(recorder{name: "handler", log: log}, nil).OnPrefix("shop").Use(mark("route 1", log), mark("route 2", log)),
+	)
+	router.Use(mark("router 1", log), mark("router 2", log))
+
+	router.Handle(context.Background(), callbackUpdate("shop"), telegram.NewFakeBot())
+	want := []string{"router 1", "router 2", "route 1", "route 2", "handler"}
+	if !reflect.DeepEqual(log.calls, want) {
+		t.Errorf("expected calls %v, got %v", want, log.calls)
+	}
+
+	log.calls = nil
+	router.Handle(context.Background(), textUpdate("hello"), telegram.NewFakeBot())
+	want = []string{"router 1", "router 2", "fallback"}
+	if !reflect.DeepEqual(log.calls, want) {
+		t.Errorf("expected router middleware around the fallback %v, got %v", want, log.calls)
+	}
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	panicking := callbackFunc{name: "panicking", run: func(context.Context, tgbotapi.Update) error {
+		panic("boom")
+	}}
+
+	router := NewRouter(nil, CallbackQueryHandler.Product(panicking, nil))
+	router.Use(Recover())
+
+	results := router.Handle(context.Background(), callbackUpdate("shop"), telegram.NewFakeBot())
+	if len(results) != 1 || !errors.Is(results[0].Error, ErrPanic) || results[0].Name != "panicking" {
+		t.Errorf("expected the panic to become ErrPanic, got %+v", results)
+	}
+}
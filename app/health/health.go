@@ -0,0 +1,228 @@
+// Package health отвечает оркестратору на вопросы "жив ли бот" (/healthz) и "готов ли он
+// принимать обновления" (/readyz).
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// checkTimeout - сколько ждать одну проверку готовности
+const checkTimeout = 3 * time.Second
+
+// Check - проверка готовности; nil означает, что проверка пройдена
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Heartbeat - отметка живости одного компонента бота (см. Checker.Heartbeat)
+type Heartbeat struct {
+	lastBeat atomic.Int64
+}
+
+// Beat отмечает, что компонент жив
+func (h *Heartbeat) Beat() {
+	h.lastBeat.Store(time.Now().UnixNano())
+}
+
+func (h *Heartbeat) since() time.Duration {
+	return time.Since(time.Unix(0, h.lastBeat.Load()))
+}
+
+type namedHeartbeat struct {
+	name      string
+	heartbeat *Heartbeat
+}
+
+// Checker собирает состояние бота.
+// Живость: каждый компонент, зарегистрированный через Heartbeat, регулярно отмечается; если компонент
+// не отмечался дольше stallTimeout, он считается зависшим. Пока компонентов нет (бот запускается,
+// например ждет миграций), бот считается живым. Готовность: все проверки, добавленные через AddReadiness,
+// проходят и бот не останавливается.
+type Checker struct {
+	stallTimeout time.Duration
+	stopping     atomic.Bool
+
+	mu         sync.RWMutex
+	checks     []namedCheck
+	heartbeats []namedHeartbeat
+}
+
+// New создает Checker
+func New(stallTimeout time.Duration) *Checker {
+	return &Checker{stallTimeout: stallTimeout}
+}
+
+// Heartbeat регистрирует компонент name для проверки живости; отсчет stallTimeout начинается сразу
+func (c *Checker) Heartbeat(name string) *Heartbeat {
+	h := &Heartbeat{}
+	h.Beat()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.heartbeats = append(c.heartbeats, namedHeartbeat{name: name, heartbeat: h})
+
+	return h
+}
+
+// AddReadiness добавляет проверку готовности name
+func (c *Checker) AddReadiness(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// SetStopping переводит бота в состояние остановки: /readyz начинает отвечать 503,
+// чтобы оркестратор перестал направлять на него трафик
+func (c *Checker) SetStopping() {
+	c.stopping.Store(true)
+}
+
+// Live возвращает результат проверки каждого компонента: ошибку, если компонент завис
+func (c *Checker) Live() map[string]error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	res := make(map[string]error, len(c.heartbeats))
+	for _, nh := range c.heartbeats {
+		if since := nh.heartbeat.since(); since > c.stallTimeout {
+			res[nh.name] = fmt.Errorf("stalled for %v", since.Round(time.Millisecond))
+		} else {
+			res[nh.name] = nil
+		}
+	}
+
+	return res
+}
+
+// Ready выполняет все проверки готовности параллельно и возвращает результат каждой
+func (c *Checker) Ready(ctx context.Context) map[string]error {
+	c.mu.RLock()
+	checks := append([]namedCheck(nil), c.checks...)
+	c.mu.RUnlock()
+
+	res := make(map[string]error, len(checks)+1)
+	if c.stopping.Load() {
+		res["shutdown"] = errors.New("bot is shutting down")
+	}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for _, nc := range checks {
+		wg.Add(1)
+		go func(nc namedCheck) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			err := nc.check(checkCtx)
+
+			mu.Lock()
+			res[nc.name] = err
+			mu.Unlock()
+		}(nc)
+	}
+	wg.Wait()
+
+	return res
+}
+
+// LiveHandler - обработчик /healthz
+func (c *Checker) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, c.Live())
+	})
+}
+
+// ReadyHandler - обработчик /readyz
+func (c *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, c.Ready(r.Context()))
+	})
+}
+
+// writeStatus отвечает 200, если все проверки пройдены, иначе 503; в теле - результат каждой проверки
+func writeStatus(w http.ResponseWriter, results map[string]error) {
+	body := make(map[string]string, len(results))
+	code := http.StatusOK
+
+	for name, err := range results {
+		if err != nil {
+			body[name] = err.Error()
+			code = http.StatusServiceUnavailable
+		} else {
+			body[name] = "ok"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// Periodic запускает probe каждые interval до отмены ctx и возвращает проверку готовности,
+// которая проходит, если последний успешный probe был не раньше maxAge назад.
+// Подходит для дорогих или внешних проверок (например, getMe Telegram), которые не стоит
+// выполнять на каждый запрос /readyz.
+func Periodic(ctx context.Context, interval, maxAge time.Duration, probe Check) Check {
+	var (
+		mu          sync.Mutex
+		lastSuccess time.Time
+		lastErr     = errors.New("not checked yet")
+	)
+
+	run := func() {
+		probeCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+		defer cancel()
+
+		err := probe(probeCtx)
+
+		mu.Lock()
+		defer mu.Unlock()
+		lastErr = err
+		if err == nil {
+			lastSuccess = time.Now()
+		}
+	}
+
+	run()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				run()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func(context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if lastSuccess.IsZero() || time.Since(lastSuccess) > maxAge {
+			return fmt.Errorf("no successful check in %v: %v", maxAge, lastErr)
+		}
+
+		return nil
+	}
+}
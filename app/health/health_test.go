@@ -0,0 +1,50 @@
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func liveStatus(c *Checker) int {
+	rec := httptest.NewRecorder()
+	c.LiveHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	return rec.Code
+}
+
+func TestLiveWithoutHeartbeatsWhileStarting(t *testing.T) {
+	c := New(10 * time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	if code := liveStatus(c); code != http.StatusOK {
+		t.Errorf("expected 200 before any component is registered, got %d", code)
+	}
+}
+
+func TestLiveDetectsStalledHeartbeat(t *testing.T) {
+	c := New(50 * time.Millisecond)
+	workers := c.Heartbeat("workers")
+	polling := c.Heartbeat("polling")
+
+	if code := liveStatus(c); code != http.StatusOK {
+		t.Fatalf("expected 200 right after registration, got %d", code)
+	}
+
+	time.Sleep(80 * time.Millisecond)
+	workers.Beat()
+
+	res := c.Live()
+	if res["workers"] != nil || res["polling"] == nil {
+		t.Errorf("expected only polling to be stalled, got %v", res)
+	}
+	if code := liveStatus(c); code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 with a stalled component, got %d", code)
+	}
+
+	polling.Beat()
+	if code := liveStatus(c); code != http.StatusOK {
+		t.Errorf("expected 200 after the component beats again, got %d", code)
+	}
+}
@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"context"
+)
+
+type contextKey int
+
+const (
+	fieldsKey contextKey = iota
+	correlationIDKey
+)
+
+// WithFields возвращает контекст, записи из которого (см. FromContext) дополняются
+// парами ключ-значение keysAndValues. Поля накапливаются по цепочке контекстов.
+func WithFields(ctx context.Context, keysAndValues ...any) context.Context {
+	parent := Fields(ctx)
+
+	fields := make([]any, 0, len(parent)+len(keysAndValues))
+	fields = append(fields, parent...)
+	fields = append(fields, keysAndValues...)
+
+	return context.WithValue(ctx, fieldsKey, fields)
+}
+
+// Fields возвращает поля журнала, накопленные в ctx
+func Fields(ctx context.Context) []any {
+	fields, _ := ctx.Value(fieldsKey).([]any)
+	return fields
+}
+
+// WithCorrelationID сохраняет в контексте идентификатор, связывающий все записи одного обновления,
+// и добавляет его в поля журнала под ключом correlation_id
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, correlationIDKey, id)
+	return WithFields(ctx, "correlation_id", id)
+}
+
+// CorrelationID возвращает идентификатор из WithCorrelationID или "", если его нет
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey).(string)
+	return id
+}
+
+// FromContext возвращает общий логгер, добавляющий к записям поля из ctx
+func FromContext(ctx context.Context) *Logger {
+	fields := Fields(ctx)
+	if len(fields) == 0 {
+		return GetLogger()
+	}
+
+	return GetLogger().With(fields...)
+}
@@ -0,0 +1,173 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Format - формат строк журнала
+type Format string
+
+const (
+	// FormatJSON - один JSON-объект на строку
+	FormatJSON Format = "json"
+	// FormatLogfmt - строка пар key=value
+	FormatLogfmt Format = "logfmt"
+)
+
+// badKey - ключ для значения без строкового ключа (как в log/slog)
+const badKey = "!BADKEY"
+
+// timeLayout - формат времени записи (RFC 3339 с миллисекундами)
+const timeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// ParseFormat разбирает имя формата: json или logfmt
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case FormatJSON, FormatLogfmt:
+		return f, nil
+	default:
+		return FormatJSON, fmt.Errorf("unknown log format %q", s)
+	}
+}
+
+// entry - одна запись журнала
+type entry struct {
+	Time    time.Time
+	Level   LogLevel
+	File    string
+	Line    int
+	Message string
+	Fields  []any
+}
+
+// encode сериализует запись в одну строку с завершающим переводом строки
+func (e entry) encode(format Format) []byte {
+	var buf bytes.Buffer
+
+	if format == FormatLogfmt {
+		writeLogfmt(&buf, "time", e.Time.Format(timeLayout))
+		writeLogfmt(&buf, "level", e.Level.String())
+		writeLogfmt(&buf, "caller", e.File+":"+strconv.Itoa(e.Line))
+		writeLogfmt(&buf, "msg", e.Message)
+		eachField(e.Fields, func(key string, value any) {
+			writeLogfmt(&buf, key, fieldString(value))
+		})
+		buf.WriteByte('\n')
+		return buf.Bytes()
+	}
+
+	buf.WriteByte('{')
+	writeJSON(&buf, "timestamp", e.Time.Format(timeLayout))
+	writeJSON(&buf, "level", e.Level.String())
+	writeJSON(&buf, "file", e.File)
+	writeJSON(&buf, "line", e.Line)
+	writeJSON(&buf, "message", e.Message)
+	eachField(e.Fields, func(key string, value any) {
+		writeJSON(&buf, key, fieldValue(value))
+	})
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+// eachField обходит пары ключ-значение. Значение без строкового ключа
+// записывается под ключом !BADKEY, чтобы не потерять его.
+func eachField(kv []any, fn func(key string, value any)) {
+	for i := 0; i < len(kv); {
+		key, ok := kv[i].(string)
+		if !ok || i+1 == len(kv) {
+			fn(badKey, kv[i])
+			i++
+			continue
+		}
+		fn(key, kv[i+1])
+		i += 2
+	}
+}
+
+// fieldValue приводит ошибки и fmt.Stringer к строке, остальное сериализуется как есть
+func fieldValue(v any) any {
+	switch t := v.(type) {
+	case error:
+		return t.Error()
+	case fmt.Stringer:
+		return t.String()
+	default:
+		return v
+	}
+}
+
+func fieldString(v any) string {
+	switch t := fieldValue(v).(type) {
+	case string:
+		return t
+	case nil:
+		return "<nil>"
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+func writeJSON(buf *bytes.Buffer, key string, value any) {
+	if buf.Len() > 1 {
+		buf.WriteByte(',')
+	}
+
+	k, _ := json.Marshal(key)
+	buf.Write(k)
+	buf.WriteByte(':')
+
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(v)
+}
+
+func writeLogfmt(buf *bytes.Buffer, key, value string) {
+	if buf.Len() > 0 {
+		buf.WriteByte(' ')
+	}
+
+	buf.WriteString(logfmtKey(key))
+	buf.WriteByte('=')
+
+	if needsQuoting(value) {
+		buf.WriteString(strconv.Quote(value))
+	} else {
+		buf.WriteString(value)
+	}
+}
+
+// logfmtKey заменяет в ключе символы, недопустимые в logfmt
+func logfmtKey(key string) string {
+	if key == "" {
+		return badKey
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r == '=' || r == '"' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+func needsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+
+	for _, r := range s {
+		if r == '=' || r == '"' || r == '\\' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,13 +1,13 @@
 package logger
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,9 +21,19 @@ const (
 	Fatal
 )
 
+// Logger пишет записи журнала во все подключенные приемники.
+// Логгеры, полученные через With, разделяют уровень, формат и приемники с родителем.
 type Logger struct {
-	level LogLevel
-	file  *os.File
+	core   *core
+	fields []any
+}
+
+// core - общее состояние логгера и всех его потомков
+type core struct {
+	level  atomic.Int32
+	mu     sync.Mutex
+	format Format
+	sinks  []Sink
 }
 
 var (
@@ -31,28 +41,73 @@ var (
 	once     sync.Once
 )
 
+// GetLogger возвращает общий логгер. До вызова Configure он пишет JSON-строки
+// уровня Info и выше в stdout/stderr.
 func GetLogger() *Logger {
 	once.Do(func() {
-		// Открываем файл для записи логов
-		file, err := os.OpenFile("log.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			log.Printf("Error opening log file: %v", err)
+		c := &core{
+			format: FormatJSON,
+			sinks:  []Sink{NewConsoleSink()},
 		}
+		c.level.Store(int32(Info))
 
-		instance = &Logger{
-			level: Info,
-			file:  file,
-		}
+		instance = &Logger{core: c}
 	})
 	return instance
 }
 
+// Configure задает уровень, формат и приемники журнала. Прежние приемники закрываются.
+// Без приемников записи не пишутся никуда.
+func (l *Logger) Configure(level LogLevel, format Format, sinks ...Sink) {
+	l.core.mu.Lock()
+	old := l.core.sinks
+	l.core.format = format
+	l.core.sinks = sinks
+	l.core.mu.Unlock()
+
+	l.SetLevel(level)
+	closeSinks(old)
+}
+
+// Close закрывает все приемники журнала; последующие записи теряются. Вызывается при завершении бота.
+func (l *Logger) Close() {
+	l.core.mu.Lock()
+	old := l.core.sinks
+	l.core.sinks = nil
+	l.core.mu.Unlock()
+
+	closeSinks(old)
+}
+
+func closeSinks(sinks []Sink) {
+	for _, s := range sinks {
+		if err := s.Close(); err != nil {
+			log.Printf("Error closing log sink: %v", err)
+		}
+	}
+}
+
 func (l *Logger) SetLevel(level LogLevel) {
-	l.level = level
+	l.core.level.Store(int32(level))
+}
+
+// Level возвращает текущий минимальный уровень записей
+func (l *Logger) Level() LogLevel {
+	return LogLevel(l.core.level.Load())
 }
 
-func (l *Logger) log(level LogLevel, format string, args ...interface{}) {
-	if level < l.level {
+// With возвращает логгер, добавляющий пары ключ-значение к каждой записи.
+// keysAndValues - чередующиеся ключи (строки) и значения.
+func (l *Logger) With(keysAndValues ...any) *Logger {
+	fields := make([]any, 0, len(l.fields)+len(keysAndValues))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keysAndValues...)
+
+	return &Logger{core: l.core, fields: fields}
+}
+
+func (l *Logger) log(level LogLevel, msg string, keysAndValues []any) {
+	if level < l.Level() {
 		return
 	}
 
@@ -63,50 +118,29 @@ func (l *Logger) log(level LogLevel, format string, args ...interface{}) {
 		line = 0
 	}
 
-	// Формируем сообщение
-	msg := fmt.Sprintf(format, args...)
-	timestamp := time.Now().Format("2006-01-02 15:04:05.000")
-
-	// Создаем структуру для логирования
-	logEntry := struct {
-		Timestamp string `json:"timestamp"`
-		Level     string `json:"level"`
-		File      string `json:"file"`
-		Line      int    `json:"line"`
-		Message   string `json:"message"`
-	}{
-		Timestamp: timestamp,
-		Level:     strings.ToUpper(level.String()),
-		File:      file,
-		Line:      line,
-		Message:   msg,
+	e := entry{
+		Time:    time.Now(),
+		Level:   level,
+		File:    file,
+		Line:    line,
+		Message: msg,
+		Fields:  l.fields,
 	}
-
-	// Сериализуем в JSON с отступами
-	jsonData, err := json.MarshalIndent(logEntry, "", "    ")
-	if err != nil {
-		log.Printf("Error marshaling log entry: %v", err)
-		return
+	if len(keysAndValues) > 0 {
+		e.Fields = append(e.Fields[:len(e.Fields):len(e.Fields)], keysAndValues...)
 	}
 
-	// Добавляем перенос строки
-	jsonData = append(jsonData, '\n')
-
-	// Записываем в файл
-	if l.file != nil {
-		if _, err := l.file.Write(jsonData); err != nil {
-			log.Printf("Error writing to log file: %v", err)
+	l.core.mu.Lock()
+	data := e.encode(l.core.format)
+	for _, s := range l.core.sinks {
+		if err := s.Write(level, data); err != nil {
+			log.Printf("Error writing log entry: %v", err)
 		}
 	}
+	l.core.mu.Unlock()
 
-	// Выводим в соответствующий поток
-	switch level {
-	case Debug, Info:
-		fmt.Fprintln(os.Stdout, string(jsonData))
-	case Warning, Error:
-		fmt.Fprintln(os.Stderr, string(jsonData))
-	case Fatal:
-		fmt.Fprintln(os.Stderr, string(jsonData))
+	if level == Fatal {
+		l.Close()
 		os.Exit(1)
 	}
 }
@@ -128,22 +162,65 @@ func (l LogLevel) String() string {
 	}
 }
 
+// ParseLevel разбирает имя уровня без учета регистра: debug, info, warning (warn), error, fatal
+func ParseLevel(s string) (LogLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return Debug, nil
+	case "info":
+		return Info, nil
+	case "warning", "warn":
+		return Warning, nil
+	case "error":
+		return Error, nil
+	case "fatal":
+		return Fatal, nil
+	default:
+		return Info, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
 func (l *Logger) Debug(format string, args ...interface{}) {
-	l.log(Debug, format, args...)
+	l.log(Debug, fmt.Sprintf(format, args...), nil)
 }
 
 func (l *Logger) Info(format string, args ...interface{}) {
-	l.log(Info, format, args...)
+	l.log(Info, fmt.Sprintf(format, args...), nil)
 }
 
 func (l *Logger) Warning(format string, args ...interface{}) {
-	l.log(Warning, format, args...)
+	l.log(Warning, fmt.Sprintf(format, args...), nil)
 }
 
 func (l *Logger) Error(format string, args ...interface{}) {
-	l.log(Error, format, args...)
+	l.log(Error, fmt.Sprintf(format, args...), nil)
 }
 
 func (l *Logger) Fatal(format string, args ...interface{}) {
-	l.log(Fatal, format, args...)
+	l.log(Fatal, fmt.Sprintf(format, args...), nil)
+}
+
+// Debugw пишет сообщение msg с полями keysAndValues на уровне Debug
+func (l *Logger) Debugw(msg string, keysAndValues ...any) {
+	l.log(Debug, msg, keysAndValues)
+}
+
+// Infow пишет сообщение msg с полями keysAndValues на уровне Info
+func (l *Logger) Infow(msg string, keysAndValues ...any) {
+	l.log(Info, msg, keysAndValues)
+}
+
+// Warningw пишет сообщение msg с полями keysAndValues на уровне Warning
+func (l *Logger) Warningw(msg string, keysAndValues ...any) {
+	l.log(Warning, msg, keysAndValues)
+}
+
+// Errorw пишет сообщение msg с полями keysAndValues на уровне Error
+func (l *Logger) Errorw(msg string, keysAndValues ...any) {
+	l.log(Error, msg, keysAndValues)
+}
+
+// Fatalw пишет сообщение msg с полями keysAndValues и завершает процесс
+func (l *Logger) Fatalw(msg string, keysAndValues ...any) {
+	l.log(Fatal, msg, keysAndValues)
 }
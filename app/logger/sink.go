@@ -0,0 +1,301 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink - приемник записей журнала. Write получает одну готовую строку с переводом строки.
+// Вызовы Write одного логгера сериализуются, но приемник может быть общим для нескольких логгеров.
+type Sink interface {
+	Write(level LogLevel, line []byte) error
+	Close() error
+}
+
+// consoleSink пишет Debug и Info в stdout, остальные уровни - в stderr
+type consoleSink struct{}
+
+// NewConsoleSink возвращает приемник стандартных потоков вывода
+func NewConsoleSink() Sink {
+	return consoleSink{}
+}
+
+func (consoleSink) Write(level LogLevel, line []byte) error {
+	out := os.Stdout
+	if level >= Warning {
+		out = os.Stderr
+	}
+
+	_, err := out.Write(line)
+	return err
+}
+
+func (consoleSink) Close() error {
+	return nil
+}
+
+// writerSink пишет все записи в произвольный io.Writer
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink возвращает приемник поверх w. Если w реализует io.Closer, Close закрывает его.
+func NewWriterSink(w io.Writer) Sink {
+	return &writerSink{w: w}
+}
+
+func (s *writerSink) Write(_ LogLevel, line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.w.Write(line)
+	return err
+}
+
+func (s *writerSink) Close() error {
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// RotateOptions - параметры ротации файла журнала
+// Path - путь к текущему файлу
+// MaxSize - размер в байтах, после которого файл ротируется (0 - без ограничения)
+// Every - как часто ротировать файл независимо от размера (0 - не ротировать по времени)
+// MaxBackups - сколько ротированных файлов хранить (0 - без ограничения)
+// MaxAge - сколько хранить ротированные файлы (0 - без ограничения)
+type RotateOptions struct {
+	Path       string
+	MaxSize    int64
+	Every      time.Duration
+	MaxBackups int
+	MaxAge     time.Duration
+}
+
+// backupTimeLayout - метка времени в имени ротированного файла; сортируется как строка
+const backupTimeLayout = "20060102T150405.000"
+
+// RotatingFile пишет записи в файл и переименовывает его в path-<время>.ext
+// по достижении размера или интервала, удаляя старые копии сверх лимитов.
+// Если ротация не удалась, запись продолжается в прежний файл; если файл не открылся,
+// каждая следующая запись пробует открыть его снова.
+type RotatingFile struct {
+	opts RotateOptions
+
+	// rename - os.Rename; подменяется в тестах
+	rename func(oldpath, newpath string) error
+
+	mu       sync.Mutex
+	file     *os.File
+	closed   bool
+	size     int64
+	openedAt time.Time
+}
+
+// NewRotatingFile открывает (или создает) файл журнала и применяет политику хранения к старым копиям
+func NewRotatingFile(opts RotateOptions) (*RotatingFile, error) {
+	if opts.Path == "" {
+		return nil, fmt.Errorf("log file path is empty")
+	}
+
+	if dir := filepath.Dir(opts.Path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("create log directory: %w", err)
+		}
+	}
+
+	r := &RotatingFile{opts: opts, rename: os.Rename}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	if err := r.prune(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *RotatingFile) Write(_ LogLevel, line []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return os.ErrClosed
+	}
+
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return err
+		}
+	}
+
+	var rotateErr error
+	if r.shouldRotate(int64(len(line))) {
+		rotateErr = r.rotate()
+		if r.file == nil {
+			return rotateErr
+		}
+	}
+
+	n, err := r.file.Write(line)
+	r.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	return rotateErr
+}
+
+// Close закрывает текущий файл; последующие записи возвращают ошибку
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		r.closed = true
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file = nil
+	r.closed = true
+	return err
+}
+
+func (r *RotatingFile) shouldRotate(next int64) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.opts.MaxSize > 0 && r.size+next > r.opts.MaxSize {
+		return true
+	}
+	if r.opts.Every > 0 && time.Since(r.openedAt) >= r.opts.Every {
+		return true
+	}
+	return false
+}
+
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.opts.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("stat log file: %w", err)
+	}
+
+	r.file = file
+	r.size = info.Size()
+	r.openedAt = time.Now()
+
+	return nil
+}
+
+// rotate переименовывает текущий файл, открывает новый и удаляет лишние копии.
+// Если переименовать файл не удалось, он открывается снова, чтобы журнал не остановился:
+// ротация по размеру повторится со следующей записью, по времени - через Every.
+func (r *RotatingFile) rotate() error {
+	closeErr := r.file.Close()
+	r.file = nil
+	if closeErr != nil {
+		return errors.Join(fmt.Errorf("close log file: %w", closeErr), r.open())
+	}
+
+	backup := r.backupPath(time.Now())
+	if err := r.rename(r.opts.Path, backup); err != nil {
+		return errors.Join(fmt.Errorf("rotate log file: %w", err), r.open())
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	return r.prune()
+}
+
+// backupPath возвращает свободное имя ротированного файла: если за одну миллисекунду
+// файл ротируется несколько раз, метка времени сдвигается, чтобы не перезаписать прежнюю копию
+func (r *RotatingFile) backupPath(now time.Time) string {
+	prefix, ext := r.backupName()
+	for {
+		backup := prefix + now.Format(backupTimeLayout) + ext
+		if _, err := os.Lstat(backup); err != nil {
+			return backup
+		}
+		now = now.Add(time.Millisecond)
+	}
+}
+
+// backupName возвращает префикс и расширение имен ротированных файлов: log.txt -> log-, .txt
+func (r *RotatingFile) backupName() (string, string) {
+	ext := filepath.Ext(r.opts.Path)
+	return strings.TrimSuffix(r.opts.Path, ext) + "-", ext
+}
+
+// prune удаляет ротированные файлы сверх MaxBackups и старше MaxAge
+func (r *RotatingFile) prune() error {
+	if r.opts.MaxBackups <= 0 && r.opts.MaxAge <= 0 {
+		return nil
+	}
+
+	prefix, ext := r.backupName()
+	matches, err := filepath.Glob(globEscape(prefix) + "*" + globEscape(ext))
+	if err != nil {
+		return fmt.Errorf("list log backups: %w", err)
+	}
+
+	var backups []string
+	for _, m := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(m, prefix), ext)
+		if _, err := time.Parse(backupTimeLayout, stamp); err == nil {
+			backups = append(backups, m)
+		}
+	}
+
+	// Новые копии в начале
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	cutoff := time.Now().Add(-r.opts.MaxAge)
+	for i, b := range backups {
+		expired := r.opts.MaxBackups > 0 && i >= r.opts.MaxBackups
+		if !expired && r.opts.MaxAge > 0 {
+			if info, err := os.Stat(b); err == nil && info.ModTime().Before(cutoff) {
+				expired = true
+			}
+		}
+
+		if expired {
+			if err := os.Remove(b); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("remove log backup: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// globEscape экранирует метасимволы filepath.Match в части пути
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
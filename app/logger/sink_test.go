@@ -0,0 +1,158 @@
+package logger
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// readLog возвращает содержимое файла журнала path
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+
+	return string(data)
+}
+
+// backups возвращает ротированные копии журнала r, старые в начале
+func backups(t *testing.T, r *RotatingFile) []string {
+	t.Helper()
+
+	prefix, ext := r.backupName()
+	matches, err := filepath.Glob(globEscape(prefix) + "*" + globEscape(ext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(matches)
+
+	return matches
+}
+
+func TestRotatingFile(t *testing.T) {
+	const line = "0123456789\n"
+
+	tests := []struct {
+		name       string
+		maxBackups int
+		writes     int
+		backups    int
+	}{
+		{"fits max size", 0, 2, 0},
+		{"rotates by size", 0, 3, 1},
+		{"rotates every time max size is reached", 0, 7, 3},
+		{"keeps max backups", 2, 7, 2},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "log.txt")
+
+		r, err := NewRotatingFile(RotateOptions{Path: path, MaxSize: 2 * int64(len(line)), MaxBackups: tt.maxBackups})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := range tt.writes {
+			if err := r.Write(Info, []byte(line)); err != nil {
+				t.Fatalf("%s: write %d: %v", tt.name, i, err)
+			}
+		}
+		r.Close()
+
+		if got := len(backups(t, r)); got != tt.backups {
+			t.Errorf("%s: expected %d backups, got %d", tt.name, tt.backups, got)
+		}
+
+		// В текущем файле остаются записи после последней ротации
+		want := 2
+		if tt.writes%2 == 1 {
+			want = 1
+		}
+		if got := strings.Count(readLog(t, path), line); got != want {
+			t.Errorf("%s: expected %d lines in the current file, got %d", tt.name, want, got)
+		}
+	}
+}
+
+func TestRotatingFileRenameFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.txt")
+
+	r, err := NewRotatingFile(RotateOptions{Path: path, MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	renameErr := errors.New("rename failed")
+	r.rename = func(string, string) error { return renameErr }
+
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		err := r.Write(Info, []byte(line))
+		if line != "first\n" && !errors.Is(err, renameErr) {
+			t.Errorf("%q: expected the rotation error, got %v", line, err)
+		}
+	}
+
+	// Ротация не удалась, но записи продолжают попадать в прежний файл
+	if got := readLog(t, path); got != "first\nsecond\nthird\n" {
+		t.Errorf("expected all lines in the log file, got %q", got)
+	}
+
+	r.rename = os.Rename
+	if err := r.Write(Info, []byte("fourth\n")); err != nil {
+		t.Fatalf("expected the rotation to succeed once rename works, got %v", err)
+	}
+	if got := readLog(t, path); got != "fourth\n" {
+		t.Errorf("expected a new log file, got %q", got)
+	}
+	if got := backups(t, r); len(got) != 1 || readLog(t, got[0]) != "first\nsecond\nthird\n" {
+		t.Errorf("expected one backup with the old lines, got %v", got)
+	}
+}
+
+func TestRotatingFileReopensAfterOpenFails(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	path := filepath.Join(dir, "log.txt")
+
+	r, err := NewRotatingFile(RotateOptions{Path: path, MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// Каталог журнала пропадает во время ротации: новый файл не открыть
+	r.rename = func(string, string) error {
+		return os.RemoveAll(dir)
+	}
+
+	if err := r.Write(Info, []byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Write(Info, []byte("lost\n")); err == nil {
+		t.Fatal("expected an error when the log file cannot be opened")
+	}
+	if err := r.Write(Info, []byte("lost again\n")); err == nil {
+		t.Fatal("expected an error while the log directory is missing")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Write(Info, []byte("restored\n")); err != nil {
+		t.Fatalf("expected logging to resume, got %v", err)
+	}
+	if got := readLog(t, path); got != "restored\n" {
+		t.Errorf("expected the new log file to get the line, got %q", got)
+	}
+
+	r.Close()
+	if err := r.Write(Info, []byte("closed\n")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected os.ErrClosed after Close, got %v", err)
+	}
+}
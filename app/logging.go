@@ -0,0 +1,42 @@
+package main
+
+import (
+	"main/config"
+	"main/logger"
+)
+
+// setupLogger применяет настройки журнала: уровень, формат, вывод в stdout/stderr
+// и, если задан файл, ротируемый файл. debug понижает уровень до Debug.
+func setupLogger(cfg config.Log, debug bool) error {
+	level, err := logger.ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	if debug {
+		level = logger.Debug
+	}
+
+	format, err := logger.ParseFormat(cfg.Format)
+	if err != nil {
+		return err
+	}
+
+	sinks := []logger.Sink{logger.NewConsoleSink()}
+	if cfg.File != "" {
+		file, err := logger.NewRotatingFile(logger.RotateOptions{
+			Path:       cfg.File,
+			MaxSize:    int64(cfg.MaxSizeMB) << 20,
+			Every:      cfg.RotateEvery,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     cfg.MaxAge,
+		})
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, file)
+	}
+
+	logger.GetLogger().Configure(level, format, sinks...)
+
+	return nil
+}
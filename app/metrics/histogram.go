@@ -0,0 +1,34 @@
+package metrics
+
+import "sort"
+
+// DefaultBuckets - верхние границы корзин гистограмм времени обработки, в секундах
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Histogram - гистограмма в духе Prometheus: Counts[i] - число наблюдений не больше Buckets[i]
+// (накопительно), Count и Sum - число и сумма всех наблюдений.
+// Не потокобезопасна, защищается мьютексом Metrics.
+type Histogram struct {
+	Buckets []float64
+	Counts  []int64
+	Count   int64
+	Sum     float64
+}
+
+// NewHistogram создает гистограмму с границами buckets (по возрастанию)
+func NewHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		Buckets: buckets,
+		Counts:  make([]int64, len(buckets)),
+	}
+}
+
+// Observe добавляет наблюдение value
+func (h *Histogram) Observe(value float64) {
+	h.Count++
+	h.Sum += value
+
+	for i := sort.SearchFloat64s(h.Buckets, value); i < len(h.Buckets); i++ {
+		h.Counts[i]++
+	}
+}
@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"runtime"
 	"sync"
 	"time"
 )
@@ -20,6 +21,39 @@ type Metrics struct {
 
 	// Метрики ошибок
 	ErrorsByType map[string]int64
+
+	// Распределение времени обработки обновлений
+	ProcessingHistogram *Histogram
+
+	// Метрики хендлеров по имени (HandleResult.Name)
+	Handlers map[string]*HandlerStats
+
+	// Метрики очередей обновлений (dispatch)
+	QueuedUpdates  int   // обновления, ожидающие обработки
+	QueueKeys      int   // пользователи с обрабатываемыми или ожидающими обновлениями
+	MaxQueueDepth  int   // наибольшая глубина очереди одного пользователя
+	DroppedUpdates int64 // обновления, отброшенные из-за переполненной очереди
+
+	// Метрики исходящих запросов к Telegram (telegram.Sender)
+	OutboundSent    int64
+	OutboundFailed  int64
+	OutboundRetries map[string]int64 // повторы по причине: rate_limited, server_error, network
+	OutboundWait    *Histogram       // ожидание из-за лимитов и повторов
+
+	// Бизнес-метрики
+	OrdersSubmitted  int64
+	PaymentsAccepted int64
+	PaymentsRejected int64
+	CartAdds         int64
+}
+
+// HandlerStats - вызовы одного хендлера
+// Calls - успешные вызовы, Failures - вызовы, завершившиеся ошибкой
+// Duration - распределение времени обработки
+type HandlerStats struct {
+	Calls    int64
+	Failures int64
+	Duration *Histogram
 }
 
 var (
@@ -30,7 +64,11 @@ var (
 func GetMetrics() *Metrics {
 	once.Do(func() {
 		instance = &Metrics{
-			ErrorsByType: make(map[string]int64),
+			ErrorsByType:        make(map[string]int64),
+			ProcessingHistogram: NewHistogram(DefaultBuckets),
+			Handlers:            make(map[string]*HandlerStats),
+			OutboundRetries:     make(map[string]int64),
+			OutboundWait:        NewHistogram(DefaultBuckets),
 		}
 	})
 	return instance
@@ -48,12 +86,112 @@ func (m *Metrics) RecordMessageProcessing(duration time.Duration, success bool)
 	if duration > m.MaxProcessingTime {
 		m.MaxProcessingTime = duration
 	}
+	m.ProcessingHistogram.Observe(duration.Seconds())
+}
+
+// RecordHandler учитывает вызов хендлера name длительностью duration; success - хендлер не вернул ошибку
+func (m *Metrics) RecordHandler(name string, duration time.Duration, success bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats, ok := m.Handlers[name]
+	if !ok {
+		stats = &HandlerStats{Duration: NewHistogram(DefaultBuckets)}
+		m.Handlers[name] = stats
+	}
+
+	if success {
+		stats.Calls++
+	} else {
+		stats.Failures++
+	}
+	stats.Duration.Observe(duration.Seconds())
+}
+
+// RecordQueue учитывает состояние очередей обновлений: queued - всего ожидающих,
+// keys - пользователей с очередями, depth - глубина только что измененной очереди
+func (m *Metrics) RecordQueue(queued, keys, depth int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.QueuedUpdates = queued
+	m.QueueKeys = keys
+	if depth > m.MaxQueueDepth {
+		m.MaxQueueDepth = depth
+	}
+}
+
+// RecordDroppedUpdate учитывает обновление, отброшенное из-за переполненной очереди пользователя
+func (m *Metrics) RecordDroppedUpdate() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.DroppedUpdates++
+}
+
+// RecordOutbound учитывает исходящий запрос к Telegram; waited - сколько он ждал лимитов и повторов
+func (m *Metrics) RecordOutbound(success bool, waited time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if success {
+		m.OutboundSent++
+	} else {
+		m.OutboundFailed++
+	}
+	m.OutboundWait.Observe(waited.Seconds())
+}
+
+// RecordOutboundRetry учитывает повтор исходящего запроса по причине reason
+func (m *Metrics) RecordOutboundRetry(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.OutboundRetries[reason]++
+}
+
+// RecordOrderSubmitted учитывает заказ, отправленный администратору на проверку оплаты
+func (m *Metrics) RecordOrderSubmitted() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.OrdersSubmitted++
+}
+
+// RecordPayment учитывает решение администратора по оплате
+func (m *Metrics) RecordPayment(accepted bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if accepted {
+		m.PaymentsAccepted++
+	} else {
+		m.PaymentsRejected++
+	}
+}
+
+// RecordCartAdd учитывает добавление единицы товара в корзину
+func (m *Metrics) RecordCartAdd() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.CartAdds++
 }
 
 func (m *Metrics) RecordGoroutineCount(count int) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	m.recordGoroutinesLocked(count)
+}
+
+// sampleGoroutinesLocked записывает текущее число горутин, чтобы метрики простаивающего бота
+// не отставали от реальности. Вызывается под m.mu.
+func (m *Metrics) sampleGoroutinesLocked() {
+	m.recordGoroutinesLocked(runtime.NumGoroutine())
+}
+
+func (m *Metrics) recordGoroutinesLocked(count int) {
 	m.ActiveGoroutines = count
 	if count > m.MaxGoroutines {
 		m.MaxGoroutines = count
@@ -71,6 +209,8 @@ func (m *Metrics) GetStats() map[string]interface{} {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	m.sampleGoroutinesLocked()
+
 	return map[string]interface{}{
 		"total_messages":      m.TotalMessages,
 		"failed_messages":     m.FailedMessages,
@@ -79,5 +219,15 @@ func (m *Metrics) GetStats() map[string]interface{} {
 		"active_goroutines":   m.ActiveGoroutines,
 		"max_goroutines":      m.MaxGoroutines,
 		"errors_by_type":      m.ErrorsByType,
+		"queued_updates":      m.QueuedUpdates,
+		"max_queue_depth":     m.MaxQueueDepth,
+		"dropped_updates":     m.DroppedUpdates,
+		"outbound_sent":       m.OutboundSent,
+		"outbound_failed":     m.OutboundFailed,
+		"outbound_retries":    m.OutboundRetries,
+		"orders_submitted":    m.OrdersSubmitted,
+		"payments_accepted":   m.PaymentsAccepted,
+		"payments_rejected":   m.PaymentsRejected,
+		"cart_adds":           m.CartAdds,
 	}
 }
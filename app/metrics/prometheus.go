@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// namespace - префикс имен всех экспортируемых метрик
+const namespace = "flylex_"
+
+// Handler возвращает HTTP-обработчик, отдающий метрики в текстовом формате Prometheus
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := m.WritePrometheus(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// WritePrometheus пишет текущие значения метрик в текстовом формате Prometheus
+func (m *Metrics) WritePrometheus(out io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sampleGoroutinesLocked()
+
+	w := &promWriter{w: bufio.NewWriter(out)}
+
+	w.header("updates_total", "counter", "Processed Telegram updates by outcome.")
+	w.sample("updates_total", labels("status", "ok"), float64(m.TotalMessages-m.FailedMessages))
+	w.sample("updates_total", labels("status", "failed"), float64(m.FailedMessages))
+
+	w.header("update_duration_seconds", "histogram", "Time spent processing one update, including next steps.")
+	w.histogram("update_duration_seconds", nil, m.ProcessingHistogram)
+
+	names := make([]string, 0, len(m.Handlers))
+	for name := range m.Handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.header("handler_calls_total", "counter", "Handler invocations by handler name and outcome.")
+	for _, name := range names {
+		w.sample("handler_calls_total", labels("handler", name, "status", "ok"), float64(m.Handlers[name].Calls))
+		w.sample("handler_calls_total", labels("handler", name, "status", "error"), float64(m.Handlers[name].Failures))
+	}
+
+	w.header("handler_duration_seconds", "histogram", "Handler latency by handler name.")
+	for _, name := range names {
+		w.histogram("handler_duration_seconds", []string{"handler", name}, m.Handlers[name].Duration)
+	}
+
+	errorTypes := make([]string, 0, len(m.ErrorsByType))
+	for t := range m.ErrorsByType {
+		errorTypes = append(errorTypes, t)
+	}
+	sort.Strings(errorTypes)
+
+	w.header("errors_total", "counter", "Errors by type.")
+	for _, t := range errorTypes {
+		w.sample("errors_total", labels("type", t), float64(m.ErrorsByType[t]))
+	}
+
+	w.header("goroutines", "gauge", "Goroutines running when the metrics were collected.")
+	w.sample("goroutines", "", float64(m.ActiveGoroutines))
+	w.header("goroutines_max", "gauge", "Maximum number of goroutines observed.")
+	w.sample("goroutines_max", "", float64(m.MaxGoroutines))
+
+	w.header("queued_updates", "gauge", "Updates waiting in per-user queues.")
+	w.sample("queued_updates", "", float64(m.QueuedUpdates))
+	w.header("queue_keys", "gauge", "Users with updates being processed or waiting.")
+	w.sample("queue_keys", "", float64(m.QueueKeys))
+	w.header("queue_depth_max", "gauge", "Deepest per-user queue observed.")
+	w.sample("queue_depth_max", "", float64(m.MaxQueueDepth))
+	w.header("dropped_updates_total", "counter", "Updates dropped because the user's queue was full.")
+	w.sample("dropped_updates_total", "", float64(m.DroppedUpdates))
+
+	w.header("outbound_requests_total", "counter", "Requests to the Telegram API by outcome (after retries).")
+	w.sample("outbound_requests_total", labels("status", "ok"), float64(m.OutboundSent))
+	w.sample("outbound_requests_total", labels("status", "failed"), float64(m.OutboundFailed))
+
+	reasons := make([]string, 0, len(m.OutboundRetries))
+	for r := range m.OutboundRetries {
+		reasons = append(reasons, r)
+	}
+	sort.Strings(reasons)
+
+	w.header("outbound_retries_total", "counter", "Retried Telegram API requests by reason.")
+	for _, r := range reasons {
+		w.sample("outbound_retries_total", labels("reason", r), float64(m.OutboundRetries[r]))
+	}
+
+	w.header("outbound_wait_seconds", "histogram", "Time Telegram API requests spent waiting for rate limits and retries.")
+	w.histogram("outbound_wait_seconds", nil, m.OutboundWait)
+
+	w.header("orders_submitted_total", "counter", "Orders sent to the administrator for payment review.")
+	w.sample("orders_submitted_total", "", float64(m.OrdersSubmitted))
+
+	w.header("payments_total", "counter", "Payment verdicts by the administrator.")
+	w.sample("payments_total", labels("verdict", "accepted"), float64(m.PaymentsAccepted))
+	w.sample("payments_total", labels("verdict", "rejected"), float64(m.PaymentsRejected))
+
+	w.header("cart_adds_total", "counter", "Product units added to carts.")
+	w.sample("cart_adds_total", "", float64(m.CartAdds))
+
+	if w.err != nil {
+		return w.err
+	}
+
+	return w.w.Flush()
+}
+
+// promWriter пишет строки текстового формата, запоминая первую ошибку записи
+type promWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (p *promWriter) printf(format string, args ...any) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
+
+func (p *promWriter) header(name, kind, help string) {
+	p.printf("# HELP %s%s %s\n", namespace, name, help)
+	p.printf("# TYPE %s%s %s\n", namespace, name, kind)
+}
+
+func (p *promWriter) sample(name, labels string, value float64) {
+	p.printf("%s%s%s %s\n", namespace, name, labels, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// histogram пишет корзины, сумму и количество гистограммы h с дополнительными метками kv
+func (p *promWriter) histogram(name string, kv []string, h *Histogram) {
+	for i, bound := range h.Buckets {
+		p.sample(name+"_bucket", labels(append(kv, "le", strconv.FormatFloat(bound, 'g', -1, 64))...), float64(h.Counts[i]))
+	}
+	p.sample(name+"_bucket", labels(append(kv, "le", "+Inf")...), float64(h.Count))
+	p.sample(name+"_sum", labels(kv...), h.Sum)
+	p.sample(name+"_count", labels(kv...), float64(h.Count))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels форматирует пары имя-значение kv как {k1="v1",k2="v2"}
+func labels(kv ...string) string {
+	if len(kv) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(kv[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(kv[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrapeGauge запрашивает /metrics и возвращает значение метрики без меток
+func scrapeGauge(t *testing.T, m *Metrics, name string) float64 {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		value, ok := strings.CutPrefix(line, namespace+name+" ")
+		if !ok {
+			continue
+		}
+
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("parse %s: %v", name, err)
+		}
+		return f
+	}
+
+	t.Fatalf("metric %s not found in:\n%s", name, rec.Body.String())
+	return 0
+}
+
+func TestGoroutinesGaugeReadAtScrape(t *testing.T) {
+	m := GetMetrics()
+	m.RecordGoroutineCount(1)
+
+	// Горутины, запущенные без обработки обновлений, тоже должны попасть в метрику
+	const extra = 20
+	stop := make(chan struct{})
+	defer close(stop)
+	for range extra {
+		go func() { <-stop }()
+	}
+
+	if got := scrapeGauge(t, m, "goroutines"); got < extra {
+		t.Errorf("expected at least %d goroutines at scrape time, got %v (runtime reports %d)", extra, got, runtime.NumGoroutine())
+	}
+	if got := scrapeGauge(t, m, "goroutines_max"); got < extra {
+		t.Errorf("expected goroutines_max to follow the scraped value, got %v", got)
+	}
+}
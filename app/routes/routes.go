@@ -0,0 +1,73 @@
+package routes
+
+import (
+	"main/actions"
+	"main/callback"
+	"main/config"
+	"main/filters"
+	"main/handlers"
+	"main/metrics"
+	"main/telegram"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// New собирает маршруты бота: хендлеры, их фильтры и middleware.
+// bot, db и cfg передаются всем хендлерам; run.go и сценарные тесты используют одни и те же маршруты.
+func New(bot telegram.BotClient, db *pg.DB, cfg *config.Config) *handlers.Router {
+	registered := handlers.RequireRegistered(db, bot)
+	admin := handlers.RequireAdmin(db, bot)
+	owner := handlers.RequireOwner(db, bot)
+	adminChat := handlers.RequireChat(cfg.Telegram.AdminChatID, bot)
+
+	router := handlers.NewRouter(actions.NewUnhandledHandler(bot),
+		handlers.CommandHandler.Product(actions.NewSayHiHandler(bot, db), []handlers.Filter{filters.StartFilter(db)}).OnPrefix("start"),
+		handlers.CallbackQueryHandler.Product(actions.NewRegisterUserHandler(bot), nil).OnData(callback.RegisterUser{}.Route()),
+		handlers.CallbackQueryHandler.Product(actions.NewGetPVZHandler(bot, db), nil).OnPrefix(callback.SelectDeliveryService{}.Route()),
+
+		handlers.CommandHandler.Product(actions.NewMainMenuHandler(bot, db), []handlers.Filter{filters.ToMainMenuFilter(db)}).OnPrefix("start"),
+		handlers.CallbackQueryHandler.Product(actions.NewMainMenuHandler(bot, db), nil).OnPrefix(callback.MainMenu{}.Route()).Use(registered),
+
+		handlers.CallbackQueryHandler.Product(actions.NewAboutHandler(bot), nil).OnData(callback.About{}.Route()),
+
+		handlers.CallbackQueryHandler.Product(actions.ProfileSettings{Name: "profile-settings", Client: bot}, nil).OnPrefix(callback.ProfileSettings{}.Route()).Use(registered),
+		handlers.CallbackQueryHandler.Product(actions.ChangeName{Name: "change-name", Client: bot, DB: db}, nil).OnPrefix(callback.ChangeName{}.Route()).Use(registered),
+		handlers.CallbackQueryHandler.Product(actions.ChangePhone{Name: "change-phone", Client: bot, DB: db}, nil).OnPrefix(callback.ChangePhone{}.Route()).Use(registered),
+		handlers.CallbackQueryHandler.Product(actions.ChangeDeliveryAddress{Name: "change-delivery-address", Client: bot, DB: db}, nil).OnPrefix(callback.ChangeDeliveryAddress{}.Route()).Use(registered),
+		handlers.CallbackQueryHandler.Product(actions.ChangeDeliveryService{Name: "change-delivery-service", Client: bot, DB: db}, nil).OnPrefix(callback.ChangeDeliveryService{}.Route()).Use(registered),
+
+		handlers.CallbackQueryHandler.Product(actions.NewShopHandler(bot, db), nil).OnPrefix(callback.Shop{}.Route()).Use(registered),
+		handlers.CallbackQueryHandler.Product(actions.NewViewCatalogHandler(bot, db), nil).OnPrefix(callback.ToCat{}.Route()).Use(registered),
+		handlers.CallbackQueryHandler.Product(actions.NewViewCartHandler(bot, db), nil).OnPrefix(callback.ViewCart{}.Route()).Use(registered),
+
+		handlers.CallbackQueryHandler.Product(actions.NewMakeOrderHandler(bot, db), nil).OnData(callback.MakeOrder{}.Route()).Use(registered),
+		handlers.CallbackQueryHandler.Product(actions.NewProcessOrderHandler(bot, db, cfg), nil).OnData(callback.ProcessOrder{}.Route()).Use(registered),
+		handlers.CallbackQueryHandler.Product(actions.NewMyOrdersHandler(bot, db), nil).OnPrefix(callback.MyOrders{}.Route()).Use(registered),
+		handlers.CallbackQueryHandler.Product(actions.NewOrderDetailsHandler(bot, db, cfg), nil).OnPrefix(callback.OrderDetails{}.Route()).Use(registered),
+		handlers.CallbackQueryHandler.Product(actions.NewPaymentVerdictHandler(bot, db), nil).OnPrefix(callback.PaymentVerdict{}.Route()).Use(adminChat, admin),
+
+		handlers.CallbackQueryHandler.Product(actions.NewAddCatalogHandler(bot), nil).OnData(callback.AddCatalog{}.Route()).Use(admin),
+		handlers.CallbackQueryHandler.Product(actions.NewEditShopHandler(bot, db, cfg), nil).OnPrefix(callback.EditShop{}.Route()).Use(admin),
+
+		handlers.CallbackQueryHandler.Product(actions.NewChangeCatalogNameHandler(bot, db), nil).OnPrefix(callback.ChangeCatalogName{}.Route()).Use(admin),
+
+		handlers.CommandHandler.Product(actions.NewAdminOrdersHandler(bot, db), nil).OnPrefix("orders").Use(admin),
+		handlers.CallbackQueryHandler.Product(actions.NewAdminOrdersHandler(bot, db), nil).OnPrefix(callback.AdminOrders{}.Route()).Use(admin),
+		handlers.CallbackQueryHandler.Product(actions.NewAdminCustomerFilterHandler(bot), nil).OnPrefix(callback.AdminCustomerFilter{}.Route()).Use(admin),
+		handlers.CallbackQueryHandler.Product(actions.NewAdminOrderCardHandler(bot, db), nil).OnPrefix(callback.AdminOrderCard{}.Route()).Use(admin),
+		handlers.CallbackQueryHandler.Product(actions.NewAdminOrderActionHandler(bot, db, cfg), nil).OnPrefix(callback.AdminOrderAction{}.Route()).Use(admin),
+		handlers.CallbackQueryHandler.Product(actions.NewAdminOrderShipHandler(bot, db), nil).OnPrefix(callback.AdminOrderShip{}.Route()).Use(admin),
+
+		handlers.CommandHandler.Product(actions.NewAdminsHandler(bot, db), nil).OnPrefix("admins").Use(owner),
+		handlers.CallbackQueryHandler.Product(actions.NewAdminsHandler(bot, db), nil).OnData(callback.Admins{}.Route()).Use(owner),
+		handlers.CommandHandler.Product(actions.NewGrantAdminHandler(bot, db), nil).OnPrefix("grant_admin").Use(owner),
+		handlers.CommandHandler.Product(actions.NewRevokeAdminHandler(bot, db), nil).OnPrefix("revoke_admin").Use(owner),
+		handlers.CallbackQueryHandler.Product(actions.NewRevokeAdminHandler(bot, db), nil).OnPrefix(callback.RevokeAdmin{}.Route()).Use(owner),
+		handlers.CommandHandler.Product(actions.NewAdminLogHandler(bot, db), nil).OnPrefix("admin_log").Use(owner),
+
+		handlers.CallbackQueryHandler.Product(actions.NewCancelHandler(bot), nil).OnData(callback.Cancel{}.Route()),
+	)
+	router.Use(handlers.Log(), handlers.Metrics(metrics.GetMetrics()), handlers.Recover(), handlers.StaleButtons(bot))
+
+	return router
+}
@@ -3,87 +3,45 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"main/actions"
+	"fmt"
+	"main/callback"
+	"main/config"
 	"main/controllers"
 	"main/database"
-	"main/filters"
+	"main/database/models"
+	"main/dispatch"
 	"main/handlers"
+	"main/health"
 	"main/logger"
 	"main/metrics"
+	"main/routes"
+	"main/telegram"
+	"main/updates"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
-	"sync"
 	"syscall"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/joho/godotenv"
 )
 
-const (
-	maxWorkers      = 50
-	shutdownTimeout = 5 * time.Second
-	metricsInterval = 12 * time.Hour
-)
-
-var (
-	debug = false
-)
-
-
-func connect() *tgbotapi.BotAPI {
-	_ = godotenv.Load() // Для dev-режима подхватит .env, в проде проигнорирует
+// telegramCheckInterval - период проверки доступности Telegram API (getMe) для /readyz
+const telegramCheckInterval = time.Minute
 
-	debug = os.Getenv("DEBUG") == "true"
-
-	bot, err := tgbotapi.NewBotAPI(os.Getenv("API_KEY"))
-	bot.Debug = debug
+func connect(cfg *config.Config) *tgbotapi.BotAPI {
+	bot, err := tgbotapi.NewBotAPI(cfg.Telegram.APIKey)
 	if err != nil {
 		panic(err)
 	}
+	bot.Debug = cfg.Debug
 
 	logger.GetLogger().Info("Successfully authorized on account @%s", bot.Self.UserName)
 
 	return bot
 }
 
-func getBotActions(bot tgbotapi.BotAPI) handlers.ActiveHandlers {
-	act := handlers.ActiveHandlers{Handlers: []handlers.Handler{
-		handlers.CommandHandler.Product(actions.NewSayHiHandler(bot), []handlers.Filter{filters.StartFilter}),
-		handlers.CallbackQueryHandler.Product(actions.NewRegisterUserHandler(bot), []handlers.Filter{filters.RegisterUserFilter}),
-		handlers.CallbackQueryHandler.Product(actions.NewGetPVZHandler(bot), []handlers.Filter{filters.SelectDeliveryServiceFilter}),
-		
-		handlers.CommandHandler.Product(actions.NewMainMenuHandler(bot), []handlers.Filter{filters.ToMainMenuFilter}),
-		handlers.CallbackQueryHandler.Product(actions.NewMainMenuHandler(bot), []handlers.Filter{filters.MainMenuFilter}),
-
-		handlers.CallbackQueryHandler.Product(actions.NewAboutHandler(bot), []handlers.Filter{filters.AboutFilter}),
-
-		handlers.CallbackQueryHandler.Product(actions.ProfileSettings{Name: "profile-settings", Client: bot}, []handlers.Filter{filters.ProfileSettingsFilter}),
-		handlers.CallbackQueryHandler.Product(actions.ChangeName{Name: "change-name", Client: bot}, []handlers.Filter{filters.ChangeNameFilter}),
-		handlers.CallbackQueryHandler.Product(actions.ChangePhone{Name: "change-phone", Client: bot}, []handlers.Filter{filters.ChangePhoneFilter}),
-		handlers.CallbackQueryHandler.Product(actions.ChangeDeliveryAddress{Name: "change-delivery-address", Client: bot}, []handlers.Filter{filters.ChangeDeliveryAddressFilter}),
-		handlers.CallbackQueryHandler.Product(actions.ChangeDeliveryService{Name: "change-delivery-service", Client: bot}, []handlers.Filter{filters.ChangeDeliveryServiceFilter}),
-
-		handlers.CallbackQueryHandler.Product(actions.NewShopHandler(bot), []handlers.Filter{filters.ShopFilter}),
-		handlers.CallbackQueryHandler.Product(actions.NewViewCatalogHandler(bot), []handlers.Filter{filters.ViewCatalogFilter}),
-		handlers.CallbackQueryHandler.Product(actions.NewViewCartHandler(bot), []handlers.Filter{filters.ViewCartFilter}),
-
-		handlers.CallbackQueryHandler.Product(actions.NewMakeOrderHandler(bot), []handlers.Filter{filters.MakeOrderFilter}),
-		handlers.CallbackQueryHandler.Product(actions.NewProcessOrderHandler(bot), []handlers.Filter{filters.ProcessOrderFilter}),
-		handlers.CallbackQueryHandler.Product(actions.NewPaymentVerdictHandler(bot), []handlers.Filter{filters.PaymentVerdictFilter}),
-	
-		handlers.CallbackQueryHandler.Product(actions.NewAddCatalogHandler(bot), []handlers.Filter{filters.AddCatalogFilter}),
-		handlers.CallbackQueryHandler.Product(actions.NewEditShopHandler(bot), []handlers.Filter{filters.EditShopFilter}),
-
-		handlers.CallbackQueryHandler.Product(actions.NewChangeCatalogNameHandler(bot), []handlers.Filter{filters.ChangeCatalogNameFilter}),
-
-		handlers.CallbackQueryHandler.Product(actions.NewCancelHandler(bot), []handlers.Filter{filters.CancelFilter}),
-	}}
-
-	return act
-}
-
 func printUpdate(update *tgbotapi.Update) {
 	updateJSON, err := json.MarshalIndent(update, "", "    ")
 	if err != nil {
@@ -95,32 +53,102 @@ func printUpdate(update *tgbotapi.Update) {
 
 func main() {
 	log := logger.GetLogger()
-	if debug {
-		log.SetLevel(logger.Debug)
-	}
 
-	metrics := metrics.GetMetrics()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("Failed to load config: %v", err)
+	}
 
+	if len(os.Args) > 1 && os.Args[1] == "--healthcheck" {
+		if err := runHealthcheck(cfg.Runtime.HTTPAddr); err != nil {
+			fmt.Fprintf(os.Stderr, "unhealthy: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	err := database.InitDb()
-	if err != nil {
-		log.Fatal("Failed to initialize database: %v", err)
+	if err := setupLogger(cfg.Log, cfg.Debug); err != nil {
+		log.Fatal("Failed to set up logging: %v", err)
 	}
+	defer log.Close()
 
-	client := connect()
-	act := getBotActions(*client)
+	m := metrics.GetMetrics()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	db, err := database.Open(ctx, cfg.Database)
+	if err != nil {
+		log.Fatal("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(ctx, db, os.Args[2:]); err != nil {
+			log.Fatal("Migration failed: %v", err)
+		}
+		return
+	}
+
+	go database.RunHealthChecks(ctx, db, cfg.Database.HealthCheckInterval)
+
+	checker := health.New(cfg.Runtime.StallTimeout)
+	checker.AddReadiness("database", func(ctx context.Context) error {
+		return db.Ping(ctx)
+	})
+	checker.AddReadiness("migrations", func(ctx context.Context) error {
+		return database.CheckMigrated(ctx, db)
+	})
+
+	var httpServer *http.Server
+	if cfg.Runtime.HTTPAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", m.Handler())
+		mux.Handle("/healthz", checker.LiveHandler())
+		mux.Handle("/readyz", checker.ReadyHandler())
+		httpServer = startHTTP(cfg.Runtime.HTTPAddr, mux)
+	}
+
+	err = database.Migrate(ctx, db)
+	if err != nil {
+		log.Fatal("Failed to migrate database: %v", err)
+	}
+
+	if cfg.Telegram.OwnerID != 0 {
+		bootstrapped, err := models.BootstrapOwner(db, cfg.Telegram.OwnerID)
+		if err != nil {
+			log.Fatal("Failed to bootstrap owner: %v", err)
+		}
+		if bootstrapped {
+			log.Infow("Bootstrapped bot owner from config", "user_id", cfg.Telegram.OwnerID)
+		}
+	}
+
+	client := connect(cfg)
+	checker.AddReadiness("telegram", health.Periodic(ctx, telegramCheckInterval, 3*telegramCheckInterval, func(context.Context) error {
+		_, err := client.GetMe()
+		return err
+	}))
+	// Все исходящие запросы обработчиков идут через sender с лимитами Telegram
+	sender := telegram.NewSender(ctx, client, telegram.SenderOptions{
+		GlobalPerSecond: cfg.Outbound.GlobalPerSecond,
+		ChatPerMinute:   cfg.Outbound.ChatPerMinute,
+		GroupPerMinute:  cfg.Outbound.GroupPerMinute,
+		ChatBurst:       cfg.Outbound.ChatBurst,
+		MaxRetries:      cfg.Outbound.MaxRetries,
+		MaxWait:         cfg.Outbound.MaxWait,
+	}, m)
+	router := routes.New(sender, db, cfg)
+	stepEnv := controllers.StepEnv{Client: sender, DB: db, Config: cfg}
+
 	go func() {
-		ticker := time.NewTicker(metricsInterval)
+		ticker := time.NewTicker(cfg.Runtime.MetricsInterval)
 		defer ticker.Stop()
 
 		for {
 			select {
 			case <-ticker.C:
-				stats := metrics.GetStats()
+				stats := m.GetStats()
 				log.Info("Metrics: %+v", stats)
 			case <-ctx.Done():
 				return
@@ -128,6 +156,41 @@ func main() {
 		}
 	}()
 
+	callbackStore := callback.PgStore{DB: db, TTL: cfg.Runtime.CallbackPayloadTTL}
+	callback.SetStore(callbackStore)
+
+	stepManager := controllers.NewNextStepManager(controllers.PgStepStore{DB: db})
+	controllers.SetNextStepManager(stepManager)
+	go stepManager.RunSweeper(ctx, sender, controllers.DefaultSweepInterval)
+
+	// Неоплаченные заказы с истекшим резервом отменяются, товар снова доступен покупателям;
+	// заодно удаляются данные давно не отрисованных кнопок
+	go func() {
+		ticker := time.NewTicker(cfg.Stock.SweepInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				cancelled, err := models.ReleaseExpiredReservations(db)
+				if err != nil {
+					log.Error("Failed to release expired reservations: %v", err)
+				} else if cancelled != 0 {
+					log.Infow("Cancelled orders with expired reservations", "orders", cancelled)
+				}
+
+				purged, err := callbackStore.Purge()
+				if err != nil {
+					log.Error("Failed to purge callback payloads: %v", err)
+				} else if purged != 0 {
+					log.Debugw("Purged stale callback payloads", "payloads", purged)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
@@ -137,59 +200,80 @@ func main() {
 		cancel()
 	}()
 
-	updateConfig := tgbotapi.NewUpdate(0)
-	updateConfig.Timeout = 60
+	// Компоненты регистрируются в проверке живости только сейчас: долгое ожидание блокировки миграций
+	// при старте не считается зависанием. В режиме webhook обновления доставляет сам Telegram.
+	var polled func()
+	if cfg.Updates.Mode == config.ModePolling {
+		polled = checker.Heartbeat("polling").Beat
+	}
+	workersHeartbeat := checker.Heartbeat("workers")
+
+	updateCh, err := updates.Listen(ctx, client, cfg.Updates, polled)
+	if err != nil {
+		log.Fatal("Failed to start receiving updates: %v", err)
+	}
+
+	// process обрабатывает одно обновление; вызывается диспетчером по очереди для каждого пользователя
+	process := func(update tgbotapi.Update) {
+		startTime := time.Now()
+		success := false
+
+		defer func() {
+			duration := time.Since(startTime)
+			m.RecordMessageProcessing(duration, success)
+			m.RecordGoroutineCount(runtime.NumGoroutine())
+			workersHeartbeat.Beat()
+		}()
+
+		// Обработчики получают свой таймаут, но не отменяются вместе с ctx при остановке:
+		// им дается SHUTDOWN_TIMEOUT на завершение
+		updateCtx, updateCancel := context.WithTimeout(context.WithoutCancel(ctx), cfg.Runtime.UpdateTimeout)
+		defer updateCancel()
+		updateCtx = handlers.UpdateContext(updateCtx, update)
+
+		defer func() {
+			if r := recover(); r != nil {
+				logger.FromContext(updateCtx).Errorw("Panic in handler", "panic", r)
+				m.RecordError("panic")
+				success = false
+			}
+		}()
+
+		success = true
+
+		afterUpdate := router.Handle(updateCtx, update, sender)
+		for _, hook := range afterUpdate {
+			if hook.Error != nil {
+				logger.FromContext(updateCtx).Errorw("Error handling update", "handler", hook.Name, "route", hook.Route, "error", hook.Error)
+				success = false
+			}
+		}
+
+		if err := controllers.RunStepUpdates(updateCtx, update, stepManager, stepEnv); err != nil {
+			success = false
+		}
+	}
 
-	updates := client.GetUpdatesChan(updateConfig)
+	dispatcher := dispatch.New(process, cfg.Runtime.MaxWorkers, cfg.Runtime.UserQueueSize, m)
 
-	var wg sync.WaitGroup
-	semaphore := make(chan struct{}, maxWorkers)
-	stepManager := controllers.GetNextStepManager()
+	heartbeat := time.NewTicker(cfg.Runtime.StallTimeout / 4)
+	defer heartbeat.Stop()
 
 	for {
 		select {
-		case update := <-updates:
-			if debug {
+		case <-heartbeat.C:
+			// Пока обновлений нет, воркеры простаивают и считаются живыми; с обновлениями в очередях
+			// живость отмечают только сами обработчики
+			if !dispatcher.Busy() {
+				workersHeartbeat.Beat()
+			}
+		case update := <-updateCh:
+			if cfg.Debug {
 				printUpdate(&update)
 			}
 
-			select {
-			case semaphore <- struct{}{}:
-				wg.Add(1)
-				startTime := time.Now()
-
-				go func(update tgbotapi.Update) {
-					defer func() {
-						<-semaphore
-						wg.Done()
-
-						duration := time.Since(startTime)
-						metrics.RecordMessageProcessing(duration, true)
-						metrics.RecordGoroutineCount(runtime.NumGoroutine())
-					}()
-
-					defer func() {
-						if r := recover(); r != nil {
-							log.Error("Panic in handler: %v", r)
-							metrics.RecordError("panic")
-						}
-					}()
-
-					_, updateCancel := context.WithTimeout(ctx, 30*time.Second)
-					defer updateCancel()
-
-					afterUpdate := act.HandleAll(update, *client)
-					for _, afterUpdate := range afterUpdate {
-						if afterUpdate.Error != nil {
-							log.Error("Error handling %s update: %v", afterUpdate.Name, afterUpdate.Error)
-							metrics.RecordError("handler_error")
-						}
-					}
-
-					controllers.RunStepUpdates(update, stepManager, *client)
-				}(update)
-			case <-ctx.Done():
-				goto shutdown
+			if err := dispatcher.Submit(update); err != nil {
+				log.Warningw("Update dropped", "update_id", update.UpdateID, "user_id", dispatch.KeyOf(update).UserID, "error", err)
 			}
 		case <-ctx.Done():
 			goto shutdown
@@ -198,21 +282,30 @@ func main() {
 
 shutdown:
 	log.Info("Shutting down...")
+	checker.SetStopping()
 
 	done := make(chan struct{})
 	go func() {
-		wg.Wait()
+		dispatcher.Wait()
 		close(done)
 	}()
 
 	select {
 	case <-done:
 		log.Info("All handlers completed successfully")
-	case <-time.After(shutdownTimeout):
+	case <-time.After(cfg.Runtime.ShutdownTimeout):
 		log.Warning("Shutdown timeout reached, some handlers may not have completed")
 	}
 
-	stats := metrics.GetStats()
+	if httpServer != nil {
+		httpCtx, httpCancel := context.WithTimeout(context.Background(), cfg.Runtime.ShutdownTimeout)
+		if err := httpServer.Shutdown(httpCtx); err != nil {
+			log.Warning("HTTP server shutdown: %v", err)
+		}
+		httpCancel()
+	}
+
+	stats := m.GetStats()
 	log.Info("Final metrics: %+v", stats)
 
 	log.Info("Bot shutdown complete")
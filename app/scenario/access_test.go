@@ -0,0 +1,71 @@
+package scenario
+
+import (
+	"context"
+	"main/callback"
+	"main/config"
+	"main/database/models"
+	"main/routes"
+	"main/telegram"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// TestAdminRoutesDenied проверяет маршруты бота целиком: покупатель не попадает в панель заказов,
+// а администратор без прав владельца не может управлять администраторами
+func TestAdminRoutesDenied(t *testing.T) {
+	db := openTestDB(t)
+
+	customer := User{ID: 1001, ChatID: 1001, FirstName: "Иван"}
+	admin := User{ID: 2001, ChatID: 2001, FirstName: "Админ"}
+
+	if _, err := db.Model(&models.TelegramUser{ID: customer.ID, IsAuthorized: true}).Insert(); err != nil {
+		t.Fatalf("seed customer: %v", err)
+	}
+	if err := SeedAdmin(db, admin); err != nil {
+		t.Fatalf("seed admin: %v", err)
+	}
+
+	cfg := config.Default()
+	bot := telegram.NewFakeBot()
+	router := routes.New(bot, db, &cfg)
+
+	tests := []struct {
+		name   string
+		update tgbotapi.Update
+	}{
+		{"customer /orders", CommandUpdate(customer, "orders")},
+		{"customer adminOrders", CallbackUpdate(customer, customer.message(), callback.MustEncode(callback.AdminOrders{}))},
+		{"customer /grant_admin", CommandUpdate(customer, "grant_admin 1001")},
+		{"admin /admins", CommandUpdate(admin, "admins")},
+		{"admin admins", CallbackUpdate(admin, admin.message(), callback.MustEncode(callback.Admins{}))},
+		{"admin /grant_admin", CommandUpdate(admin, "grant_admin 1001")},
+		{"admin /revoke_admin", CommandUpdate(admin, "revoke_admin 2001")},
+		{"admin revokeAdmin", CallbackUpdate(admin, admin.message(), callback.MustEncode(callback.RevokeAdmin{UserID: admin.ID}))},
+		{"admin /admin_log", CommandUpdate(admin, "admin_log")},
+	}
+
+	for _, tt := range tests {
+		bot.Reset()
+
+		for _, r := range router.Handle(context.Background(), tt.update, bot) {
+			if r.Error != nil {
+				t.Errorf("%s: %s: %v", tt.name, r.Name, r.Error)
+			}
+		}
+
+		records := bot.Records()
+		if len(records) != 1 || records[0].Text != "Недостаточно прав" {
+			t.Errorf("%s: expected only «Недостаточно прав», got %+v", tt.name, records)
+		}
+	}
+
+	var users []models.TelegramUser
+	if err := db.Model(&users).Where("is_admin OR is_owner").Select(); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != admin.ID || users[0].IsOwner {
+		t.Errorf("expected admin rights to stay unchanged, got %+v", users)
+	}
+}
@@ -0,0 +1,140 @@
+package scenario
+
+import (
+	"errors"
+	"main/database/models"
+	"reflect"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// roles возвращает права пользователя id: is_admin, is_owner
+func roles(t *testing.T, db *pg.DB, id int64) (bool, bool) {
+	t.Helper()
+
+	user := models.TelegramUser{ID: id}
+	if err := db.Model(&user).WherePK().Select(); err != nil {
+		t.Fatalf("select user %d: %v", id, err)
+	}
+
+	return user.IsAdmin, user.IsOwner
+}
+
+// auditActions возвращает действия журнала прав в порядке записи
+func auditActions(t *testing.T, db *pg.DB) []string {
+	t.Helper()
+
+	var entries []models.AdminAuditEntry
+	if err := db.Model(&entries).Order("id ASC").Select(); err != nil {
+		t.Fatalf("select audit: %v", err)
+	}
+
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+	}
+
+	return actions
+}
+
+// TestBootstrapOwnerChange меняет OWNER_ID между запусками: прежний владелец теряет права владельца
+func TestBootstrapOwnerChange(t *testing.T) {
+	db := openTestDB(t)
+
+	const (
+		firstOwner  = 8001
+		secondOwner = 8002
+	)
+
+	steps := []struct {
+		ownerID int64
+		changed bool
+	}{
+		{firstOwner, true},
+		{firstOwner, false},
+		{secondOwner, true},
+		{secondOwner, false},
+	}
+
+	for _, s := range steps {
+		changed, err := models.BootstrapOwner(db, s.ownerID)
+		if err != nil {
+			t.Fatalf("bootstrap %d: %v", s.ownerID, err)
+		}
+		if changed != s.changed {
+			t.Errorf("bootstrap %d: changed = %v, want %v", s.ownerID, changed, s.changed)
+		}
+	}
+
+	if admin, owner := roles(t, db, secondOwner); !admin || !owner {
+		t.Errorf("new owner: is_admin = %v, is_owner = %v", admin, owner)
+	}
+	if admin, owner := roles(t, db, firstOwner); !admin || owner {
+		t.Errorf("previous owner must stay an admin without owner rights: is_admin = %v, is_owner = %v", admin, owner)
+	}
+
+	// Бывшему владельцу права администратора снимаются как обычно
+	if changed, err := models.SetAdmin(db, secondOwner, firstOwner, false); err != nil || !changed {
+		t.Errorf("revoke previous owner: changed = %v, err = %v", changed, err)
+	}
+
+	want := []string{models.AdminActionBootstrapOwner, models.AdminActionDemoteOwner, models.AdminActionBootstrapOwner, models.AdminActionRevoke}
+	if got := auditActions(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected audit %v, got %v", want, got)
+	}
+}
+
+func TestSetAdmin(t *testing.T) {
+	db := openTestDB(t)
+
+	const (
+		ownerID    = 8101
+		customerID = 8102
+		missingID  = 8199
+	)
+
+	if _, err := models.BootstrapOwner(db, ownerID); err != nil {
+		t.Fatalf("bootstrap: %v", err)
+	}
+	if _, err := db.Model(&models.TelegramUser{ID: customerID, IsAuthorized: true}).Insert(); err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		targetID int64
+		admin    bool
+		changed  bool
+		err      error
+		isAdmin  bool
+	}{
+		{"grant", customerID, true, true, nil, true},
+		{"grant again", customerID, true, false, nil, true},
+		{"revoke", customerID, false, true, nil, false},
+		{"revoke again", customerID, false, false, nil, false},
+		{"revoke owner", ownerID, false, false, models.ErrOwnerRights, true},
+		{"unknown user", missingID, true, false, pg.ErrNoRows, false},
+	}
+
+	for _, tt := range tests {
+		changed, err := models.SetAdmin(db, ownerID, tt.targetID, tt.admin)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.err, err)
+		}
+		if changed != tt.changed {
+			t.Errorf("%s: changed = %v, want %v", tt.name, changed, tt.changed)
+		}
+		if tt.err == pg.ErrNoRows {
+			continue
+		}
+		if admin, _ := roles(t, db, tt.targetID); admin != tt.isAdmin {
+			t.Errorf("%s: is_admin = %v, want %v", tt.name, admin, tt.isAdmin)
+		}
+	}
+
+	want := []string{models.AdminActionBootstrapOwner, models.AdminActionGrant, models.AdminActionRevoke}
+	if got := auditActions(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected audit %v, got %v", want, got)
+	}
+}
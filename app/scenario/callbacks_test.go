@@ -0,0 +1,93 @@
+package scenario
+
+import (
+	"errors"
+	"main/callback"
+	"main/config"
+	"main/database/models"
+	"main/routes"
+	"main/telegram"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// TestStaleCallbackPayload проверяет срок жизни длинных callback data: повторная отрисовка кнопки
+// продлевает его, устаревший токен не разбирается, а кнопка отвечает, что устарела
+func TestStaleCallbackPayload(t *testing.T) {
+	db := openTestDB(t)
+
+	const ttl = time.Hour
+
+	cfg := config.Default()
+	cfg.Runtime.CallbackPayloadTTL = ttl
+	bot := telegram.NewFakeBot()
+	runner := NewRunner(routes.New(bot, db, &cfg), bot, db, &cfg)
+	t.Cleanup(func() { callback.SetStore(nil) })
+
+	store := callback.PgStore{DB: db, TTL: ttl}
+
+	// age сдвигает последнюю отрисовку кнопки в прошлое
+	age := func(token string, by time.Duration) {
+		t.Helper()
+		if _, err := db.Exec(`UPDATE callback_payloads SET created_at_ts = created_at_ts - ? WHERE token = ?`, int64(by.Seconds()), token); err != nil {
+			t.Fatalf("age payload: %v", err)
+		}
+	}
+
+	var route callback.MyOrders
+
+	stale, err := store.Put(route.Route() + "?p=1")
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	renewed, err := store.Put(route.Route() + "?p=2")
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	age(stale, 2*ttl)
+	age(renewed, 2*ttl)
+	if _, err := store.Put(route.Route() + "?p=2"); err != nil {
+		t.Fatalf("put again: %v", err)
+	}
+
+	if _, err := store.Get(renewed); err != nil {
+		t.Errorf("expected a redrawn button to stay valid, got %v", err)
+	}
+	if _, err := store.Get(stale); !errors.Is(err, callback.ErrUnknownToken) {
+		t.Errorf("expected ErrUnknownToken for an expired token, got %v", err)
+	}
+
+	if err := callback.Decode(route.Route()+"#"+stale, &route); !errors.Is(err, callback.ErrUnknownToken) {
+		t.Errorf("expected Decode to fail with ErrUnknownToken, got %v", err)
+	}
+
+	// Нажатие устаревшей кнопки: покупатель узнает об этом, обработчик не падает
+	customer := User{ID: 1001, ChatID: 1001, FirstName: "Иван"}
+	if _, err := db.Model(&models.TelegramUser{ID: customer.ID, IsAuthorized: true}).Insert(); err != nil {
+		t.Fatalf("seed customer: %v", err)
+	}
+
+	runner.Run(t,
+		Send("press stale button", CallbackUpdate(customer, customer.message(), route.Route()+"#"+stale),
+			Answers("Кнопка устарела")),
+	)
+
+	purged, err := store.Purge()
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("expected 1 payload purged, got %d", purged)
+	}
+
+	var left int
+	if _, err := db.QueryOne(pg.Scan(&left), `SELECT count(*) FROM callback_payloads`); err != nil {
+		t.Fatalf("count payloads: %v", err)
+	}
+	if left != 1 {
+		t.Errorf("expected only the redrawn payload to remain, got %d", left)
+	}
+}
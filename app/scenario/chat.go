@@ -0,0 +1,150 @@
+package scenario
+
+import (
+	"main/telegram"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// chatMessage - сообщение бота в том виде, в котором его сейчас видит пользователь
+type chatMessage struct {
+	ID      int
+	ChatID  int64
+	Text    string
+	IsMedia bool
+	Markup  *tgbotapi.InlineKeyboardMarkup
+}
+
+// apiMessage возвращает сообщение в виде, в котором оно приходит в CallbackQuery
+func (m chatMessage) apiMessage() *tgbotapi.Message {
+	message := &tgbotapi.Message{
+		MessageID: m.ID,
+		Chat:      &tgbotapi.Chat{ID: m.ChatID, Type: "private"},
+	}
+
+	if m.IsMedia {
+		message.Caption = m.Text
+	} else {
+		message.Text = m.Text
+	}
+
+	message.ReplyMarkup = m.Markup
+
+	return message
+}
+
+func (m chatMessage) findButton(match func(data string) bool) (string, bool) {
+	if m.Markup == nil {
+		return "", false
+	}
+
+	for _, row := range m.Markup.InlineKeyboard {
+		for _, button := range row {
+			if button.CallbackData != nil && match(*button.CallbackData) {
+				return *button.CallbackData, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// chatState воспроизводит содержимое чатов по записям FakeBot:
+// отправленные сообщения появляются, отредактированные меняются, удалённые исчезают
+type chatState struct {
+	messages []*chatMessage
+}
+
+func (c *chatState) apply(records []telegram.Record) {
+	for _, r := range records {
+		switch r.Kind {
+		case telegram.KindSent:
+			_, isPhoto := r.Config.(tgbotapi.PhotoConfig)
+			_, isDocument := r.Config.(tgbotapi.DocumentConfig)
+
+			c.messages = append(c.messages, &chatMessage{
+				ID:      r.MessageID,
+				ChatID:  r.ChatID,
+				Text:    r.Text,
+				IsMedia: isPhoto || isDocument,
+				Markup:  r.Markup,
+			})
+		case telegram.KindEdited:
+			message := c.find(r.ChatID, r.MessageID)
+			if message == nil {
+				continue
+			}
+
+			switch r.Config.(type) {
+			case tgbotapi.EditMessageTextConfig:
+				message.Text = r.Text
+				message.IsMedia = false
+			case tgbotapi.EditMessageCaptionConfig:
+				message.Text = r.Text
+			case tgbotapi.EditMessageMediaConfig:
+				message.IsMedia = true
+			}
+
+			message.Markup = r.Markup
+		case telegram.KindDeleted:
+			for i, m := range c.messages {
+				if m.ChatID == r.ChatID && m.ID == r.MessageID {
+					c.messages = append(c.messages[:i], c.messages[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+}
+
+func (c *chatState) find(chatID int64, messageID int) *chatMessage {
+	for _, m := range c.messages {
+		if m.ChatID == chatID && m.ID == messageID {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// findButton ищет кнопку в самом свежем сообщении чата, у которого она есть
+func (c *chatState) findButton(chatID int64, match func(data string) bool) (*chatMessage, string, bool) {
+	for i := len(c.messages) - 1; i >= 0; i-- {
+		m := c.messages[i]
+		if m.ChatID != chatID {
+			continue
+		}
+
+		if data, ok := m.findButton(match); ok {
+			return m, data, true
+		}
+	}
+
+	return nil, "", false
+}
+
+// buttons возвращает callback data всех кнопок в чате (для сообщений об ошибках)
+func (c *chatState) buttons(chatID int64) []string {
+	var res []string
+	for _, m := range c.messages {
+		if m.ChatID != chatID {
+			continue
+		}
+
+		m.findButton(func(data string) bool {
+			res = append(res, data)
+			return false
+		})
+	}
+
+	return res
+}
+
+func exactly(data string) func(string) bool {
+	return func(s string) bool { return s == data }
+}
+
+func withPrefix(prefix string) func(string) bool {
+	return func(s string) bool { return strings.HasPrefix(s, prefix) }
+}
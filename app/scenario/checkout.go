@@ -0,0 +1,177 @@
+package scenario
+
+import (
+	"fmt"
+	"main/callback"
+	"main/database/models"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// paymentAcceptedText - начало сообщения, которое покупатель получает после подтверждения оплаты
+const paymentAcceptedText = "Администрация приняла ваш чек"
+
+// CheckoutScript - полный путь покупателя: /start → регистрация → магазин → корзина →
+// оформление заказа → чек об оплате → подтверждение оплаты администратором.
+// product должен быть заранее создан (см. SeedProduct) и иметь хотя бы одну единицу в наличии.
+// admin.ChatID должен совпадать с Telegram.AdminChatID из конфига Runner, иначе администратор не увидит чек,
+// а сам admin должен быть администратором (см. SeedAdmin), иначе не сможет его принять.
+func CheckoutScript(customer, admin User, product models.Product) []Step {
+	const (
+		fio     = "Иванов Иван Иванович"
+		phone   = "89991234567"
+		address = "Москва, ул. Пушкина, д. 1"
+		receipt = "receipt-photo"
+	)
+
+	return []Step{
+		Send("start", CommandUpdate(customer, "start"),
+			Handled("sayHi"),
+			HasButton(customer.ChatID, callback.MustEncode(callback.RegisterUser{})),
+		),
+		Press("register", customer, callback.MustEncode(callback.RegisterUser{}),
+			Handled("registerUser"),
+			Says(customer.ChatID, "Введите ФИО"),
+		),
+		Send("enter fio", TextUpdate(customer, fio),
+			Says(customer.ChatID, "Введите номер телефона"),
+		),
+		Send("enter phone", TextUpdate(customer, phone),
+			HasButton(customer.ChatID, callback.MustEncode(callback.SelectDeliveryService{Service: "cdek"})),
+		),
+		Press("select delivery service", customer, callback.MustEncode(callback.SelectDeliveryService{Service: "cdek"}),
+			Handled("getPVZ"),
+			Says(customer.ChatID, "Введите адрес пвз"),
+		),
+		Send("enter address", TextUpdate(customer, address),
+			Says(customer.ChatID, "Вы успешно зарегистрированы"),
+			DB(func(db *pg.DB) error {
+				user := models.TelegramUser{ID: customer.ID}
+				if err := user.Get(db); err != nil {
+					return err
+				}
+
+				if !user.IsAuthorized || user.FIO != fio || user.Phone != phone || user.DeliveryAddress != address || user.DeliveryService != "cdek" {
+					return fmt.Errorf("user is not registered properly: %+v", user)
+				}
+
+				return nil
+			}),
+		),
+		Press("main menu", customer, callback.MustEncode(callback.MainMenu{}),
+			Handled("mainMenu"),
+			HasButton(customer.ChatID, callback.MustEncode(callback.Shop{})),
+		),
+		Press("shop", customer, callback.MustEncode(callback.Shop{}),
+			Handled("shop"),
+			HasButton(customer.ChatID, callback.MustEncode(callback.ToCat{CatID: product.CatalogID})),
+		),
+		Press("open catalog", customer, callback.MustEncode(callback.ToCat{CatID: product.CatalogID}),
+			Handled("viewCatalog"),
+			Says(customer.ChatID, product.Name),
+		),
+		Press("add to cart", customer, callback.MustEncode(callback.ToCat{CartDelta: 1}),
+			Handled("viewCatalog"),
+			HasButton(customer.ChatID, callback.MustEncode(callback.ToCat{CartDelta: -1})),
+		),
+		Press("view cart", customer, callback.MustEncode(callback.ViewCart{}),
+			Handled("view-cart"),
+			HasButton(customer.ChatID, callback.MustEncode(callback.MakeOrder{})),
+		),
+		Press("make order", customer, callback.MustEncode(callback.MakeOrder{}),
+			Handled("makeOrder"),
+			Says(customer.ChatID, "Проверьте корректность ваших данных"),
+		),
+		Press("process order", customer, callback.MustEncode(callback.ProcessOrder{}),
+			Handled("processOrder"),
+			Says(customer.ChatID, "пришлите боту чек"),
+			DB(func(db *pg.DB) error {
+				p := models.Product{ID: product.ID}
+				if err := db.Model(&p).WherePK().Select(); err != nil {
+					return err
+				}
+				if err := models.LoadReservedStock(db, 0, &p); err != nil {
+					return err
+				}
+
+				// До оплаты товар только зарезервирован: на складе он остается, но другим покупателям недоступен
+				if p.AvailbleForPurchase != product.AvailbleForPurchase || p.Available() != product.AvailbleForPurchase-1 {
+					return fmt.Errorf("expected %d items in stock and %d available, got %d and %d", product.AvailbleForPurchase, product.AvailbleForPurchase-1, p.AvailbleForPurchase, p.Available())
+				}
+
+				return nil
+			}),
+		),
+		Send("send receipt", PhotoUpdate(customer, receipt),
+			Says(customer.ChatID, "администратор скоро проверит оплату"),
+			Says(admin.ChatID, "Итого"),
+		),
+		PressPrefix("accept payment", admin, "paymentVerdict?ok=true",
+			Handled("paymentVerdict"),
+			Says(customer.ChatID, paymentAcceptedText),
+			DB(func(db *pg.DB) error {
+				count, err := db.Model(&models.Transaction{}).Where("user_id = ?", customer.ID).Count()
+				if err != nil {
+					return err
+				}
+
+				if count != 0 {
+					return fmt.Errorf("expected no transactions left after payment, got %d", count)
+				}
+
+				p := models.Product{ID: product.ID}
+				if err := db.Model(&p).WherePK().Select(); err != nil {
+					return err
+				}
+				if err := models.LoadReservedStock(db, 0, &p); err != nil {
+					return err
+				}
+
+				if p.AvailbleForPurchase != product.AvailbleForPurchase-1 || p.Reserved != 0 {
+					return fmt.Errorf("expected %d items in stock and no reservations after payment, got %d and %d reserved", product.AvailbleForPurchase-1, p.AvailbleForPurchase, p.Reserved)
+				}
+
+				var order models.Order
+				err = db.Model(&order).Where("user_id = ?", customer.ID).Order("id DESC").Limit(1).Select()
+				if err != nil {
+					return err
+				}
+
+				order, err = models.GetOrder(db, order.ID)
+				if err != nil {
+					return err
+				}
+
+				if order.Status != models.OrderStatusPaid || len(order.Lines) != 1 || order.Lines[0].Quantity != 1 || order.TotalPrice != product.Price {
+					return fmt.Errorf("order is not paid properly: %+v", order)
+				}
+
+				var statuses []models.OrderStatus
+				for _, change := range order.History {
+					statuses = append(statuses, change.ToStatus)
+				}
+
+				expected := []models.OrderStatus{models.OrderStatusDraft, models.OrderStatusAwaitingPayment, models.OrderStatusPaymentReview, models.OrderStatusPaid}
+				if fmt.Sprint(statuses) != fmt.Sprint(expected) {
+					return fmt.Errorf("expected order history %v, got %v", expected, statuses)
+				}
+
+				return nil
+			}),
+		),
+		Press("back to main menu", customer, callback.MustEncode(callback.MainMenu{}),
+			Handled("mainMenu"),
+			HasButton(customer.ChatID, callback.MustEncode(callback.MyOrders{})),
+		),
+		// PrepareDB сбрасывает идентификаторы, поэтому заказ - первый
+		Press("my orders", customer, callback.MustEncode(callback.MyOrders{}),
+			Handled("myOrders"),
+			HasButton(customer.ChatID, callback.MustEncode(callback.OrderDetails{OrderID: 1})),
+		),
+		Press("order details", customer, callback.MustEncode(callback.OrderDetails{OrderID: 1}),
+			Handled("orderDetails"),
+			Says(customer.ChatID, product.Name),
+			Says(customer.ChatID, "Статус: Оплачен"),
+		),
+	}
+}
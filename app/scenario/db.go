@@ -0,0 +1,47 @@
+package scenario
+
+import (
+	"context"
+	"main/database"
+	"main/database/models"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// PrepareDB применяет миграции и очищает таблицы.
+// Запускать сценарии нужно только против локальной тестовой базы.
+func PrepareDB(db *pg.DB) error {
+	if err := database.Migrate(context.Background(), db); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(`TRUNCATE telegram_users, catalogs, products, added_products, transactions, shop_view_sessions, next_steps, callback_payloads, admin_audit_entries, orders, order_lines, order_status_changes, order_notes, stock_reservations RESTART IDENTITY CASCADE`)
+
+	return err
+}
+
+// SeedProduct создает каталог catalogName и товар в нем
+func SeedProduct(db *pg.DB, catalogName string, product models.Product) (models.Product, error) {
+	catalog := models.Catalog{Name: catalogName}
+	if _, err := db.Model(&catalog).Insert(); err != nil {
+		return product, err
+	}
+
+	product.CatalogID = catalog.ID
+	_, err := db.Model(&product).Insert()
+
+	return product, err
+}
+
+// SeedAdmin создает пользователя user с правами администратора
+func SeedAdmin(db *pg.DB, user User) error {
+	_, err := db.Model(&models.TelegramUser{
+		ID:        user.ID,
+		Username:  user.UserName,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		IsAdmin:   true,
+	}).Insert()
+
+	return err
+}
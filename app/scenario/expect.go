@@ -0,0 +1,76 @@
+package scenario
+
+import (
+	"fmt"
+	"main/telegram"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// Handled проверяет, что обновление обработал хендлер с указанным именем
+func Handled(name string) Expectation {
+	return func(_ *Runner, res StepResult) error {
+		var acted []string
+		for _, h := range res.Handled {
+			if h.IsActed {
+				if h.Name == name {
+					return nil
+				}
+				acted = append(acted, h.Name+" ("+h.Route+")")
+			}
+		}
+
+		return fmt.Errorf("expected handler %q to act, acted: %q", name, acted)
+	}
+}
+
+// Says проверяет, что за шаг бот отправил или отредактировал в чате chatID сообщение, содержащее text
+func Says(chatID int64, text string) Expectation {
+	return func(_ *Runner, res StepResult) error {
+		var seen []string
+		for _, r := range res.Records {
+			if r.ChatID != chatID || (r.Kind != telegram.KindSent && r.Kind != telegram.KindEdited) {
+				continue
+			}
+
+			if strings.Contains(r.Text, text) {
+				return nil
+			}
+			seen = append(seen, r.Text)
+		}
+
+		return fmt.Errorf("expected message containing %q in chat %d, got: %q", text, chatID, seen)
+	}
+}
+
+// Answers проверяет, что за шаг бот ответил на callback query текстом, содержащим text
+func Answers(text string) Expectation {
+	return func(_ *Runner, res StepResult) error {
+		for _, r := range res.Records {
+			if r.Kind == telegram.KindCallbackAnswer && strings.Contains(r.Text, text) {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("expected callback answer containing %q", text)
+	}
+}
+
+// HasButton проверяет, что после шага в чате chatID видна кнопка с callback data data
+func HasButton(chatID int64, data string) Expectation {
+	return func(r *Runner, _ StepResult) error {
+		if _, _, ok := r.chats.findButton(chatID, exactly(data)); !ok {
+			return fmt.Errorf("no button %q in chat %d, available: %q", data, chatID, r.chats.buttons(chatID))
+		}
+
+		return nil
+	}
+}
+
+// DB выполняет произвольную проверку состояния базы данных
+func DB(check func(db *pg.DB) error) Expectation {
+	return func(r *Runner, _ StepResult) error {
+		return check(r.DB)
+	}
+}
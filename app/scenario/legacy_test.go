@@ -0,0 +1,75 @@
+package scenario
+
+import (
+	"errors"
+	"main/database/models"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// TestRejectLegacyReceiptTwice отклоняет один и тот же чек без заказа двумя администраторами одновременно:
+// товар возвращается на склад один раз, второе нажатие получает pg.ErrNoRows
+func TestRejectLegacyReceiptTwice(t *testing.T) {
+	db := openTestDB(t)
+
+	const (
+		stock  = 2
+		bought = 3
+	)
+
+	product, err := SeedProduct(db, "Кружки", models.Product{Name: "Кружка", Price: 700, AvailbleForPurchase: stock})
+	if err != nil {
+		t.Fatalf("seed product: %v", err)
+	}
+
+	user := models.TelegramUser{ID: 7001}
+	if _, err := db.Model(&user).Insert(); err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+
+	// Так выглядел чек до появления заказов: корзина ждет проверки, товар уже списан со склада
+	transaction := models.Transaction{UserID: user.ID, IsWaitingForApproval: true}
+	if _, err := db.Model(&transaction).Insert(); err != nil {
+		t.Fatalf("seed transaction: %v", err)
+	}
+	item := models.AddedProducts{UserID: user.ID, ProductID: product.ID, ProductCount: bought, TransactionID: transaction.ID, Name: product.Name, UnitPrice: product.Price}
+	if _, err := db.Model(&item).Insert(); err != nil {
+		t.Fatalf("seed cart: %v", err)
+	}
+
+	errs := concurrently(2, func(int) error {
+		return user.RejectLegacyTransaction(db, transaction.ID)
+	})
+
+	var handled, repeated int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			handled++
+		case errors.Is(err, pg.ErrNoRows):
+			repeated++
+		default:
+			t.Fatalf("reject legacy receipt: %v", err)
+		}
+	}
+	if handled != 1 || repeated != 1 {
+		t.Errorf("expected one rejection and one already handled, got %d and %d", handled, repeated)
+	}
+
+	p := models.Product{ID: product.ID}
+	if err := db.Model(&p).WherePK().Select(); err != nil {
+		t.Fatalf("select product: %v", err)
+	}
+	if p.AvailbleForPurchase != stock+bought {
+		t.Errorf("expected stock %d after returning the receipt once, got %d", stock+bought, p.AvailbleForPurchase)
+	}
+
+	left, err := db.Model((*models.AddedProducts)(nil)).Where("transaction_id = ?", transaction.ID).Count()
+	if err != nil {
+		t.Fatalf("count cart: %v", err)
+	}
+	if left != 0 {
+		t.Errorf("expected the cart to be deleted, %d items left", left)
+	}
+}
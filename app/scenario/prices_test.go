@@ -0,0 +1,76 @@
+package scenario
+
+import (
+	"main/database/models"
+	"testing"
+	"time"
+)
+
+// TestOrderPriceFixedAtCheckout меняет цену товара до и после перехода к оплате: заказ получает цену
+// на момент оформления (покупатель видит предупреждение), а последующая смена цены сумму к оплате не меняет
+func TestOrderPriceFixedAtCheckout(t *testing.T) {
+	db := openTestDB(t)
+
+	product, err := SeedProduct(db, "Кружки", models.Product{Name: "Кружка", Price: 1000, AvailbleForPurchase: 5})
+	if err != nil {
+		t.Fatalf("seed product: %v", err)
+	}
+
+	user := models.TelegramUser{ID: 8001, IsAuthorized: true}
+	if _, err := db.Model(&user).Insert(); err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+	for range 2 {
+		if err := user.AddProductToCart(db, product.ID); err != nil {
+			t.Fatalf("add to cart: %v", err)
+		}
+	}
+
+	setPrice := func(price int) {
+		t.Helper()
+		if _, err := db.Model(&product).WherePK().Set("price = ?", price).Update(); err != nil {
+			t.Fatalf("set price: %v", err)
+		}
+	}
+
+	// Цена изменилась, пока товар лежал в корзине
+	setPrice(1200)
+
+	transaction, err, _ := user.GetOrCreateTransaction(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order, changes, err := user.CreateOrderFromCart(db, transaction.ID)
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if len(changes) != 1 || changes[0].OldPrice != 1000 || changes[0].NewPrice != 1200 {
+		t.Errorf("expected one price change 1000 -> 1200, got %+v", changes)
+	}
+	if order.TotalPrice != 2400 || order.Lines[0].UnitPrice != 1200 {
+		t.Errorf("expected the order at the checkout price 2×1200, got total %d", order.TotalPrice)
+	}
+
+	if _, err := models.ReserveOrder(db, order.ID, user.ID, time.Hour); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+
+	// Цена изменилась после перехода к оплате
+	setPrice(1500)
+
+	order, err = models.GetOrder(db, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.TotalPrice != 2400 || order.Lines[0].UnitPrice != 1200 {
+		t.Errorf("expected the amount due to stay 2400 after the price change, got %d (unit %d)", order.TotalPrice, order.Lines[0].UnitPrice)
+	}
+
+	total, err := user.GetTotalCartPrice(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2400 {
+		t.Errorf("expected the cart total to match the order, got %d", total)
+	}
+}
@@ -0,0 +1,156 @@
+package scenario
+
+import (
+	"context"
+	"fmt"
+	"main/callback"
+	"main/config"
+	"main/controllers"
+	"main/handlers"
+	"main/telegram"
+
+	"github.com/go-pg/pg/v10"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// TB - подмножество testing.TB, которое нужно Runner.Run
+type TB interface {
+	Helper()
+	Fatalf(format string, args ...any)
+}
+
+// StepResult - результат обработки одного обновления
+// Update - обработанное обновление
+// Handled - результаты Router.Handle
+// StepErr - ошибка функции следующего шага, если она была вызвана
+// Records - вызовы Telegram API, сделанные ботом за время шага
+type StepResult struct {
+	Update  tgbotapi.Update
+	Handled []handlers.HandleResult
+	StepErr error
+	Records []telegram.Record
+}
+
+// Expectation проверяет результат шага и состояние базы данных
+type Expectation func(r *Runner, res StepResult) error
+
+// Step - один шаг сценария
+// Name - название шага для сообщений об ошибках
+// Update строит обновление; может опираться на текущее состояние чатов (например, чтобы нажать кнопку)
+// Expect - проверки, выполняемые после обработки обновления
+type Step struct {
+	Name   string
+	Update func(r *Runner) (tgbotapi.Update, error)
+	Expect []Expectation
+}
+
+// Send - шаг, отправляющий боту заранее подготовленное обновление
+func Send(name string, update tgbotapi.Update, expect ...Expectation) Step {
+	return Step{
+		Name:   name,
+		Update: func(*Runner) (tgbotapi.Update, error) { return update, nil },
+		Expect: expect,
+	}
+}
+
+// Press - шаг, нажимающий кнопку с callback data data в чате пользователя.
+// Шаг падает, если такой кнопки нет ни в одном видимом сообщении бота.
+func Press(name string, user User, data string, expect ...Expectation) Step {
+	return press(name, user, data, exactly(data), expect)
+}
+
+// PressPrefix - как Press, но ищет кнопку, callback data которой начинается с prefix
+func PressPrefix(name string, user User, prefix string, expect ...Expectation) Step {
+	return press(name, user, prefix+"*", withPrefix(prefix), expect)
+}
+
+func press(name string, user User, pattern string, match func(string) bool, expect []Expectation) Step {
+	return Step{
+		Name: name,
+		Update: func(r *Runner) (tgbotapi.Update, error) {
+			message, data, ok := r.chats.findButton(user.ChatID, match)
+			if !ok {
+				return tgbotapi.Update{}, fmt.Errorf("no button %q in chat %d, available: %q", pattern, user.ChatID, r.chats.buttons(user.ChatID))
+			}
+
+			return CallbackUpdate(user, message.apiMessage(), data), nil
+		},
+		Expect: expect,
+	}
+}
+
+// Runner прогоняет сценарий через handlers.Router.Handle и controllers.RunStepUpdates
+// так же, как это делает воркер в run.go, но с FakeBot вместо Telegram API
+type Runner struct {
+	Handlers *handlers.Router
+	Steps    *controllers.NextStepManager
+	Bot      *telegram.FakeBot
+	DB       *pg.DB
+	Config   *config.Config
+
+	chats chatState
+	seen  int
+}
+
+// NewRunner создает Runner. Маршруты router должны быть созданы с теми же bot, db и cfg.
+// Глобальный NextStepManager и хранилище длинных callback data подменяются хранилищами поверх db.
+func NewRunner(router *handlers.Router, bot *telegram.FakeBot, db *pg.DB, cfg *config.Config) *Runner {
+	steps := controllers.NewNextStepManager(controllers.PgStepStore{DB: db})
+	controllers.SetNextStepManager(steps)
+	callback.SetStore(callback.PgStore{DB: db, TTL: cfg.Runtime.CallbackPayloadTTL})
+
+	return &Runner{
+		Handlers: router,
+		Steps:    steps,
+		Bot:      bot,
+		DB:       db,
+		Config:   cfg,
+	}
+}
+
+// Do выполняет один шаг и проверяет его ожидания
+func (r *Runner) Do(step Step) (StepResult, error) {
+	update, err := step.Update(r)
+	if err != nil {
+		return StepResult{}, err
+	}
+
+	res := StepResult{Update: update}
+	ctx := handlers.UpdateContext(context.Background(), update)
+	res.Handled = r.Handlers.Handle(ctx, update, r.Bot)
+	res.StepErr = controllers.RunStepUpdates(ctx, update, r.Steps, controllers.StepEnv{Client: r.Bot, DB: r.DB, Config: r.Config})
+
+	records := r.Bot.Records()
+	res.Records = records[r.seen:]
+	r.seen = len(records)
+	r.chats.apply(res.Records)
+
+	for _, h := range res.Handled {
+		if h.Error != nil {
+			return res, fmt.Errorf("handler %s failed: %w", h.Name, h.Error)
+		}
+	}
+
+	if res.StepErr != nil {
+		return res, fmt.Errorf("next step failed: %w", res.StepErr)
+	}
+
+	for _, expect := range step.Expect {
+		if err := expect(r, res); err != nil {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
+
+// Run выполняет шаги по порядку и останавливает тест на первом неудачном
+func (r *Runner) Run(t TB, steps ...Step) {
+	t.Helper()
+
+	for i, step := range steps {
+		if _, err := r.Do(step); err != nil {
+			t.Fatalf("step %d (%s): %v", i+1, step.Name, err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package scenario
+
+import (
+	"errors"
+	"fmt"
+	"main/database/models"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// CheckConcurrentStock проверяет, что одновременные покупки не продают больше товара, чем есть на складе.
+// Для product (см. SeedProduct) создаются buyers покупателей с Telegram ID от firstUserID, у каждого
+// в корзине одна штука товара. Затем:
+//
+//  1. все одновременно переходят к оплате (models.ReserveOrder): резерв получают ровно
+//     min(наличие, buyers) заказов, остальные - models.ErrInsufficientStock;
+//  2. заказы без резерва все равно отправляются на проверку (бот такие заказы отменяет, но на проверке
+//     могут остаться чеки, отправленные до появления резервов), и администратор одновременно
+//     принимает оплату всех заказов: оплачено ровно min(наличие, buyers) заказов, остаток на складе
+//     не уходит в минус.
+//
+// Запускать только против локальной тестовой базы после PrepareDB.
+func CheckConcurrentStock(db *pg.DB, product models.Product, buyers int, firstUserID int64) error {
+	stock := product.AvailbleForPurchase
+	expected := min(stock, buyers)
+
+	orders := make([]models.Order, buyers)
+	for i := range orders {
+		user := models.TelegramUser{ID: firstUserID + int64(i), IsAuthorized: true}
+		if _, err := db.Model(&user).Insert(); err != nil {
+			return err
+		}
+
+		if err := user.AddProductToCart(db, product.ID); err != nil {
+			return err
+		}
+
+		transaction, err, _ := user.GetOrCreateTransaction(db)
+		if err != nil {
+			return err
+		}
+
+		orders[i], _, err = user.CreateOrderFromCart(db, transaction.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	reserveErrs := concurrently(buyers, func(i int) error {
+		_, err := models.ReserveOrder(db, orders[i].ID, orders[i].UserID, time.Hour)
+		return err
+	})
+	reserved, err := countStockResults(reserveErrs)
+	if err != nil {
+		return fmt.Errorf("reserve: %w", err)
+	}
+	if reserved != expected {
+		return fmt.Errorf("expected %d of %d orders reserved with %d in stock, got %d", expected, buyers, stock, reserved)
+	}
+
+	for i, order := range orders {
+		if reserveErrs[i] != nil {
+			if _, err := models.TransitionOrder(db, order.ID, models.OrderStatusAwaitingPayment, order.UserID, "Товар не зарезервирован"); err != nil {
+				return err
+			}
+		}
+
+		if _, err := models.TransitionOrder(db, order.ID, models.OrderStatusPaymentReview, order.UserID, ""); err != nil {
+			return err
+		}
+	}
+
+	paid, err := countStockResults(concurrently(buyers, func(i int) error {
+		_, err := models.TransitionOrder(db, orders[i].ID, models.OrderStatusPaid, 0, "")
+		return err
+	}))
+	if err != nil {
+		return fmt.Errorf("accept payment: %w", err)
+	}
+	if paid != expected {
+		return fmt.Errorf("expected %d of %d orders paid with %d in stock, got %d", expected, buyers, stock, paid)
+	}
+
+	p := models.Product{ID: product.ID}
+	if err := db.Model(&p).WherePK().Select(); err != nil {
+		return err
+	}
+	if p.AvailbleForPurchase != stock-paid {
+		return fmt.Errorf("expected %d items left in stock, got %d", stock-paid, p.AvailbleForPurchase)
+	}
+
+	return nil
+}
+
+// concurrently запускает fn(0..n-1) в отдельных горутинах одновременно и возвращает их ошибки
+func concurrently(n int, fn func(i int) error) []error {
+	errs := make([]error, n)
+	start := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs[i] = fn(i)
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+
+	return errs
+}
+
+// countStockResults считает успешные операции; ошибки, кроме models.ErrInsufficientStock, возвращаются
+func countStockResults(errs []error) (int, error) {
+	ok := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			ok++
+		case !errors.Is(err, models.ErrInsufficientStock):
+			return ok, err
+		}
+	}
+
+	return ok, nil
+}
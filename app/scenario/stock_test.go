@@ -0,0 +1,45 @@
+package scenario
+
+import (
+	"main/database/models"
+	"testing"
+)
+
+func TestConcurrentStock(t *testing.T) {
+	db := openTestDB(t)
+
+	const (
+		stock  = 3
+		buyers = 10
+	)
+
+	product, err := SeedProduct(db, "Кружки", models.Product{Name: "Кружка", Price: 700, AvailbleForPurchase: stock})
+	if err != nil {
+		t.Fatalf("seed product: %v", err)
+	}
+
+	if err := CheckConcurrentStock(db, product, buyers, 5001); err != nil {
+		t.Fatal(err)
+	}
+
+	p := models.Product{ID: product.ID}
+	if err := db.Model(&p).WherePK().Select(); err != nil {
+		t.Fatalf("select product: %v", err)
+	}
+	if p.AvailbleForPurchase != 0 {
+		t.Errorf("expected the whole stock sold and nothing below zero, got %d left", p.AvailbleForPurchase)
+	}
+
+	paid, err := db.Model((*models.Order)(nil)).Where("status = ?", models.OrderStatusPaid).Count()
+	if err != nil {
+		t.Fatalf("count paid orders: %v", err)
+	}
+	// Лишние заказы остаются на проверке чека: администратор должен пополнить наличие или отклонить их
+	rejected, err := db.Model((*models.Order)(nil)).Where("status = ?", models.OrderStatusPaymentReview).Count()
+	if err != nil {
+		t.Fatalf("count rejected orders: %v", err)
+	}
+	if paid != stock || rejected != buyers-stock {
+		t.Errorf("expected %d paid and %d rejected orders, got %d and %d", stock, buyers-stock, paid, rejected)
+	}
+}
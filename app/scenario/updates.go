@@ -0,0 +1,111 @@
+package scenario
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// incomingMessageIDBase - с этого значения нумеруются сообщения пользователей,
+// чтобы они не пересекались с сообщениями, которые "отправляет" FakeBot
+const incomingMessageIDBase = 1_000_000
+
+var (
+	lastUpdateID  int64
+	lastMessageID int64 = incomingMessageIDBase
+	lastQueryID   int64
+)
+
+// User - участник сценария
+// ID - Telegram ID пользователя
+// ChatID - ID чата, в котором пользователь общается с ботом
+type User struct {
+	ID        int64
+	ChatID    int64
+	UserName  string
+	FirstName string
+	LastName  string
+}
+
+func (u User) apiUser() *tgbotapi.User {
+	return &tgbotapi.User{
+		ID:        u.ID,
+		UserName:  u.UserName,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+	}
+}
+
+func (u User) message() *tgbotapi.Message {
+	return &tgbotapi.Message{
+		MessageID: int(atomic.AddInt64(&lastMessageID, 1)),
+		From:      u.apiUser(),
+		Date:      int(time.Now().Unix()),
+		Chat:      &tgbotapi.Chat{ID: u.ChatID, Type: "private"},
+	}
+}
+
+func nextUpdateID() int {
+	return int(atomic.AddInt64(&lastUpdateID, 1))
+}
+
+// CommandUpdate создает обновление с командой (например, "start" для /start)
+func CommandUpdate(user User, command string) tgbotapi.Update {
+	message := user.message()
+	message.Text = "/" + strings.TrimPrefix(command, "/")
+	message.Entities = []tgbotapi.MessageEntity{{
+		Type:   "bot_command",
+		Offset: 0,
+		Length: len(strings.Fields(message.Text)[0]),
+	}}
+
+	return tgbotapi.Update{UpdateID: nextUpdateID(), Message: message}
+}
+
+// TextUpdate создает обновление с текстовым сообщением пользователя
+func TextUpdate(user User, text string) tgbotapi.Update {
+	message := user.message()
+	message.Text = text
+
+	return tgbotapi.Update{UpdateID: nextUpdateID(), Message: message}
+}
+
+// PhotoUpdate создает обновление с фотографией
+func PhotoUpdate(user User, fileID string) tgbotapi.Update {
+	message := user.message()
+	message.Photo = []tgbotapi.PhotoSize{
+		{FileID: fileID + "-small", FileUniqueID: fileID + "-small", Width: 90, Height: 90},
+		{FileID: fileID, FileUniqueID: fileID, Width: 1280, Height: 1280},
+	}
+
+	return tgbotapi.Update{UpdateID: nextUpdateID(), Message: message}
+}
+
+// DocumentUpdate создает обновление с документом
+func DocumentUpdate(user User, fileID, mimeType string) tgbotapi.Update {
+	message := user.message()
+	message.Document = &tgbotapi.Document{
+		FileID:       fileID,
+		FileUniqueID: fileID,
+		MimeType:     mimeType,
+	}
+
+	return tgbotapi.Update{UpdateID: nextUpdateID(), Message: message}
+}
+
+// CallbackUpdate создает обновление с нажатием inline-кнопки под сообщением message
+func CallbackUpdate(user User, message *tgbotapi.Message, data string) tgbotapi.Update {
+	return tgbotapi.Update{
+		UpdateID: nextUpdateID(),
+		CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:           strconv.FormatInt(atomic.AddInt64(&lastQueryID, 1), 10),
+			From:         user.apiUser(),
+			Message:      message,
+			ChatInstance: strconv.FormatInt(user.ChatID, 10),
+			Data:         data,
+		},
+	}
+}
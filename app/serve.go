@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"main/logger"
+	"net"
+	"net/http"
+	"time"
+)
+
+// startHTTP запускает служебный HTTP-сервер (метрики и проверки состояния) на addr.
+// Останавливается через Shutdown в последовательности остановки main.
+func startHTTP(addr string, handler http.Handler) *http.Server {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		logger.GetLogger().Info("Serving /metrics, /healthz and /readyz on %s", addr)
+
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.GetLogger().Error("HTTP server on %s failed: %v", addr, err)
+		}
+	}()
+
+	return server
+}
+
+// runHealthcheck запрашивает /healthz работающего бота; используется HEALTHCHECK в Dockerfile
+// (bot --healthcheck), где нет curl
+func runHealthcheck(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+net.JoinHostPort(host, port)+"/healthz", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("healthz returned %s", resp.Status)
+	}
+
+	return nil
+}
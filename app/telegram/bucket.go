@@ -0,0 +1,71 @@
+package telegram
+
+import (
+	"time"
+)
+
+// bucket - token bucket: rate токенов в секунду, не больше burst про запас.
+// Токены можно брать в долг (reserve): следующий вызов подождет, пока долг не погасится,
+// поэтому ожидающие отправки выстраиваются в очередь в порядке вызова.
+// Не потокобезопасен, защищается мьютексом Sender.
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	// pausedUntil - до какого момента Telegram запретил отправку (429 retry_after)
+	pausedUntil time.Time
+}
+
+func newBucket(rate float64, burst int, now time.Time) *bucket {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &bucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
+
+// reserve забирает токен и возвращает, сколько нужно подождать перед отправкой
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens--
+
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+
+	if pause := b.pausedUntil.Sub(now); pause > wait {
+		wait = pause
+	}
+
+	return wait
+}
+
+// cancel возвращает токен, взятый reserve, если отправка не состоялась
+func (b *bucket) cancel() {
+	b.tokens++
+}
+
+// pause запрещает отправку до until
+func (b *bucket) pause(until time.Time) {
+	if until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+}
+
+// idle сообщает, что бакет полон и не на паузе, то есть его можно забыть без потери состояния
+func (b *bucket) idle(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst && !now.Before(b.pausedUntil)
+}
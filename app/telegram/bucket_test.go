@@ -0,0 +1,108 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucket(t *testing.T) {
+	type op struct {
+		at     time.Duration // момент операции от создания бакета
+		action string        // reserve, cancel или pause
+		arg    time.Duration // для pause - до какого момента
+		want   time.Duration // для reserve - ожидаемое ожидание
+	}
+
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		ops   []op
+		idle  time.Duration // момент, когда бакет снова полон и не на паузе (idle)
+	}{
+		{
+			name: "burst then rate", rate: 1, burst: 2,
+			ops: []op{
+				{0, "reserve", 0, 0},
+				{0, "reserve", 0, 0},
+				{0, "reserve", 0, time.Second},
+				{0, "reserve", 0, 2 * time.Second},
+			},
+			idle: 4 * time.Second,
+		},
+		{
+			name: "refill is capped by burst", rate: 1, burst: 2,
+			ops: []op{
+				{0, "reserve", 0, 0},
+				{time.Minute, "reserve", 0, 0},
+				{time.Minute, "reserve", 0, 0},
+				{time.Minute, "reserve", 0, time.Second},
+			},
+			idle: time.Minute + 3*time.Second,
+		},
+		{
+			name: "slow rate", rate: 1.0 / 60, burst: 1,
+			ops: []op{
+				{0, "reserve", 0, 0},
+				{30 * time.Second, "reserve", 0, 30 * time.Second},
+			},
+			idle: 2 * time.Minute,
+		},
+		{
+			name: "cancel returns token", rate: 1, burst: 1,
+			ops: []op{
+				{0, "reserve", 0, 0},
+				{0, "reserve", 0, time.Second},
+				{0, "cancel", 0, 0},
+				{0, "reserve", 0, time.Second},
+			},
+			idle: 2 * time.Second,
+		},
+		{
+			name: "pause delays even with tokens", rate: 1, burst: 5,
+			ops: []op{
+				{0, "pause", 3 * time.Second, 0},
+				{time.Second, "reserve", 0, 2 * time.Second},
+				{time.Second, "pause", 2 * time.Second, 0}, // более ранняя пауза не сокращает текущую
+				{2 * time.Second, "reserve", 0, time.Second},
+				{3 * time.Second, "reserve", 0, 0},
+			},
+			idle: 4 * time.Second,
+		},
+		{
+			name: "zero burst allows one", rate: 1, burst: 0,
+			ops: []op{
+				{0, "reserve", 0, 0},
+				{0, "reserve", 0, time.Second},
+			},
+			idle: 2 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		start := time.Now()
+		b := newBucket(tt.rate, tt.burst, start)
+
+		for i, o := range tt.ops {
+			now := start.Add(o.at)
+			switch o.action {
+			case "reserve":
+				if got := b.reserve(now); got != o.want {
+					t.Errorf("%s: op %d: reserve at %v = %v, want %v", tt.name, i, o.at, got, o.want)
+				}
+			case "cancel":
+				b.cancel()
+			case "pause":
+				b.pause(start.Add(o.arg))
+			}
+		}
+
+		if b.idle(start.Add(tt.idle - 100*time.Millisecond)) {
+			t.Errorf("%s: idle before %v", tt.name, tt.idle)
+		}
+		// Небольшой запас на погрешность дробных токенов
+		if !b.idle(start.Add(tt.idle + 10*time.Millisecond)) {
+			t.Errorf("%s: not idle at %v", tt.name, tt.idle)
+		}
+	}
+}
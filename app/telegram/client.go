@@ -0,0 +1,15 @@
+package telegram
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// BotClient описывает минимальный набор методов Telegram API, которыми пользуются
+// handlers, controllers и actions.
+// Ему удовлетворяет *tgbotapi.BotAPI, а в тестах - FakeBot.
+type BotClient interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+}
+
+var _ BotClient = (*tgbotapi.BotAPI)(nil)
@@ -0,0 +1,213 @@
+package telegram
+
+import (
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// RecordKind - тип вызова, записанного FakeBot
+type RecordKind string
+
+const (
+	KindSent           RecordKind = "sent"
+	KindEdited         RecordKind = "edited"
+	KindDeleted        RecordKind = "deleted"
+	KindCallbackAnswer RecordKind = "callbackAnswer"
+	KindOther          RecordKind = "other"
+)
+
+// Record - один вызов Telegram API, перехваченный FakeBot
+// Kind - тип вызова
+// ChatID, MessageID - адресат (для ответов на callback не заполняются)
+// Text - текст сообщения, подпись к медиа или текст ответа на callback
+// Markup - inline-клавиатура, если она была приложена
+// Config - исходная конфигурация запроса
+type Record struct {
+	Kind      RecordKind
+	ChatID    int64
+	MessageID int
+	Text      string
+	Markup    *tgbotapi.InlineKeyboardMarkup
+	Config    tgbotapi.Chattable
+}
+
+// CallbackData возвращает callback data всех кнопок клавиатуры записи
+func (r Record) CallbackData() []string {
+	if r.Markup == nil {
+		return nil
+	}
+
+	var res []string
+	for _, row := range r.Markup.InlineKeyboard {
+		for _, button := range row {
+			if button.CallbackData != nil {
+				res = append(res, *button.CallbackData)
+			}
+		}
+	}
+
+	return res
+}
+
+// FakeBot - BotClient, который ничего не отправляет в Telegram,
+// а записывает все вызовы в память. Безопасен для конкурентного использования.
+type FakeBot struct {
+	mu            sync.Mutex
+	records       []Record
+	nextMessageID int
+
+	// Err, если задан, возвращается из каждого вызова Send и Request (после записи вызова)
+	Err error
+}
+
+func NewFakeBot() *FakeBot {
+	return &FakeBot{nextMessageID: 1}
+}
+
+// Send записывает вызов и возвращает сообщение с новым MessageID
+func (f *FakeBot) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	record := f.record(c)
+
+	return tgbotapi.Message{
+		MessageID: record.MessageID,
+		Chat:      &tgbotapi.Chat{ID: record.ChatID},
+		Text:      record.Text,
+	}, f.Err
+}
+
+// Request записывает вызов и возвращает успешный ответ API
+func (f *FakeBot) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	f.record(c)
+
+	return &tgbotapi.APIResponse{Ok: true, Result: []byte("true")}, f.Err
+}
+
+func (f *FakeBot) record(c tgbotapi.Chattable) Record {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	record := Record{Kind: KindOther, Config: c}
+
+	switch cfg := c.(type) {
+	case tgbotapi.MessageConfig:
+		record.Kind = KindSent
+		record.ChatID = cfg.ChatID
+		record.Text = cfg.Text
+		record.Markup = inlineMarkup(cfg.ReplyMarkup)
+	case tgbotapi.PhotoConfig:
+		record.Kind = KindSent
+		record.ChatID = cfg.ChatID
+		record.Text = cfg.Caption
+		record.Markup = inlineMarkup(cfg.ReplyMarkup)
+	case tgbotapi.DocumentConfig:
+		record.Kind = KindSent
+		record.ChatID = cfg.ChatID
+		record.Text = cfg.Caption
+		record.Markup = inlineMarkup(cfg.ReplyMarkup)
+	case tgbotapi.EditMessageTextConfig:
+		record.Kind = KindEdited
+		record.ChatID = cfg.ChatID
+		record.MessageID = cfg.MessageID
+		record.Text = cfg.Text
+		record.Markup = cfg.ReplyMarkup
+	case tgbotapi.EditMessageCaptionConfig:
+		record.Kind = KindEdited
+		record.ChatID = cfg.ChatID
+		record.MessageID = cfg.MessageID
+		record.Text = cfg.Caption
+		record.Markup = cfg.ReplyMarkup
+	case tgbotapi.EditMessageMediaConfig:
+		record.Kind = KindEdited
+		record.ChatID = cfg.ChatID
+		record.MessageID = cfg.MessageID
+		record.Markup = cfg.ReplyMarkup
+	case tgbotapi.DeleteMessageConfig:
+		record.Kind = KindDeleted
+		record.ChatID = cfg.ChatID
+		record.MessageID = cfg.MessageID
+	case tgbotapi.CallbackConfig:
+		record.Kind = KindCallbackAnswer
+		record.Text = cfg.Text
+	}
+
+	if record.Kind == KindSent {
+		record.MessageID = f.nextMessageID
+		f.nextMessageID++
+	}
+
+	f.records = append(f.records, record)
+
+	return record
+}
+
+func inlineMarkup(markup interface{}) *tgbotapi.InlineKeyboardMarkup {
+	switch m := markup.(type) {
+	case tgbotapi.InlineKeyboardMarkup:
+		return &m
+	case *tgbotapi.InlineKeyboardMarkup:
+		return m
+	default:
+		return nil
+	}
+}
+
+// Records возвращает копию всех записанных вызовов в порядке их поступления
+func (f *FakeBot) Records() []Record {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]Record(nil), f.records...)
+}
+
+// RecordsOf возвращает записанные вызовы указанного типа
+func (f *FakeBot) RecordsOf(kind RecordKind) []Record {
+	var res []Record
+	for _, r := range f.Records() {
+		if r.Kind == kind {
+			res = append(res, r)
+		}
+	}
+
+	return res
+}
+
+// Sent возвращает отправленные сообщения (текст, фото, документы)
+func (f *FakeBot) Sent() []Record {
+	return f.RecordsOf(KindSent)
+}
+
+// Edited возвращает отредактированные сообщения
+func (f *FakeBot) Edited() []Record {
+	return f.RecordsOf(KindEdited)
+}
+
+// Deleted возвращает удалённые сообщения
+func (f *FakeBot) Deleted() []Record {
+	return f.RecordsOf(KindDeleted)
+}
+
+// CallbackAnswers возвращает ответы на callback query
+func (f *FakeBot) CallbackAnswers() []Record {
+	return f.RecordsOf(KindCallbackAnswer)
+}
+
+// Last возвращает последний записанный вызов
+func (f *FakeBot) Last() (Record, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.records) == 0 {
+		return Record{}, false
+	}
+
+	return f.records[len(f.records)-1], true
+}
+
+// Reset очищает список записанных вызовов
+func (f *FakeBot) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.records = nil
+}
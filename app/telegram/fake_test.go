@@ -0,0 +1,132 @@
+package telegram
+
+import (
+	"errors"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestFakeBotRecordKinds(t *testing.T) {
+	data := "buy"
+	markup := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{{{Text: "Купить", CallbackData: &data}}}}
+
+	message := tgbotapi.NewMessage(10, "text")
+	message.ReplyMarkup = markup
+	photo := tgbotapi.NewPhoto(20, tgbotapi.FileID("photo"))
+	photo.Caption = "photo caption"
+	document := tgbotapi.NewDocument(30, tgbotapi.FileID("doc"))
+	document.Caption = "doc caption"
+	editText := tgbotapi.NewEditMessageTextAndMarkup(10, 5, "edited", markup)
+	editCaption := tgbotapi.NewEditMessageCaption(20, 6, "edited caption")
+
+	tests := []struct {
+		name      string
+		config    tgbotapi.Chattable
+		kind      RecordKind
+		chatID    int64
+		messageID int
+		text      string
+		buttons   int
+	}{
+		{"message", message, KindSent, 10, 1, "text", 1},
+		{"photo", photo, KindSent, 20, 2, "photo caption", 0},
+		{"document", document, KindSent, 30, 3, "doc caption", 0},
+		{"edit text", editText, KindEdited, 10, 5, "edited", 1},
+		{"edit caption", editCaption, KindEdited, 20, 6, "edited caption", 0},
+		{"delete", tgbotapi.NewDeleteMessage(10, 7), KindDeleted, 10, 7, "", 0},
+		{"callback answer", tgbotapi.NewCallback("query", "answer"), KindCallbackAnswer, 0, 0, "answer", 0},
+		{"other", tgbotapi.NewChatAction(10, tgbotapi.ChatTyping), KindOther, 0, 0, "", 0},
+	}
+
+	bot := NewFakeBot()
+	for _, tt := range tests {
+		if _, err := bot.Request(tt.config); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+	}
+
+	records := bot.Records()
+	if len(records) != len(tests) {
+		t.Fatalf("expected %d records, got %d", len(tests), len(records))
+	}
+
+	for i, tt := range tests {
+		r := records[i]
+		if r.Kind != tt.kind || r.ChatID != tt.chatID || r.MessageID != tt.messageID || r.Text != tt.text || len(r.CallbackData()) != tt.buttons {
+			t.Errorf("%s: got %s chat=%d message=%d text=%q buttons=%q, want %s chat=%d message=%d text=%q with %d buttons",
+				tt.name, r.Kind, r.ChatID, r.MessageID, r.Text, r.CallbackData(), tt.kind, tt.chatID, tt.messageID, tt.text, tt.buttons)
+		}
+	}
+
+	for _, c := range []struct {
+		name string
+		got  []Record
+		want int
+	}{
+		{"Sent", bot.Sent(), 3},
+		{"Edited", bot.Edited(), 2},
+		{"Deleted", bot.Deleted(), 1},
+		{"CallbackAnswers", bot.CallbackAnswers(), 1},
+	} {
+		if len(c.got) != c.want {
+			t.Errorf("%s: expected %d records, got %d", c.name, c.want, len(c.got))
+		}
+	}
+
+	if last, ok := bot.Last(); !ok || last.Kind != KindOther {
+		t.Errorf("Last: got %+v, %v", last, ok)
+	}
+
+	bot.Reset()
+	if _, ok := bot.Last(); ok || len(bot.Records()) != 0 {
+		t.Errorf("expected no records after Reset, got %d", len(bot.Records()))
+	}
+}
+
+func TestFakeBotSendAssignsMessageIDs(t *testing.T) {
+	bot := NewFakeBot()
+
+	first, err := bot.Send(tgbotapi.NewMessage(10, "first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Правки и удаления не расходуют номера сообщений
+	bot.Send(tgbotapi.NewEditMessageText(10, first.MessageID, "edited"))
+	bot.Send(tgbotapi.NewDeleteMessage(10, first.MessageID))
+	second, err := bot.Send(tgbotapi.NewMessage(20, "second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.MessageID != 1 || second.MessageID != 2 {
+		t.Errorf("expected message ids 1 and 2, got %d and %d", first.MessageID, second.MessageID)
+	}
+	if second.Chat == nil || second.Chat.ID != 20 || second.Text != "second" {
+		t.Errorf("unexpected returned message: %+v", second)
+	}
+
+	// Номера не сбрасываются вместе с записями
+	bot.Reset()
+	third, _ := bot.Send(tgbotapi.NewMessage(10, "third"))
+	if third.MessageID != 3 {
+		t.Errorf("expected message id 3 after Reset, got %d", third.MessageID)
+	}
+}
+
+func TestFakeBotErr(t *testing.T) {
+	bot := NewFakeBot()
+	bot.Err = errors.New("telegram is down")
+
+	if _, err := bot.Send(tgbotapi.NewMessage(10, "text")); !errors.Is(err, bot.Err) {
+		t.Errorf("Send: expected %v, got %v", bot.Err, err)
+	}
+	if _, err := bot.Request(tgbotapi.NewCallback("query", "")); !errors.Is(err, bot.Err) {
+		t.Errorf("Request: expected %v, got %v", bot.Err, err)
+	}
+
+	// Вызовы записываются даже при ошибке
+	if len(bot.Records()) != 2 {
+		t.Errorf("expected 2 records, got %d", len(bot.Records()))
+	}
+}
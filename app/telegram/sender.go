@@ -0,0 +1,355 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"main/logger"
+	"main/metrics"
+	"math/rand"
+	"net"
+	"net/url"
+	"reflect"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ErrRateLimited - отправка отложилась бы дольше SenderOptions.MaxWait
+var ErrRateLimited = errors.New("outbound rate limit exceeded")
+
+const (
+	// retryBaseDelay, retryMaxDelay - границы экспоненциальной задержки между повторами при 5xx и сетевых ошибках
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+	// pruneInterval - как часто забывать лимиты чатов, в которые давно ничего не отправлялось
+	pruneInterval = time.Minute
+)
+
+// SenderOptions - ограничения исходящих запросов к Telegram
+// GlobalPerSecond - сообщений в секунду на всего бота
+// ChatPerMinute - сообщений в минуту в один личный чат
+// GroupPerMinute - сообщений в минуту в одну группу или канал
+// ChatBurst - сколько сообщений подряд можно отправить в чат без ожидания
+// MaxRetries - сколько раз повторять запрос после 429, 5xx или сетевой ошибки
+// MaxWait - дольше этого один вызов не ждет (лимиты и задержки всех повторов вместе):
+// вернется ErrRateLimited или исходная ошибка
+type SenderOptions struct {
+	GlobalPerSecond int
+	ChatPerMinute   int
+	GroupPerMinute  int
+	ChatBurst       int
+	MaxRetries      int
+	MaxWait         time.Duration
+}
+
+// Sender - BotClient, через который проходят все исходящие запросы бота.
+// Запросы в чат (сообщения, правки, удаления) ограничиваются token bucket'ами на чат и на бота:
+// если лимит исчерпан, вызов ждет своей очереди. Ответы на callback'и лимитами не ограничиваются.
+// На 429 Sender ждет retry_after (и приостанавливает отправку в этот чат). На 5xx и сетевые ошибки
+// с экспоненциальной задержкой повторяются только идемпотентные запросы: Request и правки/удаления
+// через Send. Новое сообщение после таймаута могло уже дойти до Telegram, и повтор создал бы дубль.
+//
+// Отдельной очереди отправки нет: вызов ждет в горутине вызывающего, то есть занимает воркер
+// диспетчера. Поэтому один чат, упершийся в лимит, держит воркер не дольше MaxWait, а ожидание
+// прерывается, когда отменен контекст Sender (остановка бота).
+type Sender struct {
+	ctx     context.Context
+	client  BotClient
+	opts    SenderOptions
+	metrics *metrics.Metrics
+
+	// now и sleep - часы Sender, в тестах подменяются
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+
+	mu        sync.Mutex
+	global    *bucket
+	chats     map[int64]*bucket
+	lastPrune time.Time
+}
+
+var _ BotClient = (*Sender)(nil)
+
+// NewSender оборачивает client ограничениями opts. Ожидание лимитов и повторов прерывается
+// отменой ctx. m может быть nil.
+func NewSender(ctx context.Context, client BotClient, opts SenderOptions, m *metrics.Metrics) *Sender {
+	return newSender(ctx, client, opts, m, time.Now, sleepContext)
+}
+
+func newSender(ctx context.Context, client BotClient, opts SenderOptions, m *metrics.Metrics, now func() time.Time, sleep func(context.Context, time.Duration) error) *Sender {
+	start := now()
+
+	return &Sender{
+		ctx:       ctx,
+		client:    client,
+		opts:      opts,
+		metrics:   m,
+		now:       now,
+		sleep:     sleep,
+		global:    newBucket(float64(opts.GlobalPerSecond), opts.GlobalPerSecond, start),
+		chats:     make(map[int64]*bucket),
+		lastPrune: start,
+	}
+}
+
+func (s *Sender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	var msg tgbotapi.Message
+
+	err := s.do(c, isEdit(c), func() error {
+		var err error
+		msg, err = s.client.Send(c)
+		return err
+	})
+
+	return msg, err
+}
+
+func (s *Sender) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	var resp *tgbotapi.APIResponse
+
+	err := s.do(c, true, func() error {
+		var err error
+		resp, err = s.client.Request(c)
+		return err
+	})
+
+	return resp, err
+}
+
+// do выполняет call с учетом лимитов чата c и повторяет его при временных ошибках.
+// idempotent - повтор call после 5xx или сетевой ошибки не создаст дубль
+func (s *Sender) do(c tgbotapi.Chattable, idempotent bool, call func() error) error {
+	chatID, limited := chatOf(c)
+
+	var waited time.Duration
+	for attempt := 0; ; attempt++ {
+		if limited {
+			wait, err := s.reserve(chatID, waited)
+			if err != nil {
+				s.record(false, waited)
+				return err
+			}
+			if err := s.wait(wait); err != nil {
+				s.record(false, waited)
+				return err
+			}
+			waited += wait
+		}
+
+		err := call()
+		if err == nil {
+			s.record(true, waited)
+			return nil
+		}
+
+		// После 429 чат приостанавливается, даже если этот запрос больше не повторяется:
+		// retry_after действует и для следующих сообщений в чат
+		retryAfter, rateLimited := retryAfterOf(err)
+		if rateLimited && limited {
+			s.pause(chatID, s.now().Add(retryAfter))
+		}
+
+		delay, reason, ok := s.retryDelay(err, attempt, idempotent)
+		if ok && s.opts.MaxWait > 0 && waited+delay > s.opts.MaxWait {
+			ok = false
+		}
+		if !ok {
+			s.record(false, waited)
+			return err
+		}
+
+		if rateLimited && limited {
+			delay = 0 // reserve подождет паузу чата
+		}
+
+		if s.metrics != nil {
+			s.metrics.RecordOutboundRetry(reason)
+		}
+		logger.GetLogger().Warningw("Retrying Telegram request", "chat_id", chatID, "attempt", attempt+1, "reason", reason, "error", err)
+
+		if err := s.wait(delay); err != nil {
+			s.record(false, waited)
+			return err
+		}
+		waited += delay
+	}
+}
+
+// wait ждет d, пока не отменен контекст Sender
+func (s *Sender) wait(d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	if err := s.sleep(s.ctx, d); err != nil {
+		return fmt.Errorf("telegram request cancelled while waiting: %w", err)
+	}
+
+	return nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve занимает место в лимитах чата и бота и возвращает, сколько ждать до отправки.
+// waited - сколько вызов уже прождал на предыдущих попытках
+func (s *Sender) reserve(chatID int64, waited time.Duration) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.pruneLocked(now)
+
+	chat := s.chatLocked(chatID, now)
+	wait := chat.reserve(now)
+	if global := s.global.reserve(now); global > wait {
+		wait = global
+	}
+
+	if s.opts.MaxWait > 0 && waited+wait > s.opts.MaxWait {
+		chat.cancel()
+		s.global.cancel()
+		return 0, fmt.Errorf("%w: chat %d would wait %v", ErrRateLimited, chatID, wait.Round(time.Millisecond))
+	}
+
+	return wait, nil
+}
+
+// pause приостанавливает отправку в чат до until (после 429)
+func (s *Sender) pause(chatID int64, until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.chatLocked(chatID, s.now()).pause(until)
+}
+
+func (s *Sender) chatLocked(chatID int64, now time.Time) *bucket {
+	b, ok := s.chats[chatID]
+	if !ok {
+		perMinute := s.opts.ChatPerMinute
+		if chatID < 0 {
+			perMinute = s.opts.GroupPerMinute
+		}
+
+		b = newBucket(float64(perMinute)/60, s.opts.ChatBurst, now)
+		s.chats[chatID] = b
+	}
+
+	return b
+}
+
+// pruneLocked забывает лимиты чатов, которые успели полностью восстановиться
+func (s *Sender) pruneLocked(now time.Time) {
+	if now.Sub(s.lastPrune) < pruneInterval {
+		return
+	}
+	s.lastPrune = now
+
+	for id, b := range s.chats {
+		if b.idle(now) {
+			delete(s.chats, id)
+		}
+	}
+}
+
+// retryDelay решает, повторять ли запрос после ошибки err на попытке attempt (с нуля).
+// После 429 Telegram запрос не выполнил, поэтому он повторяется всегда, а после 5xx и сетевых
+// ошибок - только idempotent. Возвращает задержку до повтора и причину для метрик.
+func (s *Sender) retryDelay(err error, attempt int, idempotent bool) (time.Duration, string, bool) {
+	if attempt >= s.opts.MaxRetries {
+		return 0, "", false
+	}
+
+	if retryAfter, ok := retryAfterOf(err); ok {
+		return retryAfter, "rate_limited", true
+	}
+
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.Code >= 500 && idempotent:
+			return backoff(attempt), "server_error", true
+		default:
+			return 0, "", false
+		}
+	}
+
+	var netErr net.Error
+	var urlErr *url.Error
+	if idempotent && (errors.As(err, &netErr) || errors.As(err, &urlErr)) {
+		return backoff(attempt), "network", true
+	}
+
+	return 0, "", false
+}
+
+// retryAfterOf возвращает retry_after, если err - ответ 429
+func retryAfterOf(err error) (time.Duration, bool) {
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == 429 {
+		return time.Duration(apiErr.RetryAfter) * time.Second, true
+	}
+
+	return 0, false
+}
+
+// backoff - экспоненциальная задержка с разбросом, чтобы повторы разных запросов не совпадали
+func backoff(attempt int) time.Duration {
+	delay := retryBaseDelay << attempt
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func (s *Sender) record(success bool, waited time.Duration) {
+	if s.metrics != nil {
+		s.metrics.RecordOutbound(success, waited)
+	}
+}
+
+// isEdit сообщает, что c меняет или удаляет уже отправленное сообщение: такой запрос можно повторить
+func isEdit(c tgbotapi.Chattable) bool {
+	switch c.(type) {
+	case tgbotapi.EditMessageTextConfig, tgbotapi.EditMessageCaptionConfig, tgbotapi.EditMessageReplyMarkupConfig,
+		tgbotapi.EditMessageMediaConfig, tgbotapi.DeleteMessageConfig:
+		return true
+	default:
+		return false
+	}
+}
+
+// chatOf возвращает чат, в который отправляется запрос c (поле ChatID в BaseChat, BaseEdit и т.п.).
+// Запросы без чата (ответы на callback'и, правки inline-сообщений) лимитами чата не ограничиваются.
+func chatOf(c tgbotapi.Chattable) (int64, bool) {
+	v := reflect.ValueOf(c)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return 0, false
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return 0, false
+	}
+
+	f := v.FieldByName("ChatID")
+	if !f.IsValid() || f.Kind() != reflect.Int64 || f.Int() == 0 {
+		return 0, false
+	}
+
+	return f.Int(), true
+}
@@ -0,0 +1,320 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeClock - часы Sender в тестах: sleep не ждет, а сдвигает время и запоминает ожидание
+type fakeClock struct {
+	mu    sync.Mutex
+	t     time.Time
+	slept []time.Duration
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.t
+}
+
+func (c *fakeClock) sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.t = c.t.Add(d)
+	c.slept = append(c.slept, d)
+
+	return nil
+}
+
+// scriptedBot - FakeBot, который возвращает ошибки errs по одной на вызов, а затем отвечает успешно
+type scriptedBot struct {
+	*FakeBot
+	errs []error
+}
+
+func (b *scriptedBot) next() error {
+	if len(b.errs) == 0 {
+		return nil
+	}
+
+	err := b.errs[0]
+	b.errs = b.errs[1:]
+
+	return err
+}
+
+func (b *scriptedBot) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	msg, _ := b.FakeBot.Send(c)
+	return msg, b.next()
+}
+
+func (b *scriptedBot) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	resp, _ := b.FakeBot.Request(c)
+	return resp, b.next()
+}
+
+func newTestSender(ctx context.Context, opts SenderOptions, errs ...error) (*Sender, *scriptedBot, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	bot := &scriptedBot{FakeBot: NewFakeBot(), errs: errs}
+
+	return newSender(ctx, bot, opts, nil, clock.now, clock.sleep), bot, clock
+}
+
+func tooManyRequests(retryAfter int) error {
+	return &tgbotapi.Error{Code: 429, Message: "Too Many Requests", ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: retryAfter}}
+}
+
+func TestSender(t *testing.T) {
+	defaults := SenderOptions{
+		GlobalPerSecond: 30,
+		ChatPerMinute:   60,
+		GroupPerMinute:  20,
+		ChatBurst:       3,
+		MaxRetries:      3,
+		MaxWait:         20 * time.Second,
+	}
+	with := func(change func(o *SenderOptions)) SenderOptions {
+		o := defaults
+		change(&o)
+		return o
+	}
+
+	badGateway := &tgbotapi.Error{Code: 502, Message: "Bad Gateway"}
+	badRequest := &tgbotapi.Error{Code: 400, Message: "Bad Request: message is not modified"}
+	timeout := &url.Error{Op: "Post", URL: "https://api.telegram.org/bot/sendMessage", Err: context.DeadlineExceeded}
+	rateLimited := tooManyRequests(3)
+	longRateLimited := tooManyRequests(30)
+
+	message := func(chatID int64) tgbotapi.Chattable { return tgbotapi.NewMessage(chatID, "text") }
+	edit := tgbotapi.NewEditMessageText(10, 1, "edited")
+	answer := tgbotapi.NewCallback("query", "")
+
+	tests := []struct {
+		name    string
+		opts    SenderOptions
+		replies []error              // ответы клиента по очереди, дальше - успех
+		send    []tgbotapi.Chattable // отправляются через Send по очереди
+		request bool                 // отправлять через Request, а не Send
+		calls   int                  // сколько вызовов дошло до клиента
+		slept   []time.Duration      // ожидания по порядку; nil - без ожиданий
+		backoff bool                 // ожидания случайны (5xx, сеть): проверяется только их число
+		errs    []error              // ожидаемые ошибки отправок по порядку; nil - все успешны
+	}{
+		{
+			name:  "burst fits chat limit",
+			opts:  defaults,
+			send:  []tgbotapi.Chattable{message(10), message(10), message(10)},
+			calls: 3,
+		},
+		{
+			name:  "chat limit after burst",
+			opts:  defaults,
+			send:  []tgbotapi.Chattable{message(10), message(10), message(10), message(10), message(10)},
+			calls: 5,
+			slept: []time.Duration{time.Second, time.Second},
+		},
+		{
+			name:  "group limit",
+			opts:  with(func(o *SenderOptions) { o.ChatBurst = 1 }),
+			send:  []tgbotapi.Chattable{message(-100), message(-100)},
+			calls: 2,
+			slept: []time.Duration{3 * time.Second},
+		},
+		{
+			name:  "chats have separate limits",
+			opts:  with(func(o *SenderOptions) { o.ChatBurst = 1 }),
+			send:  []tgbotapi.Chattable{message(10), message(20), message(30), message(-100)},
+			calls: 4,
+		},
+		{
+			name:  "global limit across chats",
+			opts:  with(func(o *SenderOptions) { o.GlobalPerSecond = 2 }),
+			send:  []tgbotapi.Chattable{message(10), message(20), message(30), message(40)},
+			calls: 4,
+			slept: []time.Duration{500 * time.Millisecond, 500 * time.Millisecond},
+		},
+		{
+			name:    "callback answers are not limited",
+			opts:    with(func(o *SenderOptions) { o.ChatBurst = 1; o.GlobalPerSecond = 1 }),
+			send:    []tgbotapi.Chattable{answer, answer, answer},
+			request: true,
+			calls:   3,
+		},
+		{
+			name:  "chat limit longer than max wait",
+			opts:  with(func(o *SenderOptions) { o.ChatBurst = 1; o.ChatPerMinute = 1 }),
+			send:  []tgbotapi.Chattable{message(10), message(10)},
+			calls: 1,
+			errs:  []error{nil, ErrRateLimited},
+		},
+		{
+			name:    "429 pauses the chat for retry_after",
+			opts:    defaults,
+			replies: []error{rateLimited},
+			send:    []tgbotapi.Chattable{message(10)},
+			calls:   2,
+			slept:   []time.Duration{3 * time.Second},
+		},
+		{
+			name:    "429 pause applies to the next message",
+			opts:    with(func(o *SenderOptions) { o.MaxRetries = 0 }),
+			replies: []error{rateLimited},
+			send:    []tgbotapi.Chattable{message(10), message(10), message(20)},
+			calls:   3,
+			slept:   []time.Duration{3 * time.Second},
+			errs:    []error{rateLimited, nil, nil},
+		},
+		{
+			name:    "429 on callback answer waits retry_after",
+			opts:    defaults,
+			replies: []error{rateLimited},
+			send:    []tgbotapi.Chattable{answer},
+			request: true,
+			calls:   2,
+			slept:   []time.Duration{3 * time.Second},
+		},
+		{
+			name:    "retry cap",
+			opts:    with(func(o *SenderOptions) { o.MaxRetries = 2 }),
+			replies: []error{tooManyRequests(1), tooManyRequests(1), rateLimited},
+			send:    []tgbotapi.Chattable{message(10)},
+			calls:   3,
+			slept:   []time.Duration{time.Second, time.Second},
+			errs:    []error{rateLimited},
+		},
+		{
+			name:    "retry_after longer than max wait",
+			opts:    defaults,
+			replies: []error{longRateLimited},
+			send:    []tgbotapi.Chattable{message(10)},
+			calls:   1,
+			errs:    []error{longRateLimited},
+		},
+		{
+			name:    "retries share max wait",
+			opts:    with(func(o *SenderOptions) { o.MaxWait = 5 * time.Second }),
+			replies: []error{rateLimited, rateLimited},
+			send:    []tgbotapi.Chattable{message(10)},
+			calls:   2,
+			slept:   []time.Duration{3 * time.Second},
+			errs:    []error{rateLimited},
+		},
+		{
+			name:    "5xx on new message is not retried",
+			opts:    defaults,
+			replies: []error{badGateway},
+			send:    []tgbotapi.Chattable{message(10)},
+			calls:   1,
+			errs:    []error{badGateway},
+		},
+		{
+			name:    "network error on new message is not retried",
+			opts:    defaults,
+			replies: []error{timeout},
+			send:    []tgbotapi.Chattable{message(10)},
+			calls:   1,
+			errs:    []error{timeout},
+		},
+		{
+			name:    "5xx on edit is retried",
+			opts:    defaults,
+			replies: []error{badGateway, badGateway},
+			send:    []tgbotapi.Chattable{edit},
+			calls:   3,
+			backoff: true,
+			slept:   make([]time.Duration, 2),
+		},
+		{
+			name:    "network error on request is retried",
+			opts:    defaults,
+			replies: []error{timeout},
+			send:    []tgbotapi.Chattable{answer},
+			request: true,
+			calls:   2,
+			backoff: true,
+			slept:   make([]time.Duration, 1),
+		},
+		{
+			name:    "4xx is not retried",
+			opts:    defaults,
+			replies: []error{badRequest},
+			send:    []tgbotapi.Chattable{edit},
+			calls:   1,
+			errs:    []error{badRequest},
+		},
+	}
+
+	for _, tt := range tests {
+		s, bot, clock := newTestSender(context.Background(), tt.opts, tt.replies...)
+
+		var errs []error
+		for _, c := range tt.send {
+			var err error
+			if tt.request {
+				_, err = s.Request(c)
+			} else {
+				_, err = s.Send(c)
+			}
+			errs = append(errs, err)
+		}
+
+		for i, err := range errs {
+			var want error
+			if i < len(tt.errs) {
+				want = tt.errs[i]
+			}
+
+			if (want == nil && err != nil) || (want != nil && !errors.Is(err, want)) {
+				t.Errorf("%s: send %d: expected error %v, got %v", tt.name, i, want, err)
+			}
+		}
+
+		if calls := len(bot.Records()); calls != tt.calls {
+			t.Errorf("%s: expected %d calls to Telegram, got %d", tt.name, tt.calls, calls)
+		}
+
+		if tt.backoff {
+			if len(clock.slept) != len(tt.slept) {
+				t.Errorf("%s: expected %d backoff waits, got %v", tt.name, len(tt.slept), clock.slept)
+			}
+			for _, d := range clock.slept {
+				if d < retryBaseDelay/2 || d > retryMaxDelay {
+					t.Errorf("%s: backoff %v out of [%v, %v]", tt.name, d, retryBaseDelay/2, retryMaxDelay)
+				}
+			}
+		} else if !reflect.DeepEqual(clock.slept, tt.slept) {
+			t.Errorf("%s: expected waits %v, got %v", tt.name, tt.slept, clock.slept)
+		}
+	}
+}
+
+func TestSenderStopsWaitingOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s, bot, _ := newTestSender(ctx, SenderOptions{GlobalPerSecond: 30, ChatPerMinute: 60, ChatBurst: 1, MaxRetries: 3, MaxWait: time.Minute})
+
+	if _, err := s.Send(tgbotapi.NewMessage(10, "first")); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	if _, err := s.Send(tgbotapi.NewMessage(10, "second")); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the throttled send to stop on cancel, got %v", err)
+	}
+	if len(bot.Records()) != 1 {
+		t.Errorf("expected only the first message to be sent, got %d calls", len(bot.Records()))
+	}
+}
@@ -0,0 +1,99 @@
+// Package updates доставляет обновления Telegram в пул воркеров:
+// long polling (getUpdates) или webhook (HTTP-сервер, на который Telegram сам присылает обновления).
+package updates
+
+import (
+	"context"
+	"fmt"
+	"main/config"
+	"main/logger"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// pollRetryDelay - пауза перед повтором getUpdates после ошибки
+const pollRetryDelay = 3 * time.Second
+
+// Listen начинает получать обновления способом из cfg.Mode и возвращает канал с ними.
+// В webhook-режиме HTTP-сервер останавливается при отмене ctx.
+// polled, если задан, вызывается после каждого ответа getUpdates (только в режиме polling):
+// по нему проверка живости видит, что получение обновлений не зависло, даже когда обновлений нет.
+func Listen(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Updates, polled func()) (tgbotapi.UpdatesChannel, error) {
+	switch cfg.Mode {
+	case config.ModePolling:
+		return poll(ctx, bot, cfg, polled)
+	case config.ModeWebhook:
+		return listenWebhook(ctx, bot, cfg.Webhook)
+	default:
+		return nil, fmt.Errorf("unknown updates mode %q", cfg.Mode)
+	}
+}
+
+// poll получает обновления через long polling до отмены ctx. Зарегистрированный webhook удаляется,
+// иначе Telegram отклоняет getUpdates.
+func poll(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Updates, polled func()) (tgbotapi.UpdatesChannel, error) {
+	if _, err := bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return nil, fmt.Errorf("delete webhook: %w", err)
+	}
+
+	updateConfig := tgbotapi.NewUpdate(0)
+	updateConfig.Timeout = int(cfg.PollTimeout.Seconds())
+
+	updates := make(chan tgbotapi.Update, bot.Buffer)
+
+	go func() {
+		for ctx.Err() == nil {
+			batch, err := bot.GetUpdates(updateConfig)
+			if polled != nil {
+				polled()
+			}
+			if err != nil {
+				logger.GetLogger().Warningw("Failed to get updates", "error", err)
+
+				select {
+				case <-time.After(pollRetryDelay):
+				case <-ctx.Done():
+				}
+				continue
+			}
+
+			for _, update := range batch {
+				if update.UpdateID >= updateConfig.Offset {
+					updateConfig.Offset = update.UpdateID + 1
+				}
+
+				// Если воркеры не успевают разбирать обновления, цикл ждет здесь и перестает отмечаться
+				select {
+				case updates <- update:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	logger.GetLogger().Info("Receiving updates via long polling")
+
+	return updates, nil
+}
+
+func listenWebhook(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Webhook) (tgbotapi.UpdatesChannel, error) {
+	if cfg.Register {
+		if err := RegisterWebhook(bot, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	server := NewWebhookServer(cfg, bot.Buffer)
+
+	go func() {
+		if err := server.Run(ctx); err != nil {
+			logger.GetLogger().Fatal("Webhook server failed: %v", err)
+		}
+	}()
+
+	logger.GetLogger().Info("Receiving updates via webhook on %s%s", cfg.ListenAddr, cfg.Path)
+
+	return server.Updates(), nil
+}
@@ -0,0 +1,169 @@
+package updates
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"main/config"
+	"main/logger"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// SecretTokenHeader - заголовок, в котором Telegram присылает secret_token, заданный в setWebhook
+const SecretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// maxUpdateSize - ограничение на размер тела запроса с одним обновлением
+const maxUpdateSize = 1 << 20
+
+// defaultEnqueueTimeout - сколько запрос ждет места в очереди обновлений, прежде чем ответить 503
+const defaultEnqueueTimeout = 2 * time.Second
+
+// WebhookServer принимает обновления от Telegram по HTTP и передает их в канал Updates.
+// Запрос подтверждается только после того, как обновление попало в канал: если за enqueueTimeout
+// место в очереди не освободилось, Telegram получает 503 и повторит доставку позже.
+type WebhookServer struct {
+	cfg            config.Webhook
+	updates        chan tgbotapi.Update
+	enqueueTimeout time.Duration
+}
+
+// NewWebhookServer создает сервер; buffer - размер очереди обновлений
+func NewWebhookServer(cfg config.Webhook, buffer int) *WebhookServer {
+	return &WebhookServer{
+		cfg:            cfg,
+		updates:        make(chan tgbotapi.Update, buffer),
+		enqueueTimeout: defaultEnqueueTimeout,
+	}
+}
+
+// Updates возвращает канал принятых обновлений
+func (s *WebhookServer) Updates() tgbotapi.UpdatesChannel {
+	return s.updates
+}
+
+// Handler возвращает HTTP-обработчик пути cfg.Path.
+// Его можно вызвать и без Run, например чтобы вручную отправить записанное обновление:
+//
+//	curl -X POST -H "X-Telegram-Bot-Api-Secret-Token: $WEBHOOK_SECRET_TOKEN" -d @update.json http://localhost:8080/telegram/webhook
+func (s *WebhookServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(s.cfg.Path, s.handleUpdate)
+	return mux
+}
+
+func (s *WebhookServer) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := r.Header.Get(SecretTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.SecretToken)) != 1 {
+		logger.GetLogger().Warning("Rejected webhook request from %s: bad secret token", r.RemoteAddr)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var update tgbotapi.Update
+	body := http.MaxBytesReader(w, r.Body, maxUpdateSize)
+	if err := json.NewDecoder(body).Decode(&update); err != nil {
+		http.Error(w, "bad update: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	timer := time.NewTimer(s.enqueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case s.updates <- update:
+		w.WriteHeader(http.StatusOK)
+	case <-timer.C:
+		logger.GetLogger().Warningw("Webhook update queue is full", "update_id", update.UpdateID)
+		http.Error(w, "update queue is full", http.StatusServiceUnavailable)
+	case <-r.Context().Done():
+		// Telegram уже закрыл соединение и повторит доставку сам
+	}
+}
+
+// Run слушает cfg.ListenAddr (по TLS, если заданы CertFile и KeyFile) до отмены ctx
+func (s *WebhookServer) Run(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              s.cfg.ListenAddr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.GetLogger().Error("Webhook server shutdown: %v", err)
+		}
+	}()
+
+	var err error
+	if s.cfg.CertFile != "" {
+		err = server.ListenAndServeTLS(s.cfg.CertFile, s.cfg.KeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// RegisterWebhook сообщает Telegram адрес webhook'а и secret_token.
+// Используется MakeRequest, так как WebhookConfig библиотеки не поддерживает secret_token.
+func RegisterWebhook(bot *tgbotapi.BotAPI, cfg config.Webhook) error {
+	params := tgbotapi.Params{
+		"url":          strings.TrimSuffix(cfg.PublicURL, "/") + cfg.Path,
+		"secret_token": cfg.SecretToken,
+	}
+	if cfg.MaxConnections > 0 {
+		params["max_connections"] = strconv.Itoa(cfg.MaxConnections)
+	}
+
+	var (
+		resp *tgbotapi.APIResponse
+		err  error
+	)
+	if cfg.UploadCert {
+		resp, err = bot.UploadFiles("setWebhook", params, []tgbotapi.RequestFile{
+			{Name: "certificate", Data: tgbotapi.FilePath(cfg.CertFile)},
+		})
+	} else {
+		resp, err = bot.MakeRequest("setWebhook", params)
+	}
+	if err != nil {
+		return fmt.Errorf("set webhook: %w", err)
+	}
+	if !resp.Ok {
+		return fmt.Errorf("set webhook: %s", resp.Description)
+	}
+
+	info, err := bot.GetWebhookInfo()
+	if err != nil {
+		return fmt.Errorf("get webhook info: %w", err)
+	}
+	if info.LastErrorDate != 0 {
+		logger.GetLogger().Warning("Telegram reports last webhook error: %s", info.LastErrorMessage)
+	}
+
+	logger.GetLogger().Info("Webhook registered at %s", params["url"])
+
+	return nil
+}
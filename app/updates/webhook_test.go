@@ -0,0 +1,65 @@
+package updates
+
+import (
+	"main/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "secret"
+
+func postUpdate(s *WebhookServer, secret string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(`{"update_id": 1}`))
+	req.Header.Set(SecretTokenHeader, secret)
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestWebhookEnqueuesUpdate(t *testing.T) {
+	s := NewWebhookServer(config.Webhook{Path: "/webhook", SecretToken: testSecret}, 1)
+
+	if rec := postUpdate(s, testSecret); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	select {
+	case update := <-s.Updates():
+		if update.UpdateID != 1 {
+			t.Errorf("expected update 1, got %d", update.UpdateID)
+		}
+	default:
+		t.Fatal("update was not enqueued")
+	}
+}
+
+func TestWebhookRejectsBadSecret(t *testing.T) {
+	s := NewWebhookServer(config.Webhook{Path: "/webhook", SecretToken: testSecret}, 1)
+
+	if rec := postUpdate(s, "wrong"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+	if len(s.Updates()) != 0 {
+		t.Error("update with a bad secret was enqueued")
+	}
+}
+
+func TestWebhookFullQueueReturns503(t *testing.T) {
+	s := NewWebhookServer(config.Webhook{Path: "/webhook", SecretToken: testSecret}, 0)
+	s.enqueueTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	rec := postUpdate(s, testSecret)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 when nobody reads updates, got %d", rec.Code)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the request to give up after the enqueue timeout, took %s", elapsed)
+	}
+}